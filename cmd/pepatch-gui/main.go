@@ -267,8 +267,7 @@ func formatSignature(output *strings.Builder, info *pe.Info) {
 		return
 	}
 
-	if len(info.Signature.Certificates) > 0 {
-		cert := info.Signature.Certificates[0]
+	if cert := info.Signature.Signer; cert != nil {
 		if cert.IsValid {
 			output.WriteString(fmt.Sprintf("签名者: ✓ %s\n", cert.Subject))
 		} else {
@@ -278,6 +277,14 @@ func formatSignature(output *strings.Builder, info *pe.Info) {
 		output.WriteString(fmt.Sprintf("有效期: %s - %s\n",
 			cert.NotBefore.Format("2006-01-02"), cert.NotAfter.Format("2006-01-02")))
 	}
+	if info.Signature.Timestamper != nil {
+		output.WriteString(fmt.Sprintf("签名时间: %s\n", info.Signature.SigningTime.Format("2006-01-02 15:04:05")))
+	}
+	if info.Signature.Verified {
+		output.WriteString("签名校验: ✓ 签名和映像摘要一致\n")
+	} else {
+		output.WriteString(fmt.Sprintf("签名校验: ✗ %s\n", info.Signature.VerifyError))
+	}
 }
 
 func formatResources(output *strings.Builder, info *pe.Info) {
@@ -363,20 +370,50 @@ func formatImports(output *strings.Builder, info *pe.Info) {
 			}
 		}
 	}
+
+	if len(info.DelayImports) > 0 {
+		output.WriteString(fmt.Sprintf("\n========== 延迟加载导入 (%d 个DLL) ==========\n", len(info.DelayImports)))
+		for i, imp := range info.DelayImports {
+			output.WriteString(fmt.Sprintf("%d. %s (%d 个函数) [延迟加载]\n", i+1, imp.DLL, len(imp.Functions)))
+		}
+	}
+
+	if bound := info.BoundImports; bound != nil {
+		output.WriteString(fmt.Sprintf("\n========== 绑定导入 (%d 个DLL) ==========\n", len(bound.Entries)))
+		for i, e := range bound.Entries {
+			output.WriteString(fmt.Sprintf("%d. %s (时间戳 0x%08X)\n", i+1, e.DLL, e.TimeDateStamp))
+		}
+		for _, issue := range bound.Issues {
+			output.WriteString(fmt.Sprintf("  ✗ %s\n", issue))
+		}
+	}
 }
 
 func formatExports(output *strings.Builder, info *pe.Info) {
-	if len(info.Exports) == 0 {
+	if info.Exports == nil || len(info.Exports.Functions) == 0 {
 		return
 	}
 
-	output.WriteString(fmt.Sprintf("\n========== 导出表 (%d 个函数) ==========\n", len(info.Exports)))
-	for i, exp := range info.Exports {
+	functions := info.Exports.Functions
+	output.WriteString(fmt.Sprintf("\n========== 导出表 (%d 个函数) ==========\n", len(functions)))
+	output.WriteString(fmt.Sprintf("DLL名称: %s, 序号基数: %d\n", info.Exports.DLLName, info.Exports.Base))
+	for i, exp := range functions {
 		if i >= 20 {
-			output.WriteString(fmt.Sprintf("  ... (还有 %d 个函数)\n", len(info.Exports)-20))
+			output.WriteString(fmt.Sprintf("  ... (还有 %d 个函数)\n", len(functions)-20))
 			break
 		}
-		output.WriteString(fmt.Sprintf("%d. %s\n", i+1, exp))
+		name := exp.Name
+		if name == "" {
+			name = "[仅序号]"
+		}
+		line := fmt.Sprintf("@%d. %s (RVA 0x%08X)", exp.Ordinal, name, exp.RVA)
+		switch {
+		case exp.Forwarded():
+			line += " → " + exp.Forwarder
+		case !exp.Executable:
+			line += " ⚠ 不在可执行节区"
+		}
+		output.WriteString(line + "\n")
 	}
 }
 
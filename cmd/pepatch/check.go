@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ZacharyZcR/PEPatch/internal/pe"
+	"github.com/ZacharyZcR/PEPatch/internal/policy"
+	"github.com/fatih/color"
+)
+
+// Exit codes for the check subcommand.
+const (
+	exitCheckPassed    = 0
+	exitCheckViolation = 1
+	exitCheckError     = 2
+)
+
+// runCheck implements "pepatch check -policy <file> <PE文件>...".
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	policyPath := fs.String("policy", "", "策略文件路径 (YAML/JSON)")
+	format := fs.String("format", "text", "输出格式: text 或 json")
+	fs.Usage = printCheckUsage
+
+	if err := fs.Parse(args); err != nil {
+		return exitCheckError
+	}
+
+	red := color.New(color.FgRed, color.Bold)
+	if *policyPath == "" || fs.NArg() == 0 {
+		printCheckUsage()
+		return exitCheckError
+	}
+	if *format != "text" && *format != "json" {
+		_, _ = red.Fprintf(os.Stderr, "\n错误: 不支持的输出格式: %s\n\n", *format)
+		return exitCheckError
+	}
+
+	pol, err := policy.Load(*policyPath)
+	if err != nil {
+		_, _ = red.Fprintf(os.Stderr, "\n错误: %v\n\n", err)
+		return exitCheckError
+	}
+
+	results := make([]policy.Result, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		results = append(results, checkFile(pol, path))
+	}
+
+	if *format == "json" {
+		printCheckJSON(results)
+	} else {
+		printCheckText(results)
+	}
+
+	return checkExitCode(results)
+}
+
+func checkFile(pol *policy.Policy, path string) policy.Result {
+	reader, err := pe.Open(path)
+	if err != nil {
+		return policy.Result{File: path, Violations: []policy.Violation{}, Error: err.Error()}
+	}
+	defer func() { _ = reader.Close() }()
+
+	info, err := pe.NewAnalyzer(reader).Analyze()
+	if err != nil {
+		return policy.Result{File: path, Violations: []policy.Violation{}, Error: err.Error()}
+	}
+
+	return pol.Evaluate(info)
+}
+
+func checkExitCode(results []policy.Result) int {
+	code := exitCheckPassed
+	for _, r := range results {
+		if r.Error != "" {
+			return exitCheckError
+		}
+		if !r.Passed {
+			code = exitCheckViolation
+		}
+	}
+	return code
+}
+
+func printCheckJSON(results []policy.Result) {
+	passed := checkExitCode(results) == exitCheckPassed
+	out := struct {
+		Passed  bool            `json:"passed"`
+		Results []policy.Result `json:"results"`
+	}{passed, results}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(out)
+}
+
+func printCheckText(results []policy.Result) {
+	green := color.New(color.FgGreen, color.Bold)
+	red := color.New(color.FgRed, color.Bold)
+
+	failed := 0
+	for _, r := range results {
+		switch {
+		case r.Error != "":
+			failed++
+			_, _ = red.Printf("✗ %s: 分析失败: %s\n", r.File, r.Error)
+		case r.Passed:
+			_, _ = green.Printf("✓ %s: 通过\n", r.File)
+		default:
+			failed++
+			_, _ = red.Printf("✗ %s: %d 项违规\n", r.File, len(r.Violations))
+			for _, v := range r.Violations {
+				fmt.Printf("    [%s] %s\n", v.Rule, v.Message)
+			}
+		}
+	}
+
+	fmt.Printf("\n共检查 %d 个文件，%d 个通过，%d 个未通过\n", len(results), len(results)-failed, failed)
+}
+
+func printCheckUsage() {
+	fmt.Println("\n策略检查用法:")
+	fmt.Println("  pepatch check -policy <策略文件> [-format text|json] <PE文件>...")
+	fmt.Println("\n选项:")
+	fmt.Println("  -policy <文件>  策略文件（YAML，或扩展名为 .json 的JSON）")
+	fmt.Println("  -format <格式>  输出格式: text（默认）或 json")
+	fmt.Println("\n退出码: 0=全部通过, 1=存在违规, 2=参数或分析错误")
+	fmt.Println("\n示例:")
+	fmt.Println("  pepatch check -policy release-policy.yaml dist/*.exe dist/*.dll")
+	fmt.Println("  pepatch check -policy policy.json -format json app.exe > report.json")
+	fmt.Println()
+}
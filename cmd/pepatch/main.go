@@ -4,7 +4,11 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/ZacharyZcR/PEPatch/internal/cli"
@@ -19,31 +23,63 @@ var (
 	detectCaves    = flag.Bool("caves", false, "检测Code Caves（可注入代码的空隙）")
 	minCaveSize    = flag.Uint("min-cave-size", 32, "Code Cave最小大小（字节）")
 	listImports    = flag.Bool("list-imports", false, "列出详细导入信息（所有函数）")
+	listFunctions  = flag.Bool("list-functions", false, "列出异常目录中的函数边界和展开信息（x64/ARM64）")
 	analyzeDeps    = flag.Bool("deps", false, "分析依赖关系（递归检测所有DLL依赖）")
 	maxDepth       = flag.Uint("max-depth", 3, "依赖分析最大深度（默认: 3）")
 	flatList       = flag.Bool("flat", false, "依赖分析使用扁平列表格式（默认: 树状）")
+	hardening      = flag.Bool("hardening", false, "安全加固检查（ASLR、DEP、CFG、SafeSEH、/GS、CET等）")
+	defOutput      = flag.String("def", "", "根据导出表生成模块定义文件（.def）")
+	implibOutput   = flag.String("implib", "", "根据导出表生成COFF导入库（.lib，可用于link.exe、lld-link和MinGW）")
 
 	// Patch flags.
 	patchMode     = flag.Bool("patch", false, "修改模式：修改PE文件")
 	sectionName   = flag.String("section", "", "要修改的节区名称")
 	permissions   = flag.String("perms", "", "新的权限 (例如: R-X, RW-, RWX)")
+	setFlags      = flag.String("set-flags", "", "设置节区标志 (例如: MEM_DISCARDABLE,MEM_SHARED 或 0x02000000)")
+	clearFlags    = flag.String("clear-flags", "", "清除节区标志 (例如: MEM_WRITE,ALIGN_16BYTES)")
+	setHeader     = flag.String("set-header", "", "修改头字段 (例如: NX_COMPAT=on,DYNAMIC_BASE=on,Subsystem=console)")
+	clearGuardCF  = flag.Bool("clear-guard-cf", false, "关闭CFG检查（清除GUARD_CF，代替重建CFG函数表）")
 	entryPoint    = flag.String("entry", "", "新的入口点地址 (十六进制，例如: 0x1000)")
 	injectSection = flag.String("inject-section", "", "注入新节区的名称 (最大8字符)")
 	sectionSize   = flag.Uint("section-size", 4096, "新节区大小（字节）")
 	sectionPerms  = flag.String("section-perms", "RWX", "新节区权限 (R-X, RW-, RWX)")
 	addImport     = flag.String("add-import", "", "添加DLL导入 (格式: DLL:Func1,Func2,...)")
-	addExport     = flag.String("add-export", "", "添加导出函数（函数名）")
-	modifyExport  = flag.String("modify-export", "", "修改导出函数（函数名）")
-	removeExport  = flag.String("remove-export", "", "删除导出函数（函数名）")
+	addExport     = flag.String("add-export", "", "添加导出函数（函数名，或 #N 添加仅序号导出）")
+	modifyExport  = flag.String("modify-export", "", "修改导出函数（函数名或 #N）")
+	removeExport  = flag.String("remove-export", "", "删除导出函数（函数名，或 #N 删除该序号及其所有名称）")
+	addDelayImport  = flag.String("add-delay-import", "", "添加延迟加载导入 (格式: DLL:Func1,Func2,...)，需已链接延迟加载辅助函数")
+	removeImport    = flag.String("remove-import", "", "删除导入 (格式: DLL 删除整个DLL，或 DLL:Func1,#23 删除指定函数)")
+	renameImport    = flag.String("rename-import", "", "重命名导入的DLL (格式: 旧名=新名，例如: foo.dll=foo_v2.dll)")
+	redirectImport  = flag.String("redirect-import", "", "重定向导入函数 (格式: DLL:Func=新DLL:新Func，或 DLL:Func=RVA 指向映像内的代码)")
+	importHints     = flag.Bool("import-hints", false, "添加导入时从目标DLL的导出名称表计算hint（需能在本地找到该DLL）")
+	stripBound      = flag.Bool("strip-bound-imports", false, "清除导入绑定（绑定导入目录和预绑定的IAT值），修改导入表时自动执行")
 	exportRVA       = flag.String("export-rva", "", "导出函数RVA地址（十六进制，用于add-export和modify-export）")
+	exportOrdinal   = flag.Uint("export-ordinal", 0, "添加导出时使用的序号（默认取下一个空闲序号）")
+	exportForward   = flag.String("export-forward", "", "转发目标 (格式: DLL.Func 或 DLL.#N，用于add-export和modify-export)")
+	exportDLLName   = flag.String("export-dll-name", "", "设置导出目录中的DLL名称")
+	exportBase      = flag.Uint("export-base", 0, "设置导出序号基数（不能大于现有最小序号）")
+	addUnwind       = flag.String("add-unwind", "", "为注入的x64代码注册展开信息 (RVA范围，例如: 0x5000-0x5080)")
+	unwindProlog    = flag.String("unwind-prolog", "", "注入代码的序言描述 (例如: push rbp,push rbx,alloc 0x28,frame rbp)")
 	removeSig       = flag.Bool("remove-signature", false, "移除数字签名")
 	truncateSig     = flag.Bool("truncate-cert", true, "移除签名时截断证书数据（节省空间）")
 	addTLSCallback  = flag.String("add-tls-callback", "", "添加TLS回调函数（RVA地址，十六进制）")
+	rewritePDB      = flag.String("rewrite-pdb-path", "", "改写CodeView中的PDB路径（保留GUID和Age）")
+	removeDebug     = flag.String("remove-debug-entry", "", "删除指定类型的调试条目 (例如: POGO,VC_FEATURE)")
+	stripDebug      = flag.Bool("strip-debug", false, "删除整个调试目录及调试数据")
+	removeRich      = flag.Bool("remove-rich", false, "移除DOS存根中的Rich头（隐藏工具链信息）")
+	fixRich         = flag.Bool("fix-rich", false, "重新计算Rich头校验密钥")
+	normalize       = flag.Bool("normalize", false, "可复现构建：将所有时间戳改为固定值（默认取 SOURCE_DATE_EPOCH，未设置时为0）")
+	normalizeTime   = flag.String("normalize-time", "", "规范化使用的时间戳（Unix秒，覆盖 SOURCE_DATE_EPOCH）")
+	normalizeRich   = flag.Bool("normalize-rich", false, "规范化时同时移除Rich头")
 	updateCksum     = flag.Bool("update-checksum", true, "修改后更新校验和")
 	createBackup    = flag.Bool("backup", true, "修改前创建备份文件")
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(runCheck(os.Args[2:]))
+	}
+
 	flag.Parse()
 
 	if flag.NArg() < 1 {
@@ -83,7 +119,11 @@ func analyzePE(filepath string) error {
 	reporter := cli.NewReporter(info)
 	reporter.SetVerbose(*verbose)
 	reporter.SetSuspiciousOnly(*suspiciousOnly)
-	reporter.Print()
+	if *hardening {
+		reporter.PrintHardening()
+	} else {
+		reporter.Print()
+	}
 
 	// Detect code caves if requested.
 	if *detectCaves {
@@ -99,6 +139,13 @@ func analyzePE(filepath string) error {
 		}
 	}
 
+	// List exception directory functions if requested.
+	if *listFunctions {
+		if err := listRuntimeFunctions(filepath); err != nil {
+			return err
+		}
+	}
+
 	// Analyze dependencies if requested.
 	if *analyzeDeps {
 		if err := analyzeDependencies(filepath); err != nil {
@@ -106,12 +153,24 @@ func analyzePE(filepath string) error {
 		}
 	}
 
+	// Generate a .def file and import library if requested.
+	if *defOutput != "" || *implibOutput != "" {
+		if err := writeLibraryFiles(info); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 func patchPE(filepath string) error {
-	if *sectionName == "" && *entryPoint == "" && *injectSection == "" && *addImport == "" &&
-		*addExport == "" && *modifyExport == "" && *removeExport == "" && !*removeSig && *addTLSCallback == "" {
+	if *sectionName == "" && *entryPoint == "" && *injectSection == "" && *addImport == "" && *addDelayImport == "" && !*stripBound &&
+		*removeImport == "" && *renameImport == "" && *redirectImport == "" &&
+		*addExport == "" && *modifyExport == "" && *removeExport == "" && *exportDLLName == "" && *exportBase == 0 &&
+		!*removeSig && *addTLSCallback == "" &&
+		*rewritePDB == "" && *removeDebug == "" && !*stripDebug && !*normalize &&
+		!*removeRich && !*fixRich && *addUnwind == "" &&
+		*setFlags == "" && *clearFlags == "" && *setHeader == "" && !*clearGuardCF {
 		return fmt.Errorf("必须指定至少一个修改操作")
 	}
 
@@ -143,6 +202,28 @@ func applyPatches(patcher *pe.Patcher) error {
 		modified = true
 	}
 
+	if *setFlags != "" || *clearFlags != "" {
+		if err := patchSectionFlags(patcher); err != nil {
+			return err
+		}
+		modified = true
+	}
+
+	if *setHeader != "" {
+		if err := patchHeaderFields(patcher); err != nil {
+			return err
+		}
+		modified = true
+	}
+
+	// Must run before entry point and export changes so they skip the CFG table rebuild
+	if *clearGuardCF {
+		if err := clearGuardCFFlag(patcher); err != nil {
+			return err
+		}
+		modified = true
+	}
+
 	if *entryPoint != "" {
 		if err := patchEntryPointAddr(patcher); err != nil {
 			return err
@@ -157,6 +238,42 @@ func applyPatches(patcher *pe.Patcher) error {
 		modified = true
 	}
 
+	// After section injection so the range can point into the new section
+	if *addUnwind != "" {
+		if err := addUnwindInfo(patcher); err != nil {
+			return err
+		}
+		modified = true
+	}
+
+	if *stripBound {
+		if err := stripBoundImports(patcher); err != nil {
+			return err
+		}
+		modified = true
+	}
+
+	if *removeImport != "" {
+		if err := removeDLLImport(patcher); err != nil {
+			return err
+		}
+		modified = true
+	}
+
+	if *renameImport != "" {
+		if err := renameDLLImport(patcher); err != nil {
+			return err
+		}
+		modified = true
+	}
+
+	if *redirectImport != "" {
+		if err := redirectDLLImport(patcher); err != nil {
+			return err
+		}
+		modified = true
+	}
+
 	if *addImport != "" {
 		if err := addDLLImport(patcher); err != nil {
 			return err
@@ -164,6 +281,13 @@ func applyPatches(patcher *pe.Patcher) error {
 		modified = true
 	}
 
+	if *addDelayImport != "" {
+		if err := addDelayLoadImport(patcher); err != nil {
+			return err
+		}
+		modified = true
+	}
+
 	if *addExport != "" {
 		if err := addExportFunc(patcher); err != nil {
 			return err
@@ -185,6 +309,13 @@ func applyPatches(patcher *pe.Patcher) error {
 		modified = true
 	}
 
+	if *exportDLLName != "" || *exportBase != 0 {
+		if err := setExportDirectory(patcher); err != nil {
+			return err
+		}
+		modified = true
+	}
+
 	if *removeSig {
 		if err := removeSignature(patcher); err != nil {
 			return err
@@ -199,6 +330,28 @@ func applyPatches(patcher *pe.Patcher) error {
 		modified = true
 	}
 
+	if *rewritePDB != "" || *removeDebug != "" || *stripDebug {
+		if err := patchDebugInfo(patcher); err != nil {
+			return err
+		}
+		modified = true
+	}
+
+	if *removeRich || *fixRich {
+		if err := patchRichHeader(patcher); err != nil {
+			return err
+		}
+		modified = true
+	}
+
+	// Must run last: the CodeView GUID is derived from the final image
+	if *normalize {
+		if err := normalizeTimestamps(patcher); err != nil {
+			return err
+		}
+		modified = true
+	}
+
 	if modified && *updateCksum {
 		return updateChecksumWithMessage(patcher)
 	}
@@ -238,6 +391,53 @@ func patchSectionPerms(patcher *pe.Patcher) error {
 	return patcher.SetSectionPermissions(*sectionName, read, write, execute)
 }
 
+func patchSectionFlags(patcher *pe.Patcher) error {
+	if *sectionName == "" {
+		return fmt.Errorf("-set-flags/-clear-flags 需要同时指定 -section")
+	}
+
+	var set, clear uint32
+	var err error
+	if *setFlags != "" {
+		if set, err = pe.ParseSectionFlags(*setFlags); err != nil {
+			return err
+		}
+	}
+	if *clearFlags != "" {
+		if clear, err = pe.ParseSectionFlags(*clearFlags); err != nil {
+			return err
+		}
+	}
+
+	cyan := color.New(color.FgCyan)
+	_, _ = cyan.Printf("正在修改节区 '%s' 的标志...\n", *sectionName)
+
+	return patcher.ModifySectionCharacteristics(*sectionName, set, clear)
+}
+
+func patchHeaderFields(patcher *pe.Patcher) error {
+	cyan := color.New(color.FgCyan)
+	_, _ = cyan.Println("正在修改PE头字段...")
+
+	return patcher.SetHeaderFields(*setHeader)
+}
+
+func clearGuardCFFlag(patcher *pe.Patcher) error {
+	cyan := color.New(color.FgCyan)
+	_, _ = cyan.Println("正在关闭CFG检查 (GUARD_CF)...")
+
+	return patcher.ClearGuardCF()
+}
+
+// noteGuardCF tells the user that a new call target will be added to the
+// CFG function table.
+func noteGuardCF(patcher *pe.Patcher) {
+	if enabled, err := patcher.GuardCFEnabled(); err == nil && enabled {
+		cyan := color.New(color.FgCyan)
+		_, _ = cyan.Println("检测到CFG，新的调用目标将加入CFG函数表")
+	}
+}
+
 func patchEntryPointAddr(patcher *pe.Patcher) error {
 	newEntry, err := parseHexAddress(*entryPoint)
 	if err != nil {
@@ -252,6 +452,7 @@ func patchEntryPointAddr(patcher *pe.Patcher) error {
 	}
 
 	_, _ = cyan.Printf("正在修改入口点为: 0x%X...\n", newEntry)
+	noteGuardCF(patcher)
 	return patcher.PatchEntryPoint(newEntry)
 }
 
@@ -306,21 +507,274 @@ func injectNewSection(patcher *pe.Patcher) error {
 	return patcher.InjectSection(*injectSection, data, characteristics)
 }
 
+func addUnwindInfo(patcher *pe.Patcher) error {
+	begin, end, ok := strings.Cut(*addUnwind, "-")
+	if !ok {
+		return fmt.Errorf("范围格式错误: %s (应为 起始-结束，例如: 0x5000-0x5080)", *addUnwind)
+	}
+	beginRVA, err := parseHexAddress(strings.TrimSpace(begin))
+	if err != nil {
+		return err
+	}
+	endRVA, err := parseHexAddress(strings.TrimSpace(end))
+	if err != nil {
+		return err
+	}
+
+	prolog, err := pe.ParsePrologSpec(*unwindProlog)
+	if err != nil {
+		return err
+	}
+
+	cyan := color.New(color.FgCyan)
+	_, _ = cyan.Printf("正在注册展开信息 (0x%X-0x%X, 序言 %d 条指令)...\n", beginRVA, endRVA, len(prolog))
+
+	return patcher.AddRuntimeFunctions(pe.UnwindFunction{
+		BeginAddress: beginRVA,
+		EndAddress:   endRVA,
+		Prolog:       prolog,
+	})
+}
+
 func addDLLImport(patcher *pe.Patcher) error {
-	// Parse format: "DLL:Func1,Func2,Func3"
-	parts := strings.SplitN(*addImport, ":", 2)
+	dllName, functions, err := parseImportSpec(*addImport)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := pe.ParseImportFunctions(functions)
+	if err != nil {
+		return err
+	}
+
+	cyan := color.New(color.FgCyan)
+	_, _ = cyan.Printf("正在添加导入: %s (%d 个函数)...\n", dllName, len(functions))
+	printImportMerge(patcher, dllName, parsed)
+	if *importHints {
+		if err := resolveImportHints(patcher, dllName, parsed); err != nil {
+			return err
+		}
+	}
+
+	return patcher.AddImportFunctions(dllName, parsed)
+}
+
+// resolveImportHints fills in hints from the target DLL when it can be found
+// next to the file or in the system search paths.
+func resolveImportHints(patcher *pe.Patcher, dllName string, functions []pe.ImportFunction) error {
+	yellow := color.New(color.FgYellow)
+
+	dllPath, missing, err := pe.ResolveImportHints(dllName, filepath.Dir(patcher.Path()), functions)
+	if err != nil {
+		return err
+	}
+	if dllPath == "" {
+		_, _ = yellow.Printf("  未找到 %s，hint 保持为0\n", dllName)
+		return nil
+	}
+
+	fmt.Printf("  从 %s 的导出名称表计算hint\n", dllPath)
+	if len(missing) > 0 {
+		_, _ = yellow.Printf("  警告: %s 未导出: %s\n", dllName, strings.Join(missing, ", "))
+	}
+	if *verbose {
+		for _, fn := range functions {
+			if !fn.IsByOrdinal {
+				fmt.Printf("    %s: hint %d\n", fn.Name, fn.Hint)
+			}
+		}
+	}
+	return nil
+}
+
+// printImportMerge reports functions that are skipped because the DLL
+// already imports them.
+func printImportMerge(patcher *pe.Patcher, dllName string, functions []pe.ImportFunction) {
+	imports, err := patcher.ListImports()
+	if err != nil {
+		return
+	}
+
+	var skipped []string
+	merged := false
+	for _, imp := range imports {
+		if !strings.EqualFold(imp.DLL, dllName) {
+			continue
+		}
+		merged = true
+		for _, fn := range functions {
+			if name := fn.String(); slices.Contains(imp.Functions, name) && !slices.Contains(skipped, name) {
+				skipped = append(skipped, name)
+			}
+		}
+	}
+	if !merged {
+		return
+	}
+
+	yellow := color.New(color.FgYellow)
+	_, _ = yellow.Printf("  %s 已在导入表中，新函数将合并到该DLL（原IAT槽位保持不变）\n", dllName)
+	if len(skipped) > 0 {
+		_, _ = yellow.Printf("  跳过已导入的函数: %s\n", strings.Join(skipped, ", "))
+	}
+}
+
+func removeDLLImport(patcher *pe.Patcher) error {
+	dllName, specs := *removeImport, []string(nil)
+	if strings.Contains(*removeImport, ":") {
+		var err error
+		if dllName, specs, err = parseImportSpec(*removeImport); err != nil {
+			return err
+		}
+	}
+	functions, err := pe.ParseImportFunctions(specs)
+	if err != nil {
+		return err
+	}
+
+	cyan := color.New(color.FgCyan)
+	if len(functions) == 0 {
+		_, _ = cyan.Printf("正在删除导入: %s...\n", dllName)
+	} else {
+		_, _ = cyan.Printf("正在删除导入: %s (%d 个函数)...\n", dllName, len(functions))
+	}
+
+	refs, err := patcher.RemoveImport(dllName, functions)
+	if err != nil {
+		return err
+	}
+	printRemovedSlotReferences(refs)
+	return nil
+}
+
+// printRemovedSlotReferences warns about code that still goes through a
+// removed IAT slot; such calls now fault on a null pointer.
+func printRemovedSlotReferences(refs []pe.IATReference) {
+	if len(refs) == 0 {
+		return
+	}
+
+	yellow := color.New(color.FgYellow)
+	_, _ = yellow.Printf("  警告: %d 处代码仍引用已删除的IAT槽位，执行到这些位置时会崩溃:\n", len(refs))
+	maxDisplay := 10
+	if *verbose {
+		maxDisplay = len(refs)
+	}
+	for _, ref := range refs[:min(len(refs), maxDisplay)] {
+		op := "call"
+		if ref.Jump {
+			op = "jmp"
+		}
+		fmt.Printf("    0x%08X: %s [IAT 0x%08X]\n", ref.RVA, op, ref.Slot)
+	}
+	if len(refs) > maxDisplay {
+		fmt.Printf("    ... (还有 %d 处，使用 -v 查看全部)\n", len(refs)-maxDisplay)
+	}
+}
+
+func renameDLLImport(patcher *pe.Patcher) error {
+	oldName, newName, ok := strings.Cut(*renameImport, "=")
+	oldName, newName = strings.TrimSpace(oldName), strings.TrimSpace(newName)
+	if !ok || oldName == "" || newName == "" {
+		return fmt.Errorf("重命名格式错误，应为 旧名=新名")
+	}
+
+	cyan := color.New(color.FgCyan)
+	_, _ = cyan.Printf("正在重命名导入: %s → %s...\n", oldName, newName)
+
+	return patcher.RenameImport(oldName, newName)
+}
+
+func redirectDLLImport(patcher *pe.Patcher) error {
+	from, to, ok := strings.Cut(*redirectImport, "=")
+	to = strings.TrimSpace(to)
+	if !ok || to == "" {
+		return fmt.Errorf("重定向格式错误，应为 DLL:Func=新DLL:新Func 或 DLL:Func=RVA")
+	}
+	dllName, function, err := parseSingleImport(from)
+	if err != nil {
+		return err
+	}
+
+	cyan := color.New(color.FgCyan)
+	if !strings.Contains(to, ":") {
+		rva, err := parseHexAddress(to)
+		if err != nil {
+			return err
+		}
+		_, _ = cyan.Printf("正在重定向导入: %s!%s → RVA 0x%X...\n", dllName, function, rva)
+		noteGuardCF(patcher)
+		return patcher.RedirectImportToRVA(dllName, function, rva)
+	}
+
+	newDLL, newFunction, err := parseSingleImport(to)
+	if err != nil {
+		return err
+	}
+	_, _ = cyan.Printf("正在重定向导入: %s!%s → %s!%s...\n", dllName, function, newDLL, newFunction)
+	if *importHints {
+		functions := []pe.ImportFunction{newFunction}
+		if err := resolveImportHints(patcher, newDLL, functions); err != nil {
+			return err
+		}
+		newFunction = functions[0]
+	}
+	return patcher.RedirectImport(dllName, function, newDLL, newFunction)
+}
+
+// parseSingleImport parses a "DLL:Func" spec naming exactly one function.
+func parseSingleImport(spec string) (string, pe.ImportFunction, error) {
+	dllName, functions, err := parseImportSpec(strings.TrimSpace(spec))
+	if err != nil {
+		return "", pe.ImportFunction{}, err
+	}
+	if len(functions) != 1 {
+		return "", pe.ImportFunction{}, fmt.Errorf("只能指定一个函数: %s", spec)
+	}
+	function, err := pe.ParseImportFunction(functions[0])
+	return dllName, function, err
+}
+
+func stripBoundImports(patcher *pe.Patcher) error {
+	cyan := color.New(color.FgCyan)
+	_, _ = cyan.Println("正在清除导入绑定...")
+
+	stripped, err := patcher.StripBoundImports()
+	if err != nil {
+		return err
+	}
+	if !stripped {
+		return fmt.Errorf("文件没有绑定导入")
+	}
+	return nil
+}
+
+func addDelayLoadImport(patcher *pe.Patcher) error {
+	dllName, functions, err := parseImportSpec(*addDelayImport)
+	if err != nil {
+		return err
+	}
+
+	cyan := color.New(color.FgCyan)
+	_, _ = cyan.Printf("正在添加延迟加载导入: %s (%d 个函数)...\n", dllName, len(functions))
+
+	return patcher.AddDelayImport(dllName, functions)
+}
+
+// parseImportSpec parses "DLL:Func1,Func2,Func3".
+func parseImportSpec(spec string) (string, []string, error) {
+	parts := strings.SplitN(spec, ":", 2)
 	if len(parts) != 2 {
-		return fmt.Errorf("导入格式错误，应为 DLL:Func1,Func2")
+		return "", nil, fmt.Errorf("导入格式错误，应为 DLL:Func1,Func2")
 	}
 
 	dllName := strings.TrimSpace(parts[0])
 	if dllName == "" {
-		return fmt.Errorf("DLL名称不能为空")
+		return "", nil, fmt.Errorf("DLL名称不能为空")
 	}
 
-	funcList := strings.Split(parts[1], ",")
 	var functions []string
-	for _, fn := range funcList {
+	for _, fn := range strings.Split(parts[1], ",") {
 		fn = strings.TrimSpace(fn)
 		if fn != "" {
 			functions = append(functions, fn)
@@ -328,42 +782,80 @@ func addDLLImport(patcher *pe.Patcher) error {
 	}
 
 	if len(functions) == 0 {
-		return fmt.Errorf("必须指定至少一个函数")
+		return "", nil, fmt.Errorf("必须指定至少一个函数")
+	}
+	return dllName, functions, nil
+}
+
+func addExportFunc(patcher *pe.Patcher) error {
+	fn, err := parseExportSpec(*addExport, *exportOrdinal)
+	if err != nil {
+		return err
 	}
 
 	cyan := color.New(color.FgCyan)
-	_, _ = cyan.Printf("正在添加导入: %s (%d 个函数)...\n", dllName, len(functions))
+	modifier := pe.NewExportModifier(patcher)
 
-	// Extend file size first for new section.
-	lastSection := patcher.File().Sections[len(patcher.File().Sections)-1]
-	newFileSize := int64(lastSection.Offset + lastSection.Size + 65536) // 64KB buffer
-	if err := patcher.ExtendFileSize(newFileSize); err != nil {
-		return fmt.Errorf("扩展文件失败: %w", err)
+	if *exportForward != "" {
+		if *exportRVA != "" {
+			return fmt.Errorf("-export-rva 和 -export-forward 不能同时使用")
+		}
+		fn.Forwarder = *exportForward
+		_, _ = cyan.Printf("正在添加转发导出: %s -> %s...\n", *addExport, fn.Forwarder)
+		return modifier.AddExportEntry(fn)
 	}
 
-	return patcher.AddImport(dllName, functions)
-}
-
-func addExportFunc(patcher *pe.Patcher) error {
 	if *exportRVA == "" {
-		return fmt.Errorf("添加导出时必须指定 -export-rva")
+		return fmt.Errorf("添加导出时必须指定 -export-rva 或 -export-forward")
 	}
 
-	rva, err := parseHexAddress(*exportRVA)
+	fn.RVA, err = parseHexAddress(*exportRVA)
 	if err != nil {
 		return fmt.Errorf("导出RVA地址格式错误: %w", err)
 	}
 
-	cyan := color.New(color.FgCyan)
-	_, _ = cyan.Printf("正在添加导出函数: %s (RVA: 0x%X)...\n", *addExport, rva)
+	_, _ = cyan.Printf("正在添加导出函数: %s (RVA: 0x%X)...\n", *addExport, fn.RVA)
+	noteGuardCF(patcher)
 
-	modifier := pe.NewExportModifier(patcher)
-	return modifier.AddExport(*addExport, rva)
+	return modifier.AddExportEntry(fn)
+}
+
+// parseExportSpec parses the -add-export value: a name, or "#N" for an
+// ordinal-only export. The ordinal may also come from -export-ordinal.
+func parseExportSpec(spec string, ordinal uint) (pe.ExportFunction, error) {
+	if ordinal > 0xFFFF {
+		return pe.ExportFunction{}, fmt.Errorf("导出序号超出范围: %d", ordinal)
+	}
+	fn := pe.ExportFunction{Name: spec, Ordinal: uint16(ordinal)}
+
+	if ordinalSpec, ok := strings.CutPrefix(spec, "#"); ok {
+		n, err := strconv.ParseUint(ordinalSpec, 10, 16)
+		if err != nil || n == 0 {
+			return pe.ExportFunction{}, fmt.Errorf("无效的导出序号: %s", spec)
+		}
+		if ordinal != 0 && uint(n) != ordinal {
+			return pe.ExportFunction{}, fmt.Errorf("%s 与 -export-ordinal %d 冲突", spec, ordinal)
+		}
+		fn.Name = ""
+		fn.Ordinal = uint16(n)
+	}
+	return fn, nil
 }
 
 func modifyExportFunc(patcher *pe.Patcher) error {
+	if *exportForward != "" {
+		if *exportRVA != "" {
+			return fmt.Errorf("-export-rva 和 -export-forward 不能同时使用")
+		}
+		cyan := color.New(color.FgCyan)
+		_, _ = cyan.Printf("正在将导出函数 %s 转发到 %s...\n", *modifyExport, *exportForward)
+
+		modifier := pe.NewExportModifier(patcher)
+		return modifier.ForwardExport(*modifyExport, *exportForward)
+	}
+
 	if *exportRVA == "" {
-		return fmt.Errorf("修改导出时必须指定 -export-rva")
+		return fmt.Errorf("修改导出时必须指定 -export-rva 或 -export-forward")
 	}
 
 	rva, err := parseHexAddress(*exportRVA)
@@ -373,6 +865,7 @@ func modifyExportFunc(patcher *pe.Patcher) error {
 
 	cyan := color.New(color.FgCyan)
 	_, _ = cyan.Printf("正在修改导出函数: %s (新RVA: 0x%X)...\n", *modifyExport, rva)
+	noteGuardCF(patcher)
 
 	modifier := pe.NewExportModifier(patcher)
 	return modifier.ModifyExport(*modifyExport, rva)
@@ -386,6 +879,29 @@ func removeExportFunc(patcher *pe.Patcher) error {
 	return modifier.RemoveExport(*removeExport)
 }
 
+func setExportDirectory(patcher *pe.Patcher) error {
+	cyan := color.New(color.FgCyan)
+	modifier := pe.NewExportModifier(patcher)
+
+	if *exportDLLName != "" {
+		_, _ = cyan.Printf("正在设置导出DLL名称: %s...\n", *exportDLLName)
+		if err := modifier.SetExportName(*exportDLLName); err != nil {
+			return err
+		}
+	}
+
+	if *exportBase != 0 {
+		if *exportBase > 0xFFFF {
+			return fmt.Errorf("序号基数超出范围: %d", *exportBase)
+		}
+		_, _ = cyan.Printf("正在设置导出序号基数: %d...\n", *exportBase)
+		if err := modifier.SetOrdinalBase(uint32(*exportBase)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func removeSignature(patcher *pe.Patcher) error {
 	cyan := color.New(color.FgCyan)
 	yellow := color.New(color.FgYellow)
@@ -444,36 +960,197 @@ func addTLSCallbackFunc(patcher *pe.Patcher) error {
 	return nil
 }
 
+func patchDebugInfo(patcher *pe.Patcher) error {
+	cyan := color.New(color.FgCyan)
+	yellow := color.New(color.FgYellow)
+	modifier := pe.NewDebugModifier(patcher)
+
+	if *stripDebug {
+		entries, err := modifier.Entries()
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.Type == pe.IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS {
+				_, _ = yellow.Println("⚠️  调试目录包含 EX_DLLCHARACTERISTICS，删除后将失去CET兼容标记")
+			}
+		}
+
+		_, _ = cyan.Printf("正在删除调试目录 (%d 项)...\n", len(entries))
+		return modifier.Strip()
+	}
+
+	if *rewritePDB != "" {
+		_, _ = cyan.Printf("正在改写PDB路径为: %s...\n", *rewritePDB)
+		if _, err := modifier.RewritePDBPath(*rewritePDB); err != nil {
+			return err
+		}
+	}
+
+	if *removeDebug != "" {
+		types, err := pe.ParseDebugTypes(*removeDebug)
+		if err != nil {
+			return err
+		}
+		_, _ = cyan.Printf("正在删除调试条目: %s...\n", *removeDebug)
+		n, err := modifier.RemoveEntries(types...)
+		if err != nil {
+			return err
+		}
+		_, _ = cyan.Printf("已删除 %d 个调试条目\n", n)
+	}
+
+	return nil
+}
+
+func patchRichHeader(patcher *pe.Patcher) error {
+	cyan := color.New(color.FgCyan)
+
+	if *removeRich {
+		_, _ = cyan.Println("正在移除Rich头...")
+		removed, err := patcher.RemoveRichHeader()
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return fmt.Errorf("文件没有Rich头")
+		}
+		return nil
+	}
+
+	_, _ = cyan.Println("正在重新计算Rich头校验密钥...")
+	key, err := patcher.FixRichHeader()
+	if err != nil {
+		return err
+	}
+	_, _ = cyan.Printf("新密钥: 0x%08X\n", key)
+	return nil
+}
+
+func normalizeTimestamps(patcher *pe.Patcher) error {
+	opts := pe.NormalizeOptions{StripRichHeader: *normalizeRich}
+
+	source := "SOURCE_DATE_EPOCH"
+	if *normalizeTime != "" {
+		ts, err := strconv.ParseUint(*normalizeTime, 10, 32)
+		if err != nil {
+			return fmt.Errorf("时间戳格式错误: %s", *normalizeTime)
+		}
+		opts.Timestamp = uint32(ts)
+		source = "-normalize-time"
+	} else if ts, ok, err := pe.SourceDateEpoch(); err != nil {
+		return err
+	} else if ok {
+		opts.Timestamp = ts
+	} else {
+		source = "默认值"
+	}
+
+	cyan := color.New(color.FgCyan)
+	_, _ = cyan.Printf("正在规范化时间戳为 %d (%s)...\n", opts.Timestamp, source)
+
+	result, err := patcher.Normalize(opts)
+	if err != nil {
+		return err
+	}
+
+	_, _ = cyan.Printf("已改写 %d 个时间戳, %d 个CodeView GUID, %d 个REPRO哈希\n",
+		result.Timestamps, result.CodeViewGUIDs, result.ReproHashes)
+	if result.RichHeaderRemoved {
+		_, _ = cyan.Println("已移除Rich头")
+	}
+	return nil
+}
+
 func printPatchSuccess() {
 	green := color.New(color.FgGreen, color.Bold)
 	fmt.Println()
 	if *sectionName != "" && *permissions != "" {
 		_, _ = green.Printf("✓ 成功修改节区权限: %s -> %s\n", *sectionName, *permissions)
 	}
+	if *setFlags != "" || *clearFlags != "" {
+		_, _ = green.Printf("✓ 成功修改节区标志: %s\n", *sectionName)
+	}
+	if *setHeader != "" {
+		_, _ = green.Printf("✓ 成功修改头字段: %s\n", *setHeader)
+	}
+	if *clearGuardCF {
+		_, _ = green.Println("✓ 成功关闭CFG检查")
+	}
 	if *entryPoint != "" {
 		_, _ = green.Printf("✓ 成功修改入口点: %s\n", *entryPoint)
 	}
 	if *injectSection != "" {
 		_, _ = green.Printf("✓ 成功注入新节区: %s (%d 字节, 权限: %s)\n", *injectSection, *sectionSize, *sectionPerms)
 	}
+	if *addUnwind != "" {
+		_, _ = green.Printf("✓ 成功注册展开信息: %s\n", *addUnwind)
+	}
+	if *stripBound {
+		_, _ = green.Println("✓ 成功清除导入绑定")
+	}
+	if *removeImport != "" {
+		_, _ = green.Printf("✓ 成功删除导入: %s\n", *removeImport)
+	}
+	if *renameImport != "" {
+		_, _ = green.Printf("✓ 成功重命名导入: %s\n", *renameImport)
+	}
+	if *redirectImport != "" {
+		_, _ = green.Printf("✓ 成功重定向导入: %s\n", *redirectImport)
+	}
 	if *addImport != "" {
 		_, _ = green.Printf("✓ 成功添加导入: %s\n", *addImport)
 	}
+	if *addDelayImport != "" {
+		_, _ = green.Printf("✓ 成功添加延迟加载导入: %s\n", *addDelayImport)
+	}
 	if *addExport != "" {
-		_, _ = green.Printf("✓ 成功添加导出: %s (RVA: %s)\n", *addExport, *exportRVA)
+		if *exportForward != "" {
+			_, _ = green.Printf("✓ 成功添加转发导出: %s -> %s\n", *addExport, *exportForward)
+		} else {
+			_, _ = green.Printf("✓ 成功添加导出: %s (RVA: %s)\n", *addExport, *exportRVA)
+		}
 	}
 	if *modifyExport != "" {
-		_, _ = green.Printf("✓ 成功修改导出: %s (新RVA: %s)\n", *modifyExport, *exportRVA)
+		if *exportForward != "" {
+			_, _ = green.Printf("✓ 成功将导出 %s 转发到 %s\n", *modifyExport, *exportForward)
+		} else {
+			_, _ = green.Printf("✓ 成功修改导出: %s (新RVA: %s)\n", *modifyExport, *exportRVA)
+		}
 	}
 	if *removeExport != "" {
 		_, _ = green.Printf("✓ 成功删除导出: %s\n", *removeExport)
 	}
+	if *exportDLLName != "" {
+		_, _ = green.Printf("✓ 成功设置导出DLL名称: %s\n", *exportDLLName)
+	}
+	if *exportBase != 0 {
+		_, _ = green.Printf("✓ 成功设置导出序号基数: %d\n", *exportBase)
+	}
 	if *removeSig {
 		_, _ = green.Printf("✓ 成功移除数字签名\n")
 	}
 	if *addTLSCallback != "" {
 		_, _ = green.Printf("✓ 成功添加TLS回调: %s\n", *addTLSCallback)
 	}
+	if *stripDebug {
+		_, _ = green.Println("✓ 成功删除调试目录")
+	} else {
+		if *rewritePDB != "" {
+			_, _ = green.Printf("✓ 成功改写PDB路径: %s\n", *rewritePDB)
+		}
+		if *removeDebug != "" {
+			_, _ = green.Printf("✓ 成功删除调试条目: %s\n", *removeDebug)
+		}
+	}
+	if *removeRich {
+		_, _ = green.Println("✓ 成功移除Rich头")
+	} else if *fixRich {
+		_, _ = green.Println("✓ 成功修复Rich头校验密钥")
+	}
+	if *normalize {
+		_, _ = green.Println("✓ 成功规范化时间戳")
+	}
 	fmt.Println()
 }
 
@@ -542,6 +1219,70 @@ func detectCodeCaves(filepath string) error {
 	return nil
 }
 
+func listRuntimeFunctions(filepath string) error {
+	reader, err := pe.Open(filepath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	exceptions, err := pe.ParseExceptionDirectory(reader.File(), reader.RawFile())
+	if err != nil {
+		return err
+	}
+
+	cyan := color.New(color.FgCyan, color.Bold)
+	yellow := color.New(color.FgYellow)
+
+	fmt.Println()
+	if !exceptions.HasExceptions {
+		_, _ = yellow.Println("文件没有异常目录（仅x64和ARM64使用表驱动的异常处理）")
+		return nil
+	}
+	_, _ = cyan.Printf("========== 函数列表 (%d 个函数) ==========\n", len(exceptions.Functions))
+
+	for i := range exceptions.Functions {
+		rf := &exceptions.Functions[i]
+		fmt.Printf("0x%08X - 0x%08X  %6d 字节", rf.BeginAddress, rf.EndAddress, rf.Size())
+		if h := rf.HandlerAddress(); h != 0 {
+			fmt.Printf("  处理程序 0x%08X", h)
+		}
+		fmt.Println()
+
+		if *verbose {
+			printUnwindInfo(rf)
+		}
+	}
+
+	fmt.Println()
+	return nil
+}
+
+func printUnwindInfo(rf *pe.RuntimeFunction) {
+	if u := rf.Unwind; u != nil {
+		fmt.Printf("    序言 %d 字节", u.SizeOfProlog)
+		if reg := u.FrameRegisterName(); reg != "" {
+			fmt.Printf(", 帧寄存器 %s (偏移 0x%X)", reg, u.FrameOffset)
+		}
+		fmt.Println()
+		for _, c := range u.Codes {
+			fmt.Printf("      +0x%02X %s\n", c.CodeOffset, c)
+		}
+		if u.Chained != nil {
+			fmt.Printf("    链接到 0x%08X - 0x%08X\n", u.Chained.BeginAddress, u.Chained.EndAddress)
+		}
+		return
+	}
+
+	if u := rf.ARM64; u != nil {
+		if u.Packed() {
+			fmt.Printf("    紧凑展开: RegI=%d RegF=%d H=%v CR=%d 栈帧=0x%X\n", u.RegI, u.RegF, u.H, u.CR, u.FrameSize)
+		} else {
+			fmt.Printf("    .xdata 0x%08X: 尾声 %d 个, 展开码 %d 字\n", rf.UnwindInfoAddress, u.EpilogCount, u.CodeWords)
+		}
+	}
+}
+
 func listDetailedImports(filepath string) error {
 	reader, err := pe.Open(filepath)
 	if err != nil {
@@ -568,10 +1309,130 @@ func listDetailedImports(filepath string) error {
 		}
 	}
 
+	delayed, err := pe.ListDelayImportsFromReader(reader)
+	if err != nil {
+		return fmt.Errorf("解析延迟加载导入失败: %w", err)
+	}
+	if len(delayed) > 0 {
+		printDelayImports(delayed)
+	}
+
+	bound, err := pe.ListBoundImportsFromReader(reader)
+	if err != nil {
+		return fmt.Errorf("解析绑定导入失败: %w", err)
+	}
+	if bound != nil {
+		printBoundImports(bound)
+	}
+
+	fmt.Println()
+	return nil
+}
+
+func printBoundImports(bound *pe.BoundImportInfo) {
+	cyan := color.New(color.FgCyan, color.Bold)
+	fmt.Println()
+	_, _ = cyan.Printf("========== 绑定导入 (%d 个DLL) ==========\n", len(bound.Entries))
+
+	for i, e := range bound.Entries {
+		fmt.Printf("%d. %s  时间戳 0x%08X\n", i+1, e.DLL, e.TimeDateStamp)
+		for _, fwd := range e.Forwarders {
+			fmt.Printf("   → %s  时间戳 0x%08X (转发)\n", fwd.DLL, fwd.TimeDateStamp)
+		}
+	}
+	for _, b := range bound.Bindings {
+		if !b.NewStyle() {
+			fmt.Printf("   %s: 旧式绑定, 时间戳 0x%08X\n", b.DLL, b.TimeDateStamp)
+		}
+	}
+
+	if len(bound.Issues) == 0 {
+		_, _ = color.New(color.FgGreen).Println("✓ 绑定与导入表一致")
+		return
+	}
+	red := color.New(color.FgRed)
+	for _, issue := range bound.Issues {
+		_, _ = red.Printf("✗ %s\n", issue)
+	}
+	_, _ = color.New(color.FgYellow).Println("  使用 -strip-bound-imports 清除绑定")
+}
+
+func printDelayImports(imports []pe.DelayImportInfo) {
+	cyan := color.New(color.FgCyan, color.Bold)
+	magenta := color.New(color.FgMagenta)
+
+	fmt.Println()
+	_, _ = cyan.Printf("========== 延迟加载导入 (%d 个DLL) ==========\n", len(imports))
+
+	for i, imp := range imports {
+		_, _ = magenta.Printf("\n%d. %s (%d 个函数) [延迟加载]\n", i+1, imp.DLL, len(imp.Functions))
+		form := "RVA"
+		if !imp.RVABased() {
+			form = "VA (旧格式)"
+		}
+		fmt.Printf("   格式: %s  IAT: 0x%08X  INT: 0x%08X  模块句柄: 0x%08X\n",
+			form, imp.IATRVA, imp.INTRVA, imp.ModuleHandleRVA)
+		if imp.Bound() {
+			fmt.Printf("   已绑定 IAT: 0x%08X (时间戳 0x%08X)\n", imp.BoundIATRVA, imp.TimeDateStamp)
+		}
+		if imp.UnloadIATRVA != 0 {
+			fmt.Printf("   卸载 IAT: 0x%08X\n", imp.UnloadIATRVA)
+		}
+
+		for j, fn := range imp.FunctionNames() {
+			fmt.Printf("   %d. %s", j+1, fn)
+			if *verbose {
+				fmt.Printf("  (IAT 0x%08X → 0x%X)", imp.Functions[j].IATAddress, imp.Functions[j].Thunk)
+			}
+			fmt.Println()
+		}
+	}
+}
+
+func writeLibraryFiles(info *pe.Info) error {
+	if info.Exports == nil {
+		return fmt.Errorf("文件没有导出表，无法生成 .def 或导入库")
+	}
+	if info.Exports.DLLName == "" {
+		info.Exports.DLLName = filepath.Base(info.FilePath)
+	}
+
+	green := color.New(color.FgGreen)
 	fmt.Println()
+
+	if *defOutput != "" {
+		if err := writeLibraryFile(*defOutput, func(w io.Writer) error {
+			return pe.WriteDefFile(w, info.Exports)
+		}); err != nil {
+			return fmt.Errorf("生成 .def 文件失败: %w", err)
+		}
+		_, _ = green.Printf("✓ 已生成模块定义文件: %s (%d 个导出)\n", *defOutput, len(info.Exports.Functions))
+	}
+
+	if *implibOutput != "" {
+		if err := writeLibraryFile(*implibOutput, func(w io.Writer) error {
+			return pe.WriteImportLibrary(w, info.Exports, info.Machine)
+		}); err != nil {
+			return fmt.Errorf("生成导入库失败: %w", err)
+		}
+		_, _ = green.Printf("✓ 已生成导入库: %s (%s)\n", *implibOutput, info.Architecture)
+	}
 	return nil
 }
 
+// writeLibraryFile creates path and fills it with write.
+func writeLibraryFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func analyzeDependencies(filepath string) error {
 	cyan := color.New(color.FgCyan, color.Bold)
 	green := color.New(color.FgGreen)
@@ -600,10 +1461,18 @@ func analyzeDependencies(filepath string) error {
 		fmt.Printf("总计: %d 个依赖\n", analysis.TotalCount)
 		fmt.Printf("最大深度: %d\n", analysis.MaxDepth)
 
+		if len(analysis.DelayLoaded) > 0 {
+			fmt.Printf("延迟加载: %d 个 (%s)\n", len(analysis.DelayLoaded), strings.Join(analysis.DelayLoaded, ", "))
+		}
+
 		if len(analysis.MissingDeps) > 0 {
 			_, _ = red.Printf("\n⚠️  缺失 %d 个依赖:\n", len(analysis.MissingDeps))
 			for _, dll := range analysis.MissingDeps {
-				_, _ = red.Printf("  - %s\n", dll)
+				if analysis.IsDelayLoaded(dll) {
+					_, _ = red.Printf("  - %s (延迟加载，首次调用时才会失败)\n", dll)
+				} else {
+					_, _ = red.Printf("  - %s\n", dll)
+				}
 			}
 		}
 	}
@@ -623,10 +1492,17 @@ func printUsage() {
 	fmt.Println("  -s              仅显示可疑节区（RWX权限，潜在安全风险）")
 	fmt.Println("  -caves          检测Code Caves（可注入代码的空隙）")
 	fmt.Println("  -min-cave-size  Code Cave最小大小（字节，默认: 32）")
-	fmt.Println("  -list-imports   列出详细导入信息（所有函数，无截断）")
+	fmt.Println("  -list-imports   列出详细导入信息（所有函数，无截断，含延迟加载导入和绑定导入）")
+	fmt.Println("  -list-functions 列出异常目录中的函数边界（x64/ARM64，配合 -v 显示展开信息）")
 	fmt.Println("  -deps           分析依赖关系（递归检测所有DLL依赖）")
 	fmt.Println("  -max-depth      依赖分析最大深度（默认: 3，防止无限递归）")
 	fmt.Println("  -flat           依赖分析使用扁平列表格式（默认: 树状）")
+	fmt.Println("  -hardening      安全加固检查（ASLR、DEP、CFG、SafeSEH、/GS、RFG、CET、RWX节区、签名等）")
+	fmt.Println("  -def <文件>     根据导出表生成 .def 文件（序号、NONAME、DATA、转发）")
+	fmt.Println("  -implib <文件>  根据导出表生成COFF导入库（x86/x64/ARM/ARM64）")
+
+	fmt.Println("\n策略检查用法:")
+	fmt.Println("  pepatch check -policy <策略文件> [-format text|json] <PE文件>...")
 
 	fmt.Println("\n修改模式用法:")
 	fmt.Println("  pepatch -patch [选项] <PE文件路径>")
@@ -635,18 +1511,48 @@ func printUsage() {
 	fmt.Println("  -section <名称>       要修改的节区名称（例如: .text, .data）")
 	fmt.Println("  -perms <RWX>          新的权限，3个字符：R(读) W(写) X(执行)，用'-'表示无")
 	fmt.Println("                        例如: R-X（只读可执行）, RW-（读写）, --X（只执行）")
+	fmt.Println("  -set-flags <标志>     设置节区标志（需配合 -section，逗号分隔）")
+	fmt.Println("                        例如: MEM_DISCARDABLE, MEM_SHARED, CNT_CODE, ALIGN_16BYTES, 0x02000000")
+	fmt.Println("  -clear-flags <标志>   清除节区标志（需配合 -section，格式同 -set-flags）")
+	fmt.Println("  -set-header <字段>    修改PE头字段（格式: 字段=值,...）")
+	fmt.Println("                        标志: NX_COMPAT, DYNAMIC_BASE, HIGH_ENTROPY_VA, GUARD_CF, FORCE_INTEGRITY,")
+	fmt.Println("                              APPCONTAINER, TERMINAL_SERVER_AWARE, LARGE_ADDRESS_AWARE 等 (on/off)")
+	fmt.Println("                        字段: Subsystem, OSVersion, SubsystemVersion, ImageVersion,")
+	fmt.Println("                              StackReserve, StackCommit, HeapReserve, HeapCommit")
+	fmt.Println("  -clear-guard-cf       关闭CFG检查（清除GUARD_CF）；默认修改入口点/导出时自动更新CFG函数表")
 	fmt.Println("  -entry <地址>         新的入口点地址（十六进制，例如: 0x1000）")
 	fmt.Println("  -inject-section <名>  注入新节区的名称（最大8字符）")
 	fmt.Println("  -section-size <大小>  新节区大小（字节，默认: 4096）")
 	fmt.Println("  -section-perms <RWX>  新节区权限（默认: RWX）")
-	fmt.Println("  -add-import <导入>    添加DLL导入（格式: DLL:Func1,Func2,...）")
-	fmt.Println("  -add-export <名称>    添加导出函数（需配合 -export-rva）")
-	fmt.Println("  -modify-export <名称> 修改导出函数RVA（需配合 -export-rva）")
-	fmt.Println("  -remove-export <名称> 删除导出函数")
+	fmt.Println("  -add-unwind <范围>    为注入的x64代码注册RUNTIME_FUNCTION（例如: 0x5000-0x5080）")
+	fmt.Println("  -unwind-prolog <描述> 序言描述，按执行顺序（例如: push rbp,alloc 0x20,frame rbp）")
+	fmt.Println("  -add-import <导入>    添加DLL导入（格式: DLL:Func1,#23,...，#N 为按序号导入）")
+	fmt.Println("  -import-hints         添加导入时从本地找到的目标DLL导出名称表计算hint")
+	fmt.Println("  -remove-import <导入> 删除导入（DLL 删除整个DLL，DLL:Func1,#23 删除指定函数）")
+	fmt.Println("  -rename-import <旧=新> 重命名导入的DLL（例如: foo.dll=foo_v2.dll），函数不变")
+	fmt.Println("  -redirect-import <规则> 重定向导入函数（DLL:Func=新DLL:新Func，或 DLL:Func=RVA），IAT槽位不变")
+	fmt.Println("  -add-delay-import <导入> 添加延迟加载导入（同上格式，DLL缺失时不影响启动，需已链接 __delayLoadHelper2）")
+	fmt.Println("  -strip-bound-imports  清除导入绑定（从INT恢复IAT）；修改导入表时自动执行")
+	fmt.Println("  -add-export <名称>    添加导出函数（需配合 -export-rva 或 -export-forward，#N 为仅序号导出）")
+	fmt.Println("  -modify-export <名称> 修改导出函数RVA或改为转发（名称或 #N，需配合 -export-rva 或 -export-forward）")
+	fmt.Println("  -remove-export <名称> 删除导出函数（#N 删除该序号及其所有名称），其余序号不变")
 	fmt.Println("  -export-rva <地址>    导出函数RVA地址（十六进制，例如: 0x1000）")
+	fmt.Println("  -export-ordinal <N>   添加导出时指定序号（默认取下一个空闲序号）")
+	fmt.Println("  -export-forward <目标> 转发到其他DLL（DLL.Func 或 DLL.#N，DLL名不带扩展名）")
+	fmt.Println("  -export-dll-name <名称> 设置导出目录中的DLL名称")
+	fmt.Println("  -export-base <N>      设置导出序号基数（不能大于现有最小序号）")
 	fmt.Println("  -remove-signature     移除数字签名")
 	fmt.Println("  -truncate-cert        移除签名时截断证书数据（默认: true，节省空间）")
 	fmt.Println("  -add-tls-callback <RVA> 添加TLS回调函数（RVA地址，十六进制）")
+	fmt.Println("  -rewrite-pdb-path <路径> 改写CodeView记录中的PDB路径（保留GUID/Age，符号仍可匹配）")
+	fmt.Println("  -remove-debug-entry <类型> 删除指定类型的调试条目（逗号分隔，例如: POGO,VC_FEATURE）")
+	fmt.Println("  -strip-debug          删除整个调试目录及其数据（优先于上面两项）")
+	fmt.Println("  -remove-rich          移除Rich头（隐藏编译工具链版本信息）")
+	fmt.Println("  -fix-rich             按当前DOS头和记录重新计算Rich头校验密钥")
+	fmt.Println("  -normalize            可复现构建：COFF/导出/资源/调试/加载配置时间戳改为固定值，")
+	fmt.Println("                        CodeView GUID 由镜像内容哈希派生（默认取 SOURCE_DATE_EPOCH，未设置时为0）")
+	fmt.Println("  -normalize-time <秒>  规范化使用的Unix时间戳（覆盖 SOURCE_DATE_EPOCH）")
+	fmt.Println("  -normalize-rich       规范化时同时移除Rich头")
 	fmt.Println("  -backup               修改前创建备份（默认: true）")
 	fmt.Println("  -update-checksum      修改后更新校验和（默认: true）")
 
@@ -658,32 +1564,59 @@ func printUsage() {
 	fmt.Println("  pepatch -caves program.exe")
 	fmt.Println("  pepatch -caves -min-cave-size 64 program.exe")
 	fmt.Println("  pepatch -list-imports program.exe")
+	fmt.Println("  pepatch -list-functions -v program.exe")
+	fmt.Println("  pepatch -hardening program.exe")
 	fmt.Println("\n  # 依赖分析")
 	fmt.Println("  pepatch -deps program.exe")
 	fmt.Println("  pepatch -deps -max-depth 5 program.exe")
 	fmt.Println("  pepatch -deps -flat program.exe")
+	fmt.Println("\n  # 为没有 .lib 的DLL生成 .def 和导入库")
+	fmt.Println("  pepatch -def thirdparty.def -implib thirdparty.lib thirdparty.dll")
 
 	fmt.Println("\n  # 修改节区权限（安全加固）")
 	fmt.Println("  pepatch -patch -section .text -perms R-X program.exe")
 	fmt.Println("  pepatch -patch -section .data -perms RW- program.exe")
+	fmt.Println("\n  # 修改节区标志")
+	fmt.Println("  pepatch -patch -section .reloc -set-flags MEM_DISCARDABLE program.exe")
+	fmt.Println("  pepatch -patch -section .shared -set-flags MEM_SHARED -clear-flags MEM_EXECUTE program.dll")
+	fmt.Println("\n  # 修改PE头（启用DEP和ASLR）")
+	fmt.Println("  pepatch -patch -set-header NX_COMPAT=on,DYNAMIC_BASE=on legacy.dll")
+	fmt.Println("  pepatch -patch -set-header Subsystem=console,StackReserve=0x400000 program.exe")
 	fmt.Println("\n  # 修改入口点")
 	fmt.Println("  pepatch -patch -entry 0x2000 program.exe")
 	fmt.Println("  pepatch -patch -entry 1A40 program.exe")
+	fmt.Println("  pepatch -patch -entry 0x2000 -clear-guard-cf program.exe  # 关闭CFG而非更新CFG函数表")
 	fmt.Println("\n  # 注入新节区")
 	fmt.Println("  pepatch -patch -inject-section .newsec program.exe")
 	fmt.Println("  pepatch -patch -inject-section .code -section-size 8192 -section-perms R-X program.exe")
+	fmt.Println("\n  # 为注入代码注册展开信息（x64）")
+	fmt.Println("  pepatch -patch -inject-section .code -section-perms R-X program.exe")
+	fmt.Println("  pepatch -patch -add-unwind 0x9000-0x9080 -unwind-prolog \"push rbx,alloc 0x20\" program.exe")
 	fmt.Println("\n  # 添加DLL导入")
 	fmt.Println("  pepatch -patch -add-import user32.dll:MessageBoxA,MessageBoxW program.exe")
 	fmt.Println("  pepatch -patch -add-import ws2_32.dll:WSAStartup,socket,connect program.exe")
+	fmt.Println("  pepatch -patch -add-delay-import plugin.dll:PluginInit,PluginRun program.exe")
 	fmt.Println("\n  # 导出表修改")
 	fmt.Println("  pepatch -patch -add-export MyFunction -export-rva 0x1000 mydll.dll")
 	fmt.Println("  pepatch -patch -modify-export ExistingFunc -export-rva 0x2000 mydll.dll")
 	fmt.Println("  pepatch -patch -remove-export OldFunction mydll.dll")
+	fmt.Println("  pepatch -patch -add-export MyFunction -export-ordinal 42 -export-rva 0x1000 mydll.dll")
+	fmt.Println("  pepatch -patch -modify-export OldFunc -export-forward newlib.NewFunc legacy.dll")
 	fmt.Println("\n  # 数字签名移除")
 	fmt.Println("  pepatch -patch -remove-signature program.exe")
 	fmt.Println("  pepatch -patch -remove-signature -truncate-cert=false program.exe  # 保留证书数据")
 	fmt.Println("\n  # TLS回调注入")
 	fmt.Println("  pepatch -patch -add-tls-callback 0x1000 program.exe")
+	fmt.Println("\n  # 调试信息处理")
+	fmt.Println("  pepatch -patch -rewrite-pdb-path app.pdb program.exe")
+	fmt.Println("  pepatch -patch -remove-debug-entry POGO,VC_FEATURE program.exe")
+	fmt.Println("  pepatch -patch -strip-debug program.exe")
+	fmt.Println("\n  # Rich头处理")
+	fmt.Println("  pepatch -patch -remove-rich program.exe")
+	fmt.Println("  pepatch -patch -fix-rich program.exe")
+	fmt.Println("\n  # 可复现构建")
+	fmt.Println("  SOURCE_DATE_EPOCH=1700000000 pepatch -patch -normalize program.exe")
+	fmt.Println("  pepatch -patch -normalize -normalize-time 0 -normalize-rich program.exe")
 	fmt.Println("\n  # 组合修改")
 	fmt.Println("  pepatch -patch -section .text -perms R-X -entry 0x1000 file.exe")
 	fmt.Println("  pepatch -patch -entry 0x5000 -backup=false file.exe")
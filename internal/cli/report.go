@@ -4,6 +4,7 @@ package cli
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/ZacharyZcR/PEPatch/internal/pe"
 	"github.com/fatih/color"
@@ -39,11 +40,51 @@ func (r *Reporter) Print() {
 	r.printResources()
 	r.printTLS()
 	r.printRelocations()
+	r.printLoadConfig()
+	r.printDebug()
+	r.printRichHeader()
+	r.printExceptions()
 	r.printSections()
 	r.printImports()
+	r.printDelayImports()
+	r.printBoundImports()
 	r.printExports()
 }
 
+// PrintHardening outputs the binary hardening audit.
+func (r *Reporter) PrintHardening() {
+	r.printHeader()
+
+	yellow := color.New(color.FgYellow, color.Bold)
+	_, _ = yellow.Println("\n【安全加固检查】")
+	fmt.Printf("  %-20s: %s\n", "文件路径", r.info.FilePath)
+	fmt.Printf("  %-20s: %s\n", "架构", r.info.Architecture)
+	fmt.Println()
+
+	counts := make(map[pe.HardeningStatus]int)
+	for _, check := range pe.AuditHardening(r.info) {
+		counts[check.Status]++
+
+		statusColor := color.New(color.FgGreen)
+		mark := "✓"
+		switch check.Status {
+		case pe.HardeningWarn:
+			statusColor = color.New(color.FgYellow)
+			mark = "!"
+		case pe.HardeningFail:
+			statusColor = color.New(color.FgRed, color.Bold)
+			mark = "✗"
+		}
+
+		fmt.Print("  ")
+		_, _ = statusColor.Printf("%s %-4s", mark, check.Status)
+		fmt.Printf("  %-28s %s\n", check.Name, check.Detail)
+	}
+
+	fmt.Printf("\n  通过: %d, 警告: %d, 失败: %d\n",
+		counts[pe.HardeningPass], counts[pe.HardeningWarn], counts[pe.HardeningFail])
+}
+
 func (r *Reporter) printHeader() {
 	cyan := color.New(color.FgCyan, color.Bold)
 	_, _ = cyan.Println("\n╔════════════════════════════════════════╗")
@@ -78,6 +119,8 @@ func (r *Reporter) printBasicInfo() {
 		}
 		fmt.Println()
 	}
+
+	r.printBuildInfo()
 }
 
 func (r *Reporter) printSignature() {
@@ -94,14 +137,13 @@ func (r *Reporter) printSignature() {
 		return
 	}
 
-	if len(r.info.Signature.Certificates) == 0 {
+	if r.info.Signature.Signer == nil {
 		red := color.New(color.FgRed)
-		_, _ = red.Println("  ✗ 已签名但无法解析证书")
+		_, _ = red.Println("  ✗ 已签名但找不到签名者的证书")
 		return
 	}
 
-	// Show first certificate (signer)
-	cert := r.info.Signature.Certificates[0]
+	cert := r.info.Signature.Signer
 
 	fmt.Printf("  %-20s: ", "签名者")
 	if cert.IsValid {
@@ -120,6 +162,19 @@ func (r *Reporter) printSignature() {
 	if r.info.Signature.DigestAlgorithm != "" {
 		fmt.Printf("  %-20s: %s\n", "摘要算法", r.info.Signature.DigestAlgorithm)
 	}
+	if ts := r.info.Signature.Timestamper; ts != nil {
+		fmt.Printf("  %-20s: %s (%s)\n", "签名时间",
+			r.info.Signature.SigningTime.Format("2006-01-02 15:04:05"), ts.Subject)
+	}
+
+	fmt.Printf("  %-20s: ", "签名校验")
+	if r.info.Signature.Verified {
+		green := color.New(color.FgGreen)
+		_, _ = green.Println("✓ 签名和映像摘要一致")
+	} else {
+		red := color.New(color.FgRed)
+		_, _ = red.Printf("✗ %s\n", r.info.Signature.VerifyError)
+	}
 
 	// Show certificate chain if available
 	if len(r.info.Signature.Certificates) > 1 {
@@ -266,6 +321,197 @@ func (r *Reporter) printRelocations() {
 	}
 }
 
+func (r *Reporter) printLoadConfig() {
+	lc := r.info.LoadConfig
+	if lc == nil || !lc.HasLoadConfig {
+		return
+	}
+
+	yellow := color.New(color.FgYellow, color.Bold)
+	_, _ = yellow.Println("\n【加载配置】")
+
+	fmt.Printf("  %-20s: %d 字节\n", "结构大小", lc.Size)
+	if lc.SecurityCookie != 0 {
+		fmt.Printf("  %-20s: 0x%X\n", "安全Cookie", lc.SecurityCookie)
+	}
+	if lc.SEHandlerTable != 0 {
+		fmt.Printf("  %-20s: %d 个 (表位于 0x%X)\n", "SafeSEH处理程序", lc.SEHandlerCount, lc.SEHandlerTable)
+	}
+	if lc.GuardFlags != 0 {
+		fmt.Printf("  %-20s: 0x%08X\n", "GuardFlags", lc.GuardFlags)
+		if r.verbose {
+			fmt.Printf("  %-20s  %s\n", "", strings.Join(pe.DescribeGuardFlags(lc.GuardFlags), " | "))
+		}
+	}
+
+	r.printGuardTable("CFG函数表", lc.GuardCFFunctionCount, lc.GuardCFFunctions)
+	r.printGuardTable("CFG IAT表", lc.GuardAddressTakenIatEntryCount, lc.GuardAddressTakenIATEntries)
+	r.printGuardTable("longjmp目标表", lc.GuardLongJumpTargetCount, lc.GuardLongJumpTargets)
+	r.printGuardTable("EH续接表", lc.GuardEHContinuationCount, lc.GuardEHContinuations)
+
+	if dyn := lc.DynamicRelocations; dyn != nil {
+		fmt.Printf("  %-20s: 版本 %d, %d 个条目\n", "动态重定位表", dyn.Version, len(dyn.Entries))
+		if r.verbose {
+			for _, e := range dyn.Entries {
+				fmt.Printf("    - %-34s %s\n", pe.DynamicRelocationSymbolName(e.Symbol), formatSize(int64(e.Size)))
+			}
+		}
+	}
+
+	if chpe := lc.CHPE; chpe != nil {
+		fmt.Printf("  %-20s: 版本 %d, 代码映射 0x%X (%d 项)\n", "CHPE元数据", chpe.Version, chpe.CodeMapRVA, chpe.CodeMapCount)
+	}
+}
+
+func (r *Reporter) printBuildInfo() {
+	dbg := r.info.Debug
+	fmt.Printf("  %-20s: %s\n", "编译时间", formatTimestamp(r.info.TimeDateStamp, dbg != nil && dbg.Reproducible))
+
+	if dbg == nil || dbg.CodeView == nil {
+		return
+	}
+	cv := dbg.CodeView
+	fmt.Printf("  %-20s: %s\n", "PDB路径", cv.PDBPath)
+	if cv.Signature == "RSDS" {
+		fmt.Printf("  %-20s: %s (Age %d)\n", "PDB GUID", cv.GUIDString(), cv.Age)
+	}
+	fmt.Printf("  %-20s: %s\n", "符号服务器键", cv.SymbolKey())
+}
+
+func (r *Reporter) printDebug() {
+	dbg := r.info.Debug
+	if dbg == nil || len(dbg.Entries) == 0 {
+		return
+	}
+
+	yellow := color.New(color.FgYellow, color.Bold)
+	_, _ = yellow.Printf("\n【调试目录】(共 %d 项)\n", len(dbg.Entries))
+
+	for _, e := range dbg.Entries {
+		fmt.Printf("  %-22s %8s  时间戳 %s\n", pe.DebugTypeName(e.Type),
+			formatSize(int64(e.SizeOfData)), formatTimestamp(e.TimeDateStamp, dbg.Reproducible))
+		r.printDebugEntry(e, dbg)
+	}
+}
+
+func (r *Reporter) printDebugEntry(e pe.DebugEntry, dbg *pe.DebugInfo) {
+	switch {
+	case e.CodeView != nil:
+		fmt.Printf("    %-18s: %s\n", e.CodeView.Signature, e.CodeView.PDBPath)
+		if path := e.CodeView.SymbolStorePath(); path != "" {
+			fmt.Printf("    %-18s: %s\n", "符号存储路径", path)
+		}
+	case e.POGO != nil:
+		if e.POGO.Signature != "" {
+			fmt.Printf("    %-18s: %s, %d 项\n", "POGO", e.POGO.Signature, len(e.POGO.Entries))
+		} else {
+			fmt.Printf("    %-18s: %d 项\n", "POGO", len(e.POGO.Entries))
+		}
+		if r.verbose {
+			for _, p := range e.POGO.Entries {
+				fmt.Printf("      0x%08X %8s  %s\n", p.RVA, formatSize(int64(p.Size)), p.Name)
+			}
+		}
+	case e.VCFeature != nil:
+		v := e.VCFeature
+		fmt.Printf("    %-18s: Pre-VC11 %d, C/C++ %d, /GS %d, /sdl %d, guardN %d\n",
+			"VC特性", v.PreVC11, v.CCpp, v.GS, v.SDL, v.GuardN)
+	case e.Repro != nil:
+		if len(e.Repro.Hash) > 0 {
+			fmt.Printf("    %-18s: %x\n", "可复现构建哈希", e.Repro.Hash)
+		} else {
+			fmt.Printf("    %-18s: 是\n", "可复现构建")
+		}
+	case e.EmbeddedPDB != nil:
+		fmt.Printf("    %-18s: %s (压缩后 %s)\n", "嵌入式PDB",
+			formatSize(int64(e.EmbeddedPDB.UncompressedSize)), formatSize(int64(e.EmbeddedPDB.CompressedSize)))
+	case e.PDBChecksum != nil:
+		fmt.Printf("    %-18s: %s %x\n", "PDB校验和", e.PDBChecksum.Algorithm, e.PDBChecksum.Checksum)
+	case e.Type == pe.IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS:
+		flags := pe.DescribeExDllCharacteristics(dbg.ExDllCharacteristics)
+		fmt.Printf("    %-18s: 0x%X %s\n", "扩展DLL特征", dbg.ExDllCharacteristics, strings.Join(flags, " | "))
+	}
+}
+
+func (r *Reporter) printRichHeader() {
+	rich := r.info.RichHeader
+	if rich == nil {
+		return
+	}
+
+	yellow := color.New(color.FgYellow, color.Bold)
+	_, _ = yellow.Printf("\n【Rich头】(共 %d 项)\n", len(rich.Entries))
+
+	fmt.Printf("  %-20s: ", "校验密钥")
+	if rich.Valid() {
+		green := color.New(color.FgGreen)
+		_, _ = green.Printf("✓ 有效 (0x%08X)", rich.Key)
+	} else {
+		red := color.New(color.FgRed, color.Bold)
+		_, _ = red.Printf("✗ 无效 (存储: 0x%08X, 计算: 0x%08X)", rich.Key, rich.ComputedKey)
+	}
+	fmt.Println()
+	fmt.Printf("  %-20s: %s\n", "RichPE哈希", rich.Hash)
+	if linker, ok := rich.Linker(); ok {
+		fmt.Printf("  %-20s: %s build %d (%s)\n", "链接器", linker.ProductName(), linker.BuildID, linker.VisualStudioVersion())
+	}
+
+	for _, e := range rich.Entries {
+		fmt.Printf("  %-22s build %-6d %5d 个  %s\n", e.ProductName(), e.BuildID, e.Count, e.VisualStudioVersion())
+	}
+}
+
+func (r *Reporter) printExceptions() {
+	exc := r.info.Exceptions
+	if exc == nil || !exc.HasExceptions {
+		return
+	}
+
+	yellow := color.New(color.FgYellow, color.Bold)
+	_, _ = yellow.Println("\n【异常目录】")
+
+	fmt.Printf("  %-20s: %d\n", "函数数量", len(exc.Functions))
+	fmt.Printf("  %-20s: %d\n", "含异常处理程序", exc.HandlerCount())
+	if n := exc.ChainedCount(); n > 0 {
+		fmt.Printf("  %-20s: %d\n", "链式展开信息", n)
+	}
+
+	gray := color.New(color.FgHiBlack)
+	_, _ = gray.Println("  (使用 -list-functions 查看所有函数边界和展开信息)")
+}
+
+// formatTimestamp renders a PE timestamp. Deterministic builds store a
+// content hash in the timestamp fields, which is shown as hex instead.
+func formatTimestamp(ts uint32, reproducible bool) string {
+	switch {
+	case ts == 0:
+		return "未设置"
+	case reproducible:
+		return fmt.Sprintf("0x%08X (可复现构建哈希)", ts)
+	default:
+		return time.Unix(int64(ts), 0).UTC().Format("2006-01-02 15:04:05 UTC")
+	}
+}
+
+func (r *Reporter) printGuardTable(name string, count uint64, entries []pe.GuardFunction) {
+	if count == 0 {
+		return
+	}
+
+	fmt.Printf("  %-20s: %d 项\n", name, count)
+	if !r.verbose {
+		return
+	}
+
+	for _, e := range entries {
+		if e.Flags != 0 {
+			fmt.Printf("    0x%08X (标志 0x%02X)\n", e.RVA, e.Flags)
+		} else {
+			fmt.Printf("    0x%08X\n", e.RVA)
+		}
+	}
+}
+
 func (r *Reporter) printSections() {
 	sections := r.info.Sections
 
@@ -273,7 +519,7 @@ func (r *Reporter) printSections() {
 	if r.suspiciousOnly {
 		var suspicious []pe.SectionInfo
 		for _, s := range sections {
-			if s.Permissions == "RWX" {
+			if strings.HasPrefix(s.Permissions, "RWX") {
 				suspicious = append(suspicious, s)
 			}
 		}
@@ -306,9 +552,9 @@ func (r *Reporter) printSections() {
 	for _, section := range sections {
 		// Highlight dangerous permissions (RWX)
 		permColor := color.New(color.FgWhite)
-		if section.Permissions == "RWX" {
+		if strings.HasPrefix(section.Permissions, "RWX") {
 			permColor = color.New(color.FgRed, color.Bold)
-		} else if strings.Contains(section.Permissions, "X") {
+		} else if len(section.Permissions) >= 3 && section.Permissions[2] == 'X' {
 			permColor = color.New(color.FgYellow)
 		}
 
@@ -330,6 +576,11 @@ func (r *Reporter) printSections() {
 		fmt.Print(" ")
 		_, _ = entropyColor.Printf("%-10.6f", section.Entropy)
 		fmt.Printf(" 0x%08X\n", section.Characteristics)
+
+		if r.verbose {
+			flags := pe.DescribeSectionCharacteristics(section.Characteristics)
+			fmt.Printf("  %-10s %s\n", "", strings.Join(flags, " | "))
+		}
 	}
 	fmt.Println(strings.Repeat("-", 110))
 }
@@ -372,33 +623,153 @@ func (r *Reporter) printImports() {
 	fmt.Println()
 }
 
-func (r *Reporter) printExports() {
+func (r *Reporter) printDelayImports() {
+	if len(r.info.DelayImports) == 0 {
+		return
+	}
+
+	yellow := color.New(color.FgYellow, color.Bold)
+	_, _ = yellow.Printf("\n【延迟加载导入】(共 %d 个DLL，首次调用时加载)\n", len(r.info.DelayImports))
+
+	cyan := color.New(color.FgCyan)
+	gray := color.New(color.FgHiBlack)
+	for i, imp := range r.info.DelayImports {
+		funcCount := len(imp.Functions)
+		_, _ = cyan.Printf("  %3d. %s (%d 个函数) [延迟加载]\n", i+1, imp.DLL, funcCount)
+
+		if r.verbose {
+			form := "RVA"
+			if !imp.RVABased() {
+				form = "VA (旧格式)"
+			}
+			fmt.Printf("       格式: %s, IAT: 0x%08X, INT: 0x%08X, 模块句柄: 0x%08X\n",
+				form, imp.IATRVA, imp.INTRVA, imp.ModuleHandleRVA)
+			if imp.Bound() {
+				fmt.Printf("       已绑定 IAT: 0x%08X (时间戳 0x%08X)\n", imp.BoundIATRVA, imp.TimeDateStamp)
+			}
+			if imp.UnloadIATRVA != 0 {
+				fmt.Printf("       卸载 IAT: 0x%08X\n", imp.UnloadIATRVA)
+			}
+		}
+
+		maxDisplay := 10
+		if r.verbose {
+			maxDisplay = funcCount
+		}
+		names := imp.FunctionNames()
+		for j := 0; j < min(funcCount, maxDisplay); j++ {
+			fmt.Printf("       - %s\n", names[j])
+		}
+		if funcCount > maxDisplay {
+			_, _ = gray.Printf("       ... (还有 %d 个函数)\n", funcCount-maxDisplay)
+		}
+	}
+	fmt.Println()
+}
+
+func (r *Reporter) printBoundImports() {
+	bound := r.info.BoundImports
+	if bound == nil {
+		return
+	}
+
 	yellow := color.New(color.FgYellow, color.Bold)
-	_, _ = yellow.Printf("\n【导出表】(共 %d 个函数)\n", len(r.info.Exports))
+	_, _ = yellow.Printf("\n【绑定导入】(%d 个绑定条目，%d 个已绑定描述符)\n", len(bound.Entries), len(bound.Bindings))
+
+	if bound.RVA != 0 {
+		fmt.Printf("  目录: 0x%08X (%d 字节)\n", bound.RVA, bound.Size)
+	}
+	for i, e := range bound.Entries {
+		fmt.Printf("  %3d. %-24s 时间戳 0x%08X\n", i+1, e.DLL, e.TimeDateStamp)
+		for _, fwd := range e.Forwarders {
+			fmt.Printf("       → %-22s 时间戳 0x%08X (转发)\n", fwd.DLL, fwd.TimeDateStamp)
+		}
+	}
+	if r.verbose {
+		for _, b := range bound.Bindings {
+			style := "新式"
+			if !b.NewStyle() {
+				style = fmt.Sprintf("旧式, 时间戳 0x%08X", b.TimeDateStamp)
+			}
+			fmt.Printf("  描述符 %s: %s, ForwarderChain 0x%08X\n", b.DLL, style, b.ForwarderChain)
+		}
+	}
+
+	if len(bound.Issues) == 0 {
+		_, _ = color.New(color.FgGreen).Println("  ✓ 绑定与导入表一致")
+	} else {
+		red := color.New(color.FgRed)
+		for _, issue := range bound.Issues {
+			_, _ = red.Printf("  ✗ %s\n", issue)
+		}
+	}
+	fmt.Println()
+}
 
-	if len(r.info.Exports) == 0 {
+func (r *Reporter) printExports() {
+	yellow := color.New(color.FgYellow, color.Bold)
+	exports := r.info.Exports
+	if exports == nil || len(exports.Functions) == 0 {
+		_, _ = yellow.Println("\n【导出表】(共 0 个函数)")
 		fmt.Println("  未发现导出")
 		return
 	}
 
+	var ordinalOnly, forwarded int
+	var outside []pe.ExportEntry
+	for _, fn := range exports.Functions {
+		switch {
+		case fn.Forwarded():
+			forwarded++
+		case !fn.Executable:
+			outside = append(outside, fn)
+		}
+		if fn.Name == "" {
+			ordinalOnly++
+		}
+	}
+
+	_, _ = yellow.Printf("\n【导出表】(共 %d 个函数)\n", len(exports.Functions))
+	fmt.Printf("  %-20s: %s\n", "DLL名称", exports.DLLName)
+	fmt.Printf("  %-20s: %d\n", "序号基数", exports.Base)
+	fmt.Printf("  %-20s: %d\n", "仅序号导出", ordinalOnly)
+	fmt.Printf("  %-20s: %d\n", "转发导出", forwarded)
+
 	maxDisplay := 20
 	if r.verbose {
-		maxDisplay = len(r.info.Exports) // Show all in verbose mode
+		maxDisplay = len(exports.Functions) // Show all in verbose mode
 	}
 
-	displayCount := len(r.info.Exports)
-	if displayCount > maxDisplay {
-		displayCount = maxDisplay
-	}
+	green := color.New(color.FgGreen)
+	cyan := color.New(color.FgCyan)
+	red := color.New(color.FgRed)
+	for _, fn := range exports.Functions[:min(len(exports.Functions), maxDisplay)] {
+		name := fn.Name
+		if name == "" {
+			name = "[仅序号]"
+		}
+		section := fn.Section
+		if section == "" {
+			section = "-"
+		}
 
-	for i := 0; i < displayCount; i++ {
-		green := color.New(color.FgGreen)
-		_, _ = green.Printf("  %3d. %s\n", i+1, r.info.Exports[i])
+		line := fmt.Sprintf("  @%-5d 0x%08X  %-8s %s", fn.Ordinal, fn.RVA, section, name)
+		switch {
+		case fn.Forwarded():
+			_, _ = cyan.Printf("%s → %s\n", line, fn.Forwarder)
+		case !fn.Executable:
+			_, _ = red.Printf("%s  ⚠ 不在可执行节区\n", line)
+		default:
+			_, _ = green.Println(line)
+		}
 	}
 
-	if len(r.info.Exports) > maxDisplay {
+	if len(exports.Functions) > maxDisplay {
 		gray := color.New(color.FgHiBlack)
-		_, _ = gray.Printf("  ... (还有 %d 个函数)\n", len(r.info.Exports)-maxDisplay)
+		_, _ = gray.Printf("  ... (还有 %d 个函数)\n", len(exports.Functions)-maxDisplay)
+	}
+	if len(outside) > 0 {
+		_, _ = red.Printf("  ⚠ %d 个导出的RVA不在可执行节区（导出的变量，或RVA已失效）\n", len(outside))
 	}
 	fmt.Println()
 }
@@ -0,0 +1,298 @@
+package pe
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"slices"
+)
+
+// allocAlign is the alignment of data placed in slack or appended to a
+// section.
+const allocAlign = 16
+
+// pepatchSections are the names of the sections allocate creates. The last
+// section of the image is grown instead of adding another one if it is one
+// of them; sections injected directly are laid out by their producers and
+// must not be grown.
+var pepatchSections = []string{".idata2", ".edata", ".tlscb", ".gfids", ".reloc2"}
+
+// allocKind tells where an allocation was placed.
+type allocKind int
+
+const (
+	allocReused     allocKind = iota // The old location of the data
+	allocSlack                       // Slack between VirtualSize and SizeOfRawData
+	allocGrown                       // Appended to a pepatch-created last section
+	allocNewSection                  // A new section
+)
+
+// allocRequest describes data to be placed in the image.
+type allocRequest struct {
+	section         string           // Name of the section to create if no space is found
+	size            uint32           // Bytes needed
+	characteristics uint32           // Flags of the new section, required of existing ones
+	old             pe.DataDirectory // Current location of the data, reused if it fits
+}
+
+// allocation is space reserved in the image, zero-filled on disk.
+type allocation struct {
+	RVA     uint32
+	Offset  uint32
+	Section string
+	Kind    allocKind
+}
+
+// allocate finds space for req, in order of preference: the old location
+// when the data fits (it is zeroed first) or can grow into the slack at the
+// end of its section, slack in a section with compatible characteristics,
+// the end of a pepatch-created last section, and finally a new section. The
+// PE file is reloaded before returning, so the space can be addressed by RVA.
+func (p *Patcher) allocate(req allocRequest) (allocation, error) {
+	if req.size == 0 {
+		req.size = allocAlign
+	}
+
+	if a, ok, err := p.reuseOldLocation(req); err != nil || ok {
+		return a, err
+	}
+	if a, ok, err := p.allocateSlack(req); err != nil || ok {
+		return a, err
+	}
+	if a, ok, err := p.growLastSection(req); err != nil || ok {
+		return a, err
+	}
+
+	if err := p.InjectSection(req.section, make([]byte, req.size), req.characteristics); err != nil {
+		return allocation{}, err
+	}
+	if err := p.Reload(); err != nil {
+		return allocation{}, fmt.Errorf("重新加载PE文件失败: %w", err)
+	}
+	sections := p.peFile.Sections
+	s := sections[len(sections)-1]
+	return allocation{RVA: s.VirtualAddress, Offset: s.Offset, Section: s.Name, Kind: allocNewSection}, nil
+}
+
+// reuseOldLocation reclaims the old location of the data if the section
+// holding it is suitable and the new data fits, either in the old size or,
+// when the old data ends the section, by extending it into the slack.
+func (p *Patcher) reuseOldLocation(req allocRequest) (allocation, bool, error) {
+	old := req.old
+	if old.VirtualAddress == 0 || old.Size == 0 {
+		return allocation{}, false, nil
+	}
+
+	sections := p.peFile.Sections
+	for i, s := range sections {
+		if old.VirtualAddress < s.VirtualAddress {
+			continue
+		}
+		start := old.VirtualAddress - s.VirtualAddress
+		if uint64(start)+uint64(old.Size) > uint64(min(s.VirtualSize, s.Size)) {
+			continue
+		}
+		if !sectionAccepts(s, req.characteristics) {
+			return allocation{}, false, nil
+		}
+
+		end := start + req.size
+		if req.size > old.Size {
+			ok, err := p.canGrowOldLocation(sections, i, start+old.Size, end)
+			if err != nil || !ok {
+				return allocation{}, false, err
+			}
+		}
+
+		offset := s.Offset + start
+		if _, err := p.file.WriteAt(make([]byte, old.Size), int64(offset)); err != nil {
+			return allocation{}, false, fmt.Errorf("清除旧数据失败: %w", err)
+		}
+		if end > s.VirtualSize {
+			if err := p.resizeSection(i, end, s.Size); err != nil {
+				return allocation{}, false, err
+			}
+		}
+		return allocation{RVA: old.VirtualAddress, Offset: offset, Section: s.Name, Kind: allocReused}, true, nil
+	}
+	return allocation{}, false, nil
+}
+
+// canGrowOldLocation reports whether data ending at oldEnd in section i can
+// be extended to newEnd: only alignment padding may follow it within the
+// VirtualSize, and the bytes it grows over must be zero slack.
+func (p *Patcher) canGrowOldLocation(sections []*pe.Section, i int, oldEnd, newEnd uint32) (bool, error) {
+	s := sections[i]
+	if alignUp(oldEnd, allocAlign) < s.VirtualSize {
+		return false, nil
+	}
+	_, slackEnd := slackRange(sections, i)
+	if newEnd > max(slackEnd, s.VirtualSize) {
+		return false, nil
+	}
+
+	grown := make([]byte, newEnd-oldEnd)
+	if _, err := p.file.ReadAt(grown, int64(s.Offset+oldEnd)); err != nil {
+		return false, fmt.Errorf("读取节区 %s 失败: %w", s.Name, err)
+	}
+	return bytes.Equal(grown, make([]byte, len(grown))), nil
+}
+
+// allocateSlack places the data in the unused file space after a section's
+// VirtualSize and extends the VirtualSize over it. The slack must be zero
+// so no unmapped data is covered.
+func (p *Patcher) allocateSlack(req allocRequest) (allocation, bool, error) {
+	sections := p.peFile.Sections
+	for i, s := range sections {
+		if !sectionAccepts(s, req.characteristics) {
+			continue
+		}
+		start, end := slackRange(sections, i)
+		if start >= end || end-start < req.size {
+			continue
+		}
+
+		slack := make([]byte, start+req.size-s.VirtualSize)
+		if _, err := p.file.ReadAt(slack, int64(s.Offset+s.VirtualSize)); err != nil {
+			return allocation{}, false, fmt.Errorf("读取节区 %s 失败: %w", s.Name, err)
+		}
+		if !bytes.Equal(slack, make([]byte, len(slack))) {
+			continue
+		}
+
+		if err := p.resizeSection(i, start+req.size, s.Size); err != nil {
+			return allocation{}, false, err
+		}
+		a := allocation{RVA: s.VirtualAddress + start, Offset: s.Offset + start, Section: s.Name, Kind: allocSlack}
+		return a, true, nil
+	}
+	return allocation{}, false, nil
+}
+
+// growLastSection appends the data to the last section if pepatch created it.
+func (p *Patcher) growLastSection(req allocRequest) (allocation, bool, error) {
+	sections := p.peFile.Sections
+	if len(sections) == 0 {
+		return allocation{}, false, nil
+	}
+	i := len(sections) - 1
+	s := sections[i]
+	if !slices.Contains(pepatchSections, s.Name) || !sectionAccepts(s, req.characteristics) {
+		return allocation{}, false, nil
+	}
+
+	fileAlignment, _, err := NewSectionInjector(p).getAlignments()
+	if err != nil {
+		return allocation{}, false, err
+	}
+	start := alignUp(s.VirtualSize, allocAlign)
+	virtualSize := start + req.size
+	rawSize := max(s.Size, alignUp(virtualSize, fileAlignment))
+
+	// The grown raw data is written as zeros, overwriting any overlay like
+	// InjectSection does
+	if rawSize > s.Size {
+		if err := p.ExtendFileSize(int64(s.Offset + rawSize)); err != nil {
+			return allocation{}, false, err
+		}
+		if _, err := p.file.WriteAt(make([]byte, rawSize-s.Size), int64(s.Offset+s.Size)); err != nil {
+			return allocation{}, false, fmt.Errorf("扩展节区 %s 失败: %w", s.Name, err)
+		}
+	}
+
+	if err := p.resizeSection(i, virtualSize, rawSize); err != nil {
+		return allocation{}, false, err
+	}
+	return allocation{RVA: s.VirtualAddress + start, Offset: s.Offset + start, Section: s.Name, Kind: allocGrown}, true, nil
+}
+
+// sectionAccepts reports whether data needing the given characteristics can
+// be placed in s: it must be initialized, have every requested memory
+// permission, and be executable or discardable only if that is requested.
+func sectionAccepts(s *pe.Section, characteristics uint32) bool {
+	const memFlags = pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_WRITE | pe.IMAGE_SCN_MEM_EXECUTE
+	const contents = pe.IMAGE_SCN_CNT_CODE | pe.IMAGE_SCN_CNT_INITIALIZED_DATA
+
+	c := s.Characteristics
+	if s.Offset == 0 || s.Size == 0 || c&contents == 0 {
+		return false
+	}
+	if c&pe.IMAGE_SCN_MEM_DISCARDABLE != 0 && characteristics&pe.IMAGE_SCN_MEM_DISCARDABLE == 0 {
+		return false
+	}
+	want := characteristics & memFlags
+	if c&want != want {
+		return false
+	}
+	return c&pe.IMAGE_SCN_MEM_EXECUTE == want&pe.IMAGE_SCN_MEM_EXECUTE
+}
+
+// slackRange returns the aligned start and the end of the slack in section
+// i, as offsets into the section. The slack is the raw data past the
+// VirtualSize, bounded by the next section's address.
+func slackRange(sections []*pe.Section, i int) (uint32, uint32) {
+	s := sections[i]
+	if s.VirtualSize == 0 || s.VirtualSize >= s.Size {
+		return 0, 0
+	}
+
+	end := s.Size
+	if i+1 < len(sections) {
+		next := sections[i+1].VirtualAddress
+		if next <= s.VirtualAddress {
+			return 0, 0
+		}
+		end = min(end, next-s.VirtualAddress)
+	}
+	return alignUp(s.VirtualSize, allocAlign), end
+}
+
+// resizeSection writes the VirtualSize and SizeOfRawData of section i,
+// extends SizeOfImage if needed and reloads the PE file.
+func (p *Patcher) resizeSection(i int, virtualSize, rawSize uint32) error {
+	peOffset, err := p.peHeaderOffset()
+	if err != nil {
+		return err
+	}
+	coffHeader := make([]byte, 20)
+	if _, err := p.file.ReadAt(coffHeader, peOffset+4); err != nil {
+		return fmt.Errorf("读取COFF头失败: %w", err)
+	}
+	optionalHeaderSize := binary.LittleEndian.Uint16(coffHeader[16:18])
+	headerOffset := peOffset + 4 + 20 + int64(optionalHeaderSize) + int64(i*40)
+
+	field := make([]byte, 4)
+	binary.LittleEndian.PutUint32(field, virtualSize)
+	if _, err := p.file.WriteAt(field, headerOffset+8); err != nil {
+		return fmt.Errorf("更新节区大小失败: %w", err)
+	}
+	binary.LittleEndian.PutUint32(field, rawSize)
+	if _, err := p.file.WriteAt(field, headerOffset+16); err != nil {
+		return fmt.Errorf("更新节区大小失败: %w", err)
+	}
+
+	injector := NewSectionInjector(p)
+	_, sectionAlignment, err := injector.getAlignments()
+	if err != nil {
+		return err
+	}
+	var sizeOfImage uint32
+	switch oh := p.peFile.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		sizeOfImage = oh.SizeOfImage
+	case *pe.OptionalHeader64:
+		sizeOfImage = oh.SizeOfImage
+	}
+	end := alignUp(p.peFile.Sections[i].VirtualAddress+virtualSize, sectionAlignment)
+	if end > sizeOfImage {
+		if err := injector.updateSizeOfImage(peOffset, end); err != nil {
+			return err
+		}
+	}
+
+	if err := p.Reload(); err != nil {
+		return fmt.Errorf("重新加载PE文件失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package pe
+
+import (
+	"debug/pe"
+	"os"
+	"testing"
+)
+
+func TestSectionAccepts(t *testing.T) {
+	const (
+		data = pe.IMAGE_SCN_CNT_INITIALIZED_DATA
+		r    = pe.IMAGE_SCN_MEM_READ
+		w    = pe.IMAGE_SCN_MEM_WRITE
+		x    = pe.IMAGE_SCN_MEM_EXECUTE
+	)
+	section := func(c uint32) *pe.Section {
+		return &pe.Section{SectionHeader: pe.SectionHeader{Offset: 0x400, Size: 0x200, Characteristics: c}}
+	}
+
+	tests := []struct {
+		name    string
+		section *pe.Section
+		want    uint32
+		ok      bool
+	}{
+		{"read-only data", section(data | r), data | r, true},
+		{"writable host for read-only data", section(data | r | w), data | r, true},
+		{"read-only host for writable data", section(data | r), data | r | w, false},
+		{"code section for data", section(pe.IMAGE_SCN_CNT_CODE | r | x), data | r, false},
+		{"code section for code", section(pe.IMAGE_SCN_CNT_CODE | r | x), pe.IMAGE_SCN_CNT_CODE | r | x, true},
+		{"discardable", section(data | r | pe.IMAGE_SCN_MEM_DISCARDABLE), data | r, false},
+		{"discardable for discardable data", section(data | r | pe.IMAGE_SCN_MEM_DISCARDABLE), data | r | pe.IMAGE_SCN_MEM_DISCARDABLE, true},
+		{"uninitialized", section(pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA | r | w), data | r, false},
+		{"no raw data", &pe.Section{SectionHeader: pe.SectionHeader{Characteristics: data | r}}, data | r, false},
+	}
+	for _, tt := range tests {
+		if got := sectionAccepts(tt.section, tt.want); got != tt.ok {
+			t.Errorf("%s: sectionAccepts() = %v, want %v", tt.name, got, tt.ok)
+		}
+	}
+}
+
+func TestSlackRange(t *testing.T) {
+	section := func(va, vsize, size uint32) *pe.Section {
+		return &pe.Section{SectionHeader: pe.SectionHeader{VirtualAddress: va, VirtualSize: vsize, Size: size}}
+	}
+
+	sections := []*pe.Section{
+		section(0x1000, 0x1234, 0x1400), // Slack up to the raw size
+		section(0x3000, 0x100, 0x1200),  // Raw data overlapping the next section's addresses
+		section(0x4000, 0x3000, 0x200),  // VirtualSize beyond the raw data
+		section(0x7000, 0, 0x200),       // No VirtualSize
+		section(0x8000, 0x10, 0x200),    // Last section
+	}
+	want := [][2]uint32{{0x1240, 0x1400}, {0x100, 0x1000}, {0, 0}, {0, 0}, {0x10, 0x200}}
+	for i, w := range want {
+		if start, end := slackRange(sections, i); start != w[0] || end != w[1] {
+			t.Errorf("slackRange(%d) = 0x%X-0x%X, want 0x%X-0x%X", i, start, end, w[0], w[1])
+		}
+	}
+}
+
+func TestOverlapsIAT(t *testing.T) {
+	existing := []ExistingImportData{
+		{Descriptor: ImportDescriptor{FirstThunk: 0x2000}, Functions: []ImportFunction{{Name: "Sleep"}, {Name: "ExitProcess"}}},
+	}
+
+	// Two functions plus the terminator span 0x2000-0x2018
+	if !overlapsIAT(pe.DataDirectory{VirtualAddress: 0x1FF0, Size: 0x20}, existing, 8) {
+		t.Error("directory covering the IAT should overlap")
+	}
+	if overlapsIAT(pe.DataDirectory{VirtualAddress: 0x2018, Size: 0x28}, existing, 8) {
+		t.Error("directory after the IAT should not overlap")
+	}
+}
+
+func TestCanGrowOldLocation(t *testing.T) {
+	tmpfile, err := os.CreateTemp("", "petest-grow-*.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(tmpfile.Name()) }()
+	defer func() { _ = tmpfile.Close() }()
+
+	// Section at file offset 0: data up to 0x1F8, a nonzero byte at 0x300 in
+	// the slack, raw data up to 0x400
+	data := make([]byte, 0x400)
+	data[0x1F7] = 1
+	data[0x300] = 1
+	if _, err := tmpfile.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Patcher{file: tmpfile}
+	sections := []*pe.Section{
+		{SectionHeader: pe.SectionHeader{VirtualAddress: 0x1000, VirtualSize: 0x1F8, Size: 0x400}},
+		{SectionHeader: pe.SectionHeader{VirtualAddress: 0x2000, VirtualSize: 0x100, Size: 0x200}},
+	}
+
+	tests := []struct {
+		name           string
+		oldEnd, newEnd uint32
+		want           bool
+	}{
+		{"into zero slack", 0x1F8, 0x280, true},
+		{"over nonzero slack", 0x1F8, 0x310, false},
+		{"past the raw data", 0x1F8, 0x410, false},
+		{"data follows the old location", 0x100, 0x180, false},
+	}
+	for _, tt := range tests {
+		got, err := p.canGrowOldLocation(sections, 0, tt.oldEnd, tt.newEnd)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: canGrowOldLocation() = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
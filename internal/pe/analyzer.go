@@ -8,20 +8,31 @@ import (
 
 // Info contains analyzed PE file information.
 type Info struct {
-	FilePath     string
-	FileSize     int64
-	Architecture string
-	Subsystem    string
-	EntryPoint   uint64
-	ImageBase    uint64
-	Checksum     *ChecksumInfo
-	Signature    *SignatureInfo
-	Resources    *ResourceInfo
-	TLS          *TLSInfo
-	Relocations  *RelocationInfo
-	Sections     []SectionInfo
-	Imports      []ImportInfo
-	Exports      []string
+	FilePath           string
+	FileSize           int64
+	Architecture       string
+	Machine            uint16
+	Characteristics    uint16
+	TimeDateStamp      uint32
+	DllCharacteristics uint16
+	Is64Bit            bool
+	Subsystem          string
+	EntryPoint         uint64
+	ImageBase          uint64
+	Checksum           *ChecksumInfo
+	Signature          *SignatureInfo
+	Resources          *ResourceInfo
+	TLS                *TLSInfo
+	Relocations        *RelocationInfo
+	LoadConfig         *LoadConfigInfo
+	Debug              *DebugInfo
+	RichHeader         *RichHeader
+	Exceptions         *ExceptionInfo
+	Sections           []SectionInfo
+	Imports            []ImportInfo
+	DelayImports       []DelayImportInfo
+	BoundImports       *BoundImportInfo
+	Exports            *ExportInfo
 }
 
 // SectionInfo contains information about a PE section.
@@ -66,17 +77,27 @@ func (a *Analyzer) Analyze() (*Info, error) {
 
 	a.extractSections(f, info)
 	a.extractImports(f, info)
+	a.extractDelayImports(f, info)
+	a.extractBoundImports(info)
 	a.extractExports(f, info)
 	a.verifyChecksum(f, info)
 	a.verifySignature(f, info)
 	a.parseResources(f, info)
 	a.parseTLS(f, info)
 	a.parseRelocations(f, info)
+	a.parseLoadConfig(f, info)
+	a.parseDebug(f, info)
+	a.parseRichHeader(info)
+	a.parseExceptions(f, info)
 
 	return info, nil
 }
 
 func (a *Analyzer) extractBasicInfo(f *pe.File, info *Info) error {
+	info.Machine = f.Machine
+	info.Characteristics = f.Characteristics
+	info.TimeDateStamp = f.TimeDateStamp
+
 	switch f.Machine {
 	case pe.IMAGE_FILE_MACHINE_I386:
 		info.Architecture = "x86 (32位)"
@@ -94,10 +115,13 @@ func (a *Analyzer) extractBasicInfo(f *pe.File, info *Info) error {
 		info.EntryPoint = uint64(opt.AddressOfEntryPoint)
 		info.ImageBase = uint64(opt.ImageBase)
 		info.Subsystem = getSubsystem(opt.Subsystem)
+		info.DllCharacteristics = opt.DllCharacteristics
 	} else if opt, ok := f.OptionalHeader.(*pe.OptionalHeader64); ok {
 		info.EntryPoint = uint64(opt.AddressOfEntryPoint)
 		info.ImageBase = opt.ImageBase
 		info.Subsystem = getSubsystem(opt.Subsystem)
+		info.DllCharacteristics = opt.DllCharacteristics
+		info.Is64Bit = true
 	}
 
 	return nil
@@ -151,6 +175,15 @@ func (a *Analyzer) extractImports(f *pe.File, info *Info) {
 	}
 }
 
+func (a *Analyzer) extractDelayImports(f *pe.File, info *Info) {
+	// Keep the descriptors parsed before an error on a truncated directory
+	info.DelayImports, _ = ParseDelayImports(f, a.reader.RawFile())
+}
+
+func (a *Analyzer) extractBoundImports(info *Info) {
+	info.BoundImports, _ = ListBoundImportsFromReader(a.reader)
+}
+
 func (a *Analyzer) extractExports(f *pe.File, info *Info) {
 	exports, err := parseExports(f, a.reader.RawFile())
 	if err != nil {
@@ -205,6 +238,42 @@ func (a *Analyzer) parseRelocations(f *pe.File, info *Info) {
 	info.Relocations = relocations
 }
 
+func (a *Analyzer) parseLoadConfig(f *pe.File, info *Info) {
+	loadConfig, err := ParseLoadConfig(f, a.reader.RawFile())
+	if err != nil {
+		// Silently ignore load config parsing errors
+		return
+	}
+	info.LoadConfig = loadConfig
+}
+
+func (a *Analyzer) parseDebug(f *pe.File, info *Info) {
+	debug, err := ParseDebug(f, a.reader.RawFile())
+	if err != nil {
+		// Silently ignore debug directory parsing errors
+		return
+	}
+	info.Debug = debug
+}
+
+func (a *Analyzer) parseRichHeader(info *Info) {
+	rich, err := ParseRichHeader(a.reader.RawFile())
+	if err != nil {
+		// Silently ignore Rich header parsing errors
+		return
+	}
+	info.RichHeader = rich
+}
+
+func (a *Analyzer) parseExceptions(f *pe.File, info *Info) {
+	exceptions, err := ParseExceptionDirectory(f, a.reader.RawFile())
+	if err != nil {
+		// Silently ignore exception directory parsing errors
+		return
+	}
+	info.Exceptions = exceptions
+}
+
 func getSubsystem(subsystem uint16) string {
 	switch subsystem {
 	case pe.IMAGE_SUBSYSTEM_WINDOWS_GUI:
@@ -234,5 +303,24 @@ func getSectionPermissions(c uint32) string {
 		perms[2] = 'X'
 	}
 
-	return string(perms[:])
+	// Append markers for the memory flags that matter at load time:
+	// D=discardable, S=shared, N=not cached, P=not paged.
+	var extra []rune
+	if c&pe.IMAGE_SCN_MEM_DISCARDABLE != 0 {
+		extra = append(extra, 'D')
+	}
+	if c&scnMemShared != 0 {
+		extra = append(extra, 'S')
+	}
+	if c&scnMemNotCached != 0 {
+		extra = append(extra, 'N')
+	}
+	if c&scnMemNotPaged != 0 {
+		extra = append(extra, 'P')
+	}
+
+	if len(extra) == 0 {
+		return string(perms[:])
+	}
+	return string(perms[:]) + " " + string(extra)
 }
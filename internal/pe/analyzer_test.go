@@ -41,6 +41,16 @@ func TestGetSectionPermissions(t *testing.T) {
 			char: 0,
 			want: "---",
 		},
+		{
+			name: "Discardable read only",
+			char: pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_DISCARDABLE,
+			want: "R-- D",
+		},
+		{
+			name: "Shared not paged",
+			char: pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_WRITE | scnMemShared | scnMemNotPaged,
+			want: "RW- SP",
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,333 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Bound import directory constants.
+const (
+	dataDirBoundImport  = 11
+	boundDescriptorSize = 8
+
+	// boundNewStyle in an import descriptor's TimeDateStamp means the IAT was
+	// bound and the binding is described by the bound import directory. Any
+	// other non-zero value is the timestamp of an old-style binding.
+	boundNewStyle = 0xFFFFFFFF
+
+	// maxBoundImportSize bounds the directory read on corrupt images.
+	maxBoundImportSize = 0x10000
+)
+
+// BoundImport is an IMAGE_BOUND_IMPORT_DESCRIPTOR: a DLL the IAT was bound
+// against, with the DLLs its forwarded exports resolved to.
+type BoundImport struct {
+	DLL           string
+	TimeDateStamp uint32 // Timestamp of the DLL the addresses were computed for
+	Forwarders    []BoundForwarder
+}
+
+// BoundForwarder is an IMAGE_BOUND_FORWARDER_REF.
+type BoundForwarder struct {
+	DLL           string
+	TimeDateStamp uint32
+}
+
+// ImportBinding is the binding state of one import descriptor.
+type ImportBinding struct {
+	DLL            string
+	TimeDateStamp  uint32
+	ForwarderChain uint32
+}
+
+// Bound reports whether the loader may use the IAT values as they are.
+func (b ImportBinding) Bound() bool {
+	return b.TimeDateStamp != 0
+}
+
+// NewStyle reports whether the binding is described by the bound import
+// directory rather than by the descriptor alone.
+func (b ImportBinding) NewStyle() bool {
+	return b.TimeDateStamp == boundNewStyle
+}
+
+// BoundImportInfo describes the prebound state of an image.
+type BoundImportInfo struct {
+	RVA      uint32
+	Size     uint32
+	Entries  []BoundImport
+	Bindings []ImportBinding // Import descriptors with a non-zero TimeDateStamp
+	Issues   []string        // Inconsistencies between the two
+}
+
+// headerRVAToOffset converts an RVA to a file offset, also for RVAs inside
+// the headers, where the bound import directory is normally stored.
+func headerRVAToOffset(f *pe.File, rva uint32) (uint32, error) {
+	var sizeOfHeaders uint32
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		sizeOfHeaders = oh.SizeOfHeaders
+	case *pe.OptionalHeader64:
+		sizeOfHeaders = oh.SizeOfHeaders
+	}
+	if rva < sizeOfHeaders {
+		return rva, nil
+	}
+	return rvaToOffset(f, rva)
+}
+
+// ParseBoundImports parses the bound import directory (data directory 11).
+// It returns nil without error when the image has none. Module name offsets
+// are relative to the start of the directory.
+func ParseBoundImports(f *pe.File, r io.ReaderAt) ([]BoundImport, error) {
+	rva, size := dataDirectory(f, dataDirBoundImport)
+	if rva == 0 || size == 0 {
+		return nil, nil
+	}
+
+	offset, err := headerRVAToOffset(f, rva)
+	if err != nil {
+		return nil, fmt.Errorf("定位绑定导入目录失败: %w", err)
+	}
+	buf := make([]byte, min(size, maxBoundImportSize))
+	if _, err := r.ReadAt(buf, int64(offset)); err != nil {
+		return nil, fmt.Errorf("读取绑定导入目录失败: %w", err)
+	}
+
+	le := binary.LittleEndian
+	readName := func(nameOffset uint16) string {
+		name, _ := readCString(r, int64(offset)+int64(nameOffset))
+		return name
+	}
+
+	var entries []BoundImport
+	for pos := 0; pos+boundDescriptorSize <= len(buf); {
+		stamp := le.Uint32(buf[pos:])
+		nameOffset := le.Uint16(buf[pos+4:])
+		forwarders := int(le.Uint16(buf[pos+6:]))
+		if stamp == 0 && nameOffset == 0 {
+			break // Null terminator
+		}
+		pos += boundDescriptorSize
+
+		entry := BoundImport{DLL: readName(nameOffset), TimeDateStamp: stamp}
+		for i := 0; i < forwarders && pos+boundDescriptorSize <= len(buf); i++ {
+			entry.Forwarders = append(entry.Forwarders, BoundForwarder{
+				DLL:           readName(le.Uint16(buf[pos+4:])),
+				TimeDateStamp: le.Uint32(buf[pos:]),
+			})
+			pos += boundDescriptorSize
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// CheckBoundImports compares the bound import directory against the import
+// descriptors of all imported DLLs and describes every mismatch. A binding
+// the loader cannot verify makes it trust IAT values that may be stale.
+func CheckBoundImports(entries []BoundImport, imports []ImportBinding) []string {
+	var issues []string
+
+	bound := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		bound[strings.ToLower(e.DLL)] = true
+	}
+	imported := make(map[string]ImportBinding, len(imports))
+	for _, imp := range imports {
+		imported[strings.ToLower(imp.DLL)] = imp
+		if imp.NewStyle() && !bound[strings.ToLower(imp.DLL)] {
+			issues = append(issues, fmt.Sprintf("%s 的导入描述符标记为新式绑定，但绑定导入目录中没有对应条目", imp.DLL))
+		}
+	}
+
+	for _, e := range entries {
+		imp, ok := imported[strings.ToLower(e.DLL)]
+		switch {
+		case !ok:
+			issues = append(issues, fmt.Sprintf("绑定导入目录中的 %s 不在导入表中", e.DLL))
+		case !imp.NewStyle():
+			issues = append(issues, fmt.Sprintf("绑定导入目录中有 %s，但其导入描述符未标记为新式绑定", e.DLL))
+		}
+	}
+	return issues
+}
+
+// readImportBindings returns the binding state of every import descriptor.
+func (im *ImportModifier) readImportBindings() ([]ImportBinding, error) {
+	importDir, err := im.getImportDirectory()
+	if err != nil {
+		return nil, nil // No imports, nothing bound
+	}
+	descriptors, err := im.readImportDescriptors(importDir)
+	if err != nil {
+		return nil, err
+	}
+
+	bindings := make([]ImportBinding, 0, len(descriptors))
+	for _, desc := range descriptors {
+		dllName, err := im.readString(desc.Name)
+		if err != nil {
+			continue
+		}
+		bindings = append(bindings, ImportBinding{
+			DLL:            dllName,
+			TimeDateStamp:  desc.TimeDateStamp,
+			ForwarderChain: desc.ForwarderChain,
+		})
+	}
+	return bindings, nil
+}
+
+// boundImportInfo combines the bound import directory with the descriptor
+// bindings. It returns nil if neither is present.
+func (im *ImportModifier) boundImportInfo() (*BoundImportInfo, error) {
+	f := im.patcher.peFile
+	entries, err := ParseBoundImports(f, im.patcher.file)
+	if err != nil {
+		return nil, err
+	}
+	imports, err := im.readImportBindings()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &BoundImportInfo{Entries: entries}
+	info.RVA, info.Size = dataDirectory(f, dataDirBoundImport)
+	for _, imp := range imports {
+		if imp.Bound() {
+			info.Bindings = append(info.Bindings, imp)
+		}
+	}
+	if info.RVA == 0 && len(info.Bindings) == 0 {
+		return nil, nil
+	}
+	info.Issues = CheckBoundImports(entries, imports)
+	return info, nil
+}
+
+// stripBoundImports unbinds the image: the bound import directory is cleared,
+// every bound IAT is restored from its INT, and the descriptors' TimeDateStamp
+// and ForwarderChain are reset. It reports whether anything was changed.
+func (im *ImportModifier) stripBoundImports() (bool, error) {
+	p := im.patcher
+	changed := false
+
+	if rva, size := dataDirectory(p.peFile, dataDirBoundImport); rva != 0 || size != 0 {
+		// The data may already have been overwritten by a new section header
+		if offset, err := headerRVAToOffset(p.peFile, rva); err == nil && rva != 0 && size <= maxBoundImportSize {
+			if _, err := p.file.WriteAt(make([]byte, size), int64(offset)); err != nil {
+				return false, fmt.Errorf("清除绑定导入目录失败: %w", err)
+			}
+		}
+		if err := p.setDataDirectory(dataDirBoundImport, 0, 0); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	if importDir, err := im.getImportDirectory(); err == nil {
+		descriptors, err := im.readImportDescriptors(importDir)
+		if err != nil {
+			return false, err
+		}
+		tableOffset, err := im.rvaToOffset(importDir.VirtualAddress)
+		if err != nil {
+			return false, err
+		}
+
+		for i, desc := range descriptors {
+			if desc.TimeDateStamp == 0 {
+				continue
+			}
+			if err := im.restoreIAT(desc); err != nil {
+				return false, err
+			}
+			// Clear TimeDateStamp and ForwarderChain
+			if _, err := p.file.WriteAt(make([]byte, 8), int64(tableOffset)+int64(i*20)+4); err != nil {
+				return false, fmt.Errorf("写入导入描述符失败: %w", err)
+			}
+			changed = true
+		}
+	}
+
+	if !changed {
+		return false, nil
+	}
+	return true, p.Reload()
+}
+
+// restoreIAT copies a descriptor's INT over its IAT, undoing a binding.
+func (im *ImportModifier) restoreIAT(desc ImportDescriptor) error {
+	if desc.OriginalFirstThunk == 0 || desc.OriginalFirstThunk == desc.FirstThunk {
+		dllName, _ := im.readString(desc.Name)
+		return fmt.Errorf("%s 的导入已绑定但没有独立的名称表(INT)，无法解除绑定", dllName)
+	}
+
+	is64bit := im.is64Bit()
+	ptrSize := im.getPtrSize(is64bit)
+	thunks, _, err := im.readImportThunks(desc.OriginalFirstThunk, is64bit)
+	if err != nil {
+		return fmt.Errorf("读取导入名称表失败: %w", err)
+	}
+	iatOffset, err := im.rvaToOffset(desc.FirstThunk)
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, uint32(len(thunks))*ptrSize)
+	for i, thunk := range thunks {
+		im.writeThunkEntry(data, uint32(i)*ptrSize, thunk, is64bit)
+	}
+	if _, err := im.patcher.file.WriteAt(data, int64(iatOffset)); err != nil {
+		return fmt.Errorf("恢复IAT失败: %w", err)
+	}
+	return nil
+}
+
+// ListBoundImports returns the bound import directory, the bound import
+// descriptors and their consistency issues, or nil if the image is unbound.
+func (p *Patcher) ListBoundImports() (*BoundImportInfo, error) {
+	return NewImportModifier(p).boundImportInfo()
+}
+
+// ListBoundImportsFromReader returns the bound import state from a Reader.
+func ListBoundImportsFromReader(reader *Reader) (*BoundImportInfo, error) {
+	modifier := &ImportModifier{
+		patcher: &Patcher{
+			file:   reader.RawFile(),
+			peFile: reader.File(),
+		},
+	}
+	return modifier.boundImportInfo()
+}
+
+// StripBoundImports removes all import bindings so the loader resolves every
+// import itself. It reports whether the image was bound. Import-modifying
+// operations call it automatically, since a rebuilt import table invalidates
+// the bindings.
+func (p *Patcher) StripBoundImports() (bool, error) {
+	return NewImportModifier(p).stripBoundImports()
+}
+
+// stripBoundImportsOverlapping unbinds the image if the bound import
+// directory overlaps the file range [start, end), which is about to be
+// overwritten. The change is refused if the image cannot be unbound.
+func (p *Patcher) stripBoundImportsOverlapping(start, end int64) error {
+	rva, size := dataDirectory(p.peFile, dataDirBoundImport)
+	if rva == 0 || size == 0 {
+		return nil
+	}
+	offset, err := headerRVAToOffset(p.peFile, rva)
+	if err != nil || int64(offset) >= end || int64(offset)+int64(size) <= start {
+		return nil
+	}
+
+	if _, err := p.StripBoundImports(); err != nil {
+		return fmt.Errorf("绑定导入数据会被覆盖，解除导入绑定失败: %w", err)
+	}
+	return nil
+}
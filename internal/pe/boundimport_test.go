@@ -0,0 +1,118 @@
+package pe
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestParseBoundImports(t *testing.T) {
+	le := binary.LittleEndian
+	data := make([]byte, 0x400)
+
+	// Directory in the headers at 0x200: kernel32 with one forwarder to
+	// ntdll, then user32, then the terminator, then the names
+	dir := data[0x200:]
+	le.PutUint32(dir[0:], 0x4A5BC60F)
+	le.PutUint16(dir[4:], 0x20)
+	le.PutUint16(dir[6:], 1)
+	le.PutUint32(dir[8:], 0x4A5BDB3C)
+	le.PutUint16(dir[12:], 0x2D)
+	le.PutUint32(dir[16:], 0x4A5BDA6D)
+	le.PutUint16(dir[20:], 0x37)
+	copy(dir[0x20:], "KERNEL32.dll\x00ntdll.dll\x00USER32.dll\x00")
+
+	oh := &pe.OptionalHeader32{SizeOfHeaders: 0x400, NumberOfRvaAndSizes: 16}
+	oh.DataDirectory[dataDirBoundImport] = pe.DataDirectory{VirtualAddress: 0x200, Size: 0x42}
+	f := &pe.File{OptionalHeader: oh}
+
+	got, err := ParseBoundImports(f, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ParseBoundImports() error = %v", err)
+	}
+	want := []BoundImport{
+		{DLL: "KERNEL32.dll", TimeDateStamp: 0x4A5BC60F, Forwarders: []BoundForwarder{{DLL: "ntdll.dll", TimeDateStamp: 0x4A5BDB3C}}},
+		{DLL: "USER32.dll", TimeDateStamp: 0x4A5BDA6D},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseBoundImports() = %+v, want %+v", got, want)
+	}
+
+	oh.DataDirectory[dataDirBoundImport] = pe.DataDirectory{}
+	if got, err := ParseBoundImports(f, bytes.NewReader(data)); got != nil || err != nil {
+		t.Errorf("ParseBoundImports(no directory) = %v, %v; want nil, nil", got, err)
+	}
+}
+
+func TestCheckBoundImports(t *testing.T) {
+	entries := []BoundImport{{DLL: "KERNEL32.dll"}, {DLL: "user32.dll"}}
+
+	consistent := []ImportBinding{
+		{DLL: "kernel32.dll", TimeDateStamp: boundNewStyle},
+		{DLL: "USER32.dll", TimeDateStamp: boundNewStyle},
+		{DLL: "msvcrt.dll"},
+	}
+	if issues := CheckBoundImports(entries, consistent); len(issues) != 0 {
+		t.Errorf("CheckBoundImports(consistent) = %v", issues)
+	}
+
+	// A rebuilt table that cleared the descriptors but left the directory,
+	// plus a new-style descriptor without an entry and a stray entry
+	stale := []ImportBinding{
+		{DLL: "kernel32.dll"},
+		{DLL: "advapi32.dll", TimeDateStamp: boundNewStyle},
+	}
+	if issues := CheckBoundImports(entries, stale); len(issues) != 3 {
+		t.Errorf("CheckBoundImports(stale) = %v, want 3 issues", issues)
+	}
+
+	// Old-style bindings are only described by the descriptor
+	oldStyle := []ImportBinding{{DLL: "kernel32.dll", TimeDateStamp: 0x3B7DFE0E, ForwarderChain: 0xFFFFFFFF}}
+	if issues := CheckBoundImports(nil, oldStyle); len(issues) != 0 || !oldStyle[0].Bound() || oldStyle[0].NewStyle() {
+		t.Errorf("CheckBoundImports(old-style) = %v", issues)
+	}
+}
+
+func TestInjectSectionStripsBoundImports(t *testing.T) {
+	// The section table of a one-section image with 16 directories ends at
+	// 0x170; the next header goes there
+	for _, tt := range []struct {
+		rva       uint32
+		wantStrip bool
+	}{
+		{0x170, true},
+		{0x180, true},
+		{0x198, false},
+	} {
+		p := newTestPatcher(t, 16, testSection{
+			name:            ".rdata",
+			characteristics: pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ,
+		})
+		if _, err := p.file.WriteAt([]byte("\x0e\xfe\x7d\x3b\x10\x00\x00\x00kernel32.dll\x00"), int64(tt.rva)); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.setDataDirectory(dataDirBoundImport, tt.rva, 0x18); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Reload(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := p.InjectSection(".new", []byte{1}, pe.IMAGE_SCN_CNT_INITIALIZED_DATA|pe.IMAGE_SCN_MEM_READ); err != nil {
+			t.Fatalf("InjectSection() error = %v", err)
+		}
+		if err := p.Reload(); err != nil {
+			t.Fatal(err)
+		}
+
+		rva, size := dataDirectory(p.File(), dataDirBoundImport)
+		if stripped := rva == 0 && size == 0; stripped != tt.wantStrip {
+			t.Errorf("bound imports at 0x%X: directory = 0x%X/0x%X, want stripped %v", tt.rva, rva, size, tt.wantStrip)
+		}
+		if n := len(p.File().Sections); n != 2 || p.File().Sections[1].Name != ".new" {
+			t.Errorf("bound imports at 0x%X: %d sections after InjectSection", tt.rva, n)
+		}
+	}
+}
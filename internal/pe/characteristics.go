@@ -0,0 +1,217 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Section alignment field (only meaningful in object files, but linkers
+// occasionally leave it set in images).
+const (
+	sectionAlignMask  = 0x00F00000
+	sectionAlignShift = 20
+)
+
+// Extra section characteristics not defined by debug/pe.
+const (
+	scnLnkNRelocOvfl = 0x01000000
+	scnMemNotCached  = 0x04000000
+	scnMemNotPaged   = 0x08000000
+	scnMemShared     = 0x10000000
+)
+
+// sectionFlag describes a single named section characteristic bit.
+type sectionFlag struct {
+	Name string
+	Mask uint32
+}
+
+// sectionFlags lists named section characteristics in display order.
+var sectionFlags = []sectionFlag{
+	{"CNT_CODE", pe.IMAGE_SCN_CNT_CODE},
+	{"CNT_INITIALIZED_DATA", pe.IMAGE_SCN_CNT_INITIALIZED_DATA},
+	{"CNT_UNINITIALIZED_DATA", pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA},
+	{"LNK_NRELOC_OVFL", scnLnkNRelocOvfl},
+	{"MEM_DISCARDABLE", pe.IMAGE_SCN_MEM_DISCARDABLE},
+	{"MEM_NOT_CACHED", scnMemNotCached},
+	{"MEM_NOT_PAGED", scnMemNotPaged},
+	{"MEM_SHARED", scnMemShared},
+	{"MEM_EXECUTE", pe.IMAGE_SCN_MEM_EXECUTE},
+	{"MEM_READ", pe.IMAGE_SCN_MEM_READ},
+	{"MEM_WRITE", pe.IMAGE_SCN_MEM_WRITE},
+}
+
+// ParseSectionFlags parses a list of section characteristics.
+// Items are separated by ',' or '|' and may be flag names (with or without
+// the IMAGE_SCN_ / MEM_ / CNT_ prefix, e.g. MEM_DISCARDABLE, DISCARDABLE),
+// alignment names (ALIGN_16BYTES) or raw hex masks (0x02000000).
+func ParseSectionFlags(spec string) (uint32, error) {
+	var mask uint32
+
+	items := strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '|' })
+	if len(items) == 0 {
+		return 0, fmt.Errorf("未指定节区标志")
+	}
+
+	for _, item := range items {
+		value, err := parseSectionFlag(strings.TrimSpace(item))
+		if err != nil {
+			return 0, err
+		}
+		if value&sectionAlignMask != 0 && mask&sectionAlignMask != 0 && value&sectionAlignMask != mask&sectionAlignMask {
+			return 0, fmt.Errorf("只能指定一个对齐标志: %s", item)
+		}
+		mask |= value
+	}
+
+	return mask, nil
+}
+
+func parseSectionFlag(item string) (uint32, error) {
+	if strings.HasPrefix(item, "0x") || strings.HasPrefix(item, "0X") {
+		value, err := strconv.ParseUint(item[2:], 16, 32)
+		if err != nil {
+			return 0, fmt.Errorf("节区标志掩码格式错误: %s", item)
+		}
+		return uint32(value), nil
+	}
+
+	name := strings.TrimPrefix(strings.ToUpper(item), "IMAGE_SCN_")
+
+	if strings.HasPrefix(name, "ALIGN_") {
+		return parseSectionAlignment(name)
+	}
+
+	for _, flag := range sectionFlags {
+		if name == flag.Name || name == flag.Name[strings.Index(flag.Name, "_")+1:] {
+			return flag.Mask, nil
+		}
+	}
+
+	return 0, fmt.Errorf("未知的节区标志: %s", item)
+}
+
+// parseSectionAlignment converts ALIGN_<n>BYTES to its encoded field value.
+func parseSectionAlignment(name string) (uint32, error) {
+	bytesStr := strings.TrimSuffix(strings.TrimPrefix(name, "ALIGN_"), "BYTES")
+	n, err := strconv.ParseUint(bytesStr, 10, 32)
+	if err != nil || n == 0 || n > 8192 || n&(n-1) != 0 {
+		return 0, fmt.Errorf("无效的对齐标志: %s (应为 ALIGN_1BYTES 到 ALIGN_8192BYTES)", name)
+	}
+
+	encoded := uint32(1)
+	for v := n; v > 1; v >>= 1 {
+		encoded++
+	}
+	return encoded << sectionAlignShift, nil
+}
+
+// ApplySectionFlags sets and clears characteristics on an existing value.
+// The alignment field is treated as a single value: setting an alignment
+// replaces the current one, clearing any alignment clears the whole field.
+func ApplySectionFlags(current, set, clear uint32) uint32 {
+	result := current &^ (clear &^ sectionAlignMask)
+	if clear&sectionAlignMask != 0 {
+		result &^= sectionAlignMask
+	}
+
+	if set&sectionAlignMask != 0 {
+		result = result&^sectionAlignMask | set&sectionAlignMask
+	}
+	return result | set&^sectionAlignMask
+}
+
+// ValidateSectionCharacteristics rejects flag combinations that make no sense.
+func ValidateSectionCharacteristics(c uint32) error {
+	if c&pe.IMAGE_SCN_CNT_CODE != 0 && c&pe.IMAGE_SCN_MEM_EXECUTE == 0 {
+		return fmt.Errorf("CNT_CODE 节区必须同时具有 MEM_EXECUTE")
+	}
+	if c&pe.IMAGE_SCN_CNT_CODE != 0 && c&pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA != 0 {
+		return fmt.Errorf("CNT_CODE 与 CNT_UNINITIALIZED_DATA 不能同时设置")
+	}
+	if c&pe.IMAGE_SCN_CNT_INITIALIZED_DATA != 0 && c&pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA != 0 {
+		return fmt.Errorf("CNT_INITIALIZED_DATA 与 CNT_UNINITIALIZED_DATA 不能同时设置")
+	}
+	if c&sectionAlignMask == sectionAlignMask {
+		return fmt.Errorf("无效的对齐字段: 0x%X", c&sectionAlignMask)
+	}
+	return nil
+}
+
+// DescribeSectionCharacteristics decodes characteristics into flag names.
+func DescribeSectionCharacteristics(c uint32) []string {
+	var names []string
+
+	for _, flag := range sectionFlags {
+		if c&flag.Mask != 0 {
+			names = append(names, flag.Name)
+		}
+	}
+
+	if align := (c & sectionAlignMask) >> sectionAlignShift; align != 0 && align != 0xF {
+		names = append(names, fmt.Sprintf("ALIGN_%dBYTES", 1<<(align-1)))
+	}
+
+	known := uint32(sectionAlignMask)
+	for _, flag := range sectionFlags {
+		known |= flag.Mask
+	}
+	if unknown := c &^ known; unknown != 0 {
+		names = append(names, fmt.Sprintf("0x%08X", unknown))
+	}
+
+	return names
+}
+
+// ModifySectionCharacteristics sets and clears characteristics of a section.
+// The current characteristics are read from the file, so earlier edits in the
+// same session are kept.
+func (p *Patcher) ModifySectionCharacteristics(sectionName string, set, clear uint32) error {
+	index := -1
+	for i, s := range p.peFile.Sections {
+		if s.Name == sectionName {
+			index = i
+			break
+		}
+	}
+
+	if index < 0 {
+		return fmt.Errorf("未找到节区: %s", sectionName)
+	}
+
+	current, err := p.readSectionCharacteristics(index)
+	if err != nil {
+		return err
+	}
+
+	newChars := ApplySectionFlags(current, set, clear)
+	if err := ValidateSectionCharacteristics(newChars); err != nil {
+		return fmt.Errorf("节区 %s 标志组合无效: %w", sectionName, err)
+	}
+
+	return p.PatchSectionPermissions(sectionName, newChars)
+}
+
+// readSectionCharacteristics reads the Characteristics field of section i
+// from the section table on disk.
+func (p *Patcher) readSectionCharacteristics(i int) (uint32, error) {
+	peOffset, err := p.peHeaderOffset()
+	if err != nil {
+		return 0, err
+	}
+	coffHeader := make([]byte, 20)
+	if _, err := p.file.ReadAt(coffHeader, peOffset+4); err != nil {
+		return 0, fmt.Errorf("读取COFF头失败: %w", err)
+	}
+	optionalHeaderSize := binary.LittleEndian.Uint16(coffHeader[16:18])
+	headerOffset := peOffset + 4 + 20 + int64(optionalHeaderSize) + int64(i*40)
+
+	field := make([]byte, 4)
+	if _, err := p.file.ReadAt(field, headerOffset+36); err != nil {
+		return 0, fmt.Errorf("读取节区特征失败: %w", err)
+	}
+	return binary.LittleEndian.Uint32(field), nil
+}
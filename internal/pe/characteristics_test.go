@@ -0,0 +1,96 @@
+package pe
+
+import (
+	"debug/pe"
+	"reflect"
+	"testing"
+)
+
+func TestParseSectionFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    uint32
+		wantErr bool
+	}{
+		{"Full name", "IMAGE_SCN_MEM_DISCARDABLE", pe.IMAGE_SCN_MEM_DISCARDABLE, false},
+		{"Short name", "discardable,shared", pe.IMAGE_SCN_MEM_DISCARDABLE | scnMemShared, false},
+		{"Pipe separator", "CNT_CODE|MEM_EXECUTE", pe.IMAGE_SCN_CNT_CODE | pe.IMAGE_SCN_MEM_EXECUTE, false},
+		{"Hex mask", "0x08000000", scnMemNotPaged, false},
+		{"Alignment", "ALIGN_16BYTES", 0x00500000, false},
+		{"Alignment 8192", "ALIGN_8192BYTES", 0x00E00000, false},
+		{"Invalid alignment", "ALIGN_3BYTES", 0, true},
+		{"Two alignments", "ALIGN_4BYTES,ALIGN_8BYTES", 0, true},
+		{"Unknown name", "MEM_FAST", 0, true},
+		{"Bad hex", "0xZZ", 0, true},
+		{"Empty", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSectionFlags(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSectionFlags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSectionFlags() = 0x%08X, want 0x%08X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplySectionFlags(t *testing.T) {
+	const textChars = pe.IMAGE_SCN_CNT_CODE | pe.IMAGE_SCN_MEM_EXECUTE | pe.IMAGE_SCN_MEM_READ | 0x00500000
+
+	tests := []struct {
+		name       string
+		set, clear uint32
+		want       uint32
+	}{
+		{"Set discardable", pe.IMAGE_SCN_MEM_DISCARDABLE, 0, textChars | pe.IMAGE_SCN_MEM_DISCARDABLE},
+		{"Clear read", 0, pe.IMAGE_SCN_MEM_READ, textChars &^ pe.IMAGE_SCN_MEM_READ},
+		{"Replace alignment", 0x00100000, 0, textChars&^sectionAlignMask | 0x00100000},
+		{"Clear alignment", 0, 0x00100000, textChars &^ sectionAlignMask},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ApplySectionFlags(textChars, tt.set, tt.clear); got != tt.want {
+				t.Errorf("ApplySectionFlags() = 0x%08X, want 0x%08X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSectionCharacteristics(t *testing.T) {
+	tests := []struct {
+		name    string
+		chars   uint32
+		wantErr bool
+	}{
+		{"Code section", pe.IMAGE_SCN_CNT_CODE | pe.IMAGE_SCN_MEM_EXECUTE | pe.IMAGE_SCN_MEM_READ, false},
+		{"Data section", pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ, false},
+		{"Code without execute", pe.IMAGE_SCN_CNT_CODE | pe.IMAGE_SCN_MEM_READ, true},
+		{"Code and bss", pe.IMAGE_SCN_CNT_CODE | pe.IMAGE_SCN_MEM_EXECUTE | pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA, true},
+		{"Data and bss", pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA, true},
+		{"Reserved alignment", pe.IMAGE_SCN_MEM_READ | sectionAlignMask, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSectionCharacteristics(tt.chars)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSectionCharacteristics() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDescribeSectionCharacteristics(t *testing.T) {
+	got := DescribeSectionCharacteristics(0x42100040 | 0x00000008)
+	want := []string{"CNT_INITIALIZED_DATA", "MEM_DISCARDABLE", "MEM_READ", "ALIGN_1BYTES", "0x00000008"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DescribeSectionCharacteristics() = %v, want %v", got, want)
+	}
+}
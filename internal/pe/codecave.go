@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"sort"
 )
 
 // CodeCave represents a usable code cave in a PE file.
@@ -32,20 +33,63 @@ func NewCodeCaveDetector(file io.ReaderAt, peFile *pe.File) *CodeCaveDetector {
 
 // FindCodeCaves searches for code caves in all sections.
 // minSize specifies the minimum cave size in bytes.
+// On x64 and ARM64, fill bytes inside function bodies listed in the
+// exception directory are not reported.
 func (d *CodeCaveDetector) FindCodeCaves(minSize uint32) ([]CodeCave, error) {
 	var caves []CodeCave
 
+	exceptions, err := ParseExceptionDirectory(d.peFile, d.file)
+	if err != nil {
+		exceptions = nil
+	}
+
 	for _, section := range d.peFile.Sections {
 		sectionCaves, err := d.findInSection(section, minSize)
 		if err != nil {
 			return nil, fmt.Errorf("扫描节区 %s 失败: %w", section.Name, err)
 		}
+		if exceptions != nil && len(exceptions.Functions) > 0 {
+			sectionCaves = excludeFunctionBodies(sectionCaves, exceptions.Functions, minSize)
+		}
 		caves = append(caves, sectionCaves...)
 	}
 
 	return caves, nil
 }
 
+// excludeFunctionBodies trims caves to the gaps between functions. Zero runs
+// inside a function are usually embedded constants or jump tables, not
+// free space. functions must be sorted by BeginAddress.
+func excludeFunctionBodies(caves []CodeCave, functions []RuntimeFunction, minSize uint32) []CodeCave {
+	var result []CodeCave
+	for _, cave := range caves {
+		start, end := cave.RVA, cave.RVA+cave.Size
+
+		i := sort.Search(len(functions), func(i int) bool {
+			return functions[i].EndAddress > start
+		})
+		for ; i < len(functions) && functions[i].BeginAddress < end; i++ {
+			if functions[i].BeginAddress > start {
+				result = appendCavePart(result, cave, start, functions[i].BeginAddress, minSize)
+			}
+			start = max(start, functions[i].EndAddress)
+		}
+		result = appendCavePart(result, cave, start, end, minSize)
+	}
+	return result
+}
+
+func appendCavePart(caves []CodeCave, cave CodeCave, start, end, minSize uint32) []CodeCave {
+	if end <= start || end-start < minSize {
+		return caves
+	}
+	part := cave
+	part.Offset += start - cave.RVA
+	part.RVA = start
+	part.Size = end - start
+	return append(caves, part)
+}
+
 // findInSection searches for code caves in a specific section.
 func (d *CodeCaveDetector) findInSection(section *pe.Section, minSize uint32) ([]CodeCave, error) {
 	// Read section data.
@@ -0,0 +1,458 @@
+package pe
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Debug directory entry types (Windows SDK naming convention).
+//
+//nolint:revive // ALL_CAPS matches Windows SDK naming
+const (
+	IMAGE_DEBUG_TYPE_UNKNOWN               = 0
+	IMAGE_DEBUG_TYPE_COFF                  = 1
+	IMAGE_DEBUG_TYPE_CODEVIEW              = 2
+	IMAGE_DEBUG_TYPE_FPO                   = 3
+	IMAGE_DEBUG_TYPE_MISC                  = 4
+	IMAGE_DEBUG_TYPE_EXCEPTION             = 5
+	IMAGE_DEBUG_TYPE_FIXUP                 = 6
+	IMAGE_DEBUG_TYPE_OMAP_TO_SRC           = 7
+	IMAGE_DEBUG_TYPE_OMAP_FROM_SRC         = 8
+	IMAGE_DEBUG_TYPE_BORLAND               = 9
+	IMAGE_DEBUG_TYPE_RESERVED10            = 10
+	IMAGE_DEBUG_TYPE_CLSID                 = 11
+	IMAGE_DEBUG_TYPE_VC_FEATURE            = 12
+	IMAGE_DEBUG_TYPE_POGO                  = 13
+	IMAGE_DEBUG_TYPE_ILTCG                 = 14
+	IMAGE_DEBUG_TYPE_MPX                   = 15
+	IMAGE_DEBUG_TYPE_REPRO                 = 16
+	IMAGE_DEBUG_TYPE_EMBEDDED_PORTABLE_PDB = 17
+	IMAGE_DEBUG_TYPE_PDBCHECKSUM           = 19
+	IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS = 20
+)
+
+// Extended DLL characteristics stored in the EX_DLLCHARACTERISTICS debug entry.
+//
+//nolint:revive // ALL_CAPS matches Windows SDK naming
+const (
+	IMAGE_DLLCHARACTERISTICS_EX_CET_COMPAT                                 = 0x01
+	IMAGE_DLLCHARACTERISTICS_EX_CET_COMPAT_STRICT_MODE                     = 0x02
+	IMAGE_DLLCHARACTERISTICS_EX_CET_SET_CONTEXT_IP_VALIDATION_RELAXED_MODE = 0x04
+	IMAGE_DLLCHARACTERISTICS_EX_CET_DYNAMIC_APIS_ALLOW_IN_PROC             = 0x08
+	IMAGE_DLLCHARACTERISTICS_EX_FORWARD_CFI_COMPAT                         = 0x40
+)
+
+// debugDirectoryEntrySize is sizeof(IMAGE_DEBUG_DIRECTORY).
+const debugDirectoryEntrySize = 28
+
+// maxDebugDataSize caps how much of a single debug entry is read.
+// Embedded portable PDBs can be large; only their header is decoded.
+const maxDebugDataSize = 64 * 1024
+
+// CodeView record signatures.
+const (
+	codeViewRSDS = "RSDS"
+	codeViewNB10 = "NB10"
+)
+
+// embeddedPDBSignature starts an EMBEDDED_PORTABLE_PDB entry.
+const embeddedPDBSignature = "MPDB"
+
+// DebugInfo contains debug directory information.
+type DebugInfo struct {
+	Entries              []DebugEntry
+	ExDllCharacteristics uint32
+	// CodeView is the first CodeView record, the one debuggers use.
+	CodeView *CodeViewInfo
+	// Reproducible is set when a REPRO entry marks a deterministic build,
+	// in which case timestamps are content hashes rather than times.
+	Reproducible bool
+}
+
+// DebugEntry is a single IMAGE_DEBUG_DIRECTORY entry.
+type DebugEntry struct {
+	Characteristics  uint32
+	TimeDateStamp    uint32
+	MajorVersion     uint16
+	MinorVersion     uint16
+	Type             uint32
+	SizeOfData       uint32
+	AddressOfRawData uint32
+	PointerToRawData uint32
+
+	// Decoded payloads; at most one is set, depending on Type.
+	CodeView    *CodeViewInfo
+	POGO        *POGOInfo
+	VCFeature   *VCFeatureInfo
+	Repro       *ReproInfo
+	EmbeddedPDB *EmbeddedPDBInfo
+	PDBChecksum *PDBChecksumInfo
+}
+
+// CodeViewInfo is a decoded CodeView (RSDS or NB10) record.
+type CodeViewInfo struct {
+	Signature string // "RSDS" or "NB10"
+	GUID      [16]byte
+	Age       uint32
+	// PDBSignature is the NB10 timestamp signature (NB10 only).
+	PDBSignature uint32
+	PDBPath      string
+}
+
+// POGOInfo is a decoded profile-guided optimization (POGO) record.
+type POGOInfo struct {
+	Signature string // "LTCG", "PGU", "PGI", ...
+	Entries   []POGOEntry
+}
+
+// POGOEntry describes one contribution to the image layout.
+type POGOEntry struct {
+	RVA  uint32
+	Size uint32
+	Name string
+}
+
+// VCFeatureInfo holds the VC_FEATURE object file counters.
+type VCFeatureInfo struct {
+	PreVC11 uint32
+	CCpp    uint32
+	GS      uint32
+	SDL     uint32
+	GuardN  uint32
+}
+
+// ReproInfo is a decoded REPRO record. Hash is empty for older linkers
+// that only emit the marker.
+type ReproInfo struct {
+	Hash []byte
+}
+
+// EmbeddedPDBInfo describes a deflate-compressed portable PDB stored in the image.
+type EmbeddedPDBInfo struct {
+	UncompressedSize uint32
+	CompressedSize   uint32
+}
+
+// PDBChecksumInfo is a decoded PDBCHECKSUM record.
+type PDBChecksumInfo struct {
+	Algorithm string
+	Checksum  []byte
+}
+
+// ParseDebug extracts debug directory information from PE file.
+func ParseDebug(f *pe.File, r io.ReaderAt) (*DebugInfo, error) {
+	info := &DebugInfo{}
+
+	// Get Debug Directory (Data Directory[6])
+	dirRVA, dirSize := dataDirectory(f, pe.IMAGE_DIRECTORY_ENTRY_DEBUG)
+	if dirRVA == 0 || dirSize == 0 {
+		return info, nil
+	}
+
+	offset, err := rvaToOffset(f, dirRVA)
+	if err != nil {
+		return info, err
+	}
+
+	count := dirSize / debugDirectoryEntrySize
+	for i := uint32(0); i < count; i++ {
+		var raw [debugDirectoryEntrySize]byte
+		if _, err := r.ReadAt(raw[:], int64(offset+i*debugDirectoryEntrySize)); err != nil {
+			return info, fmt.Errorf("读取调试目录失败: %w", err)
+		}
+
+		entry := decodeDebugEntry(raw[:])
+		decodeDebugData(f, r, &entry)
+		info.Entries = append(info.Entries, entry)
+
+		switch entry.Type {
+		case IMAGE_DEBUG_TYPE_CODEVIEW:
+			if info.CodeView == nil {
+				info.CodeView = entry.CodeView
+			}
+		case IMAGE_DEBUG_TYPE_REPRO:
+			info.Reproducible = true
+		case IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS:
+			if data := readDebugData(f, r, &entry, 4); len(data) >= 4 {
+				info.ExDllCharacteristics = binary.LittleEndian.Uint32(data)
+			}
+		}
+	}
+
+	return info, nil
+}
+
+func decodeDebugEntry(raw []byte) DebugEntry {
+	le := binary.LittleEndian
+	return DebugEntry{
+		Characteristics:  le.Uint32(raw[0:]),
+		TimeDateStamp:    le.Uint32(raw[4:]),
+		MajorVersion:     le.Uint16(raw[8:]),
+		MinorVersion:     le.Uint16(raw[10:]),
+		Type:             le.Uint32(raw[12:]),
+		SizeOfData:       le.Uint32(raw[16:]),
+		AddressOfRawData: le.Uint32(raw[20:]),
+		PointerToRawData: le.Uint32(raw[24:]),
+	}
+}
+
+// decodeDebugData decodes the payload of known entry types. Malformed
+// payloads are left undecoded rather than failing the whole directory.
+func decodeDebugData(f *pe.File, r io.ReaderAt, entry *DebugEntry) {
+	switch entry.Type {
+	case IMAGE_DEBUG_TYPE_CODEVIEW:
+		entry.CodeView = parseCodeView(readDebugData(f, r, entry, maxDebugDataSize))
+	case IMAGE_DEBUG_TYPE_POGO:
+		entry.POGO = parsePOGO(readDebugData(f, r, entry, maxDebugDataSize))
+	case IMAGE_DEBUG_TYPE_VC_FEATURE:
+		entry.VCFeature = parseVCFeature(readDebugData(f, r, entry, 20))
+	case IMAGE_DEBUG_TYPE_REPRO:
+		entry.Repro = parseRepro(readDebugData(f, r, entry, maxDebugDataSize))
+	case IMAGE_DEBUG_TYPE_EMBEDDED_PORTABLE_PDB:
+		entry.EmbeddedPDB = parseEmbeddedPDB(readDebugData(f, r, entry, 8), entry.SizeOfData)
+	case IMAGE_DEBUG_TYPE_PDBCHECKSUM:
+		entry.PDBChecksum = parsePDBChecksum(readDebugData(f, r, entry, maxDebugDataSize))
+	}
+}
+
+// readDebugData reads up to limit bytes of an entry's payload. The file
+// pointer is preferred; entries that are mapped but have no file pointer
+// are located through their RVA.
+func readDebugData(f *pe.File, r io.ReaderAt, entry *DebugEntry, limit uint32) []byte {
+	size := min(entry.SizeOfData, limit)
+	if size == 0 {
+		return nil
+	}
+
+	offset := entry.PointerToRawData
+	if offset == 0 {
+		if entry.AddressOfRawData == 0 {
+			return nil
+		}
+		var err error
+		if offset, err = rvaToOffset(f, entry.AddressOfRawData); err != nil {
+			return nil
+		}
+	}
+
+	data := make([]byte, size)
+	n, err := r.ReadAt(data, int64(offset))
+	if err != nil && err != io.EOF {
+		return nil
+	}
+	return data[:n]
+}
+
+func parseCodeView(data []byte) *CodeViewInfo {
+	if len(data) < 4 {
+		return nil
+	}
+
+	cv := &CodeViewInfo{Signature: string(data[:4])}
+	switch cv.Signature {
+	case codeViewRSDS:
+		if len(data) < 24 {
+			return nil
+		}
+		copy(cv.GUID[:], data[4:20])
+		cv.Age = binary.LittleEndian.Uint32(data[20:24])
+		cv.PDBPath = readNullTerminatedString(data[24:])
+	case codeViewNB10:
+		if len(data) < 16 {
+			return nil
+		}
+		cv.PDBSignature = binary.LittleEndian.Uint32(data[8:12])
+		cv.Age = binary.LittleEndian.Uint32(data[12:16])
+		cv.PDBPath = readNullTerminatedString(data[16:])
+	default:
+		return nil
+	}
+	return cv
+}
+
+// GUIDString formats the PDB GUID in registry form.
+func (cv *CodeViewInfo) GUIDString() string {
+	g := cv.GUID
+	le := binary.LittleEndian
+	return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}",
+		le.Uint32(g[0:4]), le.Uint16(g[4:6]), le.Uint16(g[6:8]), g[8:10], g[10:16])
+}
+
+// SymbolKey returns the symbol server key: the GUID (or NB10 signature)
+// as uppercase hex followed by the age in hex.
+func (cv *CodeViewInfo) SymbolKey() string {
+	if cv.Signature == codeViewNB10 {
+		return fmt.Sprintf("%08X%X", cv.PDBSignature, cv.Age)
+	}
+	g := cv.GUID
+	le := binary.LittleEndian
+	return fmt.Sprintf("%08X%04X%04X%X%X",
+		le.Uint32(g[0:4]), le.Uint16(g[4:6]), le.Uint16(g[6:8]), g[8:16], cv.Age)
+}
+
+// PDBFileName returns the file name part of PDBPath, accepting both
+// Windows and POSIX separators.
+func (cv *CodeViewInfo) PDBFileName() string {
+	name := cv.PDBPath
+	if i := strings.LastIndexAny(name, `\/`); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// SymbolStorePath returns the relative path of the PDB in a symbol store
+// laid out like symsrv: <pdb name>/<key>/<pdb name>.
+func (cv *CodeViewInfo) SymbolStorePath() string {
+	name := cv.PDBFileName()
+	if name == "" {
+		return ""
+	}
+	return name + "/" + cv.SymbolKey() + "/" + name
+}
+
+func parsePOGO(data []byte) *POGOInfo {
+	if len(data) < 4 {
+		return nil
+	}
+
+	// The signature is a big-endian tag such as 'LTCG' or 'PGU\0'.
+	var sig [4]byte
+	binary.BigEndian.PutUint32(sig[:], binary.LittleEndian.Uint32(data[:4]))
+	info := &POGOInfo{Signature: strings.TrimRight(string(sig[:]), "\x00")}
+
+	for pos := 4; pos+8 < len(data); {
+		entry := POGOEntry{
+			RVA:  binary.LittleEndian.Uint32(data[pos:]),
+			Size: binary.LittleEndian.Uint32(data[pos+4:]),
+		}
+		end := bytes.IndexByte(data[pos+8:], 0)
+		if end < 0 {
+			break
+		}
+		entry.Name = string(data[pos+8 : pos+8+end])
+		info.Entries = append(info.Entries, entry)
+
+		// Names are NUL-terminated and padded to a 4-byte boundary.
+		pos = int(alignUp(uint32(pos+8+end+1), 4))
+	}
+	return info
+}
+
+func parseVCFeature(data []byte) *VCFeatureInfo {
+	if len(data) < 20 {
+		return nil
+	}
+	le := binary.LittleEndian
+	return &VCFeatureInfo{
+		PreVC11: le.Uint32(data[0:]),
+		CCpp:    le.Uint32(data[4:]),
+		GS:      le.Uint32(data[8:]),
+		SDL:     le.Uint32(data[12:]),
+		GuardN:  le.Uint32(data[16:]),
+	}
+}
+
+// parseRepro decodes a REPRO payload: a length-prefixed hash, or nothing.
+func parseRepro(data []byte) *ReproInfo {
+	info := &ReproInfo{}
+	if len(data) < 4 {
+		return info
+	}
+	n := binary.LittleEndian.Uint32(data[:4])
+	if n > uint32(len(data)-4) {
+		return info
+	}
+	info.Hash = append([]byte(nil), data[4:4+n]...)
+	return info
+}
+
+func parseEmbeddedPDB(data []byte, size uint32) *EmbeddedPDBInfo {
+	if len(data) < 8 || string(data[:4]) != embeddedPDBSignature {
+		return nil
+	}
+	return &EmbeddedPDBInfo{
+		UncompressedSize: binary.LittleEndian.Uint32(data[4:8]),
+		CompressedSize:   size - 8,
+	}
+}
+
+func parsePDBChecksum(data []byte) *PDBChecksumInfo {
+	end := bytes.IndexByte(data, 0)
+	if end <= 0 {
+		return nil
+	}
+	return &PDBChecksumInfo{
+		Algorithm: string(data[:end]),
+		Checksum:  append([]byte(nil), data[end+1:]...),
+	}
+}
+
+// DebugTypeName returns the short name of a debug directory entry type.
+func DebugTypeName(t uint32) string {
+	switch t {
+	case IMAGE_DEBUG_TYPE_COFF:
+		return "COFF"
+	case IMAGE_DEBUG_TYPE_CODEVIEW:
+		return "CODEVIEW"
+	case IMAGE_DEBUG_TYPE_FPO:
+		return "FPO"
+	case IMAGE_DEBUG_TYPE_MISC:
+		return "MISC"
+	case IMAGE_DEBUG_TYPE_EXCEPTION:
+		return "EXCEPTION"
+	case IMAGE_DEBUG_TYPE_FIXUP:
+		return "FIXUP"
+	case IMAGE_DEBUG_TYPE_OMAP_TO_SRC:
+		return "OMAP_TO_SRC"
+	case IMAGE_DEBUG_TYPE_OMAP_FROM_SRC:
+		return "OMAP_FROM_SRC"
+	case IMAGE_DEBUG_TYPE_BORLAND:
+		return "BORLAND"
+	case IMAGE_DEBUG_TYPE_CLSID:
+		return "CLSID"
+	case IMAGE_DEBUG_TYPE_VC_FEATURE:
+		return "VC_FEATURE"
+	case IMAGE_DEBUG_TYPE_POGO:
+		return "POGO"
+	case IMAGE_DEBUG_TYPE_ILTCG:
+		return "ILTCG"
+	case IMAGE_DEBUG_TYPE_MPX:
+		return "MPX"
+	case IMAGE_DEBUG_TYPE_REPRO:
+		return "REPRO"
+	case IMAGE_DEBUG_TYPE_EMBEDDED_PORTABLE_PDB:
+		return "EMBEDDED_PORTABLE_PDB"
+	case IMAGE_DEBUG_TYPE_PDBCHECKSUM:
+		return "PDBCHECKSUM"
+	case IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS:
+		return "EX_DLLCHARACTERISTICS"
+	default:
+		return fmt.Sprintf("TYPE_%d", t)
+	}
+}
+
+// DescribeExDllCharacteristics decodes EX_DLLCHARACTERISTICS flags into names.
+func DescribeExDllCharacteristics(flags uint32) []string {
+	names := []struct {
+		mask uint32
+		name string
+	}{
+		{IMAGE_DLLCHARACTERISTICS_EX_CET_COMPAT, "CET_COMPAT"},
+		{IMAGE_DLLCHARACTERISTICS_EX_CET_COMPAT_STRICT_MODE, "CET_COMPAT_STRICT_MODE"},
+		{IMAGE_DLLCHARACTERISTICS_EX_CET_SET_CONTEXT_IP_VALIDATION_RELAXED_MODE, "CET_SET_CONTEXT_IP_VALIDATION_RELAXED_MODE"},
+		{IMAGE_DLLCHARACTERISTICS_EX_CET_DYNAMIC_APIS_ALLOW_IN_PROC, "CET_DYNAMIC_APIS_ALLOW_IN_PROC"},
+		{IMAGE_DLLCHARACTERISTICS_EX_FORWARD_CFI_COMPAT, "FORWARD_CFI_COMPAT"},
+	}
+
+	var out []string
+	for _, n := range names {
+		if flags&n.mask != 0 {
+			out = append(out, n.name)
+		}
+	}
+	return out
+}
@@ -0,0 +1,403 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// coffDebugStripped is IMAGE_FILE_DEBUG_STRIPPED.
+const coffDebugStripped = 0x0200
+
+// DebugModifier rewrites and removes debug directory entries.
+type DebugModifier struct {
+	patcher *Patcher
+}
+
+// NewDebugModifier creates a new debug directory modifier.
+func NewDebugModifier(patcher *Patcher) *DebugModifier {
+	return &DebugModifier{patcher: patcher}
+}
+
+// debugDirectory is the debug directory as stored in the file.
+type debugDirectory struct {
+	rva     uint32
+	offset  uint32
+	entries []DebugEntry
+}
+
+func (dm *DebugModifier) read() (*debugDirectory, error) {
+	f := dm.patcher.peFile
+	rva, size := dataDirectory(f, pe.IMAGE_DIRECTORY_ENTRY_DEBUG)
+	if rva == 0 || size == 0 {
+		return nil, fmt.Errorf("文件没有调试目录")
+	}
+
+	offset, err := rvaToOffset(f, rva)
+	if err != nil {
+		return nil, fmt.Errorf("定位调试目录失败: %w", err)
+	}
+
+	info, err := ParseDebug(f, dm.patcher.file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &debugDirectory{rva: rva, offset: offset, entries: info.Entries}, nil
+}
+
+// Entries returns the current debug directory entries.
+func (dm *DebugModifier) Entries() ([]DebugEntry, error) {
+	dir, err := dm.read()
+	if err != nil {
+		return nil, err
+	}
+	return dir.entries, nil
+}
+
+// RewritePDBPath replaces the PDB path in every CodeView record, keeping the
+// GUID and age so symbol lookup still works. Records that do not fit in place
+// are moved to a new .cvinfo section. Returns the number of records rewritten.
+func (dm *DebugModifier) RewritePDBPath(newPath string) (int, error) {
+	dir, err := dm.read()
+	if err != nil {
+		return 0, err
+	}
+
+	moved := make(map[int][]byte)
+	count := 0
+	for i := range dir.entries {
+		e := &dir.entries[i]
+		if e.CodeView == nil {
+			continue
+		}
+		count++
+
+		cv := *e.CodeView
+		cv.PDBPath = newPath
+		record := encodeCodeView(&cv)
+
+		if uint32(len(record)) > e.SizeOfData {
+			moved[i] = record
+			continue
+		}
+
+		// Pad to the old size so no part of the old path is left behind
+		padded := make([]byte, e.SizeOfData)
+		copy(padded, record)
+		if err := dm.writePayload(e, padded); err != nil {
+			return 0, err
+		}
+		e.SizeOfData = uint32(len(record))
+	}
+
+	if count == 0 {
+		return 0, fmt.Errorf("文件没有CodeView调试记录")
+	}
+
+	if len(moved) > 0 {
+		if err := dm.relocate(dir, moved); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := dm.writeEntries(dir, dir.entries); err != nil {
+		return 0, err
+	}
+	return count, dm.patcher.UpdateChecksum()
+}
+
+// RemoveEntries removes all debug directory entries of the given types and
+// clears their data. Returns the number of entries removed.
+func (dm *DebugModifier) RemoveEntries(types ...uint32) (int, error) {
+	match := make(map[uint32]bool, len(types))
+	for _, t := range types {
+		match[t] = true
+	}
+
+	return dm.remove(func(e DebugEntry) bool { return match[e.Type] })
+}
+
+// Strip removes the whole debug directory, clears all debug data, zeroes
+// data directory 6 and marks the image DEBUG_STRIPPED.
+func (dm *DebugModifier) Strip() error {
+	if _, err := dm.remove(func(DebugEntry) bool { return true }); err != nil {
+		return err
+	}
+
+	peOffset, err := dm.patcher.peHeaderOffset()
+	if err != nil {
+		return err
+	}
+	img, err := NewHeaderEditor(dm.patcher).read(peOffset)
+	if err != nil {
+		return err
+	}
+	flags := binary.LittleEndian.Uint16(img.coff[18:20]) | coffDebugStripped
+	binary.LittleEndian.PutUint16(img.coff[18:20], flags)
+	if _, err := dm.patcher.file.WriteAt(img.coff[18:20], peOffset+4+18); err != nil {
+		return fmt.Errorf("写入COFF特征失败: %w", err)
+	}
+
+	return dm.patcher.UpdateChecksum()
+}
+
+func (dm *DebugModifier) remove(match func(DebugEntry) bool) (int, error) {
+	dir, err := dm.read()
+	if err != nil {
+		return 0, err
+	}
+
+	var kept, removed []DebugEntry
+	for _, e := range dir.entries {
+		if match(e) {
+			removed = append(removed, e)
+		} else {
+			kept = append(kept, e)
+		}
+	}
+	if len(removed) == 0 {
+		return 0, fmt.Errorf("没有匹配的调试条目")
+	}
+
+	if err := dm.clearPayloads(removed, kept); err != nil {
+		return 0, err
+	}
+
+	// Compact the remaining entries and zero the freed slots
+	if err := dm.writeEntries(dir, kept); err != nil {
+		return 0, err
+	}
+	freed := make([]byte, len(removed)*debugDirectoryEntrySize)
+	freedOffset := int64(dir.offset) + int64(len(kept)*debugDirectoryEntrySize)
+	if _, err := dm.patcher.file.WriteAt(freed, freedOffset); err != nil {
+		return 0, fmt.Errorf("清除调试目录失败: %w", err)
+	}
+
+	if len(kept) == 0 {
+		err = dm.patcher.setDataDirectory(pe.IMAGE_DIRECTORY_ENTRY_DEBUG, 0, 0)
+	} else {
+		err = dm.patcher.setDataDirectory(pe.IMAGE_DIRECTORY_ENTRY_DEBUG, dir.rva, uint32(len(kept)*debugDirectoryEntrySize))
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := dm.patcher.Reload(); err != nil {
+		return 0, fmt.Errorf("重新加载PE失败: %w", err)
+	}
+	return len(removed), dm.patcher.UpdateChecksum()
+}
+
+// clearPayloads zeroes the data of removed entries. Data shared with a kept
+// entry is left alone. Data outside all sections that ends the file is
+// truncated away instead.
+func (dm *DebugModifier) clearPayloads(removed, kept []DebugEntry) error {
+	// Highest offsets first so trailing blocks can be truncated one after another
+	sort.Slice(removed, func(i, j int) bool {
+		return dm.payloadOffset(&removed[i]) > dm.payloadOffset(&removed[j])
+	})
+
+	for i := range removed {
+		e := &removed[i]
+		offset := dm.payloadOffset(e)
+		if offset == 0 || e.SizeOfData == 0 || dm.payloadShared(offset, e.SizeOfData, kept) {
+			continue
+		}
+
+		end := int64(offset) + int64(e.SizeOfData)
+		if dm.isOverlay(offset) && end >= dm.patcher.filesize {
+			if err := dm.patcher.file.Truncate(int64(offset)); err != nil {
+				return fmt.Errorf("截断调试数据失败: %w", err)
+			}
+			dm.patcher.filesize = int64(offset)
+			continue
+		}
+
+		if _, err := dm.patcher.file.WriteAt(make([]byte, e.SizeOfData), int64(offset)); err != nil {
+			return fmt.Errorf("清除调试数据失败: %w", err)
+		}
+	}
+	return nil
+}
+
+func (dm *DebugModifier) payloadShared(offset, size uint32, kept []DebugEntry) bool {
+	for i := range kept {
+		o := dm.payloadOffset(&kept[i])
+		if o != 0 && o < offset+size && offset < o+kept[i].SizeOfData {
+			return true
+		}
+	}
+	return false
+}
+
+// relocate moves payloads into a new .cvinfo section. Payloads stored
+// outside all sections are moved along with them, since the new section
+// is placed where that data used to be.
+func (dm *DebugModifier) relocate(dir *debugDirectory, payloads map[int][]byte) error {
+	for i := range dir.entries {
+		e := &dir.entries[i]
+		if _, ok := payloads[i]; ok {
+			continue
+		}
+		if offset := dm.payloadOffset(e); offset != 0 && e.SizeOfData != 0 && dm.isOverlay(offset) {
+			data := make([]byte, e.SizeOfData)
+			if _, err := dm.patcher.file.ReadAt(data, int64(offset)); err != nil {
+				return fmt.Errorf("读取调试数据失败: %w", err)
+			}
+			payloads[i] = data
+		}
+	}
+
+	indexes := make([]int, 0, len(payloads))
+	for i := range payloads {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	// Clear the old copies first; overlay data may lie where the section goes
+	offsets := make(map[int]uint32, len(indexes))
+	var section []byte
+	for _, i := range indexes {
+		e := &dir.entries[i]
+		if offset := dm.payloadOffset(e); offset != 0 && e.SizeOfData != 0 {
+			if _, err := dm.patcher.file.WriteAt(make([]byte, e.SizeOfData), int64(offset)); err != nil {
+				return fmt.Errorf("清除调试数据失败: %w", err)
+			}
+		}
+		offsets[i] = uint32(len(section))
+		section = append(section, payloads[i]...)
+		section = append(section, make([]byte, alignUp(uint32(len(section)), 4)-uint32(len(section)))...)
+	}
+
+	if err := dm.patcher.InjectSection(".cvinfo", section,
+		pe.IMAGE_SCN_CNT_INITIALIZED_DATA|pe.IMAGE_SCN_MEM_READ); err != nil {
+		return fmt.Errorf("注入调试数据节区失败: %w", err)
+	}
+	if err := dm.patcher.Reload(); err != nil {
+		return fmt.Errorf("重新加载PE失败: %w", err)
+	}
+
+	sections := dm.patcher.peFile.Sections
+	newSection := sections[len(sections)-1]
+	for _, i := range indexes {
+		e := &dir.entries[i]
+		e.AddressOfRawData = newSection.VirtualAddress + offsets[i]
+		e.PointerToRawData = newSection.Offset + offsets[i]
+		e.SizeOfData = uint32(len(payloads[i]))
+	}
+	return nil
+}
+
+// payloadOffset returns the file offset of an entry's data, or 0 if it has none.
+func (dm *DebugModifier) payloadOffset(e *DebugEntry) uint32 {
+	if e.PointerToRawData != 0 {
+		return e.PointerToRawData
+	}
+	if e.AddressOfRawData == 0 {
+		return 0
+	}
+	offset, err := rvaToOffset(dm.patcher.peFile, e.AddressOfRawData)
+	if err != nil {
+		return 0
+	}
+	return offset
+}
+
+// isOverlay reports whether a file offset lies beyond the raw data of every section.
+func (dm *DebugModifier) isOverlay(offset uint32) bool {
+	var end uint32
+	for _, s := range dm.patcher.peFile.Sections {
+		end = max(end, s.Offset+s.Size)
+	}
+	return offset >= end
+}
+
+func (dm *DebugModifier) writePayload(e *DebugEntry, data []byte) error {
+	offset := dm.payloadOffset(e)
+	if offset == 0 {
+		return fmt.Errorf("调试条目没有数据")
+	}
+	if _, err := dm.patcher.file.WriteAt(data, int64(offset)); err != nil {
+		return fmt.Errorf("写入调试数据失败: %w", err)
+	}
+	return nil
+}
+
+func (dm *DebugModifier) writeEntries(dir *debugDirectory, entries []DebugEntry) error {
+	data := make([]byte, 0, len(entries)*debugDirectoryEntrySize)
+	for i := range entries {
+		data = append(data, encodeDebugEntry(&entries[i])...)
+	}
+	if _, err := dm.patcher.file.WriteAt(data, int64(dir.offset)); err != nil {
+		return fmt.Errorf("写入调试目录失败: %w", err)
+	}
+	return nil
+}
+
+func encodeDebugEntry(e *DebugEntry) []byte {
+	le := binary.LittleEndian
+	raw := make([]byte, debugDirectoryEntrySize)
+	le.PutUint32(raw[0:], e.Characteristics)
+	le.PutUint32(raw[4:], e.TimeDateStamp)
+	le.PutUint16(raw[8:], e.MajorVersion)
+	le.PutUint16(raw[10:], e.MinorVersion)
+	le.PutUint32(raw[12:], e.Type)
+	le.PutUint32(raw[16:], e.SizeOfData)
+	le.PutUint32(raw[20:], e.AddressOfRawData)
+	le.PutUint32(raw[24:], e.PointerToRawData)
+	return raw
+}
+
+// encodeCodeView serializes a CodeView record with a NUL-terminated path.
+func encodeCodeView(cv *CodeViewInfo) []byte {
+	le := binary.LittleEndian
+	data := []byte(cv.Signature)
+	if cv.Signature == codeViewNB10 {
+		data = le.AppendUint32(data, 0) // Offset, always 0 for a separate PDB
+		data = le.AppendUint32(data, cv.PDBSignature)
+	} else {
+		data = append(data, cv.GUID[:]...)
+	}
+	data = le.AppendUint32(data, cv.Age)
+	data = append(data, cv.PDBPath...)
+	return append(data, 0)
+}
+
+// ParseDebugTypes parses a comma-separated list of debug entry types given
+// by name (CODEVIEW, POGO, IMAGE_DEBUG_TYPE_REPRO, ...) or number.
+func ParseDebugTypes(spec string) ([]uint32, error) {
+	var types []uint32
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		if n, err := strconv.ParseUint(name, 0, 32); err == nil {
+			types = append(types, uint32(n))
+			continue
+		}
+
+		name = strings.TrimPrefix(name, "IMAGE_DEBUG_TYPE_")
+		found := false
+		for t := uint32(0); t <= IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS; t++ {
+			if DebugTypeName(t) == name {
+				types = append(types, t)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("未知的调试条目类型: %s", name)
+		}
+	}
+
+	if len(types) == 0 {
+		return nil, fmt.Errorf("未指定调试条目类型")
+	}
+	return types, nil
+}
@@ -0,0 +1,152 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func rsdsRecord(path string, age uint32) []byte {
+	data := []byte("RSDS")
+	data = append(data,
+		0xA1, 0x23, 0x59, 0x08, 0xAB, 0xB7, 0xED, 0x44,
+		0xB1, 0x6B, 0x45, 0xE5, 0x83, 0x40, 0x57, 0x15)
+	data = binary.LittleEndian.AppendUint32(data, age)
+	data = append(data, path...)
+	return append(data, 0)
+}
+
+func TestParseCodeViewRSDS(t *testing.T) {
+	cv := parseCodeView(rsdsRecord(`C:\build\out\app.pdb`, 2))
+	if cv == nil {
+		t.Fatal("parseCodeView() = nil")
+	}
+
+	if cv.PDBPath != `C:\build\out\app.pdb` || cv.Age != 2 {
+		t.Errorf("path/age = %q/%d", cv.PDBPath, cv.Age)
+	}
+	if got, want := cv.GUIDString(), "{085923A1-B7AB-44ED-B16B-45E583405715}"; got != want {
+		t.Errorf("GUIDString() = %s, want %s", got, want)
+	}
+	if got, want := cv.SymbolKey(), "085923A1B7AB44EDB16B45E5834057152"; got != want {
+		t.Errorf("SymbolKey() = %s, want %s", got, want)
+	}
+	if got, want := cv.SymbolStorePath(), "app.pdb/085923A1B7AB44EDB16B45E5834057152/app.pdb"; got != want {
+		t.Errorf("SymbolStorePath() = %s, want %s", got, want)
+	}
+}
+
+func TestParseCodeViewNB10(t *testing.T) {
+	data := []byte("NB10")
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = binary.LittleEndian.AppendUint32(data, 0x3A1B2C4D)
+	data = binary.LittleEndian.AppendUint32(data, 0x1F)
+	data = append(data, "old.pdb\x00"...)
+
+	cv := parseCodeView(data)
+	if cv == nil {
+		t.Fatal("parseCodeView() = nil")
+	}
+	if got, want := cv.SymbolKey(), "3A1B2C4D1F"; got != want {
+		t.Errorf("SymbolKey() = %s, want %s", got, want)
+	}
+	if cv.PDBPath != "old.pdb" {
+		t.Errorf("PDBPath = %q", cv.PDBPath)
+	}
+}
+
+func TestParseCodeViewInvalid(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("RSDS"), []byte("XXXX0000000000000000000000")} {
+		if cv := parseCodeView(data); cv != nil {
+			t.Errorf("parseCodeView(% X) = %+v, want nil", data, cv)
+		}
+	}
+}
+
+func TestParsePOGO(t *testing.T) {
+	data := binary.LittleEndian.AppendUint32(nil, 0x4C544347) // 'LTCG'
+	data = binary.LittleEndian.AppendUint32(data, 0x1000)
+	data = binary.LittleEndian.AppendUint32(data, 0x200)
+	data = append(data, ".text$mn\x00\x00\x00\x00"...)
+	data = binary.LittleEndian.AppendUint32(data, 0x2000)
+	data = binary.LittleEndian.AppendUint32(data, 0x10)
+	data = append(data, ".rdata\x00\x00"...)
+
+	got := parsePOGO(data)
+	want := &POGOInfo{Signature: "LTCG", Entries: []POGOEntry{
+		{RVA: 0x1000, Size: 0x200, Name: ".text$mn"},
+		{RVA: 0x2000, Size: 0x10, Name: ".rdata"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePOGO() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseRepro(t *testing.T) {
+	hash := bytes.Repeat([]byte{0xAB}, 32)
+	data := binary.LittleEndian.AppendUint32(nil, 32)
+	data = append(data, hash...)
+
+	if got := parseRepro(data); !bytes.Equal(got.Hash, hash) {
+		t.Errorf("Hash = %x, want %x", got.Hash, hash)
+	}
+	if got := parseRepro(nil); got == nil || got.Hash != nil {
+		t.Errorf("parseRepro(nil) = %+v, want empty marker", got)
+	}
+}
+
+func TestParseEmbeddedPDB(t *testing.T) {
+	data := append([]byte("MPDB"), 0x00, 0x10, 0x00, 0x00)
+	got := parseEmbeddedPDB(data, 0x208)
+	if got == nil || got.UncompressedSize != 0x1000 || got.CompressedSize != 0x200 {
+		t.Errorf("parseEmbeddedPDB() = %+v", got)
+	}
+	if parseEmbeddedPDB([]byte("BSJB0000"), 8) != nil {
+		t.Error("parseEmbeddedPDB accepted wrong signature")
+	}
+}
+
+func TestEncodeCodeViewRoundTrip(t *testing.T) {
+	orig := parseCodeView(rsdsRecord(`D:\jenkins\workspace\app\Release\app.pdb`, 3))
+	cv := *orig
+	cv.PDBPath = "app.pdb"
+
+	got := parseCodeView(encodeCodeView(&cv))
+	if got == nil || got.PDBPath != "app.pdb" || got.GUID != orig.GUID || got.Age != 3 {
+		t.Errorf("round trip = %+v", got)
+	}
+
+	nb10 := &CodeViewInfo{Signature: "NB10", PDBSignature: 0x12345678, Age: 4, PDBPath: "x.pdb"}
+	if got := parseCodeView(encodeCodeView(nb10)); !reflect.DeepEqual(got, nb10) {
+		t.Errorf("NB10 round trip = %+v, want %+v", got, nb10)
+	}
+}
+
+func TestEncodeDebugEntryRoundTrip(t *testing.T) {
+	e := DebugEntry{
+		TimeDateStamp: 0x5F000000, MajorVersion: 1, MinorVersion: 2,
+		Type: IMAGE_DEBUG_TYPE_POGO, SizeOfData: 0x100,
+		AddressOfRawData: 0x3000, PointerToRawData: 0x2400,
+	}
+	if got := decodeDebugEntry(encodeDebugEntry(&e)); !reflect.DeepEqual(got, e) {
+		t.Errorf("round trip = %+v, want %+v", got, e)
+	}
+}
+
+func TestParseDebugTypes(t *testing.T) {
+	got, err := ParseDebugTypes("codeview, IMAGE_DEBUG_TYPE_POGO,16,VC_FEATURE")
+	if err != nil {
+		t.Fatalf("ParseDebugTypes() error = %v", err)
+	}
+	want := []uint32{IMAGE_DEBUG_TYPE_CODEVIEW, IMAGE_DEBUG_TYPE_POGO, IMAGE_DEBUG_TYPE_REPRO, IMAGE_DEBUG_TYPE_VC_FEATURE}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDebugTypes() = %v, want %v", got, want)
+	}
+
+	for _, spec := range []string{"", "DWARF"} {
+		if _, err := ParseDebugTypes(spec); err == nil {
+			t.Errorf("ParseDebugTypes(%q) expected error", spec)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Delay-load import directory constants.
+const (
+	dataDirDelayImport  = 13
+	delayDescriptorSize = 32
+
+	// dlattrRVA marks descriptors whose fields are RVAs. Images built by
+	// VC++ 6.0 and earlier store virtual addresses instead.
+	dlattrRVA = 0x1
+
+	// maxDelayDescriptors and maxDelayThunks bound the walk on corrupt images.
+	maxDelayDescriptors = 4096
+	maxDelayThunks      = 0x10000
+)
+
+// DelayImportDescriptor is the raw ImgDelayDescr. In the old VA-based form
+// every address field holds a virtual address rather than an RVA.
+type DelayImportDescriptor struct {
+	Attributes                 uint32
+	DllNameRVA                 uint32
+	ModuleHandleRVA            uint32
+	ImportAddressTableRVA      uint32
+	ImportNameTableRVA         uint32
+	BoundImportAddressTableRVA uint32
+	UnloadInformationTableRVA  uint32
+	TimeDateStamp              uint32
+}
+
+// DelayImportInfo describes a DLL that is loaded on the first call to one of
+// its functions rather than at process start. All addresses are RVAs, also
+// for descriptors stored in the VA-based form.
+type DelayImportInfo struct {
+	DLL             string
+	Attributes      uint32
+	ModuleHandleRVA uint32 // HMODULE slot filled by the delay-load helper
+	IATRVA          uint32
+	INTRVA          uint32
+	BoundIATRVA     uint32 // 0 if the descriptor was never bound
+	UnloadIATRVA    uint32 // 0 if the DLL cannot be unloaded
+	TimeDateStamp   uint32 // Timestamp of the DLL the bound IAT was computed for
+	Functions       []DelayImportFunction
+}
+
+// DelayImportFunction is one delay-loaded function.
+type DelayImportFunction struct {
+	ImportFunction
+	IATAddress   uint32 // RVA of the IAT slot
+	Thunk        uint64 // Initial IAT value: the VA of the load thunk
+	BoundAddress uint64 // Prebound address from the bound IAT, 0 if none
+	UnloadThunk  uint64 // Saved IAT value restored on unload, 0 if none
+}
+
+// RVABased reports whether the descriptor uses the RVA form.
+func (d *DelayImportInfo) RVABased() bool {
+	return d.Attributes&dlattrRVA != 0
+}
+
+// Bound reports whether the descriptor carries a bound IAT.
+func (d *DelayImportInfo) Bound() bool {
+	return d.BoundIATRVA != 0 && d.TimeDateStamp != 0
+}
+
+// FunctionNames returns the function names in the format used by
+// ImportInfo, with ordinal imports rendered as "Ordinal_N".
+func (d *DelayImportInfo) FunctionNames() []string {
+	names := make([]string, len(d.Functions))
+	for i, fn := range d.Functions {
+		names[i] = fn.String()
+	}
+	return names
+}
+
+// delayImportParser reads delay-load descriptors and their thunk arrays.
+type delayImportParser struct {
+	f           *pe.File
+	r           io.ReaderAt
+	base        uint64
+	ptrSize     uint32
+	ordinalFlag uint64
+}
+
+// ParseDelayImports parses the delay-load import directory (data directory
+// 13). It returns nil without error when the image has none. Descriptors
+// whose DLL name cannot be read are skipped.
+func ParseDelayImports(f *pe.File, r io.ReaderAt) ([]DelayImportInfo, error) {
+	descriptors, err := readDelayDescriptors(f, r)
+
+	p := &delayImportParser{f: f, r: r, base: imageBase(f), ptrSize: 4, ordinalFlag: 0x80000000}
+	if _, ok := f.OptionalHeader.(*pe.OptionalHeader64); ok {
+		p.ptrSize, p.ordinalFlag = 8, 0x8000000000000000
+	}
+
+	var imports []DelayImportInfo
+	for _, desc := range descriptors {
+		if imp, ok := p.parseDescriptor(desc); ok {
+			imports = append(imports, imp)
+		}
+	}
+	return imports, err
+}
+
+// readDelayDescriptors reads the raw descriptor table up to the null
+// terminator. On a read error the descriptors read so far are returned.
+func readDelayDescriptors(f *pe.File, r io.ReaderAt) ([]DelayImportDescriptor, error) {
+	rva, size := dataDirectory(f, dataDirDelayImport)
+	if rva == 0 || size == 0 {
+		return nil, nil
+	}
+
+	offset, err := rvaToOffset(f, rva)
+	if err != nil {
+		return nil, fmt.Errorf("定位延迟加载导入目录失败: %w", err)
+	}
+
+	var descriptors []DelayImportDescriptor
+	buf := make([]byte, delayDescriptorSize)
+	for i := 0; i < maxDelayDescriptors; i++ {
+		if _, err := r.ReadAt(buf, int64(offset)+int64(i*delayDescriptorSize)); err != nil {
+			return descriptors, fmt.Errorf("读取延迟加载描述符失败: %w", err)
+		}
+		desc := decodeDelayDescriptor(buf)
+		if desc.DllNameRVA == 0 {
+			break // Null terminator
+		}
+		descriptors = append(descriptors, desc)
+	}
+	return descriptors, nil
+}
+
+func decodeDelayDescriptor(buf []byte) DelayImportDescriptor {
+	le := binary.LittleEndian
+	return DelayImportDescriptor{
+		Attributes:                 le.Uint32(buf[0:4]),
+		DllNameRVA:                 le.Uint32(buf[4:8]),
+		ModuleHandleRVA:            le.Uint32(buf[8:12]),
+		ImportAddressTableRVA:      le.Uint32(buf[12:16]),
+		ImportNameTableRVA:         le.Uint32(buf[16:20]),
+		BoundImportAddressTableRVA: le.Uint32(buf[20:24]),
+		UnloadInformationTableRVA:  le.Uint32(buf[24:28]),
+		TimeDateStamp:              le.Uint32(buf[28:32]),
+	}
+}
+
+func (d DelayImportDescriptor) encode(buf []byte) {
+	le := binary.LittleEndian
+	le.PutUint32(buf[0:4], d.Attributes)
+	le.PutUint32(buf[4:8], d.DllNameRVA)
+	le.PutUint32(buf[8:12], d.ModuleHandleRVA)
+	le.PutUint32(buf[12:16], d.ImportAddressTableRVA)
+	le.PutUint32(buf[16:20], d.ImportNameTableRVA)
+	le.PutUint32(buf[20:24], d.BoundImportAddressTableRVA)
+	le.PutUint32(buf[24:28], d.UnloadInformationTableRVA)
+	le.PutUint32(buf[28:32], d.TimeDateStamp)
+}
+
+func (p *delayImportParser) parseDescriptor(desc DelayImportDescriptor) (DelayImportInfo, bool) {
+	rvaBased := desc.Attributes&dlattrRVA != 0
+	toRVA := func(addr uint64) uint32 {
+		if rvaBased || addr == 0 {
+			return uint32(addr)
+		}
+		if addr < p.base {
+			return 0
+		}
+		return uint32(addr - p.base)
+	}
+
+	imp := DelayImportInfo{
+		Attributes:      desc.Attributes,
+		ModuleHandleRVA: toRVA(uint64(desc.ModuleHandleRVA)),
+		IATRVA:          toRVA(uint64(desc.ImportAddressTableRVA)),
+		INTRVA:          toRVA(uint64(desc.ImportNameTableRVA)),
+		BoundIATRVA:     toRVA(uint64(desc.BoundImportAddressTableRVA)),
+		UnloadIATRVA:    toRVA(uint64(desc.UnloadInformationTableRVA)),
+		TimeDateStamp:   desc.TimeDateStamp,
+	}
+
+	nameOffset, err := rvaToOffset(p.f, toRVA(uint64(desc.DllNameRVA)))
+	if err != nil {
+		return imp, false
+	}
+	if imp.DLL, err = readCString(p.r, int64(nameOffset)); err != nil || imp.DLL == "" {
+		return imp, false
+	}
+
+	// The INT is null-terminated; the other tables run in parallel with it
+	names := p.readThunks(imp.INTRVA, maxDelayThunks)
+	iat := p.readThunks(imp.IATRVA, len(names))
+	bound := p.readThunks(imp.BoundIATRVA, len(names))
+	unload := p.readThunks(imp.UnloadIATRVA, len(names))
+
+	imp.Functions = make([]DelayImportFunction, len(names))
+	for i, thunk := range names {
+		fn := &imp.Functions[i]
+		fn.IATAddress = imp.IATRVA + uint32(i)*p.ptrSize
+		if thunk&p.ordinalFlag != 0 {
+			fn.IsByOrdinal = true
+			fn.Ordinal = uint16(thunk)
+		} else {
+			p.readHintName(toRVA(thunk), &fn.ImportFunction)
+		}
+		if i < len(iat) {
+			fn.Thunk = iat[i]
+		}
+		if i < len(bound) {
+			fn.BoundAddress = bound[i]
+		}
+		if i < len(unload) {
+			fn.UnloadThunk = unload[i]
+		}
+	}
+	return imp, true
+}
+
+// readThunks reads up to limit pointer-sized entries at rva, stopping at the
+// first zero entry. The bound and unload tables are not null-terminated on
+// every linker, so their reads are bounded by the INT length instead.
+func (p *delayImportParser) readThunks(rva uint32, limit int) []uint64 {
+	if rva == 0 || limit == 0 {
+		return nil
+	}
+	offset, err := rvaToOffset(p.f, rva)
+	if err != nil {
+		return nil
+	}
+
+	var thunks []uint64
+	buf := make([]byte, p.ptrSize)
+	for len(thunks) < limit {
+		if _, err := p.r.ReadAt(buf, int64(offset)+int64(len(thunks))*int64(p.ptrSize)); err != nil {
+			break
+		}
+		var v uint64
+		if p.ptrSize == 8 {
+			v = binary.LittleEndian.Uint64(buf)
+		} else {
+			v = uint64(binary.LittleEndian.Uint32(buf))
+		}
+		if v == 0 {
+			break
+		}
+		thunks = append(thunks, v)
+	}
+	return thunks
+}
+
+// readHintName reads an IMAGE_IMPORT_BY_NAME entry.
+func (p *delayImportParser) readHintName(rva uint32, fn *ImportFunction) {
+	offset, err := rvaToOffset(p.f, rva)
+	if err != nil {
+		return
+	}
+	hint := make([]byte, 2)
+	if _, err := p.r.ReadAt(hint, int64(offset)); err == nil {
+		fn.Hint = binary.LittleEndian.Uint16(hint)
+	}
+	fn.Name, _ = readCString(p.r, int64(offset)+2)
+}
+
+// ListDelayImports returns the delay-loaded DLLs and their functions.
+func (p *Patcher) ListDelayImports() ([]DelayImportInfo, error) {
+	return ParseDelayImports(p.peFile, p.file)
+}
+
+// ListDelayImportsFromReader returns the delay-loaded DLLs from a Reader.
+func ListDelayImportsFromReader(reader *Reader) ([]DelayImportInfo, error) {
+	return ParseDelayImports(reader.File(), reader.RawFile())
+}
@@ -0,0 +1,386 @@
+package pe
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// delayLoadHelperSymbols are the COFF symbol names of __delayLoadHelper2;
+// x86 uses the decorated stdcall name.
+var delayLoadHelperSymbols = []string{"__delayLoadHelper2", "___delayLoadHelper2@8"}
+
+// Tail-merge routines save the argument registers, then load the descriptor
+// address and call the helper. These are the opcodes of the descriptor load
+// that MSVC emits right before the call: "push imm32" on x86 and
+// "lea rcx, [rip+rel32]" on x64, each followed by a 4-byte operand.
+var (
+	descriptorLoadX86 = []byte{0x68}
+	descriptorLoadX64 = []byte{0x48, 0x8D, 0x0D}
+)
+
+// tailMergeFrameX64 is the stack allocation of the generated x64 tail-merge:
+// 0x20 bytes of home space for the helper plus four saved XMM argument
+// registers, keeping RSP 16-byte aligned at the call.
+const tailMergeFrameX64 = 0x68
+
+// FindDelayLoadHelper returns the RVA of __delayLoadHelper2. It is looked up
+// in the COFF symbol table and, failing that, by following the load thunk of
+// an existing delay-load import to the call in its tail-merge routine. An
+// error means the image does not link the delay-load helper.
+func FindDelayLoadHelper(f *pe.File, r io.ReaderAt) (uint32, error) {
+	for _, sym := range f.Symbols {
+		for _, name := range delayLoadHelperSymbols {
+			if sym.Name == name && sym.SectionNumber > 0 && int(sym.SectionNumber) <= len(f.Sections) {
+				return f.Sections[sym.SectionNumber-1].VirtualAddress + sym.Value, nil
+			}
+		}
+	}
+
+	imports, _ := ParseDelayImports(f, r)
+	for _, imp := range imports {
+		for _, fn := range imp.Functions {
+			if rva, ok := traceDelayLoadHelper(f, r, fn.Thunk); ok {
+				return rva, nil
+			}
+		}
+	}
+
+	if len(imports) == 0 {
+		return 0, fmt.Errorf("文件未链接延迟加载辅助函数 __delayLoadHelper2（没有符号表，也没有可供追踪的延迟加载导入）")
+	}
+	return 0, fmt.Errorf("无法从现有延迟加载桩中定位 __delayLoadHelper2")
+}
+
+// traceDelayLoadHelper follows a load thunk ("mov eax, imm32" or
+// "lea rax, [rip+rel32]", then "jmp tailMerge") and returns the target of
+// the helper call in the tail-merge routine.
+func traceDelayLoadHelper(f *pe.File, r io.ReaderAt, thunkVA uint64) (uint32, bool) {
+	base := imageBase(f)
+	if thunkVA < base {
+		return 0, false
+	}
+	thunk := uint32(thunkVA - base)
+	code := readCode(f, r, thunk, 16)
+
+	jmpAt := 0
+	load := descriptorLoadX86
+	switch {
+	case f.Machine == pe.IMAGE_FILE_MACHINE_I386 && len(code) >= 10 && code[0] == 0xB8:
+		jmpAt = 5
+	case f.Machine == pe.IMAGE_FILE_MACHINE_AMD64 && len(code) >= 12 && bytes.Equal(code[:3], []byte{0x48, 0x8D, 0x05}):
+		jmpAt, load = 7, descriptorLoadX64
+	default:
+		return 0, false
+	}
+	if code[jmpAt] != 0xE9 {
+		return 0, false
+	}
+	tailMerge := thunk + uint32(jmpAt+5) + binary.LittleEndian.Uint32(code[jmpAt+1:])
+
+	// Find "<descriptor load> imm32/rel32; call rel32"
+	code = readCode(f, r, tailMerge, 0x100)
+	call := len(load) + 4
+	for i := 0; i+call+5 <= len(code); i++ {
+		if !bytes.Equal(code[i:i+len(load)], load) || code[i+call] != 0xE8 {
+			continue
+		}
+		next := tailMerge + uint32(i+call+5)
+		helper := next + binary.LittleEndian.Uint32(code[i+call+1:])
+		if isExecutableRVA(f, helper) {
+			return helper, true
+		}
+	}
+	return 0, false
+}
+
+// readCode reads up to size bytes at rva, truncated at the end of the file.
+func readCode(f *pe.File, r io.ReaderAt, rva, size uint32) []byte {
+	offset, err := rvaToOffset(f, rva)
+	if err != nil {
+		return nil
+	}
+	buf := make([]byte, size)
+	n, _ := r.ReadAt(buf, int64(offset))
+	return buf[:n]
+}
+
+func isExecutableRVA(f *pe.File, rva uint32) bool {
+	for _, s := range f.Sections {
+		if rva >= s.VirtualAddress && rva < s.VirtualAddress+max(s.VirtualSize, s.Size) {
+			return s.Characteristics&pe.IMAGE_SCN_MEM_EXECUTE != 0
+		}
+	}
+	return false
+}
+
+// delayImportLayout places the rebuilt descriptor table and the new DLL's
+// tables in the data section.
+type delayImportLayout struct {
+	moduleHandle uint32
+	iat          uint32
+	int          uint32
+	names        []uint32 // IMAGE_IMPORT_BY_NAME entries
+	dllName      uint32
+	size         uint32
+}
+
+func newDelayImportLayout(descriptorCount int, dllName string, functions []string, ptrSize uint32) delayImportLayout {
+	var l delayImportLayout
+	// Existing descriptors, the new one and the null terminator
+	l.moduleHandle = uint32(descriptorCount+2) * delayDescriptorSize
+	l.iat = l.moduleHandle + ptrSize
+	l.int = l.iat + uint32(len(functions)+1)*ptrSize
+	offset := l.int + uint32(len(functions)+1)*ptrSize
+	for _, fn := range functions {
+		l.names = append(l.names, offset)
+		offset = alignUp(offset+2+uint32(len(fn))+1, 2)
+	}
+	l.dllName = offset
+	l.size = offset + uint32(len(dllName)) + 1
+	return l
+}
+
+// delayLoadStubs emits the tail-merge routine for the new descriptor
+// followed by one load thunk per function. Each thunk passes its IAT slot to
+// the tail-merge, which calls __delayLoadHelper2(descriptor, slot) and jumps
+// to the resolved function.
+type delayLoadStubs struct {
+	is64       bool
+	base       uint64
+	code       uint32 // RVA of the stub section
+	descriptor uint32
+	iat        uint32
+	helper     uint32
+}
+
+// build returns the code, the RVA of each thunk, the end of the tail-merge
+// routine, and the RVAs of absolute addresses that need base relocations.
+func (s delayLoadStubs) build(count int) (code []byte, thunks []uint32, tailMergeEnd uint32, relocs []uint32) {
+	le := binary.LittleEndian
+	emit := func(b ...byte) { code = append(code, b...) }
+	// emitRel emits an instruction ending in a rel32 operand
+	emitRel := func(target uint32, op ...byte) {
+		emit(op...)
+		next := s.code + uint32(len(code)) + 4
+		code = le.AppendUint32(code, target-next)
+	}
+	// emitAbs emits an instruction ending in an absolute 32-bit address
+	emitAbs := func(rva uint32, op ...byte) {
+		emit(op...)
+		relocs = append(relocs, s.code+uint32(len(code)))
+		code = le.AppendUint32(code, uint32(s.base)+rva)
+	}
+
+	if s.is64 {
+		// The prolog is only the allocation, so the unwind data is one code
+		emit(0x48, 0x83, 0xEC, tailMergeFrameX64)   // sub rsp, 0x68
+		emit(0x48, 0x89, 0x4C, 0x24, 0x70)          // mov [rsp+0x70], rcx
+		emit(0x48, 0x89, 0x54, 0x24, 0x78)          // mov [rsp+0x78], rdx
+		emit(0x4C, 0x89, 0x84, 0x24, 0x80, 0, 0, 0) // mov [rsp+0x80], r8
+		emit(0x4C, 0x89, 0x8C, 0x24, 0x88, 0, 0, 0) // mov [rsp+0x88], r9
+		emit(0x66, 0x0F, 0x7F, 0x44, 0x24, 0x20)    // movdqa [rsp+0x20], xmm0
+		emit(0x66, 0x0F, 0x7F, 0x4C, 0x24, 0x30)    // movdqa [rsp+0x30], xmm1
+		emit(0x66, 0x0F, 0x7F, 0x54, 0x24, 0x40)    // movdqa [rsp+0x40], xmm2
+		emit(0x66, 0x0F, 0x7F, 0x5C, 0x24, 0x50)    // movdqa [rsp+0x50], xmm3
+		emit(0x48, 0x8B, 0xD0)                      // mov rdx, rax (IAT slot)
+		emitRel(s.descriptor, 0x48, 0x8D, 0x0D)     // lea rcx, [descriptor]
+		emitRel(s.helper, 0xE8)                     // call __delayLoadHelper2
+		emit(0x66, 0x0F, 0x6F, 0x44, 0x24, 0x20)    // movdqa xmm0, [rsp+0x20]
+		emit(0x66, 0x0F, 0x6F, 0x4C, 0x24, 0x30)    // movdqa xmm1, [rsp+0x30]
+		emit(0x66, 0x0F, 0x6F, 0x54, 0x24, 0x40)    // movdqa xmm2, [rsp+0x40]
+		emit(0x66, 0x0F, 0x6F, 0x5C, 0x24, 0x50)    // movdqa xmm3, [rsp+0x50]
+		emit(0x48, 0x8B, 0x4C, 0x24, 0x70)          // mov rcx, [rsp+0x70]
+		emit(0x48, 0x8B, 0x54, 0x24, 0x78)          // mov rdx, [rsp+0x78]
+		emit(0x4C, 0x8B, 0x84, 0x24, 0x80, 0, 0, 0) // mov r8, [rsp+0x80]
+		emit(0x4C, 0x8B, 0x8C, 0x24, 0x88, 0, 0, 0) // mov r9, [rsp+0x88]
+		emit(0x48, 0x83, 0xC4, tailMergeFrameX64)   // add rsp, 0x68
+		emit(0xFF, 0xE0)                            // jmp rax
+	} else {
+		emit(0x51, 0x52, 0x50)       // push ecx; push edx; push eax (IAT slot)
+		emitAbs(s.descriptor, 0x68)  // push descriptor
+		emitRel(s.helper, 0xE8)      // call __delayLoadHelper2 (stdcall)
+		emit(0x5A, 0x59, 0xFF, 0xE0) // pop edx; pop ecx; jmp eax
+	}
+	tailMergeEnd = s.code + uint32(len(code))
+	for len(code)%16 != 0 {
+		emit(0xCC)
+	}
+
+	ptrSize := uint32(4)
+	if s.is64 {
+		ptrSize = 8
+	}
+	for i := 0; i < count; i++ {
+		thunks = append(thunks, s.code+uint32(len(code)))
+		slot := s.iat + uint32(i)*ptrSize
+		if s.is64 {
+			emitRel(slot, 0x48, 0x8D, 0x05) // lea rax, [slot]
+		} else {
+			emitAbs(slot, 0xB8) // mov eax, slot
+		}
+		emitRel(s.code, 0xE9) // jmp tailMerge
+	}
+	return code, thunks, tailMergeEnd, relocs
+}
+
+// AddDelayImport adds a delay-loaded DLL: the import is resolved on the first
+// call to one of its functions instead of at process start, so a missing DLL
+// does not prevent the program from starting. The image must already link
+// __delayLoadHelper2 (see FindDelayLoadHelper); the new load thunks call it.
+//
+// The descriptor table is rebuilt in a new .didat2 section together with the
+// new module handle slot, delay IAT, INT and names, and the thunks go into a
+// new .dlthunk code section. Absolute addresses get base relocations, and on
+// x64 the tail-merge routine gets unwind data.
+func (p *Patcher) AddDelayImport(dllName string, functions []string) error {
+	var is64 bool
+	switch p.peFile.Machine {
+	case pe.IMAGE_FILE_MACHINE_I386:
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		is64 = true
+	default:
+		return fmt.Errorf("延迟加载导入仅支持x86和x64文件")
+	}
+	if len(functions) == 0 {
+		return fmt.Errorf("必须指定至少一个函数")
+	}
+	for _, fn := range functions {
+		if strings.HasPrefix(fn, "#") {
+			return fmt.Errorf("延迟加载导入不支持按序号导入: %s", fn)
+		}
+	}
+
+	// Pick up sections injected earlier in the same session
+	if err := p.Reload(); err != nil {
+		return err
+	}
+
+	helper, err := FindDelayLoadHelper(p.peFile, p.file)
+	if err != nil {
+		return fmt.Errorf("无法添加延迟加载导入: %w", err)
+	}
+	if err := p.checkDelayImportName(dllName); err != nil {
+		return err
+	}
+
+	descriptors, err := readDelayDescriptors(p.peFile, p.file)
+	if err != nil {
+		return err
+	}
+
+	ptrSize := uint32(4)
+	if is64 {
+		ptrSize = 8
+	}
+	layout := newDelayImportLayout(len(descriptors), dllName, functions, ptrSize)
+	placeholder, _, _, _ := delayLoadStubs{is64: is64}.build(len(functions))
+
+	// Reserve both sections first; the contents depend on their RVAs
+	if err := p.InjectSection(".didat2", make([]byte, layout.size),
+		pe.IMAGE_SCN_CNT_INITIALIZED_DATA|pe.IMAGE_SCN_MEM_READ|pe.IMAGE_SCN_MEM_WRITE); err != nil {
+		return err
+	}
+	if err := p.Reload(); err != nil {
+		return err
+	}
+	dataSection := p.peFile.Sections[len(p.peFile.Sections)-1]
+	if err := p.InjectSection(".dlthunk", make([]byte, len(placeholder)),
+		pe.IMAGE_SCN_CNT_CODE|pe.IMAGE_SCN_MEM_READ|pe.IMAGE_SCN_MEM_EXECUTE); err != nil {
+		return err
+	}
+	if err := p.Reload(); err != nil {
+		return err
+	}
+	codeSection := p.peFile.Sections[len(p.peFile.Sections)-1]
+
+	dataRVA := dataSection.VirtualAddress
+	descriptorRVA := dataRVA + uint32(len(descriptors))*delayDescriptorSize
+	stubs := delayLoadStubs{
+		is64:       is64,
+		base:       imageBase(p.peFile),
+		code:       codeSection.VirtualAddress,
+		descriptor: descriptorRVA,
+		iat:        dataRVA + layout.iat,
+		helper:     helper,
+	}
+	code, thunks, tailMergeEnd, codeRelocs := stubs.build(len(functions))
+
+	data := make([]byte, layout.size)
+	for i, desc := range descriptors {
+		desc.encode(data[i*delayDescriptorSize:])
+	}
+	DelayImportDescriptor{
+		Attributes:            dlattrRVA,
+		DllNameRVA:            dataRVA + layout.dllName,
+		ModuleHandleRVA:       dataRVA + layout.moduleHandle,
+		ImportAddressTableRVA: dataRVA + layout.iat,
+		ImportNameTableRVA:    dataRVA + layout.int,
+	}.encode(data[descriptorRVA-dataRVA:])
+
+	var dataRelocs []uint32
+	for i, fn := range functions {
+		iatEntry := layout.iat + uint32(i)*ptrSize
+		intEntry := layout.int + uint32(i)*ptrSize
+		thunkVA := stubs.base + uint64(thunks[i])
+		if is64 {
+			binary.LittleEndian.PutUint64(data[iatEntry:], thunkVA)
+			binary.LittleEndian.PutUint64(data[intEntry:], uint64(dataRVA+layout.names[i]))
+		} else {
+			binary.LittleEndian.PutUint32(data[iatEntry:], uint32(thunkVA))
+			binary.LittleEndian.PutUint32(data[intEntry:], dataRVA+layout.names[i])
+		}
+		dataRelocs = append(dataRelocs, dataRVA+iatEntry)
+		copy(data[layout.names[i]+2:], fn) // Hint 0
+	}
+	copy(data[layout.dllName:], dllName)
+
+	if _, err := p.file.WriteAt(data, int64(dataSection.Offset)); err != nil {
+		return fmt.Errorf("写入延迟加载导入数据失败: %w", err)
+	}
+	if _, err := p.file.WriteAt(code, int64(codeSection.Offset)); err != nil {
+		return fmt.Errorf("写入延迟加载桩代码失败: %w", err)
+	}
+	if err := p.setDataDirectory(dataDirDelayImport, dataRVA, uint32(len(descriptors)+2)*delayDescriptorSize); err != nil {
+		return err
+	}
+	if err := p.Reload(); err != nil {
+		return err
+	}
+
+	if is64 {
+		if err := p.AddBaseRelocations(IMAGE_REL_BASED_DIR64, dataRelocs...); err != nil {
+			return err
+		}
+		return p.AddRuntimeFunctions(UnwindFunction{
+			BeginAddress: codeSection.VirtualAddress,
+			EndAddress:   tailMergeEnd,
+			Prolog:       []PrologOp{{Kind: PrologAlloc, Size: tailMergeFrameX64}},
+		})
+	}
+	return p.AddBaseRelocations(IMAGE_REL_BASED_HIGHLOW, append(dataRelocs, codeRelocs...)...)
+}
+
+// checkDelayImportName rejects a DLL that is already imported, normally or
+// delay-loaded.
+func (p *Patcher) checkDelayImportName(dllName string) error {
+	imports, err := p.ListImports()
+	if err == nil {
+		for _, imp := range imports {
+			if strings.EqualFold(imp.DLL, dllName) {
+				return fmt.Errorf("DLL %s 已存在于导入表中", dllName)
+			}
+		}
+	}
+
+	delayed, _ := ParseDelayImports(p.peFile, p.file)
+	for _, imp := range delayed {
+		if strings.EqualFold(imp.DLL, dllName) {
+			return fmt.Errorf("DLL %s 已存在于延迟加载导入表中", dllName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package pe
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// delayImportImage lays out a PE32 image with one section at RVA 0x1000 and
+// a delay-load descriptor for "user32.dll" importing MessageBoxA and
+// ordinal 5. In the VA form every address is offset by the image base.
+func delayImportImage(rvaBased bool) (*pe.File, []byte) {
+	const base = 0x400000
+	le := binary.LittleEndian
+	data := make([]byte, 0x400)
+	addr := func(rva uint32) uint32 {
+		if rvaBased {
+			return rva
+		}
+		return rva + base
+	}
+
+	// Descriptor at 0x1000, terminator at 0x1020
+	desc := []uint32{0, addr(0x1100), addr(0x1110), addr(0x1120), addr(0x1140), addr(0x1160), 0, 0x5F000000}
+	if rvaBased {
+		desc[0] = dlattrRVA
+	}
+	for i, v := range desc {
+		le.PutUint32(data[i*4:], v)
+	}
+	copy(data[0x100:], "user32.dll\x00")
+	// IAT entries point at the load thunks, INT at hint/name and ordinal
+	le.PutUint32(data[0x120:], base+0x1300)
+	le.PutUint32(data[0x124:], base+0x1308)
+	le.PutUint32(data[0x140:], addr(0x1180))
+	le.PutUint32(data[0x144:], 0x80000005)
+	le.PutUint32(data[0x160:], 0x77D50000)
+	le.PutUint32(data[0x164:], 0x77D51000)
+	le.PutUint16(data[0x180:], 0x1BD)
+	copy(data[0x182:], "MessageBoxA\x00")
+
+	oh := &pe.OptionalHeader32{ImageBase: base, NumberOfRvaAndSizes: 16}
+	oh.DataDirectory[dataDirDelayImport] = pe.DataDirectory{VirtualAddress: 0x1000, Size: 0x40}
+	f := &pe.File{
+		OptionalHeader: oh,
+		Sections: []*pe.Section{{SectionHeader: pe.SectionHeader{
+			Name: ".rdata", VirtualAddress: 0x1000, VirtualSize: 0x400, Size: 0x400, Offset: 0,
+		}}},
+	}
+	return f, data
+}
+
+func TestParseDelayImports(t *testing.T) {
+	for _, rvaBased := range []bool{true, false} {
+		f, data := delayImportImage(rvaBased)
+		imports, err := ParseDelayImports(f, bytes.NewReader(data))
+		if err != nil || len(imports) != 1 {
+			t.Fatalf("ParseDelayImports(rvaBased=%v) = %+v, %v", rvaBased, imports, err)
+		}
+
+		imp := imports[0]
+		if imp.DLL != "user32.dll" || imp.RVABased() != rvaBased {
+			t.Errorf("DLL = %q, RVABased = %v", imp.DLL, imp.RVABased())
+		}
+		if imp.ModuleHandleRVA != 0x1110 || imp.IATRVA != 0x1120 || imp.INTRVA != 0x1140 || imp.BoundIATRVA != 0x1160 {
+			t.Errorf("addresses not normalized to RVAs: %+v", imp)
+		}
+		if !imp.Bound() || imp.UnloadIATRVA != 0 {
+			t.Errorf("Bound() = %v, UnloadIATRVA = 0x%X", imp.Bound(), imp.UnloadIATRVA)
+		}
+
+		if got := imp.FunctionNames(); len(got) != 2 || got[0] != "MessageBoxA" || got[1] != "Ordinal_5" {
+			t.Fatalf("FunctionNames() = %v", got)
+		}
+		fn := imp.Functions[0]
+		if fn.Hint != 0x1BD || fn.IATAddress != 0x1120 || fn.Thunk != 0x401300 || fn.BoundAddress != 0x77D50000 {
+			t.Errorf("Functions[0] = %+v", fn)
+		}
+		if fn := imp.Functions[1]; !fn.IsByOrdinal || fn.Ordinal != 5 || fn.IATAddress != 0x1124 {
+			t.Errorf("Functions[1] = %+v", fn)
+		}
+	}
+}
+
+func TestParseDelayImportsNone(t *testing.T) {
+	f, data := delayImportImage(true)
+	f.OptionalHeader.(*pe.OptionalHeader32).DataDirectory[dataDirDelayImport] = pe.DataDirectory{}
+	if imports, err := ParseDelayImports(f, bytes.NewReader(data)); imports != nil || err != nil {
+		t.Errorf("ParseDelayImports(no directory) = %v, %v; want nil, nil", imports, err)
+	}
+}
+
+func TestDelayLoadStubs(t *testing.T) {
+	for _, is64 := range []bool{false, true} {
+		// Helper at 0x1000 and stubs at 0x1800 in one code section
+		const base = 0x10000000
+		stubs := delayLoadStubs{is64: is64, base: base, code: 0x1800, descriptor: 0x3040, iat: 0x3088, helper: 0x1000}
+		code, thunks, tailMergeEnd, relocs := stubs.build(2)
+
+		if tailMergeEnd <= stubs.code || thunks[0] != alignUp(tailMergeEnd, 16) {
+			t.Errorf("is64=%v: tail-merge ends at 0x%X, first thunk at 0x%X", is64, tailMergeEnd, thunks[0])
+		}
+		if is64 && (len(relocs) != 0 || code[3] != tailMergeFrameX64) {
+			t.Errorf("x64 stubs: relocs %X, prolog % X", relocs, code[:4])
+		}
+		if !is64 && !reflect.DeepEqual(relocs, []uint32{0x1804, thunks[0] + 1, thunks[1] + 1}) {
+			t.Errorf("x86 relocs = %X", relocs)
+		}
+
+		data := make([]byte, 0x1000)
+		copy(data[0x800:], code)
+		f := &pe.File{
+			FileHeader:     pe.FileHeader{Machine: pe.IMAGE_FILE_MACHINE_I386},
+			OptionalHeader: &pe.OptionalHeader32{ImageBase: base},
+			Sections: []*pe.Section{{SectionHeader: pe.SectionHeader{
+				VirtualAddress: 0x1000, VirtualSize: 0x1000, Size: 0x1000,
+				Characteristics: pe.IMAGE_SCN_MEM_EXECUTE,
+			}}},
+		}
+		if is64 {
+			f.Machine = pe.IMAGE_FILE_MACHINE_AMD64
+			f.OptionalHeader = &pe.OptionalHeader64{ImageBase: base}
+		}
+
+		// The generated stubs follow the same pattern as the linker's
+		if helper, ok := traceDelayLoadHelper(f, bytes.NewReader(data), base+uint64(thunks[1])); !ok || helper != 0x1000 {
+			t.Errorf("is64=%v: traceDelayLoadHelper() = 0x%X, %v; want 0x1000", is64, helper, ok)
+		}
+	}
+}
+
+func TestNewDelayImportLayout(t *testing.T) {
+	l := newDelayImportLayout(2, "plugin.dll", []string{"Init", "Run"}, 8)
+
+	// Three descriptors plus the terminator, then handle, IAT and INT
+	if l.moduleHandle != 0x80 || l.iat != 0x88 || l.int != 0xA0 {
+		t.Errorf("layout = %+v", l)
+	}
+	if !reflect.DeepEqual(l.names, []uint32{0xB8, 0xC0}) || l.dllName != 0xC6 || l.size != 0xC6+11 {
+		t.Errorf("names = %X, dllName = 0x%X, size = 0x%X", l.names, l.dllName, l.size)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -16,6 +17,7 @@ type DependencyNode struct {
 	Found        bool              // Whether the DLL was found
 	Dependencies []*DependencyNode // Child dependencies
 	Depth        int               // Depth in dependency tree
+	Delayed      bool              // Imported through the delay-load directory
 }
 
 // DependencyAnalysis contains the complete dependency analysis result.
@@ -26,6 +28,11 @@ type DependencyAnalysis struct {
 	TotalCount   int               // Total number of unique dependencies
 	MaxDepth     int               // Maximum dependency depth
 	HasCycles    bool              // Whether circular dependencies exist
+	DelayLoaded  []string          // Dependencies that are only ever delay-loaded
+
+	// delayOnly tracks, per dependency, whether every import seen so far
+	// was a delay-load import
+	delayOnly map[string]bool
 }
 
 // systemDLLs is a list of well-known Windows system DLLs that we skip recursion for.
@@ -72,6 +79,7 @@ func AnalyzeDependencies(filePath string, maxDepth int) (*DependencyAnalysis, er
 	analysis := &DependencyAnalysis{
 		AllDeps:     make(map[string]string),
 		MissingDeps: make([]string, 0),
+		delayOnly:   make(map[string]bool),
 	}
 
 	// Build dependency tree
@@ -83,6 +91,12 @@ func AnalyzeDependencies(filePath string, maxDepth int) (*DependencyAnalysis, er
 
 	analysis.Root = root
 	analysis.TotalCount = len(analysis.AllDeps)
+	for dll, delayed := range analysis.delayOnly {
+		if delayed {
+			analysis.DelayLoaded = append(analysis.DelayLoaded, dll)
+		}
+	}
+	sort.Strings(analysis.DelayLoaded)
 
 	return analysis, nil
 }
@@ -155,9 +169,25 @@ func buildDependencyTree(filePath string, depth, maxDepth int, visited map[strin
 		return node, nil // Can't get imports, skip
 	}
 
+	// Delay-loaded DLLs are followed too, but a DLL that is also imported
+	// normally is loaded at startup and not marked
+	delayed := getDelayImportedDLLs(peFile, f)
+	for dllName := range delayed {
+		if dllMap[dllName] {
+			delete(delayed, dllName)
+		} else {
+			dllMap[dllName] = true
+		}
+	}
+
 	// Process each DLL dependency
 	baseDir := filepath.Dir(filePath)
 	for dllName := range dllMap {
+		isDelayed := delayed[dllName]
+		if seenDelayOnly, seen := analysis.delayOnly[dllName]; !seen || seenDelayOnly {
+			analysis.delayOnly[dllName] = isDelayed
+		}
+
 		// Skip system DLLs for recursion (but still record them)
 		if isSystemDLL(dllName) {
 			analysis.AllDeps[dllName] = "<system>"
@@ -174,10 +204,11 @@ func buildDependencyTree(filePath string, depth, maxDepth int, visited map[strin
 			}
 
 			childNode := &DependencyNode{
-				Name:  dllName,
-				Path:  "",
-				Found: false,
-				Depth: depth + 1,
+				Name:    dllName,
+				Path:    "",
+				Found:   false,
+				Depth:   depth + 1,
+				Delayed: isDelayed,
 			}
 			node.Dependencies = append(node.Dependencies, childNode)
 		} else {
@@ -194,6 +225,7 @@ func buildDependencyTree(filePath string, depth, maxDepth int, visited map[strin
 					Depth: depth + 1,
 				}
 			}
+			childNode.Delayed = isDelayed
 			node.Dependencies = append(node.Dependencies, childNode)
 		}
 	}
@@ -305,6 +337,9 @@ func PrintDependencyTree(node *DependencyNode, prefix string, isLast bool) {
 	} else if node.Path == "<system>" {
 		status = " (system)"
 	}
+	if node.Delayed {
+		status += " (delay-load)"
+	}
 
 	fmt.Printf("%s%s%s%s\n", prefix, marker, node.Name, status)
 
@@ -332,12 +367,13 @@ func PrintDependencyList(analysis *DependencyAnalysis) {
 	fmt.Printf("总计依赖: %d 个\n", analysis.TotalCount)
 	fmt.Printf("最大深度: %d\n", analysis.MaxDepth)
 	fmt.Printf("循环依赖: %v\n", analysis.HasCycles)
-	fmt.Printf("缺失依赖: %d 个\n\n", len(analysis.MissingDeps))
+	fmt.Printf("缺失依赖: %d 个\n", len(analysis.MissingDeps))
+	fmt.Printf("延迟加载: %d 个\n\n", len(analysis.DelayLoaded))
 
 	if len(analysis.MissingDeps) > 0 {
 		fmt.Printf("⚠️  缺失的 DLL:\n")
 		for _, dll := range analysis.MissingDeps {
-			fmt.Printf("  - %s\n", dll)
+			fmt.Printf("  - %s%s\n", dll, analysis.delayLoadMark(dll))
 		}
 		fmt.Printf("\n")
 	}
@@ -345,14 +381,37 @@ func PrintDependencyList(analysis *DependencyAnalysis) {
 	fmt.Printf("所有依赖:\n")
 	for dll, path := range analysis.AllDeps {
 		if path == "<system>" {
-			fmt.Printf("  ✓ %s (系统DLL)\n", dll)
+			fmt.Printf("  ✓ %s (系统DLL)%s\n", dll, analysis.delayLoadMark(dll))
 		} else {
-			fmt.Printf("  ✓ %s\n", dll)
+			fmt.Printf("  ✓ %s%s\n", dll, analysis.delayLoadMark(dll))
 			fmt.Printf("    → %s\n", path)
 		}
 	}
 }
 
+// IsDelayLoaded reports whether the DLL is only ever imported through the
+// delay-load directory, so a missing copy fails on first use, not at startup.
+func (a *DependencyAnalysis) IsDelayLoaded(dllName string) bool {
+	return contains(a.DelayLoaded, dllName)
+}
+
+func (a *DependencyAnalysis) delayLoadMark(dllName string) string {
+	if a.IsDelayLoaded(dllName) {
+		return " (延迟加载)"
+	}
+	return ""
+}
+
+// getDelayImportedDLLs extracts DLL names from the delay-load import directory.
+func getDelayImportedDLLs(peFile *pe.File, r *os.File) map[string]bool {
+	dllMap := make(map[string]bool)
+	imports, _ := ParseDelayImports(peFile, r)
+	for _, imp := range imports {
+		dllMap[strings.ToLower(imp.DLL)] = true
+	}
+	return dllMap
+}
+
 // getImportedDLLs extracts DLL names from the import directory.
 func getImportedDLLs(peFile *pe.File, r *os.File) (map[string]bool, error) {
 	dllMap := make(map[string]bool)
@@ -0,0 +1,455 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Exception directory constants.
+const (
+	dataDirException = 3
+
+	runtimeFunctionSizeX64   = 12
+	runtimeFunctionSizeARM64 = 8
+
+	// maxRuntimeFunctions bounds the directory walk on corrupt images.
+	maxRuntimeFunctions = 1 << 20
+	// maxUnwindChain bounds chained unwind info resolution.
+	maxUnwindChain = 32
+)
+
+// UNWIND_INFO flags.
+const (
+	UNW_FLAG_EHANDLER  = 0x1 //nolint:revive // ALL_CAPS matches Windows SDK naming
+	UNW_FLAG_UHANDLER  = 0x2 //nolint:revive // ALL_CAPS matches Windows SDK naming
+	UNW_FLAG_CHAININFO = 0x4 //nolint:revive // ALL_CAPS matches Windows SDK naming
+)
+
+// x64 unwind operation codes.
+const (
+	UWOP_PUSH_NONVOL     = 0  //nolint:revive // ALL_CAPS matches Windows SDK naming
+	UWOP_ALLOC_LARGE     = 1  //nolint:revive // ALL_CAPS matches Windows SDK naming
+	UWOP_ALLOC_SMALL     = 2  //nolint:revive // ALL_CAPS matches Windows SDK naming
+	UWOP_SET_FPREG       = 3  //nolint:revive // ALL_CAPS matches Windows SDK naming
+	UWOP_SAVE_NONVOL     = 4  //nolint:revive // ALL_CAPS matches Windows SDK naming
+	UWOP_SAVE_NONVOL_FAR = 5  //nolint:revive // ALL_CAPS matches Windows SDK naming
+	UWOP_EPILOG          = 6  //nolint:revive // ALL_CAPS matches Windows SDK naming
+	UWOP_SPARE_CODE      = 7  //nolint:revive // ALL_CAPS matches Windows SDK naming
+	UWOP_SAVE_XMM128     = 8  //nolint:revive // ALL_CAPS matches Windows SDK naming
+	UWOP_SAVE_XMM128_FAR = 9  //nolint:revive // ALL_CAPS matches Windows SDK naming
+	UWOP_PUSH_MACHFRAME  = 10 //nolint:revive // ALL_CAPS matches Windows SDK naming
+)
+
+var x64RegisterNames = []string{
+	"rax", "rcx", "rdx", "rbx", "rsp", "rbp", "rsi", "rdi",
+	"r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15",
+}
+
+// ExceptionInfo contains the decoded exception directory (.pdata).
+type ExceptionInfo struct {
+	HasExceptions bool
+	Machine       uint16
+	// Functions is sorted by BeginAddress, as the loader requires.
+	Functions []RuntimeFunction
+}
+
+// RuntimeFunction is one RUNTIME_FUNCTION entry. EndAddress is exclusive.
+type RuntimeFunction struct {
+	BeginAddress uint32
+	EndAddress   uint32
+	// UnwindInfoAddress is the RVA of UNWIND_INFO (x64) or .xdata (ARM64).
+	// It is zero for ARM64 packed unwind data.
+	UnwindInfoAddress uint32
+	Unwind            *UnwindInfo      // x64
+	ARM64             *ARM64UnwindInfo // ARM64
+}
+
+// Size returns the length of the function body in bytes.
+func (rf *RuntimeFunction) Size() uint32 {
+	if rf.EndAddress <= rf.BeginAddress {
+		return 0
+	}
+	return rf.EndAddress - rf.BeginAddress
+}
+
+// HandlerAddress returns the RVA of the language-specific exception handler,
+// or zero if the function has none.
+func (rf *RuntimeFunction) HandlerAddress() uint32 {
+	switch {
+	case rf.Unwind != nil:
+		return rf.Unwind.HandlerAddress
+	case rf.ARM64 != nil:
+		return rf.ARM64.HandlerAddress
+	}
+	return 0
+}
+
+// UnwindInfo is the x64 UNWIND_INFO structure.
+type UnwindInfo struct {
+	Version       uint8
+	Flags         uint8
+	SizeOfProlog  uint8
+	CountOfCodes  uint8
+	FrameRegister uint8
+	// FrameOffset is the scaled offset in bytes (the raw nibble times 16).
+	FrameOffset    uint32
+	Codes          []UnwindCode
+	HandlerAddress uint32
+	// Chained is the parent function whose unwind data continues this one
+	// (UNW_FLAG_CHAININFO).
+	Chained *RuntimeFunction
+}
+
+// FrameRegisterName returns the name of the frame pointer register, or an
+// empty string if the function does not establish one.
+func (u *UnwindInfo) FrameRegisterName() string {
+	if u.FrameRegister == 0 {
+		return ""
+	}
+	return x64RegisterName(u.FrameRegister)
+}
+
+func x64RegisterName(i uint8) string {
+	if int(i) < len(x64RegisterNames) {
+		return x64RegisterNames[i]
+	}
+	return fmt.Sprintf("r%d", i)
+}
+
+// UnwindCode is one decoded x64 unwind operation. Operations that take more
+// than one slot are folded into a single code.
+type UnwindCode struct {
+	CodeOffset uint8
+	Op         uint8
+	OpInfo     uint8
+	// Operand is the allocation size or save offset, when the operation has one.
+	Operand uint32
+}
+
+// String renders the operation in the style of dumpbin /unwindinfo.
+func (c UnwindCode) String() string {
+	switch c.Op {
+	case UWOP_PUSH_NONVOL:
+		return "PUSH_NONVOL " + x64RegisterName(c.OpInfo)
+	case UWOP_ALLOC_LARGE, UWOP_ALLOC_SMALL:
+		return fmt.Sprintf("ALLOC 0x%X", c.Operand)
+	case UWOP_SET_FPREG:
+		return "SET_FPREG"
+	case UWOP_SAVE_NONVOL, UWOP_SAVE_NONVOL_FAR:
+		return fmt.Sprintf("SAVE_NONVOL %s, 0x%X", x64RegisterName(c.OpInfo), c.Operand)
+	case UWOP_SAVE_XMM128, UWOP_SAVE_XMM128_FAR:
+		return fmt.Sprintf("SAVE_XMM128 xmm%d, 0x%X", c.OpInfo, c.Operand)
+	case UWOP_PUSH_MACHFRAME:
+		if c.OpInfo == 1 {
+			return "PUSH_MACHFRAME (错误码)"
+		}
+		return "PUSH_MACHFRAME"
+	case UWOP_EPILOG:
+		return "EPILOG"
+	}
+	return fmt.Sprintf("UWOP_%d", c.Op)
+}
+
+// ARM64UnwindInfo describes ARM64 unwind data, either packed into the .pdata
+// entry or stored as an .xdata record.
+type ARM64UnwindInfo struct {
+	// Flag is the low two bits of the .pdata entry: 0 for .xdata, 1 for packed
+	// data with a canonical prolog/epilog, 2 for packed fragment data.
+	Flag           uint8
+	FunctionLength uint32 // Bytes
+
+	// Packed unwind data fields.
+	RegF      uint8
+	RegI      uint8
+	H         bool
+	CR        uint8
+	FrameSize uint32 // Bytes
+
+	// .xdata fields.
+	Version        uint8
+	EpilogInHeader bool
+	EpilogCount    uint16
+	CodeWords      uint8
+	HandlerAddress uint32
+}
+
+// Packed reports whether the unwind data is packed into the .pdata entry.
+func (u *ARM64UnwindInfo) Packed() bool {
+	return u.Flag != 0
+}
+
+// ParseExceptionDirectory decodes the exception directory of x64 and ARM64
+// images. Other machines have no table-based unwind data and yield an empty
+// result.
+func ParseExceptionDirectory(f *pe.File, r io.ReaderAt) (*ExceptionInfo, error) {
+	info := &ExceptionInfo{Machine: f.Machine}
+
+	var entrySize uint32
+	switch f.Machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		entrySize = runtimeFunctionSizeX64
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		entrySize = runtimeFunctionSizeARM64
+	default:
+		return info, nil
+	}
+
+	rva, size := dataDirectory(f, dataDirException)
+	if rva == 0 || size < entrySize {
+		return info, nil
+	}
+	info.HasExceptions = true
+
+	offset, err := rvaToOffset(f, rva)
+	if err != nil {
+		return info, fmt.Errorf("定位异常目录失败: %w", err)
+	}
+
+	count := min(size/entrySize, maxRuntimeFunctions)
+	data := make([]byte, count*entrySize)
+	if _, err := r.ReadAt(data, int64(offset)); err != nil {
+		return info, fmt.Errorf("读取异常目录失败: %w", err)
+	}
+
+	p := &unwindParser{f: f, r: r, cache: make(map[uint32]*UnwindInfo)}
+	info.Functions = make([]RuntimeFunction, 0, count)
+	for i := uint32(0); i < count; i++ {
+		entry := data[i*entrySize:]
+		var rf RuntimeFunction
+		if entrySize == runtimeFunctionSizeX64 {
+			rf = p.x64Function(entry, 0)
+		} else {
+			rf = p.arm64Function(entry)
+		}
+		if rf.BeginAddress == 0 && rf.EndAddress == 0 {
+			continue // Zero padding at the end of the directory
+		}
+		info.Functions = append(info.Functions, rf)
+	}
+
+	sort.SliceStable(info.Functions, func(i, j int) bool {
+		return info.Functions[i].BeginAddress < info.Functions[j].BeginAddress
+	})
+	return info, nil
+}
+
+// FunctionAt returns the function whose body contains rva, or nil.
+func (e *ExceptionInfo) FunctionAt(rva uint32) *RuntimeFunction {
+	i := sort.Search(len(e.Functions), func(i int) bool {
+		return e.Functions[i].EndAddress > rva
+	})
+	if i < len(e.Functions) && e.Functions[i].BeginAddress <= rva {
+		return &e.Functions[i]
+	}
+	return nil
+}
+
+// HandlerCount returns the number of functions with an exception handler.
+func (e *ExceptionInfo) HandlerCount() int {
+	n := 0
+	for i := range e.Functions {
+		if e.Functions[i].HandlerAddress() != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// ChainedCount returns the number of x64 functions whose unwind info is
+// chained to a parent function.
+func (e *ExceptionInfo) ChainedCount() int {
+	n := 0
+	for i := range e.Functions {
+		if u := e.Functions[i].Unwind; u != nil && u.Chained != nil {
+			n++
+		}
+	}
+	return n
+}
+
+type unwindParser struct {
+	f     *pe.File
+	r     io.ReaderAt
+	cache map[uint32]*UnwindInfo
+}
+
+func (p *unwindParser) x64Function(entry []byte, depth int) RuntimeFunction {
+	rf := RuntimeFunction{
+		BeginAddress:      binary.LittleEndian.Uint32(entry[0:4]),
+		EndAddress:        binary.LittleEndian.Uint32(entry[4:8]),
+		UnwindInfoAddress: binary.LittleEndian.Uint32(entry[8:12]),
+	}
+	if rf.UnwindInfoAddress != 0 {
+		rf.Unwind = p.x64Unwind(rf.UnwindInfoAddress, depth)
+	}
+	return rf
+}
+
+// x64Unwind decodes UNWIND_INFO at rva. Unwind info is commonly shared
+// between functions, so results are cached.
+func (p *unwindParser) x64Unwind(rva uint32, depth int) *UnwindInfo {
+	if u, ok := p.cache[rva]; ok {
+		return u
+	}
+	offset, err := rvaToOffset(p.f, rva)
+	if err != nil {
+		return nil
+	}
+
+	header := make([]byte, 4)
+	if _, err := p.r.ReadAt(header, int64(offset)); err != nil {
+		return nil
+	}
+	u := &UnwindInfo{
+		Version:       header[0] & 0x07,
+		Flags:         header[0] >> 3,
+		SizeOfProlog:  header[1],
+		CountOfCodes:  header[2],
+		FrameRegister: header[3] & 0x0F,
+		FrameOffset:   uint32(header[3]>>4) * 16,
+	}
+	p.cache[rva] = u
+
+	// Codes are padded to an even count, followed by the chained function
+	// or the handler RVA
+	slots := (int(u.CountOfCodes) + 1) &^ 1
+	tail := make([]byte, slots*2+runtimeFunctionSizeX64)
+	n, _ := p.r.ReadAt(tail, int64(offset)+4)
+	tail = tail[:n]
+	if len(tail) < int(u.CountOfCodes)*2 {
+		return u
+	}
+	u.Codes = decodeUnwindCodes(tail[:int(u.CountOfCodes)*2])
+
+	rest := tail[min(slots*2, len(tail)):]
+	switch {
+	case u.Flags&UNW_FLAG_CHAININFO != 0:
+		if len(rest) >= runtimeFunctionSizeX64 && depth < maxUnwindChain {
+			parent := p.x64Function(rest, depth+1)
+			u.Chained = &parent
+		}
+	case u.Flags&(UNW_FLAG_EHANDLER|UNW_FLAG_UHANDLER) != 0:
+		if len(rest) >= 4 {
+			u.HandlerAddress = binary.LittleEndian.Uint32(rest)
+		}
+	}
+	return u
+}
+
+func decodeUnwindCodes(data []byte) []UnwindCode {
+	slot := func(i int) uint32 {
+		if 2*i+2 > len(data) {
+			return 0
+		}
+		return uint32(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+
+	var codes []UnwindCode
+	for i := 0; i < len(data)/2; {
+		c := UnwindCode{
+			CodeOffset: data[2*i],
+			Op:         data[2*i+1] & 0x0F,
+			OpInfo:     data[2*i+1] >> 4,
+		}
+
+		used := 1
+		switch c.Op {
+		case UWOP_ALLOC_LARGE:
+			if c.OpInfo == 0 {
+				c.Operand = slot(i+1) * 8
+				used = 2
+			} else {
+				c.Operand = slot(i+1) | slot(i+2)<<16
+				used = 3
+			}
+		case UWOP_ALLOC_SMALL:
+			c.Operand = uint32(c.OpInfo)*8 + 8
+		case UWOP_SAVE_NONVOL:
+			c.Operand = slot(i+1) * 8
+			used = 2
+		case UWOP_SAVE_NONVOL_FAR, UWOP_SAVE_XMM128_FAR:
+			c.Operand = slot(i+1) | slot(i+2)<<16
+			used = 3
+		case UWOP_SAVE_XMM128:
+			c.Operand = slot(i+1) * 16
+			used = 2
+		case UWOP_EPILOG:
+			used = 2
+		case UWOP_SPARE_CODE:
+			used = 3
+		}
+
+		codes = append(codes, c)
+		i += used
+	}
+	return codes
+}
+
+func (p *unwindParser) arm64Function(entry []byte) RuntimeFunction {
+	begin := binary.LittleEndian.Uint32(entry[0:4])
+	data := binary.LittleEndian.Uint32(entry[4:8])
+
+	u := &ARM64UnwindInfo{Flag: uint8(data & 0x3)}
+	rf := RuntimeFunction{BeginAddress: begin, ARM64: u}
+
+	if u.Packed() {
+		u.FunctionLength = (data >> 2 & 0x7FF) * 4
+		u.RegF = uint8(data >> 13 & 0x7)
+		u.RegI = uint8(data >> 16 & 0xF)
+		u.H = data>>20&0x1 != 0
+		u.CR = uint8(data >> 21 & 0x3)
+		u.FrameSize = (data >> 23) * 16
+	} else {
+		rf.UnwindInfoAddress = data
+		p.arm64XData(data, u)
+	}
+
+	rf.EndAddress = begin + u.FunctionLength
+	return rf
+}
+
+// arm64XData decodes the .xdata header and locates the exception handler.
+func (p *unwindParser) arm64XData(rva uint32, u *ARM64UnwindInfo) {
+	offset, err := rvaToOffset(p.f, rva)
+	if err != nil {
+		return
+	}
+
+	header := make([]byte, 8)
+	if n, _ := p.r.ReadAt(header, int64(offset)); n < 4 {
+		return
+	}
+	word := binary.LittleEndian.Uint32(header)
+	u.FunctionLength = (word & 0x3FFFF) * 4
+	u.Version = uint8(word >> 18 & 0x3)
+	hasHandler := word>>20&0x1 != 0
+	u.EpilogInHeader = word>>21&0x1 != 0
+	u.EpilogCount = uint16(word >> 22 & 0x1F)
+	u.CodeWords = uint8(word >> 27)
+
+	headerSize := uint32(4)
+	if u.EpilogCount == 0 && u.CodeWords == 0 {
+		// Extension word for large unwind data
+		ext := binary.LittleEndian.Uint32(header[4:])
+		u.EpilogCount = uint16(ext)
+		u.CodeWords = uint8(ext >> 16)
+		headerSize = 8
+	}
+	if !hasHandler {
+		return
+	}
+
+	// Epilog scopes (one word each, absent when E is set) and the unwind
+	// codes precede the handler RVA
+	handlerOffset := headerSize + uint32(u.CodeWords)*4
+	if !u.EpilogInHeader {
+		handlerOffset += uint32(u.EpilogCount) * 4
+	}
+	handler := make([]byte, 4)
+	if _, err := p.r.ReadAt(handler, int64(offset+handlerOffset)); err == nil {
+		u.HandlerAddress = binary.LittleEndian.Uint32(handler)
+	}
+}
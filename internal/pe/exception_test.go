@@ -0,0 +1,100 @@
+package pe
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeUnwindCodes(t *testing.T) {
+	// Slots as the compiler emits them, in reverse prolog order
+	slots := []uint16{
+		0x1E | UWOP_SAVE_NONVOL<<8 | 7<<12, 0x000B, // mov [rsp+0x58], rdi
+		0x1A | UWOP_ALLOC_LARGE<<8, 0x0041, // sub rsp, 0x208
+		0x13 | UWOP_ALLOC_SMALL<<8 | 4<<12,                     // sub rsp, 0x28
+		0x0F | UWOP_SAVE_XMM128_FAR<<8 | 6<<12, 0x0000, 0x0001, // movaps [rsp+0x10000], xmm6
+		0x04 | UWOP_SET_FPREG<<8,
+		0x01 | UWOP_PUSH_NONVOL<<8 | 5<<12, // push rbp
+	}
+	var data []byte
+	for _, s := range slots {
+		data = binary.LittleEndian.AppendUint16(data, s)
+	}
+
+	got := decodeUnwindCodes(data)
+	want := []UnwindCode{
+		{CodeOffset: 0x1E, Op: UWOP_SAVE_NONVOL, OpInfo: 7, Operand: 0x58},
+		{CodeOffset: 0x1A, Op: UWOP_ALLOC_LARGE, Operand: 0x208},
+		{CodeOffset: 0x13, Op: UWOP_ALLOC_SMALL, OpInfo: 4, Operand: 0x28},
+		{CodeOffset: 0x0F, Op: UWOP_SAVE_XMM128_FAR, OpInfo: 6, Operand: 0x10000},
+		{CodeOffset: 0x04, Op: UWOP_SET_FPREG},
+		{CodeOffset: 0x01, Op: UWOP_PUSH_NONVOL, OpInfo: 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decodeUnwindCodes() = %+v, want %+v", got, want)
+	}
+
+	names := []string{"SAVE_NONVOL rdi, 0x58", "ALLOC 0x208", "ALLOC 0x28", "SAVE_XMM128 xmm6, 0x10000", "SET_FPREG", "PUSH_NONVOL rbp"}
+	for i, c := range got {
+		if c.String() != names[i] {
+			t.Errorf("code %d String() = %q, want %q", i, c.String(), names[i])
+		}
+	}
+}
+
+func TestARM64PackedFunction(t *testing.T) {
+	// Flag=1, FunctionLength=0x40 words, RegF=0, RegI=2, H=0, CR=3, FrameSize=2 (32 bytes)
+	packed := uint32(1 | 0x40<<2 | 2<<16 | 3<<21 | 2<<23)
+	entry := binary.LittleEndian.AppendUint32(nil, 0x1000)
+	entry = binary.LittleEndian.AppendUint32(entry, packed)
+
+	p := &unwindParser{}
+	rf := p.arm64Function(entry)
+	if rf.BeginAddress != 0x1000 || rf.EndAddress != 0x1100 || rf.UnwindInfoAddress != 0 {
+		t.Errorf("range = 0x%X-0x%X, unwind 0x%X", rf.BeginAddress, rf.EndAddress, rf.UnwindInfoAddress)
+	}
+	u := rf.ARM64
+	if !u.Packed() || u.RegI != 2 || u.CR != 3 || u.FrameSize != 32 || u.H {
+		t.Errorf("packed fields = %+v", u)
+	}
+}
+
+func TestFunctionAt(t *testing.T) {
+	info := &ExceptionInfo{Functions: []RuntimeFunction{
+		{BeginAddress: 0x1000, EndAddress: 0x1040},
+		{BeginAddress: 0x1050, EndAddress: 0x1100},
+	}}
+
+	tests := map[uint32]uint32{0x1000: 0x1000, 0x103F: 0x1000, 0x1050: 0x1050, 0x10FF: 0x1050}
+	for rva, begin := range tests {
+		if rf := info.FunctionAt(rva); rf == nil || rf.BeginAddress != begin {
+			t.Errorf("FunctionAt(0x%X) = %+v, want function at 0x%X", rva, rf, begin)
+		}
+	}
+	for _, rva := range []uint32{0x0FFF, 0x1040, 0x104F, 0x1100} {
+		if rf := info.FunctionAt(rva); rf != nil {
+			t.Errorf("FunctionAt(0x%X) = %+v, want nil", rva, rf)
+		}
+	}
+}
+
+func TestExcludeFunctionBodies(t *testing.T) {
+	functions := []RuntimeFunction{
+		{BeginAddress: 0x1000, EndAddress: 0x1080},
+		{BeginAddress: 0x10A0, EndAddress: 0x1200},
+	}
+	caves := []CodeCave{
+		{Section: ".text", Offset: 0x440, RVA: 0x1040, Size: 0x100}, // Spans both functions
+		{Section: ".text", Offset: 0x700, RVA: 0x1300, Size: 0x40},  // After all functions
+		{Section: ".text", Offset: 0x500, RVA: 0x1100, Size: 0x40},  // Inside a function
+	}
+
+	got := excludeFunctionBodies(caves, functions, 0x10)
+	want := []CodeCave{
+		{Section: ".text", Offset: 0x480, RVA: 0x1080, Size: 0x20},
+		{Section: ".text", Offset: 0x700, RVA: 0x1300, Size: 0x40},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("excludeFunctionBodies() = %+v, want %+v", got, want)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"sort"
 )
 
 // ExportDirectory represents the PE export directory table.
@@ -22,24 +23,66 @@ type ExportDirectory struct {
 	AddressOfNameOrdinals uint32
 }
 
-// parseExports extracts exported function names from a PE file.
-func parseExports(f *pe.File, r io.ReaderAt) ([]string, error) {
-	// Get export data directory RVA and size
-	var exportDirRVA, exportDirSize uint32
+// maxExports bounds the export address and name tables; ordinals are 16-bit.
+const maxExports = 0x10000
+
+// ExportInfo contains the parsed export directory.
+type ExportInfo struct {
+	DLLName       string // Name recorded in the directory
+	Base          uint32 // Ordinal base
+	TimeDateStamp uint32
+	RVA           uint32 // Export directory; forwarder strings lie inside it
+	Size          uint32
+	Functions     []ExportEntry // Sorted by ordinal
+}
+
+// ExportEntry is an exported function or variable. An entry exported under
+// several names appears once per name.
+type ExportEntry struct {
+	Ordinal    uint16
+	RVA        uint32 // Address, or the forwarder string for forwarders
+	Name       string // Empty for ordinal-only exports
+	Hint       uint16 // Index in the export name table, for named exports
+	Forwarder  string // "DLL.Function" or "DLL.#N" for forwarded exports
+	Section    string // Section containing RVA, empty if none
+	Executable bool   // RVA lies in an executable section
+}
 
-	if oh32, ok := f.OptionalHeader.(*pe.OptionalHeader32); ok {
-		if len(oh32.DataDirectory) > 0 {
-			exportDirRVA = oh32.DataDirectory[0].VirtualAddress
-			exportDirSize = oh32.DataDirectory[0].Size
+// String returns the export name, or "Ordinal_N" for ordinal-only exports.
+func (e ExportEntry) String() string {
+	if e.Name == "" {
+		return fmt.Sprintf("Ordinal_%d", e.Ordinal)
+	}
+	return e.Name
+}
+
+// Forwarded reports whether the loader resolves the entry in another DLL.
+func (e ExportEntry) Forwarded() bool {
+	return e.Forwarder != ""
+}
+
+// Names returns the exported names in export name table order, so that the
+// index of a name is its hint.
+func (e *ExportInfo) Names() []string {
+	var count int
+	for _, fn := range e.Functions {
+		if fn.Name != "" {
+			count = max(count, int(fn.Hint)+1)
 		}
-	} else if oh64, ok := f.OptionalHeader.(*pe.OptionalHeader64); ok {
-		if len(oh64.DataDirectory) > 0 {
-			exportDirRVA = oh64.DataDirectory[0].VirtualAddress
-			exportDirSize = oh64.DataDirectory[0].Size
+	}
+	names := make([]string, count)
+	for _, fn := range e.Functions {
+		if fn.Name != "" {
+			names[fn.Hint] = fn.Name
 		}
 	}
+	return names
+}
 
-	// No exports
+// parseExports parses the export directory, or returns nil if the image has
+// none.
+func parseExports(f *pe.File, r io.ReaderAt) (*ExportInfo, error) {
+	exportDirRVA, exportDirSize := dataDirectory(f, 0)
 	if exportDirRVA == 0 || exportDirSize == 0 {
 		return nil, nil
 	}
@@ -56,41 +99,99 @@ func parseExports(f *pe.File, r io.ReaderAt) ([]string, error) {
 	if err := binary.Read(sr, binary.LittleEndian, &exportDir); err != nil {
 		return nil, fmt.Errorf("读取导出目录失败: %w", err)
 	}
-
-	// No named exports
-	if exportDir.NumberOfNames == 0 {
-		return nil, nil
+	if exportDir.NumberOfFunctions > maxExports || exportDir.NumberOfNames > maxExports {
+		return nil, fmt.Errorf("导出数量异常: %d 个函数, %d 个名称", exportDir.NumberOfFunctions, exportDir.NumberOfNames)
 	}
 
-	// Read export name pointers
-	namePointersOffset, err := rvaToOffset(f, exportDir.AddressOfNames)
-	if err != nil {
-		return nil, err
+	info := &ExportInfo{
+		Base:          exportDir.Base,
+		TimeDateStamp: exportDir.TimeDateStamp,
+		RVA:           exportDirRVA,
+		Size:          exportDirSize,
+	}
+	if nameOffset, err := rvaToOffset(f, exportDir.Name); err == nil {
+		info.DLLName, _ = readCString(r, int64(nameOffset))
 	}
 
+	addresses := make([]uint32, exportDir.NumberOfFunctions)
+	if err := readExportTable(f, r, exportDir.AddressOfFunctions, addresses); err != nil {
+		return nil, fmt.Errorf("读取导出地址表失败: %w", err)
+	}
 	namePointers := make([]uint32, exportDir.NumberOfNames)
-	sr = io.NewSectionReader(r, int64(namePointersOffset), int64(exportDir.NumberOfNames*4))
-	if err := binary.Read(sr, binary.LittleEndian, &namePointers); err != nil {
+	if err := readExportTable(f, r, exportDir.AddressOfNames, namePointers); err != nil {
 		return nil, fmt.Errorf("读取导出名称指针失败: %w", err)
 	}
+	ordinals := make([]uint16, exportDir.NumberOfNames)
+	if err := readExportTable(f, r, exportDir.AddressOfNameOrdinals, ordinals); err != nil {
+		return nil, fmt.Errorf("读取导出序号表失败: %w", err)
+	}
 
-	// Read export names
-	var exports []string
-	for _, nameRVA := range namePointers {
+	// Named exports, then the address table slots no name refers to
+	named := make(map[uint16]bool, len(ordinals))
+	for i, nameRVA := range namePointers {
+		index := ordinals[i]
+		if uint32(index) >= exportDir.NumberOfFunctions {
+			continue
+		}
 		nameOffset, err := rvaToOffset(f, nameRVA)
 		if err != nil {
 			continue
 		}
-
 		name, err := readCString(r, int64(nameOffset))
 		if err != nil {
 			continue
 		}
 
-		exports = append(exports, name)
+		entry := info.newEntry(f, r, index, addresses[index])
+		entry.Name = name
+		entry.Hint = uint16(i)
+		info.Functions = append(info.Functions, entry)
+		named[index] = true
+	}
+	for i, rva := range addresses {
+		if rva != 0 && !named[uint16(i)] {
+			info.Functions = append(info.Functions, info.newEntry(f, r, uint16(i), rva))
+		}
+	}
+
+	sort.SliceStable(info.Functions, func(i, j int) bool {
+		return info.Functions[i].Ordinal < info.Functions[j].Ordinal
+	})
+	return info, nil
+}
+
+// newEntry describes the address table slot at index.
+func (e *ExportInfo) newEntry(f *pe.File, r io.ReaderAt, index uint16, rva uint32) ExportEntry {
+	entry := ExportEntry{Ordinal: uint16(e.Base + uint32(index)), RVA: rva}
+
+	// An address inside the export directory is a forwarder string
+	if rva >= e.RVA && rva < e.RVA+e.Size {
+		if offset, err := rvaToOffset(f, rva); err == nil {
+			entry.Forwarder, _ = readCString(r, int64(offset))
+		}
 	}
 
-	return exports, nil
+	for _, s := range f.Sections {
+		if rva >= s.VirtualAddress && rva < s.VirtualAddress+max(s.VirtualSize, s.Size) {
+			entry.Section = s.Name
+			entry.Executable = s.Characteristics&pe.IMAGE_SCN_MEM_EXECUTE != 0
+			break
+		}
+	}
+	return entry
+}
+
+// readExportTable fills table, a slice of uint16 or uint32, from rva.
+func readExportTable(f *pe.File, r io.ReaderAt, rva uint32, table any) error {
+	size := binary.Size(table)
+	if size == 0 {
+		return nil
+	}
+	offset, err := rvaToOffset(f, rva)
+	if err != nil {
+		return err
+	}
+	return binary.Read(io.NewSectionReader(r, int64(offset), int64(size)), binary.LittleEndian, table)
 }
 
 // rvaToOffset converts RVA to file offset.
@@ -4,7 +4,9 @@ import (
 	"debug/pe"
 	"encoding/binary"
 	"fmt"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -20,275 +22,360 @@ func NewExportModifier(patcher *Patcher) *ExportModifier {
 	}
 }
 
-// ExportFunction represents a single exported function.
+// ExportFunction represents a single exported function. A function exported
+// under several names appears once per name, with the same ordinal.
 type ExportFunction struct {
-	Name    string // Function name (empty for ordinal-only exports)
-	Ordinal uint16 // Ordinal number
-	RVA     uint32 // Relative Virtual Address of the function
+	Name      string // Function name (empty for ordinal-only exports)
+	Ordinal   uint16 // Ordinal number
+	RVA       uint32 // Relative Virtual Address of the function
+	Forwarder string // "DLL.Function" or "DLL.#N" for forwarded exports
 }
 
 // ExportTableData contains the complete export table information.
 type ExportTableData struct {
-	ModuleName string
-	Base       uint32 // Ordinal base
-	Functions  []ExportFunction
+	ModuleName    string
+	Base          uint32 // Ordinal base
+	TimeDateStamp uint32
+	Functions     []ExportFunction
 }
 
-// AddExport adds a new function to the export table.
+// AddExport adds a new function to the export table with the next free
+// ordinal.
+// In CFG images the function is also registered as a valid call target.
 func (em *ExportModifier) AddExport(name string, rva uint32) error {
-	// Read existing exports
+	return em.AddExportEntry(ExportFunction{Name: name, RVA: rva})
+}
+
+// AddExportEntry adds an export with an explicit ordinal, or the next free
+// one if Ordinal is 0. The name may be empty for an ordinal-only export, and
+// either RVA or Forwarder must be set. Existing ordinals are kept; the
+// ordinal base is lowered if the new ordinal is below it.
+// In CFG images the function is also registered as a valid call target.
+func (em *ExportModifier) AddExportEntry(fn ExportFunction) error {
+	if (fn.RVA == 0) == (fn.Forwarder == "") {
+		return fmt.Errorf("导出必须指定RVA或转发目标之一")
+	}
+	if fn.Forwarder != "" {
+		if err := validateForwarder(fn.Forwarder); err != nil {
+			return err
+		}
+	}
+
 	exports, err := em.readExports()
 	if err != nil {
 		return fmt.Errorf("读取现有导出失败: %w", err)
 	}
 
-	// Check if export already exists
 	for _, exp := range exports.Functions {
-		if exp.Name == name {
-			return fmt.Errorf("导出 %s 已存在", name)
+		if fn.Name != "" && exp.Name == fn.Name {
+			return fmt.Errorf("导出 %s 已存在", fn.Name)
+		}
+		if fn.Ordinal != 0 && exp.Ordinal == fn.Ordinal {
+			return fmt.Errorf("序号 %d 已被 %s 使用", fn.Ordinal, exportLabel(exp))
 		}
 	}
 
-	// Find next available ordinal
-	maxOrdinal := uint16(0)
-	for _, exp := range exports.Functions {
-		if exp.Ordinal > maxOrdinal {
-			maxOrdinal = exp.Ordinal
+	if fn.Ordinal == 0 {
+		fn.Ordinal, err = nextFreeOrdinal(exports)
+		if err != nil {
+			return err
 		}
 	}
-	newOrdinal := maxOrdinal + 1
+	if uint32(fn.Ordinal) < exports.Base {
+		exports.Base = uint32(fn.Ordinal)
+	}
 
-	// Add new export
-	exports.Functions = append(exports.Functions, ExportFunction{
-		Name:    name,
-		Ordinal: newOrdinal,
-		RVA:     rva,
-	})
+	exports.Functions = append(exports.Functions, fn)
+	if err := em.rebuildExportTable(exports); err != nil {
+		return err
+	}
 
-	// Rebuild export table
-	return em.rebuildExportTable(exports)
+	// Exports are called through GetProcAddress, so CFG images must list them
+	if fn.Forwarder != "" {
+		return nil
+	}
+	return em.patcher.AddGuardCFTargets(fn.RVA)
 }
 
-// ModifyExport changes the RVA of an existing export.
+// ModifyExport changes the RVA of an existing export, given by name or as
+// "#N" for an ordinal. Only its export address table slot is rewritten, so
+// all names of the ordinal change; a forwarded export becomes a local one.
+// In CFG images the new RVA is also registered as a valid call target.
 func (em *ExportModifier) ModifyExport(name string, newRVA uint32) error {
 	exports, err := em.readExports()
 	if err != nil {
 		return fmt.Errorf("读取现有导出失败: %w", err)
 	}
 
-	found := false
-	for i := range exports.Functions {
-		if exports.Functions[i].Name == name {
-			exports.Functions[i].RVA = newRVA
-			found = true
-			break
-		}
+	ordinal, err := findExport(exports, name)
+	if err != nil {
+		return err
+	}
+
+	if err := em.patchExportAddress(exports.Base, ordinal, newRVA); err != nil {
+		return err
+	}
+
+	return em.patcher.AddGuardCFTargets(newRVA)
+}
+
+// patchExportAddress writes rva into the export address table slot of
+// ordinal in place.
+func (em *ExportModifier) patchExportAddress(base uint32, ordinal uint16, rva uint32) error {
+	exportDir, _ := dataDirectory(em.patcher.File(), 0)
+	dir, err := em.patcher.ReadRVA(exportDir, 40)
+	if err != nil {
+		return fmt.Errorf("读取导出目录失败: %w", err)
+	}
+	addressTable := binary.LittleEndian.Uint32(dir[28:32])
+
+	offset, err := rvaToOffset(em.patcher.File(), addressTable+(uint32(ordinal)-base)*4)
+	if err != nil {
+		return fmt.Errorf("定位导出地址表失败: %w", err)
+	}
+	return em.patcher.writeUint32(int64(offset), rva)
+}
+
+// ForwardExport turns an existing export, given by name or as "#N" for an
+// ordinal, into a forwarder to "DLL.Function" or "DLL.#N". Its ordinal and
+// names are kept, so callers importing it from this DLL keep working.
+func (em *ExportModifier) ForwardExport(name, forwarder string) error {
+	if err := validateForwarder(forwarder); err != nil {
+		return err
+	}
+
+	exports, err := em.readExports()
+	if err != nil {
+		return fmt.Errorf("读取现有导出失败: %w", err)
 	}
 
-	if !found {
-		return fmt.Errorf("导出 %s 不存在", name)
+	ordinal, err := findExport(exports, name)
+	if err != nil {
+		return err
 	}
+	setExportTarget(exports, ordinal, 0, forwarder)
 
 	return em.rebuildExportTable(exports)
 }
 
-// RemoveExport removes a function from the export table.
+// RemoveExport removes a function from the export table. A name removes
+// only that name, "#N" removes the ordinal with all its names. The
+// ordinals of the remaining exports are kept.
 func (em *ExportModifier) RemoveExport(name string) error {
 	exports, err := em.readExports()
 	if err != nil {
 		return fmt.Errorf("读取现有导出失败: %w", err)
 	}
 
+	ordinal, err := findExport(exports, name)
+	if err != nil {
+		return err
+	}
+	byOrdinal := strings.HasPrefix(name, "#")
+
 	newFunctions := make([]ExportFunction, 0)
-	found := false
 	for _, exp := range exports.Functions {
-		if exp.Name != name {
-			newFunctions = append(newFunctions, exp)
-		} else {
-			found = true
+		if byOrdinal && exp.Ordinal == ordinal || !byOrdinal && exp.Name == name {
+			continue
 		}
-	}
-
-	if !found {
-		return fmt.Errorf("导出 %s 不存在", name)
+		newFunctions = append(newFunctions, exp)
 	}
 
 	exports.Functions = newFunctions
 	return em.rebuildExportTable(exports)
 }
 
-// readExports reads the current export table.
-func (em *ExportModifier) readExports() (*ExportTableData, error) {
-	// Get export directory
-	var exportDirRVA, exportDirSize uint32
-	oh := em.patcher.File().OptionalHeader
-
-	if oh32, ok := oh.(*pe.OptionalHeader32); ok {
-		if len(oh32.DataDirectory) > 0 {
-			exportDirRVA = oh32.DataDirectory[0].VirtualAddress
-			exportDirSize = oh32.DataDirectory[0].Size
-		}
-	} else if oh64, ok := oh.(*pe.OptionalHeader64); ok {
-		if len(oh64.DataDirectory) > 0 {
-			exportDirRVA = oh64.DataDirectory[0].VirtualAddress
-			exportDirSize = oh64.DataDirectory[0].Size
-		}
-	}
-
-	if exportDirRVA == 0 {
-		// No exports, create empty table
-		return &ExportTableData{
-			ModuleName: "module.dll",
-			Base:       1,
-			Functions:  make([]ExportFunction, 0),
-		}, nil
+// SetExportName sets the DLL name recorded in the export directory.
+func (em *ExportModifier) SetExportName(name string) error {
+	if name == "" {
+		return fmt.Errorf("DLL名称不能为空")
 	}
 
-	// Read export directory
-	exportData, err := em.patcher.ReadRVA(exportDirRVA, exportDirSize)
+	exports, err := em.readExports()
 	if err != nil {
-		return nil, fmt.Errorf("读取导出目录失败: %w", err)
+		return fmt.Errorf("读取现有导出失败: %w", err)
 	}
 
-	if len(exportData) < 40 {
-		return nil, fmt.Errorf("导出目录大小不足")
-	}
+	exports.ModuleName = name
+	return em.rebuildExportTable(exports)
+}
 
-	// Parse export directory structure
-	nameRVA := binary.LittleEndian.Uint32(exportData[12:16])
-	base := binary.LittleEndian.Uint32(exportData[16:20])
-	numFunctions := binary.LittleEndian.Uint32(exportData[20:24])
-	numNames := binary.LittleEndian.Uint32(exportData[24:28])
-	addressTableRVA := binary.LittleEndian.Uint32(exportData[28:32])
-	namePointerRVA := binary.LittleEndian.Uint32(exportData[32:36])
-	ordinalTableRVA := binary.LittleEndian.Uint32(exportData[36:40])
+// SetOrdinalBase sets the ordinal base of the export directory. Ordinals
+// are kept, so the base can't be above the lowest exported ordinal.
+func (em *ExportModifier) SetOrdinalBase(base uint32) error {
+	if base == 0 || base >= maxExports {
+		return fmt.Errorf("序号基数必须在 1-65535 之间")
+	}
 
-	// Read module name
-	nameData, err := em.patcher.ReadRVA(nameRVA, 256)
+	exports, err := em.readExports()
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("读取现有导出失败: %w", err)
 	}
-	moduleName := readNullTerminatedString(nameData)
 
-	result := &ExportTableData{
-		ModuleName: moduleName,
-		Base:       base,
-		Functions:  make([]ExportFunction, 0),
+	for _, exp := range exports.Functions {
+		if uint32(exp.Ordinal) < base {
+			return fmt.Errorf("序号基数 %d 大于现有导出 %s 的序号 %d", base, exportLabel(exp), exp.Ordinal)
+		}
 	}
 
-	// Read address table
-	addressTable, err := em.patcher.ReadRVA(addressTableRVA, numFunctions*4)
+	exports.Base = base
+	return em.rebuildExportTable(exports)
+}
+
+// readExports reads the current export table. Without one, the table is
+// empty and named after the file.
+func (em *ExportModifier) readExports() (*ExportTableData, error) {
+	info, err := parseExports(em.patcher.File(), em.patcher.file)
 	if err != nil {
 		return nil, err
 	}
+	if info == nil {
+		// No exports, create empty table
+		return &ExportTableData{
+			ModuleName: filepath.Base(em.patcher.Path()),
+			Base:       1,
+			Functions:  make([]ExportFunction, 0),
+		}, nil
+	}
 
-	// Read name pointers
-	namePointers := make([]uint32, numNames)
-	if numNames > 0 {
-		namePointerData, err := em.patcher.ReadRVA(namePointerRVA, numNames*4)
-		if err != nil {
-			return nil, err
-		}
-		for i := uint32(0); i < numNames; i++ {
-			namePointers[i] = binary.LittleEndian.Uint32(namePointerData[i*4:])
+	result := &ExportTableData{
+		ModuleName:    info.DLLName,
+		Base:          info.Base,
+		TimeDateStamp: info.TimeDateStamp,
+		Functions:     make([]ExportFunction, 0, len(info.Functions)),
+	}
+	for _, entry := range info.Functions {
+		fn := ExportFunction{Name: entry.Name, Ordinal: entry.Ordinal, RVA: entry.RVA, Forwarder: entry.Forwarder}
+		if fn.Forwarder != "" {
+			// The forwarder string is rewritten with the rest of the table
+			fn.RVA = 0
 		}
+		result.Functions = append(result.Functions, fn)
 	}
+	return result, nil
+}
 
-	// Read ordinals
-	ordinals := make([]uint16, numNames)
-	if numNames > 0 {
-		ordinalData, err := em.patcher.ReadRVA(ordinalTableRVA, numNames*2)
+// findExport returns the ordinal of the export given by name or as "#N".
+func findExport(exports *ExportTableData, name string) (uint16, error) {
+	if ordinalSpec, ok := strings.CutPrefix(name, "#"); ok {
+		ordinal, err := strconv.ParseUint(ordinalSpec, 10, 16)
 		if err != nil {
-			return nil, err
+			return 0, fmt.Errorf("无效的序号: %s", name)
 		}
-		for i := uint32(0); i < numNames; i++ {
-			ordinals[i] = binary.LittleEndian.Uint16(ordinalData[i*2:])
+		for _, exp := range exports.Functions {
+			if exp.Ordinal == uint16(ordinal) {
+				return exp.Ordinal, nil
+			}
 		}
+		return 0, fmt.Errorf("序号 %d 的导出不存在", ordinal)
 	}
 
-	// Build function list
-	for i := uint32(0); i < numFunctions; i++ {
-		rva := binary.LittleEndian.Uint32(addressTable[i*4:])
-		if rva == 0 {
-			continue // Skip empty slots
+	for _, exp := range exports.Functions {
+		if exp.Name == name {
+			return exp.Ordinal, nil
 		}
+	}
+	return 0, fmt.Errorf("导出 %s 不存在", name)
+}
 
-		ordinal := uint16(base + i)
-
-		// Find name for this ordinal
-		name := ""
-		for j := uint32(0); j < numNames; j++ {
-			if ordinals[j] == uint16(i) {
-				// Read name
-				nameData, err := em.patcher.ReadRVA(namePointers[j], 256)
-				if err == nil {
-					name = readNullTerminatedString(nameData)
-				}
-				break
-			}
+// setExportTarget points every name of the ordinal at rva or forwarder, as
+// they share one address table slot.
+func setExportTarget(exports *ExportTableData, ordinal uint16, rva uint32, forwarder string) {
+	for i := range exports.Functions {
+		if exports.Functions[i].Ordinal == ordinal {
+			exports.Functions[i].RVA = rva
+			exports.Functions[i].Forwarder = forwarder
 		}
-
-		result.Functions = append(result.Functions, ExportFunction{
-			Name:    name,
-			Ordinal: ordinal,
-			RVA:     rva,
-		})
 	}
+}
 
-	return result, nil
+// nextFreeOrdinal returns the ordinal after the highest one in use, or the
+// base for an empty table.
+func nextFreeOrdinal(exports *ExportTableData) (uint16, error) {
+	next := exports.Base
+	for _, exp := range exports.Functions {
+		next = max(next, uint32(exp.Ordinal)+1)
+	}
+	if next == 0 || next >= maxExports {
+		return 0, fmt.Errorf("没有可用的导出序号")
+	}
+	return uint16(next), nil
 }
 
-// rebuildExportTable rebuilds the export table in a new section.
-func (em *ExportModifier) rebuildExportTable(exports *ExportTableData) error {
-	// Sort functions by name (Windows requirement for binary search)
-	sort.Slice(exports.Functions, func(i, j int) bool {
-		if exports.Functions[i].Name == "" {
-			return false
-		}
-		if exports.Functions[j].Name == "" {
-			return true
+// validateForwarder checks a forwarder string: "DLL.Function" or "DLL.#N",
+// where the DLL is named without its extension.
+func validateForwarder(forwarder string) error {
+	dot := strings.Index(forwarder, ".")
+	if dot <= 0 || dot == len(forwarder)-1 {
+		return fmt.Errorf("无效的转发目标: %s（格式: DLL.函数名 或 DLL.#序号）", forwarder)
+	}
+	if ordinalSpec, ok := strings.CutPrefix(forwarder[dot+1:], "#"); ok {
+		if _, err := strconv.ParseUint(ordinalSpec, 10, 16); err != nil {
+			return fmt.Errorf("无效的转发序号: %s", forwarder)
 		}
-		return strings.ToLower(exports.Functions[i].Name) < strings.ToLower(exports.Functions[j].Name)
-	})
+	}
+	return nil
+}
 
+// exportLabel names an export in messages.
+func exportLabel(exp ExportFunction) string {
+	if exp.Name == "" {
+		return fmt.Sprintf("#%d", exp.Ordinal)
+	}
+	return exp.Name
+}
+
+// rebuildExportTable rebuilds the export table in space found by allocate.
+func (em *ExportModifier) rebuildExportTable(exports *ExportTableData) error {
 	// Calculate required size
 	size := em.calculateExportDataSize(exports)
 
-	// Create new export section
-	sectionData := make([]byte, size)
-
-	// Write export data
-	offset := em.writeExportData(sectionData, exports)
-	_ = offset
-
-	// Inject section
-	err := em.patcher.InjectSection(".edata", sectionData,
-		pe.IMAGE_SCN_CNT_INITIALIZED_DATA|pe.IMAGE_SCN_MEM_READ)
+	// Find space, reusing the old export data if the new one fits
+	exportDir, exportDirSize := dataDirectory(em.patcher.File(), 0)
+	space, err := em.patcher.allocate(allocRequest{
+		section:         ".edata",
+		size:            size,
+		characteristics: pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ,
+		old:             pe.DataDirectory{VirtualAddress: exportDir, Size: exportDirSize},
+	})
 	if err != nil {
-		return fmt.Errorf("注入导出节区失败: %w", err)
+		return fmt.Errorf("分配导出数据空间失败: %w", err)
 	}
 
-	// Reload PE
-	if err := em.patcher.Reload(); err != nil {
-		return fmt.Errorf("重新加载PE失败: %w", err)
+	// Write export data with the final RVAs
+	sectionData := make([]byte, size)
+	em.writeExportDataWithRVA(sectionData, exports, space.RVA)
+	if _, err := em.patcher.file.WriteAt(sectionData, int64(space.Offset)); err != nil {
+		return fmt.Errorf("写入导出数据失败: %w", err)
 	}
 
-	// Get new section
-	sections := em.patcher.File().Sections
-	newSection := sections[len(sections)-1]
-
-	// Now rewrite the export data with correct RVAs
-	sectionData = make([]byte, size)
-	em.writeExportDataWithRVA(sectionData, exports, newSection.VirtualAddress)
+	// Update export directory pointer
+	return em.updateExportDirectory(space.RVA, uint32(len(sectionData)))
+}
 
-	// Write corrected data to file
-	_, err = em.patcher.file.WriteAt(sectionData, int64(newSection.Offset))
-	if err != nil {
-		return fmt.Errorf("写入导出数据失败: %w", err)
+// exportAddressCount returns the number of address table slots, from the
+// ordinal base to the highest ordinal.
+func exportAddressCount(exports *ExportTableData) uint32 {
+	var count uint32
+	for _, exp := range exports.Functions {
+		count = max(count, uint32(exp.Ordinal)-exports.Base+1)
 	}
+	return count
+}
 
-	// Update export directory pointer
-	return em.updateExportDirectory(newSection.VirtualAddress, uint32(len(sectionData)))
+// sortedExportNames returns the named exports in the byte-wise order the
+// loader's binary search expects.
+func sortedExportNames(exports *ExportTableData) []ExportFunction {
+	var named []ExportFunction
+	for _, exp := range exports.Functions {
+		if exp.Name != "" {
+			named = append(named, exp)
+		}
+	}
+	sort.Slice(named, func(i, j int) bool {
+		return named[i].Name < named[j].Name
+	})
+	return named
 }
 
 // calculateExportDataSize calculates the size needed for export data.
@@ -303,8 +390,8 @@ func (em *ExportModifier) calculateExportDataSize(exports *ExportTableData) uint
 		}
 	}
 
-	// Address table (4 bytes per function)
-	size += uint32(len(exports.Functions) * 4)
+	// Address table (4 bytes per ordinal)
+	size += exportAddressCount(exports) * 4
 
 	// Name pointer table
 	size += uint32(namedCount * 4)
@@ -322,18 +409,33 @@ func (em *ExportModifier) calculateExportDataSize(exports *ExportTableData) uint
 		}
 	}
 
+	// Forwarder strings, one per ordinal
+	for _, forwarder := range exportForwarders(exports) {
+		size += uint32(len(forwarder) + 1)
+	}
+
 	// Align to 16 bytes
 	size = (size + 15) &^ 15
 
 	return size
 }
 
-// writeExportData writes the export data to a buffer (for initial size calculation).
-func (em *ExportModifier) writeExportData(data []byte, exports *ExportTableData) uint32 {
-	return em.writeExportDataWithRVA(data, exports, 0)
+// exportForwarders maps the ordinals of forwarded exports to their
+// forwarder strings.
+func exportForwarders(exports *ExportTableData) map[uint16]string {
+	forwarders := make(map[uint16]string)
+	for _, exp := range exports.Functions {
+		if exp.Forwarder != "" {
+			forwarders[exp.Ordinal] = exp.Forwarder
+		}
+	}
+	return forwarders
 }
 
 // writeExportDataWithRVA writes the export data to a buffer with specified section RVA.
+// The address table is indexed by ordinal minus the base, so ordinals are
+// preserved, and forwarder strings are placed inside the directory data
+// where the loader looks for them.
 func (em *ExportModifier) writeExportDataWithRVA(data []byte, exports *ExportTableData, sectionRVA uint32) uint32 {
 	baseRVA := sectionRVA
 
@@ -344,17 +446,13 @@ func (em *ExportModifier) writeExportDataWithRVA(data []byte, exports *ExportTab
 	offset += 40
 
 	// Calculate offsets
+	addressCount := exportAddressCount(exports)
 	addressTableOffset := offset
 	addressTableRVA := baseRVA + addressTableOffset
-	offset += uint32(len(exports.Functions) * 4)
+	offset += addressCount * 4
 
-	// Count named exports
-	namedExports := make([]int, 0)
-	for i, exp := range exports.Functions {
-		if exp.Name != "" {
-			namedExports = append(namedExports, i)
-		}
-	}
+	// Named exports in name table order
+	namedExports := sortedExportNames(exports)
 
 	namePointerOffset := offset
 	namePointerRVA := baseRVA + namePointerOffset
@@ -371,72 +469,69 @@ func (em *ExportModifier) writeExportDataWithRVA(data []byte, exports *ExportTab
 	offset += uint32(len(exports.ModuleName) + 1)
 
 	// Write function names and collect RVAs
-	nameRVAs := make(map[int]uint32)
-	for _, idx := range namedExports {
-		nameRVAs[idx] = baseRVA + offset
-		copy(data[offset:], exports.Functions[idx].Name)
-		offset += uint32(len(exports.Functions[idx].Name) + 1)
+	nameRVAs := make([]uint32, len(namedExports))
+	for i, exp := range namedExports {
+		nameRVAs[i] = baseRVA + offset
+		copy(data[offset:], exp.Name)
+		offset += uint32(len(exp.Name) + 1)
+	}
+
+	// Write forwarder strings and collect RVAs, in ordinal order
+	forwarders := exportForwarders(exports)
+	forwarderRVAs := make(map[uint16]uint32, len(forwarders))
+	for i := uint32(0); i < addressCount; i++ {
+		ordinal := uint16(exports.Base + i)
+		if forwarder, ok := forwarders[ordinal]; ok {
+			forwarderRVAs[ordinal] = baseRVA + offset
+			copy(data[offset:], forwarder)
+			offset += uint32(len(forwarder) + 1)
+		}
 	}
 
 	// Write export directory
-	binary.LittleEndian.PutUint32(data[dirOffset:], 0)           // Characteristics
-	binary.LittleEndian.PutUint32(data[dirOffset+4:], 0)         // TimeDateStamp
-	binary.LittleEndian.PutUint16(data[dirOffset+8:], 0)         // MajorVersion
-	binary.LittleEndian.PutUint16(data[dirOffset+10:], 0)        // MinorVersion
+	binary.LittleEndian.PutUint32(data[dirOffset:], 0)                       // Characteristics
+	binary.LittleEndian.PutUint32(data[dirOffset+4:], exports.TimeDateStamp) // TimeDateStamp
+	binary.LittleEndian.PutUint16(data[dirOffset+8:], 0)                     // MajorVersion
+	binary.LittleEndian.PutUint16(data[dirOffset+10:], 0)                    // MinorVersion
 	binary.LittleEndian.PutUint32(data[dirOffset+12:], moduleNameRVA)
 	binary.LittleEndian.PutUint32(data[dirOffset+16:], exports.Base)
-	binary.LittleEndian.PutUint32(data[dirOffset+20:], uint32(len(exports.Functions)))
+	binary.LittleEndian.PutUint32(data[dirOffset+20:], addressCount)
 	binary.LittleEndian.PutUint32(data[dirOffset+24:], uint32(len(namedExports)))
 	binary.LittleEndian.PutUint32(data[dirOffset+28:], addressTableRVA)
 	binary.LittleEndian.PutUint32(data[dirOffset+32:], namePointerRVA)
 	binary.LittleEndian.PutUint32(data[dirOffset+36:], ordinalTableRVA)
 
-	// Write address table
-	for i, exp := range exports.Functions {
-		binary.LittleEndian.PutUint32(data[addressTableOffset+uint32(i*4):], exp.RVA)
+	// Write address table; ordinals without an export keep a zero slot
+	for _, exp := range exports.Functions {
+		rva := exp.RVA
+		if exp.Forwarder != "" {
+			rva = forwarderRVAs[exp.Ordinal]
+		}
+		binary.LittleEndian.PutUint32(data[addressTableOffset+(uint32(exp.Ordinal)-exports.Base)*4:], rva)
 	}
 
 	// Write name pointer table and ordinal table
-	for i, idx := range namedExports {
-		binary.LittleEndian.PutUint32(data[namePointerOffset+uint32(i*4):], nameRVAs[idx])
+	for i, exp := range namedExports {
+		binary.LittleEndian.PutUint32(data[namePointerOffset+uint32(i*4):], nameRVAs[i])
 
 		// Ordinal is index in address table (not the actual ordinal value)
-		ordinalIndex := uint16(idx)
+		ordinalIndex := uint16(uint32(exp.Ordinal) - exports.Base)
 		binary.LittleEndian.PutUint16(data[ordinalTableOffset+uint32(i*2):], ordinalIndex)
 	}
 
 	return offset
 }
 
-// updateExportDirectory updates the export directory pointer in PE header.
+// updateExportDirectory updates the export directory pointer in PE header
+// and reloads the PE file, so later edits read the new table.
 func (em *ExportModifier) updateExportDirectory(rva, size uint32) error {
-	// Read DOS header to get PE offset
-	dosHeader := make([]byte, 64)
-	if _, err := em.patcher.file.ReadAt(dosHeader, 0); err != nil {
-		return fmt.Errorf("读取DOS头失败: %w", err)
+	if err := em.patcher.setDataDirectory(0, rva, size); err != nil {
+		return err
 	}
-
-	peOffset := binary.LittleEndian.Uint32(dosHeader[60:64])
-
-	// Calculate data directory offset
-	var dataDirOffset int64
-	if em.patcher.File().Machine == 0x8664 { // x64
-		dataDirOffset = int64(peOffset) + 4 + 20 + 112 // Signature + COFF + OptionalHeader offset
-	} else { // x86
-		dataDirOffset = int64(peOffset) + 4 + 20 + 96
+	if err := em.patcher.Reload(); err != nil {
+		return fmt.Errorf("重新加载PE文件失败: %w", err)
 	}
-
-	// Export directory is index 0
-	exportDirOffset := dataDirOffset
-
-	// Prepare data
-	data := make([]byte, 8)
-	binary.LittleEndian.PutUint32(data, rva)
-	binary.LittleEndian.PutUint32(data[4:], size)
-
-	// Write to file
-	_, err := em.patcher.file.WriteAt(data, exportDirOffset)
-	return err
+	return nil
 }
 
 // readNullTerminatedString reads a null-terminated string from a byte slice.
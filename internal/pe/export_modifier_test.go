@@ -0,0 +1,104 @@
+package pe
+
+import (
+	"bytes"
+	"debug/pe"
+	"reflect"
+	"testing"
+)
+
+func TestWriteExportData(t *testing.T) {
+	exports := &ExportTableData{
+		ModuleName: "legacy.dll",
+		Base:       10,
+		Functions: []ExportFunction{
+			{Name: "beta", Ordinal: 10, RVA: 0x1000},
+			{Name: "Alpha", Ordinal: 12, Forwarder: "newlib.Alpha"},
+			{Ordinal: 13, RVA: 0x1040},
+			{Name: "AlphaAlias", Ordinal: 12, Forwarder: "newlib.Alpha"},
+		},
+	}
+
+	em := &ExportModifier{}
+	size := em.calculateExportDataSize(exports)
+	data := make([]byte, 0x1000)
+	if end := em.writeExportDataWithRVA(data, exports, 0x2000); end > size {
+		t.Fatalf("writeExportDataWithRVA() wrote 0x%X bytes, calculated 0x%X", end, size)
+	}
+
+	oh := &pe.OptionalHeader64{NumberOfRvaAndSizes: 16}
+	oh.DataDirectory[0] = pe.DataDirectory{VirtualAddress: 0x2000, Size: size}
+	f := &pe.File{OptionalHeader: oh, Sections: []*pe.Section{
+		{SectionHeader: pe.SectionHeader{Name: ".edata", VirtualAddress: 0x2000, VirtualSize: 0x1000, Size: 0x1000,
+			Characteristics: pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ}},
+	}}
+	got, err := parseExports(f, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("parseExports() error = %v", err)
+	}
+
+	// Ordinals are kept, with an empty slot for 11, and names are sorted
+	// byte-wise so uppercase sorts first
+	if got.DLLName != "legacy.dll" || got.Base != 10 {
+		t.Errorf("DLLName, Base = %q, %d", got.DLLName, got.Base)
+	}
+	if names := got.Names(); !reflect.DeepEqual(names, []string{"Alpha", "AlphaAlias", "beta"}) {
+		t.Errorf("Names() = %v", names)
+	}
+	type entry struct {
+		Ordinal   uint16
+		Name      string
+		Forwarder string
+	}
+	var entries []entry
+	for _, fn := range got.Functions {
+		entries = append(entries, entry{fn.Ordinal, fn.Name, fn.Forwarder})
+	}
+	want := []entry{
+		{10, "beta", ""},
+		{12, "Alpha", "newlib.Alpha"},
+		{12, "AlphaAlias", "newlib.Alpha"},
+		{13, "", ""},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("exports = %+v, want %+v", entries, want)
+	}
+	if got.Functions[3].RVA != 0x1040 {
+		t.Errorf("ordinal 13 RVA = 0x%X, want 0x1040", got.Functions[3].RVA)
+	}
+}
+
+func TestValidateForwarder(t *testing.T) {
+	for _, forwarder := range []string{"NTDLL.RtlAllocateHeap", "newlib.#5", "api-ms-win-core-synch-l1-2-0.Sleep"} {
+		if err := validateForwarder(forwarder); err != nil {
+			t.Errorf("validateForwarder(%q) error = %v", forwarder, err)
+		}
+	}
+	for _, forwarder := range []string{"Sleep", ".Sleep", "kernel32.", "newlib.#x", "newlib.#70000"} {
+		if err := validateForwarder(forwarder); err == nil {
+			t.Errorf("validateForwarder(%q) should fail", forwarder)
+		}
+	}
+}
+
+func TestFindExport(t *testing.T) {
+	exports := &ExportTableData{Base: 1, Functions: []ExportFunction{
+		{Name: "Alpha", Ordinal: 3, RVA: 0x1000},
+		{Ordinal: 7, RVA: 0x1010},
+	}}
+
+	if ordinal, err := findExport(exports, "Alpha"); err != nil || ordinal != 3 {
+		t.Errorf("findExport(Alpha) = %d, %v", ordinal, err)
+	}
+	if ordinal, err := findExport(exports, "#7"); err != nil || ordinal != 7 {
+		t.Errorf("findExport(#7) = %d, %v", ordinal, err)
+	}
+	for _, name := range []string{"Beta", "#4", "#x"} {
+		if _, err := findExport(exports, name); err == nil {
+			t.Errorf("findExport(%s) should fail", name)
+		}
+	}
+	if next, err := nextFreeOrdinal(exports); err != nil || next != 8 {
+		t.Errorf("nextFreeOrdinal() = %d, %v", next, err)
+	}
+}
@@ -2,6 +2,9 @@ package pe
 
 import (
 	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"reflect"
 	"testing"
 )
 
@@ -59,3 +62,63 @@ func TestReadCString(t *testing.T) {
 		})
 	}
 }
+
+func TestParseExports(t *testing.T) {
+	le := binary.LittleEndian
+	data := make([]byte, 0x2000)
+
+	// .rdata at RVA 0x2000 holds the directory: a named function, a named
+	// forwarder, an empty slot and an ordinal-only data export
+	rdata := data[0x1000:]
+	le.PutUint32(rdata[12:], 0x2100) // Name
+	le.PutUint32(rdata[16:], 5)      // Base
+	le.PutUint32(rdata[20:], 4)      // NumberOfFunctions
+	le.PutUint32(rdata[24:], 2)      // NumberOfNames
+	le.PutUint32(rdata[28:], 0x2040) // AddressOfFunctions
+	le.PutUint32(rdata[32:], 0x2060) // AddressOfNames
+	le.PutUint32(rdata[36:], 0x2070) // AddressOfNameOrdinals
+	for i, rva := range []uint32{0x1010, 0x2080, 0, 0x2200} {
+		le.PutUint32(rdata[0x40+i*4:], rva)
+	}
+	le.PutUint32(rdata[0x60:], 0x20C0)
+	le.PutUint32(rdata[0x64:], 0x20B0)
+	le.PutUint16(rdata[0x70:], 0)
+	le.PutUint16(rdata[0x72:], 1)
+	copy(rdata[0x80:], "NTDLL.RtlAllocateHeap\x00")
+	copy(rdata[0xB0:], "Beta\x00")
+	copy(rdata[0xC0:], "Alpha\x00")
+	copy(rdata[0x100:], "test.dll\x00")
+
+	oh := &pe.OptionalHeader64{NumberOfRvaAndSizes: 16}
+	oh.DataDirectory[0] = pe.DataDirectory{VirtualAddress: 0x2000, Size: 0x120}
+	f := &pe.File{OptionalHeader: oh, Sections: []*pe.Section{
+		{SectionHeader: pe.SectionHeader{Name: ".text", VirtualAddress: 0x1000, VirtualSize: 0x1000, Size: 0x1000,
+			Characteristics: pe.IMAGE_SCN_CNT_CODE | pe.IMAGE_SCN_MEM_EXECUTE | pe.IMAGE_SCN_MEM_READ}},
+		{SectionHeader: pe.SectionHeader{Name: ".rdata", VirtualAddress: 0x2000, VirtualSize: 0x1000, Size: 0x1000, Offset: 0x1000,
+			Characteristics: pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ}},
+	}}
+
+	got, err := parseExports(f, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("parseExports() error = %v", err)
+	}
+	want := []ExportEntry{
+		{Ordinal: 5, RVA: 0x1010, Name: "Alpha", Section: ".text", Executable: true},
+		{Ordinal: 6, RVA: 0x2080, Name: "Beta", Hint: 1, Forwarder: "NTDLL.RtlAllocateHeap", Section: ".rdata"},
+		{Ordinal: 8, RVA: 0x2200, Section: ".rdata"},
+	}
+	if got.DLLName != "test.dll" || got.Base != 5 || !reflect.DeepEqual(got.Functions, want) {
+		t.Errorf("parseExports() = %+v", got)
+	}
+	if names := got.Names(); !reflect.DeepEqual(names, []string{"Alpha", "Beta"}) {
+		t.Errorf("Names() = %v", names)
+	}
+	if !got.Functions[1].Forwarded() || got.Functions[2].String() != "Ordinal_8" {
+		t.Errorf("Forwarded() / String() mismatch: %+v", got.Functions)
+	}
+
+	oh.DataDirectory[0] = pe.DataDirectory{}
+	if got, err := parseExports(f, bytes.NewReader(data)); got != nil || err != nil {
+		t.Errorf("parseExports(no directory) = %v, %v; want nil, nil", got, err)
+	}
+}
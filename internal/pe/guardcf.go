@@ -0,0 +1,198 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Offsets of the CFG function table fields inside IMAGE_LOAD_CONFIG_DIRECTORY.
+const (
+	lcGuardCFFunctionTable32 = 80
+	lcGuardFlags32           = 88
+	lcGuardCFFunctionTable64 = 128
+	lcGuardFlags64           = 144
+)
+
+// guardSuppressionFlags are the per-entry flags that make a function an
+// invalid indirect call target.
+const guardSuppressionFlags = IMAGE_GUARD_FLAG_FID_SUPPRESSED | IMAGE_GUARD_FLAG_EXPORT_SUPPRESSED
+
+// GuardCFEnabled reports whether the image was built with /guard:cf and the
+// loader will enforce CFG: GUARD_CF is set and the load config carries CFG
+// instrumentation data.
+func (p *Patcher) GuardCFEnabled() (bool, error) {
+	_, enabled, err := p.guardCFConfig()
+	return enabled, err
+}
+
+// guardCFConfig reads DllCharacteristics from the file rather than the parsed
+// headers so that an earlier -set-header or ClearGuardCF in the same session
+// is honored without a reload.
+func (p *Patcher) guardCFConfig() (*LoadConfigInfo, bool, error) {
+	peOffset, err := p.peHeaderOffset()
+	if err != nil {
+		return nil, false, err
+	}
+	img, err := NewHeaderEditor(p).read(peOffset)
+	if err != nil {
+		return nil, false, err
+	}
+	if img.dllCharacteristics()&pe.IMAGE_DLLCHARACTERISTICS_GUARD_CF == 0 {
+		return nil, false, nil
+	}
+
+	lc, err := ParseLoadConfig(p.peFile, p.file)
+	if err != nil {
+		return nil, false, fmt.Errorf("解析加载配置失败: %w", err)
+	}
+	if !lc.HasLoadConfig || lc.GuardFlags&IMAGE_GUARD_CF_INSTRUMENTED == 0 {
+		return lc, false, nil
+	}
+	return lc, true, nil
+}
+
+// AddGuardCFTargets registers RVAs as valid indirect call targets in a CFG
+// image. The guard function table is rebuilt, sorted and with the existing
+// metadata preserved, in place when it fits or else wherever the allocator
+// finds room, and the load config pointer and count are updated to match.
+// Images without CFG are left untouched.
+func (p *Patcher) AddGuardCFTargets(rvas ...uint32) error {
+	lc, enabled, err := p.guardCFConfig()
+	if err != nil || !enabled {
+		return err
+	}
+
+	if lc.GuardCFFunctionCount != uint64(len(lc.GuardCFFunctions)) {
+		return fmt.Errorf("无法读取CFG函数表 (%d 项)", lc.GuardCFFunctionCount)
+	}
+
+	_, is64Bit := p.peFile.OptionalHeader.(*pe.OptionalHeader64)
+	if _, flagsOff := guardCFFieldOffsets(is64Bit); int(lc.Size) < flagsOff+4 {
+		return fmt.Errorf("加载配置过小 (%d 字节)，不包含CFG字段", lc.Size)
+	}
+
+	entries, changed := mergeGuardTargets(lc.GuardCFFunctions, rvas)
+	if !changed {
+		return nil
+	}
+
+	stride := lc.GuardTableStride()
+	table := buildGuardTable(entries, stride)
+
+	base := imageBase(p.peFile)
+	var old pe.DataDirectory
+	if lc.GuardCFFunctionTable > base {
+		old.VirtualAddress = uint32(lc.GuardCFFunctionTable - base)
+		old.Size = uint32(len(lc.GuardCFFunctions) * stride)
+	}
+	space, err := p.allocate(allocRequest{
+		section:         ".gfids",
+		size:            uint32(len(table)),
+		characteristics: pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ,
+		old:             old,
+	})
+	if err != nil {
+		return fmt.Errorf("分配CFG函数表空间失败: %w", err)
+	}
+	if _, err := p.file.WriteAt(table, int64(space.Offset)); err != nil {
+		return fmt.Errorf("写入CFG函数表失败: %w", err)
+	}
+
+	return p.writeGuardCFTable(lc.GuardFlags, base+uint64(space.RVA), uint64(len(entries)))
+}
+
+// guardCFFieldOffsets returns the load config offsets of GuardCFFunctionTable
+// (immediately followed by GuardCFFunctionCount) and GuardFlags.
+func guardCFFieldOffsets(is64Bit bool) (table, flags int) {
+	if is64Bit {
+		return lcGuardCFFunctionTable64, lcGuardFlags64
+	}
+	return lcGuardCFFunctionTable32, lcGuardFlags32
+}
+
+// writeGuardCFTable points the load config at a new guard function table.
+func (p *Patcher) writeGuardCFTable(guardFlags uint32, tableVA, count uint64) error {
+	dirRVA, _ := dataDirectory(p.peFile, dataDirLoadConfig)
+	offset, err := rvaToOffset(p.peFile, dirRVA)
+	if err != nil {
+		return fmt.Errorf("定位加载配置失败: %w", err)
+	}
+
+	_, is64Bit := p.peFile.OptionalHeader.(*pe.OptionalHeader64)
+
+	fieldsOff, flagsOff := guardCFFieldOffsets(is64Bit)
+
+	var buf []byte
+	if is64Bit {
+		buf = make([]byte, 16)
+		binary.LittleEndian.PutUint64(buf[0:8], tableVA)
+		binary.LittleEndian.PutUint64(buf[8:16], count)
+	} else {
+		buf = make([]byte, 8)
+		binary.LittleEndian.PutUint32(buf[0:4], uint32(tableVA))
+		binary.LittleEndian.PutUint32(buf[4:8], uint32(count))
+	}
+
+	if _, err := p.file.WriteAt(buf, int64(offset)+int64(fieldsOff)); err != nil {
+		return fmt.Errorf("写入CFG函数表指针失败: %w", err)
+	}
+
+	flags := make([]byte, 4)
+	binary.LittleEndian.PutUint32(flags, guardFlags|IMAGE_GUARD_CF_FUNCTION_TABLE_PRESENT)
+	if _, err := p.file.WriteAt(flags, int64(offset)+int64(flagsOff)); err != nil {
+		return fmt.Errorf("写入GuardFlags失败: %w", err)
+	}
+
+	return nil
+}
+
+// ClearGuardCF turns off CFG enforcement by clearing the GUARD_CF
+// DllCharacteristics flag. The instrumentation in the code stays in place
+// but the loader no longer checks indirect call targets.
+func (p *Patcher) ClearGuardCF() error {
+	return p.SetHeaderFields("GUARD_CF=off")
+}
+
+// mergeGuardTargets adds RVAs to a guard table and returns it sorted by RVA.
+// Targets already present have their suppression flags cleared. The second
+// result reports whether the table changed.
+func mergeGuardTargets(existing []GuardFunction, rvas []uint32) ([]GuardFunction, bool) {
+	index := make(map[uint32]int, len(existing))
+	entries := make([]GuardFunction, len(existing))
+	copy(entries, existing)
+	for i, e := range entries {
+		index[e.RVA] = i
+	}
+
+	changed := false
+	for _, rva := range rvas {
+		if i, ok := index[rva]; ok {
+			if entries[i].Flags&guardSuppressionFlags != 0 {
+				entries[i].Flags &^= guardSuppressionFlags
+				changed = true
+			}
+			continue
+		}
+		index[rva] = len(entries)
+		entries = append(entries, GuardFunction{RVA: rva})
+		changed = true
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].RVA < entries[j].RVA })
+	return entries, changed
+}
+
+// buildGuardTable serializes guard table entries with the given stride.
+func buildGuardTable(entries []GuardFunction, stride int) []byte {
+	data := make([]byte, len(entries)*stride)
+	for i, e := range entries {
+		entry := data[i*stride:]
+		binary.LittleEndian.PutUint32(entry, e.RVA)
+		if stride > 4 {
+			entry[4] = e.Flags
+		}
+	}
+	return data
+}
@@ -0,0 +1,78 @@
+package pe
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMergeGuardTargets(t *testing.T) {
+	existing := []GuardFunction{
+		{RVA: 0x1000, Flags: 0},
+		{RVA: 0x3000, Flags: IMAGE_GUARD_FLAG_EXPORT_SUPPRESSED},
+		{RVA: 0x4000, Flags: 0x04},
+	}
+
+	tests := []struct {
+		name    string
+		rvas    []uint32
+		want    []GuardFunction
+		changed bool
+	}{
+		{
+			name:    "already present",
+			rvas:    []uint32{0x1000, 0x4000},
+			want:    existing,
+			changed: false,
+		},
+		{
+			name: "new targets sorted and deduplicated",
+			rvas: []uint32{0x5000, 0x2000, 0x5000},
+			want: []GuardFunction{
+				{RVA: 0x1000}, {RVA: 0x2000}, {RVA: 0x3000, Flags: IMAGE_GUARD_FLAG_EXPORT_SUPPRESSED},
+				{RVA: 0x4000, Flags: 0x04}, {RVA: 0x5000},
+			},
+			changed: true,
+		},
+		{
+			name: "suppressed target re-enabled",
+			rvas: []uint32{0x3000},
+			want: []GuardFunction{
+				{RVA: 0x1000}, {RVA: 0x3000}, {RVA: 0x4000, Flags: 0x04},
+			},
+			changed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := mergeGuardTargets(existing, tt.rvas)
+			if changed != tt.changed {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if existing[1].Flags != IMAGE_GUARD_FLAG_EXPORT_SUPPRESSED {
+		t.Error("mergeGuardTargets modified its input")
+	}
+}
+
+func TestBuildGuardTable(t *testing.T) {
+	entries := []GuardFunction{{RVA: 0x1010, Flags: 0x01}, {RVA: 0x20304050}}
+
+	got := buildGuardTable(entries, 5)
+	want := []byte{0x10, 0x10, 0, 0, 0x01, 0x50, 0x40, 0x30, 0x20, 0}
+	if !bytes.Equal(got, want) {
+		t.Errorf("stride 5 = % X, want % X", got, want)
+	}
+
+	got = buildGuardTable(entries, 4)
+	want = []byte{0x10, 0x10, 0, 0, 0x50, 0x40, 0x30, 0x20}
+	if !bytes.Equal(got, want) {
+		t.Errorf("stride 4 = % X, want % X", got, want)
+	}
+}
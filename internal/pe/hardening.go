@@ -0,0 +1,267 @@
+package pe
+
+import (
+	"debug/pe"
+	"fmt"
+	"strings"
+)
+
+// HardeningStatus is the outcome of a single hardening check.
+type HardeningStatus int
+
+// Hardening check outcomes.
+const (
+	HardeningPass HardeningStatus = iota
+	HardeningWarn
+	HardeningFail
+)
+
+// String returns a short label for the status.
+func (s HardeningStatus) String() string {
+	switch s {
+	case HardeningPass:
+		return "PASS"
+	case HardeningWarn:
+		return "WARN"
+	default:
+		return "FAIL"
+	}
+}
+
+// HardeningCheck is the result of one hardening check.
+// ID is a stable, language-neutral identifier (e.g. "aslr", "dep", "cfg").
+type HardeningCheck struct {
+	ID     string
+	Name   string
+	Status HardeningStatus
+	Detail string
+}
+
+// AuditHardening evaluates exploit mitigations and risky layout in an analyzed
+// PE file. Checks that do not apply to the file (e.g. SafeSEH on x64) are omitted.
+func AuditHardening(info *Info) []HardeningCheck {
+	checks := []HardeningCheck{
+		checkASLR(info),
+		checkRelocations(info),
+	}
+
+	if info.Is64Bit {
+		checks = append(checks, checkHighEntropyVA(info))
+	}
+
+	checks = append(checks, checkDEP(info), checkCFG(info))
+
+	if info.Machine == pe.IMAGE_FILE_MACHINE_I386 {
+		checks = append(checks, checkSafeSEH(info))
+	}
+
+	checks = append(checks,
+		checkSecurityCookie(info),
+		checkRFG(info),
+		checkCET(info),
+		checkDllFlag(info, "force_integrity", "强制完整性 (Force Integrity)", pe.IMAGE_DLLCHARACTERISTICS_FORCE_INTEGRITY),
+		checkDllFlag(info, "appcontainer", "AppContainer", pe.IMAGE_DLLCHARACTERISTICS_APPCONTAINER),
+		checkRWXSections(info),
+		checkEntrySection(info),
+		checkSignature(info),
+	)
+
+	return checks
+}
+
+func hasDllFlag(info *Info, flag uint16) bool {
+	return info.DllCharacteristics&flag != 0
+}
+
+func hasRelocations(info *Info) bool {
+	return info.Relocations != nil && info.Relocations.HasRelocations &&
+		info.Characteristics&pe.IMAGE_FILE_RELOCS_STRIPPED == 0
+}
+
+func hasGuardFlag(info *Info, flag uint32) bool {
+	return info.LoadConfig != nil && info.LoadConfig.GuardFlags&flag != 0
+}
+
+func checkASLR(info *Info) HardeningCheck {
+	c := HardeningCheck{ID: "aslr", Name: "ASLR (DYNAMIC_BASE)"}
+	switch {
+	case !hasDllFlag(info, pe.IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE):
+		c.Status, c.Detail = HardeningFail, "未启用"
+	case !hasRelocations(info):
+		c.Status, c.Detail = HardeningFail, "已声明但无重定位表，无法随机化"
+	default:
+		c.Status, c.Detail = HardeningPass, "已启用"
+	}
+	return c
+}
+
+func checkRelocations(info *Info) HardeningCheck {
+	c := HardeningCheck{ID: "relocations", Name: "重定位表"}
+	aslr := hasDllFlag(info, pe.IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE)
+	switch {
+	case hasRelocations(info):
+		c.Status, c.Detail = HardeningPass, fmt.Sprintf("%d 个重定位项", info.Relocations.TotalEntries)
+	case aslr:
+		c.Status, c.Detail = HardeningFail, "声明了ASLR但没有重定位表"
+	default:
+		c.Status, c.Detail = HardeningWarn, "无重定位表"
+	}
+	return c
+}
+
+func checkHighEntropyVA(info *Info) HardeningCheck {
+	c := HardeningCheck{ID: "high_entropy_va", Name: "高熵ASLR (HIGH_ENTROPY_VA)"}
+	if hasDllFlag(info, pe.IMAGE_DLLCHARACTERISTICS_HIGH_ENTROPY_VA) {
+		c.Status, c.Detail = HardeningPass, "已启用"
+	} else {
+		c.Status, c.Detail = HardeningWarn, "未启用"
+	}
+	return c
+}
+
+func checkDEP(info *Info) HardeningCheck {
+	c := HardeningCheck{ID: "dep", Name: "DEP (NX_COMPAT)"}
+	switch {
+	case hasDllFlag(info, pe.IMAGE_DLLCHARACTERISTICS_NX_COMPAT):
+		c.Status, c.Detail = HardeningPass, "已启用"
+	case info.Is64Bit:
+		c.Status, c.Detail = HardeningWarn, "未声明（64位进程始终启用DEP）"
+	default:
+		c.Status, c.Detail = HardeningFail, "未启用"
+	}
+	return c
+}
+
+func checkCFG(info *Info) HardeningCheck {
+	c := HardeningCheck{ID: "cfg", Name: "控制流保护 (CFG)"}
+	flag := hasDllFlag(info, pe.IMAGE_DLLCHARACTERISTICS_GUARD_CF)
+	instrumented := hasGuardFlag(info, IMAGE_GUARD_CF_INSTRUMENTED)
+	switch {
+	case flag && instrumented:
+		c.Status = HardeningPass
+		c.Detail = fmt.Sprintf("已启用 (%d 个有效调用目标)", info.LoadConfig.GuardCFFunctionCount)
+	case flag:
+		c.Status, c.Detail = HardeningWarn, "已声明GUARD_CF但加载配置中没有CFG检测数据"
+	default:
+		c.Status, c.Detail = HardeningWarn, "未启用"
+	}
+	return c
+}
+
+func checkSafeSEH(info *Info) HardeningCheck {
+	c := HardeningCheck{ID: "safeseh", Name: "SafeSEH"}
+	switch {
+	case hasDllFlag(info, pe.IMAGE_DLLCHARACTERISTICS_NO_SEH):
+		c.Status, c.Detail = HardeningPass, "不使用SEH (NO_SEH)"
+	case info.LoadConfig != nil && info.LoadConfig.SEHandlerTable != 0:
+		c.Status, c.Detail = HardeningPass, fmt.Sprintf("%d 个已注册处理程序", info.LoadConfig.SEHandlerCount)
+	default:
+		c.Status, c.Detail = HardeningFail, "无SafeSEH处理程序表"
+	}
+	return c
+}
+
+func checkSecurityCookie(info *Info) HardeningCheck {
+	c := HardeningCheck{ID: "gs", Name: "栈保护 (/GS)"}
+	if info.LoadConfig != nil && info.LoadConfig.SecurityCookie != 0 {
+		c.Status, c.Detail = HardeningPass, fmt.Sprintf("安全Cookie位于 0x%X", info.LoadConfig.SecurityCookie)
+	} else {
+		c.Status, c.Detail = HardeningWarn, "未找到安全Cookie"
+	}
+	return c
+}
+
+func checkRFG(info *Info) HardeningCheck {
+	c := HardeningCheck{ID: "rfg", Name: "返回流保护 (RFG)"}
+	if hasGuardFlag(info, IMAGE_GUARD_RF_INSTRUMENTED) {
+		c.Status, c.Detail = HardeningPass, "已插桩"
+	} else {
+		c.Status, c.Detail = HardeningWarn, "未启用"
+	}
+	return c
+}
+
+func checkCET(info *Info) HardeningCheck {
+	c := HardeningCheck{ID: "cet", Name: "CET影子栈兼容"}
+	if info.Debug != nil && info.Debug.ExDllCharacteristics&IMAGE_DLLCHARACTERISTICS_EX_CET_COMPAT != 0 {
+		c.Status, c.Detail = HardeningPass, "已标记CET_COMPAT"
+	} else {
+		c.Status, c.Detail = HardeningWarn, "未标记"
+	}
+	return c
+}
+
+func checkDllFlag(info *Info, id, name string, flag uint16) HardeningCheck {
+	c := HardeningCheck{ID: id, Name: name}
+	if hasDllFlag(info, flag) {
+		c.Status, c.Detail = HardeningPass, "已启用"
+	} else {
+		c.Status, c.Detail = HardeningWarn, "未启用"
+	}
+	return c
+}
+
+func checkRWXSections(info *Info) HardeningCheck {
+	c := HardeningCheck{ID: "no_rwx_sections", Name: "RWX节区"}
+
+	var rwx []string
+	for _, s := range info.Sections {
+		if strings.HasPrefix(s.Permissions, "RWX") {
+			rwx = append(rwx, s.Name)
+		}
+	}
+
+	if len(rwx) > 0 {
+		c.Status, c.Detail = HardeningFail, strings.Join(rwx, ", ")
+	} else {
+		c.Status, c.Detail = HardeningPass, "无"
+	}
+	return c
+}
+
+func checkEntrySection(info *Info) HardeningCheck {
+	c := HardeningCheck{ID: "entry_section", Name: "入口点节区"}
+
+	if info.EntryPoint == 0 {
+		c.Status, c.Detail = HardeningPass, "无入口点"
+		return c
+	}
+
+	for _, s := range info.Sections {
+		if info.EntryPoint < uint64(s.VirtualAddress) || info.EntryPoint >= uint64(s.VirtualAddress)+uint64(s.VirtualSize) {
+			continue
+		}
+		writable := s.Characteristics&pe.IMAGE_SCN_MEM_WRITE != 0
+		executable := s.Characteristics&pe.IMAGE_SCN_MEM_EXECUTE != 0
+		switch {
+		case writable && executable:
+			c.Status, c.Detail = HardeningFail, fmt.Sprintf("%s 可写且可执行", s.Name)
+		case writable || !executable:
+			c.Status, c.Detail = HardeningWarn, fmt.Sprintf("%s 权限异常 (%s)", s.Name, s.Permissions)
+		default:
+			c.Status, c.Detail = HardeningPass, fmt.Sprintf("%s (%s)", s.Name, s.Permissions)
+		}
+		return c
+	}
+
+	c.Status, c.Detail = HardeningWarn, "入口点不在任何节区内"
+	return c
+}
+
+func checkSignature(info *Info) HardeningCheck {
+	c := HardeningCheck{ID: "signature", Name: "数字签名"}
+	sig := info.Signature
+	switch {
+	case sig == nil || !sig.IsSigned:
+		c.Status, c.Detail = HardeningWarn, "未签名"
+	case sig.Signer == nil:
+		c.Status, c.Detail = HardeningFail, "已签名但找不到签名者的证书"
+	case !sig.Verified:
+		c.Status, c.Detail = HardeningFail, sig.VerifyError
+	case !sig.Signer.IsValid:
+		c.Status, c.Detail = HardeningWarn, "签名证书不在有效期内"
+	default:
+		c.Status, c.Detail = HardeningPass, sig.Signer.Subject
+	}
+	return c
+}
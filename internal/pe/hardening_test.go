@@ -0,0 +1,100 @@
+package pe
+
+import (
+	"debug/pe"
+	"testing"
+)
+
+func findCheck(checks []HardeningCheck, name string) *HardeningCheck {
+	for i := range checks {
+		if checks[i].Name == name {
+			return &checks[i]
+		}
+	}
+	return nil
+}
+
+func hardenedInfo() *Info {
+	return &Info{
+		Machine:    pe.IMAGE_FILE_MACHINE_AMD64,
+		Is64Bit:    true,
+		EntryPoint: 0x1010,
+		DllCharacteristics: pe.IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE | pe.IMAGE_DLLCHARACTERISTICS_HIGH_ENTROPY_VA |
+			pe.IMAGE_DLLCHARACTERISTICS_NX_COMPAT | pe.IMAGE_DLLCHARACTERISTICS_GUARD_CF,
+		Relocations: &RelocationInfo{HasRelocations: true, BlockCount: 1, TotalEntries: 4},
+		LoadConfig: &LoadConfigInfo{
+			HasLoadConfig:        true,
+			SecurityCookie:       0x140003000,
+			GuardCFFunctionCount: 12,
+			GuardFlags:           IMAGE_GUARD_CF_INSTRUMENTED,
+		},
+		Debug: &DebugInfo{ExDllCharacteristics: IMAGE_DLLCHARACTERISTICS_EX_CET_COMPAT},
+		Sections: []SectionInfo{
+			{Name: ".text", VirtualAddress: 0x1000, VirtualSize: 0x100,
+				Characteristics: pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_EXECUTE, Permissions: "R-X"},
+			{Name: ".data", VirtualAddress: 0x2000, VirtualSize: 0x100,
+				Characteristics: pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_WRITE, Permissions: "RW-"},
+		},
+	}
+}
+
+func TestAuditHardeningHardened(t *testing.T) {
+	checks := AuditHardening(hardenedInfo())
+
+	for _, name := range []string{"ASLR (DYNAMIC_BASE)", "重定位表", "高熵ASLR (HIGH_ENTROPY_VA)", "DEP (NX_COMPAT)",
+		"控制流保护 (CFG)", "栈保护 (/GS)", "CET影子栈兼容", "RWX节区", "入口点节区"} {
+		c := findCheck(checks, name)
+		if c == nil {
+			t.Errorf("missing check %q", name)
+			continue
+		}
+		if c.Status != HardeningPass {
+			t.Errorf("%s = %v (%s), want PASS", name, c.Status, c.Detail)
+		}
+	}
+
+	if findCheck(checks, "SafeSEH") != nil {
+		t.Error("SafeSEH check should be omitted for x64")
+	}
+}
+
+func TestAuditHardeningWeak(t *testing.T) {
+	info := &Info{
+		Machine:            pe.IMAGE_FILE_MACHINE_I386,
+		EntryPoint:         0x1000,
+		DllCharacteristics: pe.IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE | pe.IMAGE_DLLCHARACTERISTICS_GUARD_CF,
+		Sections: []SectionInfo{
+			{Name: ".text", VirtualAddress: 0x1000, VirtualSize: 0x100,
+				Characteristics: pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_WRITE | pe.IMAGE_SCN_MEM_EXECUTE, Permissions: "RWX"},
+		},
+	}
+	checks := AuditHardening(info)
+
+	tests := []struct {
+		name string
+		want HardeningStatus
+	}{
+		{"ASLR (DYNAMIC_BASE)", HardeningFail},
+		{"重定位表", HardeningFail},
+		{"DEP (NX_COMPAT)", HardeningFail},
+		{"控制流保护 (CFG)", HardeningWarn},
+		{"SafeSEH", HardeningFail},
+		{"RWX节区", HardeningFail},
+		{"入口点节区", HardeningFail},
+		{"数字签名", HardeningWarn},
+	}
+	for _, tt := range tests {
+		c := findCheck(checks, tt.name)
+		if c == nil {
+			t.Errorf("missing check %q", tt.name)
+			continue
+		}
+		if c.Status != tt.want {
+			t.Errorf("%s = %v (%s), want %v", tt.name, c.Status, c.Detail, tt.want)
+		}
+	}
+
+	if findCheck(checks, "高熵ASLR (HIGH_ENTROPY_VA)") != nil {
+		t.Error("HIGH_ENTROPY_VA check should be omitted for PE32")
+	}
+}
@@ -0,0 +1,615 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// COFF characteristics edited by the header editor.
+const (
+	coffRelocsStripped    = 0x0001
+	coffLargeAddressAware = 0x0020
+)
+
+// Optional header layout.
+const (
+	optionalHeaderMagic64  = 0x20b
+	optNumberOfRvaAndSizes = 92 // PE32; PE32+ is 16 bytes further
+	optDataDirectoryOff32  = 96
+	optDataDirectoryOff64  = 112
+)
+
+// Data directory indexes.
+const (
+	dataDirBaseReloc  = 5
+	dataDirLoadConfig = 10
+)
+
+type headerFieldKind int
+
+const (
+	fieldNumber headerFieldKind = iota
+	fieldVersion
+	fieldSubsystem
+	fieldDllFlag
+	fieldCOFFFlag
+)
+
+// headerField describes a named, editable header field.
+// Offsets are relative to the start of the optional header; for fieldVersion
+// the offset points at the Major half and the Minor half follows it.
+type headerField struct {
+	name   string
+	kind   headerFieldKind
+	off32  int
+	off64  int
+	size32 int
+	size64 int
+	mask   uint16
+}
+
+var headerFields = []headerField{
+	{name: "Subsystem", kind: fieldSubsystem, off32: 68, off64: 68, size32: 2, size64: 2},
+	{name: "OSVersion", kind: fieldVersion, off32: 40, off64: 40, size32: 2, size64: 2},
+	{name: "ImageVersion", kind: fieldVersion, off32: 44, off64: 44, size32: 2, size64: 2},
+	{name: "SubsystemVersion", kind: fieldVersion, off32: 48, off64: 48, size32: 2, size64: 2},
+	{name: "StackReserve", kind: fieldNumber, off32: 72, off64: 72, size32: 4, size64: 8},
+	{name: "StackCommit", kind: fieldNumber, off32: 76, off64: 80, size32: 4, size64: 8},
+	{name: "HeapReserve", kind: fieldNumber, off32: 80, off64: 88, size32: 4, size64: 8},
+	{name: "HeapCommit", kind: fieldNumber, off32: 84, off64: 96, size32: 4, size64: 8},
+	{name: "DllCharacteristics", kind: fieldNumber, off32: 70, off64: 70, size32: 2, size64: 2},
+	{name: "HIGH_ENTROPY_VA", kind: fieldDllFlag, mask: pe.IMAGE_DLLCHARACTERISTICS_HIGH_ENTROPY_VA},
+	{name: "DYNAMIC_BASE", kind: fieldDllFlag, mask: pe.IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE},
+	{name: "FORCE_INTEGRITY", kind: fieldDllFlag, mask: pe.IMAGE_DLLCHARACTERISTICS_FORCE_INTEGRITY},
+	{name: "NX_COMPAT", kind: fieldDllFlag, mask: pe.IMAGE_DLLCHARACTERISTICS_NX_COMPAT},
+	{name: "NO_ISOLATION", kind: fieldDllFlag, mask: pe.IMAGE_DLLCHARACTERISTICS_NO_ISOLATION},
+	{name: "NO_SEH", kind: fieldDllFlag, mask: pe.IMAGE_DLLCHARACTERISTICS_NO_SEH},
+	{name: "NO_BIND", kind: fieldDllFlag, mask: pe.IMAGE_DLLCHARACTERISTICS_NO_BIND},
+	{name: "APPCONTAINER", kind: fieldDllFlag, mask: pe.IMAGE_DLLCHARACTERISTICS_APPCONTAINER},
+	{name: "WDM_DRIVER", kind: fieldDllFlag, mask: pe.IMAGE_DLLCHARACTERISTICS_WDM_DRIVER},
+	{name: "GUARD_CF", kind: fieldDllFlag, mask: pe.IMAGE_DLLCHARACTERISTICS_GUARD_CF},
+	{name: "TERMINAL_SERVER_AWARE", kind: fieldDllFlag, mask: pe.IMAGE_DLLCHARACTERISTICS_TERMINAL_SERVER_AWARE},
+	{name: "LARGE_ADDRESS_AWARE", kind: fieldCOFFFlag, mask: coffLargeAddressAware},
+	{name: "RELOCS_STRIPPED", kind: fieldCOFFFlag, mask: coffRelocsStripped},
+}
+
+var subsystemNames = map[string]uint16{
+	"NATIVE":                   pe.IMAGE_SUBSYSTEM_NATIVE,
+	"WINDOWS_GUI":              pe.IMAGE_SUBSYSTEM_WINDOWS_GUI,
+	"GUI":                      pe.IMAGE_SUBSYSTEM_WINDOWS_GUI,
+	"WINDOWS_CUI":              pe.IMAGE_SUBSYSTEM_WINDOWS_CUI,
+	"CUI":                      pe.IMAGE_SUBSYSTEM_WINDOWS_CUI,
+	"CONSOLE":                  pe.IMAGE_SUBSYSTEM_WINDOWS_CUI,
+	"OS2_CUI":                  pe.IMAGE_SUBSYSTEM_OS2_CUI,
+	"POSIX_CUI":                pe.IMAGE_SUBSYSTEM_POSIX_CUI,
+	"NATIVE_WINDOWS":           pe.IMAGE_SUBSYSTEM_NATIVE_WINDOWS,
+	"WINDOWS_CE_GUI":           pe.IMAGE_SUBSYSTEM_WINDOWS_CE_GUI,
+	"EFI_APPLICATION":          pe.IMAGE_SUBSYSTEM_EFI_APPLICATION,
+	"EFI_BOOT_SERVICE_DRIVER":  pe.IMAGE_SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER,
+	"EFI_RUNTIME_DRIVER":       pe.IMAGE_SUBSYSTEM_EFI_RUNTIME_DRIVER,
+	"EFI_ROM":                  pe.IMAGE_SUBSYSTEM_EFI_ROM,
+	"XBOX":                     pe.IMAGE_SUBSYSTEM_XBOX,
+	"WINDOWS_BOOT_APPLICATION": pe.IMAGE_SUBSYSTEM_WINDOWS_BOOT_APPLICATION,
+}
+
+// HeaderChange is a single "Field=Value" assignment for the header editor.
+type HeaderChange struct {
+	Field string
+	Value string
+}
+
+// ParseHeaderChanges parses a comma-separated list of Field=Value pairs,
+// e.g. "NX_COMPAT=on,DYNAMIC_BASE=on,Subsystem=console,StackReserve=0x200000".
+func ParseHeaderChanges(spec string) ([]HeaderChange, error) {
+	var changes []HeaderChange
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("头字段格式错误 (应为 字段=值): %s", item)
+		}
+		if _, err := lookupHeaderField(name); err != nil {
+			return nil, err
+		}
+		changes = append(changes, HeaderChange{Field: strings.TrimSpace(name), Value: strings.TrimSpace(value)})
+	}
+
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("未指定头字段")
+	}
+	return changes, nil
+}
+
+// HeaderFieldNames returns the names accepted by the header editor.
+func HeaderFieldNames() []string {
+	names := make([]string, len(headerFields))
+	for i, f := range headerFields {
+		names[i] = f.name
+	}
+	return names
+}
+
+func lookupHeaderField(name string) (headerField, error) {
+	name = strings.TrimSpace(name)
+	flagName := strings.TrimPrefix(strings.TrimPrefix(strings.ToUpper(name), "IMAGE_DLLCHARACTERISTICS_"), "IMAGE_FILE_")
+	for _, f := range headerFields {
+		if strings.EqualFold(f.name, name) || strings.EqualFold(f.name, strings.TrimPrefix(name, "SizeOf")) || f.name == flagName {
+			return f, nil
+		}
+	}
+	return headerField{}, fmt.Errorf("未知的头字段: %s", name)
+}
+
+// headerImage holds raw copies of the COFF and optional headers so that all
+// changes can be applied and validated before anything is written back.
+type headerImage struct {
+	coff []byte
+	opt  []byte
+	is64 bool
+}
+
+func (h *headerImage) get(f headerField) uint64 {
+	switch f.kind {
+	case fieldDllFlag:
+		return boolToUint(h.dllCharacteristics()&f.mask != 0)
+	case fieldCOFFFlag:
+		return boolToUint(binary.LittleEndian.Uint16(h.coff[18:20])&f.mask != 0)
+	case fieldVersion:
+		off := f.off32
+		return uint64(binary.LittleEndian.Uint16(h.opt[off:]))<<16 | uint64(binary.LittleEndian.Uint16(h.opt[off+2:]))
+	}
+
+	off, size := f.off32, f.size32
+	if h.is64 {
+		off, size = f.off64, f.size64
+	}
+	switch size {
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(h.opt[off:]))
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(h.opt[off:]))
+	default:
+		return binary.LittleEndian.Uint64(h.opt[off:])
+	}
+}
+
+func (h *headerImage) set(f headerField, v uint64) error {
+	switch f.kind {
+	case fieldDllFlag:
+		h.setDllCharacteristics(setMask16(h.dllCharacteristics(), f.mask, v != 0))
+		return nil
+	case fieldCOFFFlag:
+		binary.LittleEndian.PutUint16(h.coff[18:20], setMask16(binary.LittleEndian.Uint16(h.coff[18:20]), f.mask, v != 0))
+		return nil
+	case fieldVersion:
+		binary.LittleEndian.PutUint16(h.opt[f.off32:], uint16(v>>16))
+		binary.LittleEndian.PutUint16(h.opt[f.off32+2:], uint16(v))
+		return nil
+	}
+
+	off, size := f.off32, f.size32
+	if h.is64 {
+		off, size = f.off64, f.size64
+	}
+	if size < 8 && v>>(8*size) != 0 {
+		return fmt.Errorf("%s 的值 0x%X 超出 %d 字节字段范围", f.name, v, size)
+	}
+	switch size {
+	case 2:
+		binary.LittleEndian.PutUint16(h.opt[off:], uint16(v))
+	case 4:
+		binary.LittleEndian.PutUint32(h.opt[off:], uint32(v))
+	default:
+		binary.LittleEndian.PutUint64(h.opt[off:], v)
+	}
+	return nil
+}
+
+func (h *headerImage) dllCharacteristics() uint16 {
+	return binary.LittleEndian.Uint16(h.opt[70:72])
+}
+
+func (h *headerImage) setDllCharacteristics(v uint16) {
+	binary.LittleEndian.PutUint16(h.opt[70:72], v)
+}
+
+// dataDirectoryOffset returns the optional header offset of a data directory
+// entry, or false if the header does not declare that many entries.
+func (h *headerImage) dataDirectoryOffset(index int) (int, bool) {
+	countOff, dirOff := optNumberOfRvaAndSizes, optDataDirectoryOff32
+	if h.is64 {
+		countOff, dirOff = optNumberOfRvaAndSizes+16, optDataDirectoryOff64
+	}
+	count := int(binary.LittleEndian.Uint32(h.opt[countOff:]))
+	off := dirOff + index*8
+	if index >= count || off+8 > len(h.opt) {
+		return 0, false
+	}
+	return off, true
+}
+
+// dataDirectorySize returns the Size of the given data directory entry.
+func (h *headerImage) dataDirectorySize(index int) uint32 {
+	off, ok := h.dataDirectoryOffset(index)
+	if !ok {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(h.opt[off+4:])
+}
+
+// validate checks the combined result of all changes.
+func (h *headerImage) validate() error {
+	field := func(name string) uint64 {
+		f, _ := lookupHeaderField(name)
+		return h.get(f)
+	}
+
+	if field("StackCommit") > field("StackReserve") {
+		return fmt.Errorf("StackCommit (0x%X) 不能大于 StackReserve (0x%X)", field("StackCommit"), field("StackReserve"))
+	}
+	if field("HeapCommit") > field("HeapReserve") {
+		return fmt.Errorf("HeapCommit (0x%X) 不能大于 HeapReserve (0x%X)", field("HeapCommit"), field("HeapReserve"))
+	}
+
+	dll := h.dllCharacteristics()
+	if dll&pe.IMAGE_DLLCHARACTERISTICS_HIGH_ENTROPY_VA != 0 {
+		if !h.is64 {
+			return fmt.Errorf("HIGH_ENTROPY_VA 仅适用于 PE32+ (64位) 文件")
+		}
+		if dll&pe.IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE == 0 {
+			return fmt.Errorf("HIGH_ENTROPY_VA 需要同时启用 DYNAMIC_BASE")
+		}
+	}
+	if dll&pe.IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE != 0 {
+		if h.dataDirectorySize(dataDirBaseReloc) == 0 || field("RELOCS_STRIPPED") != 0 {
+			return fmt.Errorf("DYNAMIC_BASE 需要重定位表 (文件没有重定位表或已设置 RELOCS_STRIPPED)")
+		}
+	}
+	if dll&pe.IMAGE_DLLCHARACTERISTICS_GUARD_CF != 0 && h.dataDirectorySize(dataDirLoadConfig) == 0 {
+		return fmt.Errorf("GUARD_CF 需要加载配置目录 (文件没有 Load Config)")
+	}
+	return nil
+}
+
+func (h *headerImage) apply(c HeaderChange) error {
+	f, err := lookupHeaderField(c.Field)
+	if err != nil {
+		return err
+	}
+
+	v, err := parseHeaderValue(f, c.Value)
+	if err != nil {
+		return err
+	}
+	return h.set(f, v)
+}
+
+func parseHeaderValue(f headerField, value string) (uint64, error) {
+	switch f.kind {
+	case fieldDllFlag, fieldCOFFFlag:
+		return parseOnOff(f.name, value)
+	case fieldVersion:
+		return parseVersionValue(f.name, value)
+	case fieldSubsystem:
+		if v, ok := subsystemNames[strings.ToUpper(value)]; ok {
+			return uint64(v), nil
+		}
+	}
+
+	v, err := strconv.ParseUint(value, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s 的值无效: %s", f.name, value)
+	}
+	return v, nil
+}
+
+func parseOnOff(name, value string) (uint64, error) {
+	switch strings.ToLower(value) {
+	case "on", "true", "1", "yes":
+		return 1, nil
+	case "off", "false", "0", "no":
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%s 的值应为 on/off: %s", name, value)
+}
+
+func parseVersionValue(name, value string) (uint64, error) {
+	majorStr, minorStr, _ := strings.Cut(value, ".")
+	if minorStr == "" {
+		minorStr = "0"
+	}
+
+	major, err1 := strconv.ParseUint(majorStr, 10, 16)
+	minor, err2 := strconv.ParseUint(minorStr, 10, 16)
+	if err1 != nil || err2 != nil {
+		return 0, fmt.Errorf("%s 的版本号格式错误 (应为 主版本.次版本): %s", name, value)
+	}
+	return major<<16 | minor, nil
+}
+
+func boolToUint(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func setMask16(v, mask uint16, on bool) uint16 {
+	if on {
+		return v | mask
+	}
+	return v &^ mask
+}
+
+// HeaderEditor edits named COFF and optional header fields.
+type HeaderEditor struct {
+	patcher *Patcher
+}
+
+// NewHeaderEditor creates a new header editor.
+func NewHeaderEditor(patcher *Patcher) *HeaderEditor {
+	return &HeaderEditor{patcher: patcher}
+}
+
+// Apply validates and writes all changes, then updates the checksum.
+// Nothing is written if any change or the resulting combination is invalid.
+func (e *HeaderEditor) Apply(changes []HeaderChange) error {
+	peOffset, err := e.patcher.peHeaderOffset()
+	if err != nil {
+		return err
+	}
+
+	img, err := e.read(peOffset)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		if err := img.apply(c); err != nil {
+			return err
+		}
+	}
+	if err := img.validate(); err != nil {
+		return err
+	}
+
+	if _, err := e.patcher.file.WriteAt(img.coff, peOffset+4); err != nil {
+		return fmt.Errorf("写入COFF头失败: %w", err)
+	}
+	if _, err := e.patcher.file.WriteAt(img.opt, peOffset+24); err != nil {
+		return fmt.Errorf("写入可选头失败: %w", err)
+	}
+
+	return e.patcher.UpdateChecksum()
+}
+
+// Get returns the current value of a named field formatted for display.
+func (e *HeaderEditor) Get(name string) (string, error) {
+	f, err := lookupHeaderField(name)
+	if err != nil {
+		return "", err
+	}
+
+	peOffset, err := e.patcher.peHeaderOffset()
+	if err != nil {
+		return "", err
+	}
+	img, err := e.read(peOffset)
+	if err != nil {
+		return "", err
+	}
+
+	v := img.get(f)
+	switch f.kind {
+	case fieldDllFlag, fieldCOFFFlag:
+		if v != 0 {
+			return "on", nil
+		}
+		return "off", nil
+	case fieldVersion:
+		return fmt.Sprintf("%d.%d", v>>16, v&0xFFFF), nil
+	}
+	return fmt.Sprintf("0x%X", v), nil
+}
+
+func (e *HeaderEditor) read(peOffset int64) (*headerImage, error) {
+	img := &headerImage{coff: make([]byte, 20)}
+	if _, err := e.patcher.file.ReadAt(img.coff, peOffset+4); err != nil {
+		return nil, fmt.Errorf("读取COFF头失败: %w", err)
+	}
+
+	optSize := binary.LittleEndian.Uint16(img.coff[16:18])
+	if optSize < optDataDirectoryOff32 {
+		return nil, fmt.Errorf("可选头过小: %d 字节", optSize)
+	}
+
+	img.opt = make([]byte, optSize)
+	if _, err := e.patcher.file.ReadAt(img.opt, peOffset+24); err != nil {
+		return nil, fmt.Errorf("读取可选头失败: %w", err)
+	}
+	img.is64 = binary.LittleEndian.Uint16(img.opt[0:2]) == optionalHeaderMagic64
+	if img.is64 && optSize < optDataDirectoryOff64 {
+		return nil, fmt.Errorf("可选头过小: %d 字节", optSize)
+	}
+
+	return img, nil
+}
+
+// peHeaderOffset reads e_lfanew from the DOS header.
+func (p *Patcher) peHeaderOffset() (int64, error) {
+	dosHeader := make([]byte, 64)
+	if _, err := p.file.ReadAt(dosHeader, 0); err != nil {
+		return 0, fmt.Errorf("读取DOS头失败: %w", err)
+	}
+	return int64(binary.LittleEndian.Uint32(dosHeader[60:64])), nil
+}
+
+// SetHeaderFields parses and applies a "Field=Value,..." header change list.
+func (p *Patcher) SetHeaderFields(spec string) error {
+	changes, err := ParseHeaderChanges(spec)
+	if err != nil {
+		return err
+	}
+	return NewHeaderEditor(p).Apply(changes)
+}
+
+// dataDirectory returns the RVA and size of a data directory entry, or zeros
+// if the entry is absent.
+func dataDirectory(f *pe.File, index int) (rva, size uint32) {
+	var dirs []pe.DataDirectory
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		dirs = oh.DataDirectory[:min(oh.NumberOfRvaAndSizes, 16)]
+	case *pe.OptionalHeader64:
+		dirs = oh.DataDirectory[:min(oh.NumberOfRvaAndSizes, 16)]
+	}
+
+	if index >= len(dirs) {
+		return 0, 0
+	}
+	return dirs[index].VirtualAddress, dirs[index].Size
+}
+
+// dataDirectoryCount returns the number of data directory entries the
+// optional header declares, at most 16.
+func dataDirectoryCount(f *pe.File) int {
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		return int(min(oh.NumberOfRvaAndSizes, 16))
+	case *pe.OptionalHeader64:
+		return int(min(oh.NumberOfRvaAndSizes, 16))
+	}
+	return 0
+}
+
+// setDataDirectory writes a data directory entry in the file. The parsed
+// headers are not refreshed; call Reload if they are needed afterwards.
+func (p *Patcher) setDataDirectory(index int, rva, size uint32) error {
+	peOffset, err := p.peHeaderOffset()
+	if err != nil {
+		return err
+	}
+	img, err := NewHeaderEditor(p).read(peOffset)
+	if err != nil {
+		return err
+	}
+
+	entryOff, ok := img.dataDirectoryOffset(index)
+	if !ok {
+		return fmt.Errorf("数据目录 %d 不存在", index)
+	}
+
+	entry := make([]byte, 8)
+	binary.LittleEndian.PutUint32(entry[0:4], rva)
+	binary.LittleEndian.PutUint32(entry[4:8], size)
+	if _, err := p.file.WriteAt(entry, peOffset+24+int64(entryOff)); err != nil {
+		return fmt.Errorf("写入数据目录失败: %w", err)
+	}
+	return nil
+}
+
+// ensureDataDirectories makes the optional header declare at least count
+// data directories. The new entries are zeroed; when SizeOfOptionalHeader is
+// too small for them, the section table is moved down in the header space,
+// and the PE file is reloaded.
+func (p *Patcher) ensureDataDirectories(count int) error {
+	if dataDirectoryCount(p.peFile) >= count {
+		return nil
+	}
+	peOffset, err := p.peHeaderOffset()
+	if err != nil {
+		return err
+	}
+	coffHeader := make([]byte, 20)
+	if _, err := p.file.ReadAt(coffHeader, peOffset+4); err != nil {
+		return fmt.Errorf("读取COFF头失败: %w", err)
+	}
+	numberOfSections := int64(binary.LittleEndian.Uint16(coffHeader[2:4]))
+	optionalHeaderSize := int64(binary.LittleEndian.Uint16(coffHeader[16:18]))
+
+	countOff, dirOff := int64(optNumberOfRvaAndSizes), int64(optDataDirectoryOff32)
+	var sizeOfHeaders uint32
+	switch oh := p.peFile.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		sizeOfHeaders = oh.SizeOfHeaders
+	case *pe.OptionalHeader64:
+		countOff, dirOff = optNumberOfRvaAndSizes+16, optDataDirectoryOff64
+		sizeOfHeaders = oh.SizeOfHeaders
+	}
+	oldCount := int64(dataDirectoryCount(p.peFile))
+	newSize := max(optionalHeaderSize, dirOff+int64(count)*8)
+
+	optOffset := peOffset + 24
+	tableOffset := optOffset + optionalHeaderSize
+	tableSize := numberOfSections * 40
+	newTableOffset := optOffset + newSize
+	if newTableOffset > tableOffset {
+		limit := int64(sizeOfHeaders)
+		for _, s := range p.peFile.Sections {
+			if s.Offset != 0 {
+				limit = min(limit, int64(s.Offset))
+			}
+		}
+		if newTableOffset+tableSize > limit {
+			return fmt.Errorf("头部空间不足，无法将数据目录扩展到 %d 项", count)
+		}
+		if err := p.stripBoundImportsOverlapping(tableOffset+tableSize, newTableOffset+tableSize); err != nil {
+			return err
+		}
+
+		table := make([]byte, tableSize)
+		if _, err := p.file.ReadAt(table, tableOffset); err != nil {
+			return fmt.Errorf("读取节区头表失败: %w", err)
+		}
+		if _, err := p.file.WriteAt(table, newTableOffset); err != nil {
+			return fmt.Errorf("移动节区头表失败: %w", err)
+		}
+	}
+
+	dirs := make([]byte, (int64(count)-oldCount)*8)
+	if _, err := p.file.WriteAt(dirs, optOffset+dirOff+oldCount*8); err != nil {
+		return fmt.Errorf("写入数据目录失败: %w", err)
+	}
+	field := make([]byte, 4)
+	binary.LittleEndian.PutUint32(field, uint32(count))
+	if _, err := p.file.WriteAt(field, optOffset+countOff); err != nil {
+		return fmt.Errorf("更新NumberOfRvaAndSizes失败: %w", err)
+	}
+	binary.LittleEndian.PutUint16(field, uint16(newSize))
+	if _, err := p.file.WriteAt(field[:2], peOffset+4+16); err != nil {
+		return fmt.Errorf("更新SizeOfOptionalHeader失败: %w", err)
+	}
+
+	if err := p.Reload(); err != nil {
+		return fmt.Errorf("重新加载PE文件失败: %w", err)
+	}
+	return nil
+}
+
+// imageBase returns the preferred load address from the optional header.
+func imageBase(f *pe.File) uint64 {
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		return uint64(oh.ImageBase)
+	case *pe.OptionalHeader64:
+		return oh.ImageBase
+	}
+	return 0
+}
+
+// vaToOffset converts a virtual address to a file offset.
+func vaToOffset(f *pe.File, va uint64) (uint32, error) {
+	base := imageBase(f)
+	if va < base || va-base > 0xFFFFFFFF {
+		return 0, fmt.Errorf("VA 0x%X 不在镜像范围内", va)
+	}
+	return rvaToOffset(f, uint32(va-base))
+}
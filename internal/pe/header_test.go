@@ -0,0 +1,141 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"testing"
+)
+
+// newTestHeaderImage builds a minimal header image with relocations present.
+func newTestHeaderImage(is64 bool) *headerImage {
+	img := &headerImage{coff: make([]byte, 20), opt: make([]byte, 240), is64: is64}
+	countOff, dirOff := optNumberOfRvaAndSizes, optDataDirectoryOff32
+	if is64 {
+		countOff, dirOff = optNumberOfRvaAndSizes+16, optDataDirectoryOff64
+	}
+	binary.LittleEndian.PutUint32(img.opt[countOff:], 16)
+	binary.LittleEndian.PutUint32(img.opt[dirOff+dataDirBaseReloc*8+4:], 0x100)
+	return img
+}
+
+func TestParseHeaderChanges(t *testing.T) {
+	changes, err := ParseHeaderChanges("NX_COMPAT=on, DYNAMIC_BASE=on,Subsystem=console")
+	if err != nil {
+		t.Fatalf("ParseHeaderChanges() error = %v", err)
+	}
+	if len(changes) != 3 || changes[2].Field != "Subsystem" || changes[2].Value != "console" {
+		t.Errorf("ParseHeaderChanges() = %v", changes)
+	}
+
+	for _, spec := range []string{"", "NX_COMPAT", "BOGUS=1"} {
+		if _, err := ParseHeaderChanges(spec); err == nil {
+			t.Errorf("ParseHeaderChanges(%q) expected error", spec)
+		}
+	}
+}
+
+func TestHeaderImageApply(t *testing.T) {
+	img := newTestHeaderImage(true)
+	changes := []HeaderChange{
+		{"NX_COMPAT", "on"},
+		{"IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE", "true"},
+		{"high_entropy_va", "1"},
+		{"LARGE_ADDRESS_AWARE", "on"},
+		{"Subsystem", "gui"},
+		{"SubsystemVersion", "6.1"},
+		{"SizeOfStackReserve", "0x200000"},
+		{"StackCommit", "4096"},
+	}
+	for _, c := range changes {
+		if err := img.apply(c); err != nil {
+			t.Fatalf("apply(%v) error = %v", c, err)
+		}
+	}
+	if err := img.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+
+	wantDll := uint16(pe.IMAGE_DLLCHARACTERISTICS_NX_COMPAT | pe.IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE |
+		pe.IMAGE_DLLCHARACTERISTICS_HIGH_ENTROPY_VA)
+	if got := img.dllCharacteristics(); got != wantDll {
+		t.Errorf("DllCharacteristics = 0x%X, want 0x%X", got, wantDll)
+	}
+	if got := binary.LittleEndian.Uint16(img.coff[18:]); got != coffLargeAddressAware {
+		t.Errorf("COFF Characteristics = 0x%X, want 0x%X", got, coffLargeAddressAware)
+	}
+	if got := binary.LittleEndian.Uint16(img.opt[68:]); got != pe.IMAGE_SUBSYSTEM_WINDOWS_GUI {
+		t.Errorf("Subsystem = %d", got)
+	}
+	if major, minor := binary.LittleEndian.Uint16(img.opt[48:]), binary.LittleEndian.Uint16(img.opt[50:]); major != 6 || minor != 1 {
+		t.Errorf("SubsystemVersion = %d.%d, want 6.1", major, minor)
+	}
+	if got := binary.LittleEndian.Uint64(img.opt[72:]); got != 0x200000 {
+		t.Errorf("StackReserve = 0x%X", got)
+	}
+	if got := binary.LittleEndian.Uint64(img.opt[80:]); got != 4096 {
+		t.Errorf("StackCommit = %d", got)
+	}
+}
+
+func TestHeaderImageValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		is64    bool
+		changes []HeaderChange
+		wantErr bool
+	}{
+		{"Commit larger than reserve", true, []HeaderChange{{"StackReserve", "0x1000"}, {"StackCommit", "0x2000"}}, true},
+		{"Heap commit larger than reserve", false, []HeaderChange{{"HeapCommit", "0x2000"}}, true},
+		{"High entropy on PE32", false, []HeaderChange{{"DYNAMIC_BASE", "on"}, {"HIGH_ENTROPY_VA", "on"}}, true},
+		{"High entropy without ASLR", true, []HeaderChange{{"HIGH_ENTROPY_VA", "on"}}, true},
+		{"ASLR with stripped relocations", true, []HeaderChange{{"DYNAMIC_BASE", "on"}, {"RELOCS_STRIPPED", "on"}}, true},
+		{"CFG without load config", true, []HeaderChange{{"GUARD_CF", "on"}}, true},
+		{"DEP and ASLR", false, []HeaderChange{{"NX_COMPAT", "on"}, {"DYNAMIC_BASE", "on"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := newTestHeaderImage(tt.is64)
+			for _, c := range tt.changes {
+				if err := img.apply(c); err != nil {
+					t.Fatalf("apply(%v) error = %v", c, err)
+				}
+			}
+			if err := img.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHeaderImageApplyInvalidValue(t *testing.T) {
+	tests := []HeaderChange{
+		{"StackReserve", "0x100000000"}, // Does not fit PE32.
+		{"NX_COMPAT", "maybe"},
+		{"OSVersion", "six"},
+		{"Subsystem", "amiga"},
+	}
+
+	for _, c := range tests {
+		if err := newTestHeaderImage(false).apply(c); err == nil {
+			t.Errorf("apply(%v) expected error", c)
+		}
+	}
+}
+
+func TestDataDirectoryCount(t *testing.T) {
+	tests := []struct {
+		oh   any
+		want int
+	}{
+		{&pe.OptionalHeader32{NumberOfRvaAndSizes: 2}, 2},
+		{&pe.OptionalHeader64{NumberOfRvaAndSizes: 16}, 16},
+		{&pe.OptionalHeader64{NumberOfRvaAndSizes: 0x100}, 16},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		if got := dataDirectoryCount(&pe.File{OptionalHeader: tt.oh}); got != tt.want {
+			t.Errorf("dataDirectoryCount(%T) = %d, want %d", tt.oh, got, tt.want)
+		}
+	}
+}
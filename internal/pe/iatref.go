@@ -0,0 +1,89 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// IATReference is an instruction that calls or jumps through an IAT slot.
+type IATReference struct {
+	RVA  uint32 // Address of the instruction
+	Slot uint32 // RVA of the IAT slot it reads
+	Jump bool   // jmp rather than call
+}
+
+// FindIATReferences scans the executable sections for indirect calls and
+// jumps through the given IAT slots: FF 15 / FF 25 with an absolute address
+// on x86, or a RIP-relative one on x64 (optionally REX.W-prefixed). Other
+// machines return nil. This is a byte pattern scan, so it can report matches
+// inside data and misses slots loaded through a register first.
+func FindIATReferences(f *pe.File, r io.ReaderAt, slots []uint32) ([]IATReference, error) {
+	var is64 bool
+	switch f.Machine {
+	case pe.IMAGE_FILE_MACHINE_I386:
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		is64 = true
+	default:
+		return nil, nil
+	}
+	if len(slots) == 0 {
+		return nil, nil
+	}
+
+	wanted := make(map[uint32]bool, len(slots))
+	for _, slot := range slots {
+		wanted[slot] = true
+	}
+
+	var refs []IATReference
+	for _, s := range f.Sections {
+		if s.Characteristics&pe.IMAGE_SCN_MEM_EXECUTE == 0 {
+			continue
+		}
+		size := s.Size
+		if s.VirtualSize != 0 && s.VirtualSize < size {
+			size = s.VirtualSize
+		}
+		code := make([]byte, size)
+		if _, err := r.ReadAt(code, int64(s.Offset)); err != nil && err != io.EOF {
+			return refs, fmt.Errorf("读取节区 %s 失败: %w", s.Name, err)
+		}
+		refs = append(refs, scanIATReferences(code, s.VirtualAddress, is64, imageBase(f), wanted)...)
+	}
+	return refs, nil
+}
+
+// scanIATReferences finds call/jmp [slot] instructions in code loaded at
+// codeRVA.
+func scanIATReferences(code []byte, codeRVA uint32, is64 bool, base uint64, slots map[uint32]bool) []IATReference {
+	var refs []IATReference
+	for i := 0; i+6 <= len(code); i++ {
+		if code[i] != 0xFF || (code[i+1] != 0x15 && code[i+1] != 0x25) {
+			continue
+		}
+
+		disp := binary.LittleEndian.Uint32(code[i+2:])
+		var target uint32
+		if is64 {
+			// RIP-relative: the displacement counts from the next instruction
+			target = codeRVA + uint32(i) + 6 + disp
+		} else {
+			if uint64(disp) < base {
+				continue
+			}
+			target = uint32(uint64(disp) - base)
+		}
+		if !slots[target] {
+			continue
+		}
+
+		site := codeRVA + uint32(i)
+		if is64 && i > 0 && code[i-1] == 0x48 {
+			site-- // REX.W jmp, as in import thunks
+		}
+		refs = append(refs, IATReference{RVA: site, Slot: target, Jump: code[i+1] == 0x25})
+	}
+	return refs
+}
@@ -0,0 +1,34 @@
+package pe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScanIATReferences(t *testing.T) {
+	slots := map[uint32]bool{0x3010: true, 0x3028: true}
+
+	// x86: absolute addresses
+	code := []byte{
+		0xFF, 0x15, 0x10, 0x30, 0x40, 0x00, // call [0x403010]
+		0x90,
+		0xFF, 0x25, 0x28, 0x30, 0x40, 0x00, // jmp [0x403028]
+		0xFF, 0x15, 0x00, 0x30, 0x40, 0x00, // call [0x403000], not removed
+	}
+	got := scanIATReferences(code, 0x1000, false, 0x400000, slots)
+	want := []IATReference{{RVA: 0x1000, Slot: 0x3010}, {RVA: 0x1007, Slot: 0x3028, Jump: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("x86 = %+v, want %+v", got, want)
+	}
+
+	// x64: RIP-relative, relative to the end of the instruction
+	code = []byte{
+		0xFF, 0x15, 0x0A, 0x20, 0x00, 0x00, // 0x1000: call [rip+0x200A] -> 0x3010
+		0x48, 0xFF, 0x25, 0x1B, 0x20, 0x00, 0x00, // 0x1006: rex.w jmp [rip+0x201B] -> 0x3028
+	}
+	got = scanIATReferences(code, 0x1000, true, 0x140000000, slots)
+	want = []IATReference{{RVA: 0x1000, Slot: 0x3010}, {RVA: 0x1006, Slot: 0x3028, Jump: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("x64 = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,475 @@
+package pe
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Import object types and name types, see IMPORT_OBJECT_HEADER in winnt.h.
+const (
+	importCode = 0
+	importData = 1
+
+	importOrdinal      = 0 // Import by ordinal
+	importName         = 1 // Import by the symbol name
+	importNameNoPrefix = 2 // Import by the symbol name without its leading ?, @ or _
+)
+
+// COFF object constants not defined by debug/pe.
+const (
+	imageFile32BitMachine = 0x0100
+
+	scnAlign2Bytes = 0x00200000
+	scnAlign4Bytes = 0x00300000
+	scnAlign8Bytes = 0x00400000
+
+	symClassExternal = 2
+	symClassStatic   = 3
+	symClassSection  = 104
+
+	relI386Dir32NB   = 7
+	relAMD64Addr32NB = 3
+	relARMAddr32NB   = 2
+	relARM64Addr32NB = 2
+)
+
+// libraryExport is an export as it appears in a .def file or import library.
+type libraryExport struct {
+	Name      string // Export name, or "Ordinal_N" for ordinal-only exports
+	Ordinal   uint16
+	Hint      uint16
+	NoName    bool   // Imported by ordinal
+	Data      bool   // Variable rather than function
+	Alias     bool   // Another name of an ordinal listed before
+	Forwarder string // Forwarder string, for .def files
+}
+
+// libraryExports lists the exports for a .def file or import library.
+// Exports outside executable sections are treated as data; forwarders are
+// assumed to be functions since their target can't be checked.
+func libraryExports(exports *ExportInfo) []libraryExport {
+	var result []libraryExport
+	seen := make(map[uint16]bool)
+	for _, fn := range exports.Functions {
+		result = append(result, libraryExport{
+			Name:      fn.String(),
+			Ordinal:   fn.Ordinal,
+			Hint:      fn.Hint,
+			NoName:    fn.Name == "",
+			Data:      !fn.Executable && !fn.Forwarded(),
+			Alias:     seen[fn.Ordinal],
+			Forwarder: fn.Forwarder,
+		})
+		seen[fn.Ordinal] = true
+	}
+	return result
+}
+
+// WriteDefFile writes a module-definition (.def) file for the exports:
+// names with their ordinals, NONAME for ordinal-only exports, DATA for
+// exports outside executable sections and forwarders.
+func WriteDefFile(w io.Writer, exports *ExportInfo) error {
+	if exports == nil || exports.DLLName == "" {
+		return fmt.Errorf("缺少导出目录或DLL名称")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "LIBRARY %s\n", defName(exports.DLLName))
+	b.WriteString("EXPORTS\n")
+	for _, exp := range libraryExports(exports) {
+		b.WriteString("    " + defName(exp.Name))
+		if exp.Forwarder != "" {
+			b.WriteString(" = " + defName(exp.Forwarder))
+		}
+		// Ordinals must be unique, so aliases are listed by name only
+		if !exp.Alias {
+			fmt.Fprintf(&b, " @%d", exp.Ordinal)
+			if exp.NoName {
+				b.WriteString(" NONAME")
+			}
+		}
+		if exp.Data {
+			b.WriteString(" DATA")
+		}
+		b.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// defName quotes names the .def syntax would otherwise split or misread.
+func defName(name string) string {
+	if strings.HasPrefix(name, "@") || strings.ContainsAny(name, " \t=,;\"") {
+		return strconv.Quote(name)
+	}
+	return name
+}
+
+// importSymbol returns the linker symbol for an export name and the name
+// type that maps the symbol back to the export name. On x86, C names get
+// the leading underscore of the cdecl and stdcall decorations ("Foo" and
+// "Foo@8" become "_Foo" and "_Foo@8"), while names that are already
+// decorated ("_Foo@8", "@Foo@8", "?Foo@@YAXXZ") are the symbol as is.
+func importSymbol(name string, machine uint16) (string, uint16) {
+	if machine != pe.IMAGE_FILE_MACHINE_I386 {
+		return name, importName
+	}
+	if strings.HasPrefix(name, "?") || strings.HasPrefix(name, "@") ||
+		strings.HasPrefix(name, "_") && strings.Contains(name, "@") {
+		return name, importName
+	}
+	return "_" + name, importNameNoPrefix
+}
+
+// WriteImportLibrary writes a COFF import library for the exports, usable
+// by link.exe, lld-link and MinGW ld. Each export is a short import object;
+// the import descriptor, null import descriptor and null thunk objects that
+// link.exe needs to build the import table come first.
+func WriteImportLibrary(w io.Writer, exports *ExportInfo, machine uint16) error {
+	if exports == nil || exports.DLLName == "" {
+		return fmt.Errorf("缺少导出目录或DLL名称")
+	}
+	var is64 bool
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_I386, pe.IMAGE_FILE_MACHINE_ARMNT:
+	case pe.IMAGE_FILE_MACHINE_AMD64, pe.IMAGE_FILE_MACHINE_ARM64:
+		is64 = true
+	default:
+		return fmt.Errorf("不支持为机器类型 0x%04X 生成导入库", machine)
+	}
+
+	dll := exports.DLLName
+	library := strings.TrimSuffix(dll, filepath.Ext(dll))
+	descriptorSymbol := "__IMPORT_DESCRIPTOR_" + library
+	nullDescriptorSymbol := "__NULL_IMPORT_DESCRIPTOR"
+	nullThunkSymbol := "\x7f" + library + "_NULL_THUNK_DATA"
+
+	members := []archiveMember{
+		{
+			data:    importDescriptorObject(dll, machine, descriptorSymbol, nullDescriptorSymbol, nullThunkSymbol),
+			symbols: []string{descriptorSymbol},
+		},
+		{
+			data:    nullImportDescriptorObject(machine, nullDescriptorSymbol),
+			symbols: []string{nullDescriptorSymbol},
+		},
+		{
+			data:    nullThunkObject(machine, is64, nullThunkSymbol),
+			symbols: []string{nullThunkSymbol},
+		},
+	}
+	for _, exp := range libraryExports(exports) {
+		symbol, nameType := importSymbol(exp.Name, machine)
+		member := archiveMember{
+			data:    shortImportObject(dll, machine, symbol, exp, nameType),
+			symbols: []string{"__imp_" + symbol},
+		}
+		// Functions also get a thunk that jumps through the IAT
+		if !exp.Data {
+			member.symbols = append(member.symbols, symbol)
+		}
+		members = append(members, member)
+	}
+
+	return writeArchive(w, dll, members)
+}
+
+// shortImportObject builds an import object in the short import format: an
+// IMPORT_OBJECT_HEADER followed by the symbol and DLL names.
+func shortImportObject(dll string, machine uint16, symbol string, exp libraryExport, nameType uint16) []byte {
+	importType := uint16(importCode)
+	if exp.Data {
+		importType = importData
+	}
+	ordinalOrHint := exp.Hint
+	if exp.NoName {
+		ordinalOrHint = exp.Ordinal
+		nameType = importOrdinal
+	}
+
+	var buf bytes.Buffer
+	header := struct {
+		Sig1, Sig2, Version, Machine uint16
+		TimeDateStamp, SizeOfData    uint32
+		OrdinalOrHint, Type          uint16
+	}{
+		Sig1:          0, // IMAGE_FILE_MACHINE_UNKNOWN
+		Sig2:          0xFFFF,
+		Machine:       machine,
+		SizeOfData:    uint32(len(symbol) + 1 + len(dll) + 1),
+		OrdinalOrHint: ordinalOrHint,
+		Type:          importType | nameType<<2,
+	}
+	_ = binary.Write(&buf, binary.LittleEndian, header)
+	buf.WriteString(symbol + "\x00" + dll + "\x00")
+	return buf.Bytes()
+}
+
+// coffObject assembles a COFF object file in memory.
+type coffObject struct {
+	machine  uint16
+	sections []pe.SectionHeader32
+	data     [][]byte // Raw data of each section
+	relocs   [][]pe.Reloc
+	symbols  []pe.COFFSymbol
+	strings  []string // String table, referenced by symbols in order
+}
+
+// addExternal adds an external symbol named through the string table.
+func (o *coffObject) addExternal(name string, section int16) {
+	offset := uint32(4)
+	for _, s := range o.strings {
+		offset += uint32(len(s) + 1)
+	}
+	o.strings = append(o.strings, name)
+
+	sym := pe.COFFSymbol{SectionNumber: section, StorageClass: symClassExternal}
+	binary.LittleEndian.PutUint32(sym.Name[4:], offset)
+	o.symbols = append(o.symbols, sym)
+}
+
+// bytes lays out the header, section headers, each section's data and
+// relocations, the symbol table and the string table.
+func (o *coffObject) bytes(is64 bool) []byte {
+	const fileHeaderSize, sectionHeaderSize, relocSize = 20, 40, 10
+
+	offset := uint32(fileHeaderSize + sectionHeaderSize*len(o.sections))
+	for i := range o.sections {
+		if len(o.data[i]) > 0 {
+			o.sections[i].PointerToRawData = offset
+			offset += uint32(len(o.data[i]))
+		}
+		if len(o.relocs[i]) > 0 {
+			o.sections[i].PointerToRelocations = offset
+			o.sections[i].NumberOfRelocations = uint16(len(o.relocs[i]))
+			offset += uint32(relocSize * len(o.relocs[i]))
+		}
+	}
+
+	header := pe.FileHeader{
+		Machine:              o.machine,
+		NumberOfSections:     uint16(len(o.sections)),
+		PointerToSymbolTable: offset,
+		NumberOfSymbols:      uint32(len(o.symbols)),
+	}
+	if !is64 {
+		header.Characteristics = imageFile32BitMachine
+	}
+
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, header)
+	_ = binary.Write(&buf, binary.LittleEndian, o.sections)
+	for i := range o.sections {
+		buf.Write(o.data[i])
+		for _, r := range o.relocs[i] {
+			_ = binary.Write(&buf, binary.LittleEndian, r)
+		}
+	}
+	_ = binary.Write(&buf, binary.LittleEndian, o.symbols)
+
+	var table bytes.Buffer
+	for _, s := range o.strings {
+		table.WriteString(s + "\x00")
+	}
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(4+table.Len()))
+	buf.Write(table.Bytes())
+	return buf.Bytes()
+}
+
+// sectionName returns a section or section symbol name field.
+func sectionName(name string) [8]uint8 {
+	var field [8]uint8
+	copy(field[:], name)
+	return field
+}
+
+// importDescriptorObject builds the object defining __IMPORT_DESCRIPTOR_x:
+// the DLL's import descriptor in .idata$2, with relocations to the DLL name
+// in .idata$6 and to the INT and IAT the linker gathers from .idata$4 and
+// .idata$5. It references the null descriptor and thunk so they are linked
+// too.
+func importDescriptorObject(dll string, machine uint16, descriptorSymbol, nullDescriptorSymbol, nullThunkSymbol string) []byte {
+	const data = pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_WRITE
+
+	var relocType uint16
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_I386:
+		relocType = relI386Dir32NB
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		relocType = relAMD64Addr32NB
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		relocType = relARMAddr32NB
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		relocType = relARM64Addr32NB
+	}
+
+	o := &coffObject{
+		machine: machine,
+		sections: []pe.SectionHeader32{
+			{Name: sectionName(".idata$2"), SizeOfRawData: 20, Characteristics: scnAlign4Bytes | data},
+			{Name: sectionName(".idata$6"), SizeOfRawData: uint32(len(dll) + 1), Characteristics: scnAlign2Bytes | data},
+		},
+		data: [][]byte{make([]byte, 20), []byte(dll + "\x00")},
+		relocs: [][]pe.Reloc{
+			{
+				{VirtualAddress: 12, SymbolTableIndex: 2, Type: relocType}, // Name
+				{VirtualAddress: 0, SymbolTableIndex: 3, Type: relocType},  // OriginalFirstThunk
+				{VirtualAddress: 16, SymbolTableIndex: 4, Type: relocType}, // FirstThunk
+			},
+			nil,
+		},
+	}
+	o.addExternal(descriptorSymbol, 1)
+	o.symbols = append(o.symbols,
+		pe.COFFSymbol{Name: sectionName(".idata$2"), SectionNumber: 1, StorageClass: symClassSection},
+		pe.COFFSymbol{Name: sectionName(".idata$6"), SectionNumber: 2, StorageClass: symClassStatic},
+		pe.COFFSymbol{Name: sectionName(".idata$4"), StorageClass: symClassSection},
+		pe.COFFSymbol{Name: sectionName(".idata$5"), StorageClass: symClassSection},
+	)
+	o.addExternal(nullDescriptorSymbol, 0)
+	o.addExternal(nullThunkSymbol, 0)
+	return o.bytes(machine == pe.IMAGE_FILE_MACHINE_AMD64 || machine == pe.IMAGE_FILE_MACHINE_ARM64)
+}
+
+// nullImportDescriptorObject builds the object defining the zero descriptor
+// that terminates the import directory.
+func nullImportDescriptorObject(machine uint16, symbol string) []byte {
+	o := &coffObject{
+		machine: machine,
+		sections: []pe.SectionHeader32{{
+			Name:            sectionName(".idata$3"),
+			SizeOfRawData:   20,
+			Characteristics: scnAlign4Bytes | pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_WRITE,
+		}},
+		data:   [][]byte{make([]byte, 20)},
+		relocs: [][]pe.Reloc{nil},
+	}
+	o.addExternal(symbol, 1)
+	return o.bytes(machine == pe.IMAGE_FILE_MACHINE_AMD64 || machine == pe.IMAGE_FILE_MACHINE_ARM64)
+}
+
+// nullThunkObject builds the object defining the zero entries that
+// terminate the DLL's INT and IAT.
+func nullThunkObject(machine uint16, is64 bool, symbol string) []byte {
+	size, align := uint32(4), uint32(scnAlign4Bytes)
+	if is64 {
+		size, align = 8, scnAlign8Bytes
+	}
+	const data = pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_WRITE
+
+	o := &coffObject{
+		machine: machine,
+		sections: []pe.SectionHeader32{
+			{Name: sectionName(".idata$5"), SizeOfRawData: size, Characteristics: align | data},
+			{Name: sectionName(".idata$4"), SizeOfRawData: size, Characteristics: align | data},
+		},
+		data:   [][]byte{make([]byte, size), make([]byte, size)},
+		relocs: [][]pe.Reloc{nil, nil},
+	}
+	o.addExternal(symbol, 1)
+	return o.bytes(is64)
+}
+
+// archiveMember is an object in an archive and the symbols it defines.
+type archiveMember struct {
+	data    []byte
+	symbols []string
+}
+
+// writeArchive writes members as a Microsoft-style archive, all named name:
+// the first linker member (big-endian, in member order), the second linker
+// member (little-endian, sorted for lookup) and the long names member
+// precede the objects.
+func writeArchive(w io.Writer, name string, members []archiveMember) error {
+	const headerSize = 60
+
+	// Member names longer than 15 characters live in the long names member
+	memberName := name + "/"
+	var longNames []byte
+	if len(memberName) > 16 {
+		memberName = "/0"
+		longNames = []byte(name + "\x00")
+	}
+
+	var symbolCount, symbolBytes int
+	for _, m := range members {
+		symbolCount += len(m.symbols)
+		for _, s := range m.symbols {
+			symbolBytes += len(s) + 1
+		}
+	}
+	firstSize := 4 + 4*symbolCount + symbolBytes
+	secondSize := 4 + 4*len(members) + 4 + 2*symbolCount + symbolBytes
+
+	// Offsets of the member headers
+	offset := 8 + headerSize + alignEven(firstSize) + headerSize + alignEven(secondSize) + headerSize + alignEven(len(longNames))
+	offsets := make([]uint32, len(members))
+	for i, m := range members {
+		offsets[i] = uint32(offset)
+		offset += headerSize + alignEven(len(m.data))
+	}
+
+	type symbolRef struct {
+		name  string
+		index uint16 // 1-based member index
+	}
+	var refs []symbolRef
+	var first bytes.Buffer
+	_ = binary.Write(&first, binary.BigEndian, uint32(symbolCount))
+	for i, m := range members {
+		for _, s := range m.symbols {
+			_ = binary.Write(&first, binary.BigEndian, offsets[i])
+			refs = append(refs, symbolRef{s, uint16(i + 1)})
+		}
+	}
+	for _, ref := range refs {
+		first.WriteString(ref.name + "\x00")
+	}
+
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].name < refs[j].name })
+	var second bytes.Buffer
+	_ = binary.Write(&second, binary.LittleEndian, uint32(len(members)))
+	_ = binary.Write(&second, binary.LittleEndian, offsets)
+	_ = binary.Write(&second, binary.LittleEndian, uint32(symbolCount))
+	for _, ref := range refs {
+		_ = binary.Write(&second, binary.LittleEndian, ref.index)
+	}
+	for _, ref := range refs {
+		second.WriteString(ref.name + "\x00")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	writeArchiveMember(&buf, "/", "0", first.Bytes())
+	writeArchiveMember(&buf, "/", "0", second.Bytes())
+	writeArchiveMember(&buf, "//", "0", longNames)
+	for _, m := range members {
+		writeArchiveMember(&buf, memberName, "644", m.data)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeArchiveMember writes a member header and the data, padded to an even
+// size. Dates are zero so the output is reproducible.
+func writeArchiveMember(buf *bytes.Buffer, name, mode string, data []byte) {
+	fmt.Fprintf(buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", name, 0, 0, 0, mode, len(data))
+	buf.Write(data)
+	if len(data)%2 != 0 {
+		buf.WriteByte('\n')
+	}
+}
+
+// alignEven rounds n up to the 2-byte alignment of archive members.
+func alignEven(n int) int {
+	return n + n%2
+}
@@ -0,0 +1,175 @@
+package pe
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func testLibraryExports() *ExportInfo {
+	return &ExportInfo{
+		DLLName: "legacy.dll",
+		Base:    1,
+		Functions: []ExportEntry{
+			{Ordinal: 1, Name: "Alpha", Hint: 1, Executable: true},
+			{Ordinal: 1, Name: "@Fast@8", Hint: 0, Executable: true},
+			{Ordinal: 2, Name: "gCounter", Hint: 2},
+			{Ordinal: 3, Name: "Moved", Hint: 3, Forwarder: "newlib.Moved"},
+			{Ordinal: 7, Executable: true},
+		},
+	}
+}
+
+func TestWriteDefFile(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteDefFile(&buf, testLibraryExports()); err != nil {
+		t.Fatalf("WriteDefFile() error = %v", err)
+	}
+
+	want := `LIBRARY legacy.dll
+EXPORTS
+    Alpha @1
+    "@Fast@8"
+    gCounter @2 DATA
+    Moved = newlib.Moved @3
+    Ordinal_7 @7 NONAME
+`
+	if buf.String() != want {
+		t.Errorf("WriteDefFile() =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	if err := WriteDefFile(&buf, &ExportInfo{}); err == nil {
+		t.Error("WriteDefFile() without a DLL name should fail")
+	}
+}
+
+func TestImportSymbol(t *testing.T) {
+	tests := []struct {
+		name     string
+		machine  uint16
+		symbol   string
+		nameType uint16
+	}{
+		{"Alpha", pe.IMAGE_FILE_MACHINE_AMD64, "Alpha", importName},
+		{"Alpha", pe.IMAGE_FILE_MACHINE_I386, "_Alpha", importNameNoPrefix},
+		{"Alpha@8", pe.IMAGE_FILE_MACHINE_I386, "_Alpha@8", importNameNoPrefix},
+		{"_Alpha@8", pe.IMAGE_FILE_MACHINE_I386, "_Alpha@8", importName},
+		{"@Fast@8", pe.IMAGE_FILE_MACHINE_I386, "@Fast@8", importName},
+		{"?Func@@YAXXZ", pe.IMAGE_FILE_MACHINE_I386, "?Func@@YAXXZ", importName},
+	}
+	for _, tt := range tests {
+		symbol, nameType := importSymbol(tt.name, tt.machine)
+		if symbol != tt.symbol || nameType != tt.nameType {
+			t.Errorf("importSymbol(%q, 0x%X) = %q, %d; want %q, %d", tt.name, tt.machine, symbol, nameType, tt.symbol, tt.nameType)
+		}
+	}
+}
+
+// archiveMembers splits an archive into its member names and data.
+func archiveMembers(t *testing.T, data []byte) ([]string, [][]byte) {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("!<arch>\n")) {
+		t.Fatal("missing archive signature")
+	}
+	var names []string
+	var members [][]byte
+	for p := 8; p < len(data); {
+		header := data[p : p+60]
+		size, err := strconv.Atoi(strings.TrimSpace(string(header[48:58])))
+		if err != nil || string(header[58:60]) != "`\n" {
+			t.Fatalf("bad member header at 0x%X: %q", p, header)
+		}
+		names = append(names, strings.TrimSpace(string(header[:16])))
+		members = append(members, data[p+60:p+60+size])
+		p += 60 + size + size%2
+	}
+	return names, members
+}
+
+func TestWriteImportLibrary(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteImportLibrary(&buf, testLibraryExports(), pe.IMAGE_FILE_MACHINE_I386); err != nil {
+		t.Fatalf("WriteImportLibrary() error = %v", err)
+	}
+	names, members := archiveMembers(t, buf.Bytes())
+
+	// Two linker members, long names, three import descriptor objects and
+	// one short import per export
+	if len(members) != 3+3+5 || names[0] != "/" || names[1] != "/" || names[2] != "//" || names[3] != "legacy.dll/" {
+		t.Fatalf("archive members = %q", names)
+	}
+
+	// Resolve every symbol through the sorted second linker member
+	le := binary.LittleEndian
+	second := members[1]
+	memberCount := le.Uint32(second)
+	offsets := second[4 : 4+4*memberCount]
+	symbolCount := le.Uint32(second[4+4*memberCount:])
+	indices := second[8+4*memberCount:]
+	symbols := strings.Split(string(indices[2*symbolCount:]), "\x00")[:symbolCount]
+
+	headerOffsets := make(map[uint32]int)
+	for p, i := 8, 0; i < len(members); i++ {
+		headerOffsets[uint32(p)] = i
+		p += 60 + len(members[i]) + len(members[i])%2
+	}
+
+	type object struct {
+		member       int
+		typ, ordinal uint16
+	}
+	resolved := make(map[string]object)
+	for i, symbol := range symbols {
+		if i > 0 && symbols[i-1] >= symbol {
+			t.Errorf("symbols not sorted: %q before %q", symbols[i-1], symbol)
+		}
+		index := le.Uint16(indices[2*i:])
+		member := headerOffsets[le.Uint32(offsets[4*(index-1):])]
+		data := members[member]
+		if !bytes.Contains(data, []byte(strings.TrimPrefix(symbol, "__imp_")+"\x00")) {
+			t.Errorf("symbol %q resolves to member %d, which doesn't define it", symbol, member)
+		}
+		o := object{member: member}
+		if le.Uint16(data[2:]) == 0xFFFF {
+			o.typ = le.Uint16(data[18:])
+			o.ordinal = le.Uint16(data[16:])
+		}
+		resolved[symbol] = o
+	}
+
+	tests := []struct {
+		symbol       string
+		typ, ordinal uint16
+	}{
+		{"_Alpha", importCode | importNameNoPrefix<<2, 1},
+		{"__imp__Alpha", importCode | importNameNoPrefix<<2, 1},
+		{"@Fast@8", importCode | importName<<2, 0},
+		{"__imp__gCounter", importData | importNameNoPrefix<<2, 2},
+		{"_Ordinal_7", importCode | importOrdinal<<2, 7},
+	}
+	for _, tt := range tests {
+		o, ok := resolved[tt.symbol]
+		if !ok {
+			t.Errorf("symbol %q missing", tt.symbol)
+			continue
+		}
+		if o.typ != tt.typ || o.ordinal != tt.ordinal {
+			t.Errorf("%s: type 0x%X ordinal/hint %d, want 0x%X %d", tt.symbol, o.typ, o.ordinal, tt.typ, tt.ordinal)
+		}
+	}
+	if _, ok := resolved["_gCounter"]; ok {
+		t.Error("data export should not define a thunk symbol")
+	}
+	for _, symbol := range []string{"__IMPORT_DESCRIPTOR_legacy", "__NULL_IMPORT_DESCRIPTOR", "\x7flegacy_NULL_THUNK_DATA"} {
+		if _, ok := resolved[symbol]; !ok {
+			t.Errorf("symbol %q missing", symbol)
+		}
+	}
+
+	if err := WriteImportLibrary(&buf, testLibraryExports(), 0x1234); err == nil {
+		t.Error("WriteImportLibrary() for an unknown machine should fail")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"debug/pe"
 	"encoding/binary"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 // ImportModifier handles Import Table modifications.
@@ -29,32 +31,57 @@ type ImportDescriptor struct {
 }
 
 // AddImport adds a new DLL import with specified functions.
-// Universal compatible solution: Rebuilds descriptor table + INT in new section,
+// Universal compatible solution: Rebuilds descriptor table + INT in free space,
 // but preserves ALL original IAT RVAs (critical for Go and other languages).
+// Functions from an already imported DLL are merged: those not yet imported
+// are added, the others skipped. Functions are names or "#N" ordinals.
 func (im *ImportModifier) AddImport(dllName string, functions []string) error {
-	// Read existing import data.
-	importDir, err := im.getImportDirectory()
+	parsed, err := ParseImportFunctions(functions)
 	if err != nil {
 		return err
 	}
+	return im.AddImportFunctions(dllName, parsed)
+}
 
-	descriptors, err := im.readImportDescriptors(importDir)
+// AddImportFunctions is AddImport for parsed functions. Named functions keep
+// their Hint, which the loader tries first in the DLL's export name table.
+func (im *ImportModifier) AddImportFunctions(dllName string, functions []ImportFunction) error {
+	// Read all existing import data (we need INT data for rebuilding).
+	existingImports, err := im.readExistingImports()
 	if err != nil {
 		return err
 	}
 
-	// Check if DLL already exists.
-	for _, desc := range descriptors {
-		existingName, _ := im.readString(desc.Name)
-		if existingName == dllName {
-			return fmt.Errorf("DLL %s 已存在于导入表中", dllName)
-		}
+	// For an already imported DLL the new functions get a second descriptor
+	// with its own INT/IAT, so the original IAT slots stay at their RVAs.
+	dllName, functions = pendingImports(existingImports, dllName, functions)
+	if len(functions) == 0 {
+		return fmt.Errorf("所有函数均已从 %s 导入", dllName)
 	}
 
-	// Read all existing import data (we need INT data for rebuilding).
-	existingImports, err := im.readAllImportData(descriptors)
-	if err != nil {
-		return fmt.Errorf("读取现有导入数据失败: %w", err)
+	// Unbind before rebuilding, since the new table invalidates the bindings.
+	// Only the IATs change, the INTs read above stay valid.
+	if _, err := im.stripBoundImports(); err != nil {
+		return fmt.Errorf("解除导入绑定失败: %w", err)
+	}
+
+	return im.rebuildImportTable(existingImports, dllName, functions)
+}
+
+// rebuildImportTable writes the descriptor table, INTs and names for the
+// existing imports plus an optional new DLL to space found by allocate and
+// points the import directory at it. Existing descriptors keep their IAT
+// RVAs; only the new DLL gets a new IAT. Callers must strip bound imports
+// first.
+func (im *ImportModifier) rebuildImportTable(existingImports []ExistingImportData, dllName string, functions []ImportFunction) error {
+	// A new IAT needs directory 12, which images without imports may not
+	// declare; grow the directories before anything is written
+	dirCount := 2
+	if len(functions) > 0 {
+		dirCount = 13
+	}
+	if err := im.patcher.ensureDataDirectories(dirCount); err != nil {
+		return err
 	}
 
 	// Get original IAT Directory.
@@ -69,34 +96,42 @@ func (im *ImportModifier) AddImport(dllName string, functions []string) error {
 		}
 	}
 
-	// Calculate size for new import section (descriptors + INT + strings).
+	// Calculate size for new import data (descriptors + INT + strings).
 	// Note: We don't include IAT here, we'll preserve original IATs.
 	dataSize := im.calculateCompatibleImportDataSize(existingImports, dllName, functions)
 
-	// Create new section.
-	newSectionName := ".idata2"
-	err = im.patcher.InjectSection(newSectionName, make([]byte, dataSize),
-		pe.IMAGE_SCN_CNT_INITIALIZED_DATA|pe.IMAGE_SCN_MEM_READ|pe.IMAGE_SCN_MEM_WRITE)
+	// The loader writes a new DLL's IAT, so it needs a writable section
+	characteristics := uint32(pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ)
+	if len(functions) > 0 {
+		characteristics |= pe.IMAGE_SCN_MEM_WRITE
+	}
+	importDir, _ := im.getImportDirectory()
+	if overlapsIAT(importDir, existingImports, im.getPtrSize(im.is64Bit())) {
+		// Some linkers' import directory covers the IATs, which stay in place
+		importDir = pe.DataDirectory{}
+	}
+	space, err := im.patcher.allocate(allocRequest{
+		section:         ".idata2",
+		size:            dataSize,
+		characteristics: characteristics,
+		old:             importDir,
+	})
 	if err != nil {
-		return fmt.Errorf("创建导入数据节区失败: %w", err)
-	}
-
-	if err := im.patcher.Reload(); err != nil {
-		return fmt.Errorf("重新加载PE文件失败: %w", err)
+		return fmt.Errorf("分配导入数据空间失败: %w", err)
 	}
 
-	sections := im.patcher.File().Sections
-	newSection := sections[len(sections)-1]
-
-	// Build import data in new section, preserving original IAT RVAs.
-	newIATInfo, err := im.buildCompatibleImportData(newSection, existingImports, dllName, functions)
+	// Build import data, preserving original IAT RVAs.
+	newIATInfo, err := im.buildCompatibleImportData(space, existingImports, dllName, functions)
 	if err != nil {
 		return err
 	}
 
 	// Calculate new IAT Directory info.
 	var iatInfo IATInfo
-	if origIATDir.VirtualAddress != 0 {
+	if len(functions) == 0 {
+		// Nothing added, the remaining IATs are all in the original range.
+		iatInfo = IATInfo{RVA: origIATDir.VirtualAddress, Size: origIATDir.Size}
+	} else if origIATDir.VirtualAddress != 0 {
 		// Preserve original IAT RVA, extend size to include new IAT.
 		iatInfo.RVA = origIATDir.VirtualAddress
 		iatInfo.Size = origIATDir.Size + newIATInfo.Size
@@ -106,14 +141,79 @@ func (im *ImportModifier) AddImport(dllName string, functions []string) error {
 	}
 
 	// Update Import Directory to point to new section.
-	descriptorTableSize := uint32((len(existingImports) + 2) * 20) // existing + new + null
-	if err := im.updateImportDirectoryInPlace(newSection.VirtualAddress, descriptorTableSize, iatInfo); err != nil {
+	descriptorTableSize := uint32((len(existingImports) + min(len(functions), 1) + 1) * 20) // existing + new + null
+	if err := im.updateImportDirectoryInPlace(space.RVA, descriptorTableSize, iatInfo); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// overlapsIAT reports whether dir overlaps the IAT of an existing import.
+func overlapsIAT(dir pe.DataDirectory, existing []ExistingImportData, ptrSize uint32) bool {
+	for _, imp := range existing {
+		start := imp.Descriptor.FirstThunk
+		end := start + uint32(len(imp.Functions)+1)*ptrSize
+		if start < dir.VirtualAddress+dir.Size && dir.VirtualAddress < end {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingImports drops the functions already imported from dllName, as well
+// as duplicates, and returns the DLL name as spelled in the existing table.
+// DLL names are compared case-insensitively like the loader does.
+func pendingImports(existing []ExistingImportData, dllName string, functions []ImportFunction) (string, []ImportFunction) {
+	imported := make(map[string]bool)
+	for _, imp := range existing {
+		if !strings.EqualFold(imp.DLLName, dllName) {
+			continue
+		}
+		dllName = imp.DLLName
+		for _, fn := range imp.Functions {
+			imported[fn.String()] = true
+		}
+	}
+
+	var pending []ImportFunction
+	for _, fn := range functions {
+		if !imported[fn.String()] {
+			imported[fn.String()] = true
+			pending = append(pending, fn)
+		}
+	}
+	return dllName, pending
+}
+
+// ParseImportFunction parses a function name, or an ordinal written as "#N".
+func ParseImportFunction(spec string) (ImportFunction, error) {
+	if spec == "" {
+		return ImportFunction{}, fmt.Errorf("函数名不能为空")
+	}
+	if digits, ok := strings.CutPrefix(spec, "#"); ok {
+		ordinal, err := strconv.ParseUint(digits, 10, 16)
+		if err != nil {
+			return ImportFunction{}, fmt.Errorf("无效的序号: %s (应为 #1 到 #65535)", spec)
+		}
+		return ImportFunction{Ordinal: uint16(ordinal), IsByOrdinal: true}, nil
+	}
+	return ImportFunction{Name: spec}, nil
+}
+
+// ParseImportFunctions parses each entry with ParseImportFunction.
+func ParseImportFunctions(specs []string) ([]ImportFunction, error) {
+	functions := make([]ImportFunction, len(specs))
+	for i, spec := range specs {
+		fn, err := ParseImportFunction(spec)
+		if err != nil {
+			return nil, err
+		}
+		functions[i] = fn
+	}
+	return functions, nil
+}
+
 // getImportDirectory returns the Import Table data directory.
 func (im *ImportModifier) getImportDirectory() (pe.DataDirectory, error) {
 	var importDir pe.DataDirectory
@@ -230,6 +330,14 @@ type ImportFunction struct {
 	Hint        uint16
 }
 
+// String returns the function name, or "Ordinal_N" for ordinal imports.
+func (fn ImportFunction) String() string {
+	if fn.IsByOrdinal {
+		return fmt.Sprintf("Ordinal_%d", fn.Ordinal)
+	}
+	return fn.Name
+}
+
 // readAllImportData reads all existing import data for preservation.
 func (im *ImportModifier) readAllImportData(descriptors []ImportDescriptor) ([]ExistingImportData, error) {
 	var allData []ExistingImportData
@@ -251,8 +359,13 @@ func (im *ImportModifier) readAllImportData(descriptors []ImportDescriptor) ([]E
 		}
 		data.DLLName = dllName
 
-		// Read INT and IAT.
-		intEntries, functions, err := im.readImportThunks(desc.OriginalFirstThunk, is64bit)
+		// Read INT and IAT. Old linkers omit the INT; after unbinding the IAT
+		// holds the same entries.
+		intRVA := desc.OriginalFirstThunk
+		if intRVA == 0 {
+			intRVA = desc.FirstThunk
+		}
+		intEntries, functions, err := im.readImportThunks(intRVA, is64bit)
 		if err != nil {
 			continue
 		}
@@ -360,7 +473,7 @@ func (im *ImportModifier) getOrdinalFlag(is64bit bool) uint64 {
 
 // calculateCompatibleImportDataSize calculates size for compatible mode.
 // Includes: descriptors + INT (for all imports) + IAT (for new import only) + strings.
-func (im *ImportModifier) calculateCompatibleImportDataSize(existing []ExistingImportData, newDLL string, newFunctions []string) uint32 {
+func (im *ImportModifier) calculateCompatibleImportDataSize(existing []ExistingImportData, newDLL string, newFunctions []ImportFunction) uint32 {
 	is64bit := im.is64Bit()
 	ptrSize := uint32(4)
 	if is64bit {
@@ -369,23 +482,28 @@ func (im *ImportModifier) calculateCompatibleImportDataSize(existing []ExistingI
 
 	size := uint32(0)
 
-	// Descriptors: existing + new + null.
-	size += uint32((len(existing) + 2) * 20)
+	// Descriptors: existing + new (if any) + null.
+	hasNew := len(newFunctions) > 0
+	size += uint32((len(existing) + min(len(newFunctions), 1) + 1) * 20)
 
 	// INT for all imports (existing + new).
 	for _, imp := range existing {
 		size += uint32(len(imp.Functions)+1) * ptrSize
 	}
-	size += (uint32(len(newFunctions)) + 1) * ptrSize
+	if hasNew {
+		size += (uint32(len(newFunctions)) + 1) * ptrSize
 
-	// IAT only for new import (existing IATs stay at original locations).
-	size += (uint32(len(newFunctions)) + 1) * ptrSize
+		// IAT only for new import (existing IATs stay at original locations).
+		size += (uint32(len(newFunctions)) + 1) * ptrSize
+	}
 
 	// DLL names.
 	for _, imp := range existing {
 		size += uint32(len(imp.DLLName)) + 1
 	}
-	size += uint32(len(newDLL)) + 1
+	if hasNew {
+		size += uint32(len(newDLL)) + 1
+	}
 
 	// Function names.
 	for _, imp := range existing {
@@ -396,7 +514,9 @@ func (im *ImportModifier) calculateCompatibleImportDataSize(existing []ExistingI
 		}
 	}
 	for _, fn := range newFunctions {
-		size += 2 + uint32(len(fn)) + 1
+		if !fn.IsByOrdinal {
+			size += 2 + uint32(len(fn.Name)) + 1
+		}
 	}
 
 	size = alignUp(size, 16)
@@ -405,6 +525,7 @@ func (im *ImportModifier) calculateCompatibleImportDataSize(existing []ExistingI
 
 // importDataOffsets holds calculated offsets for import data layout.
 type importDataOffsets struct {
+	hasNew             bool // A new DLL descriptor follows the existing ones
 	intOffsets         []uint32
 	newINTOffset       uint32
 	newIATOffset       uint32
@@ -415,9 +536,9 @@ type importDataOffsets struct {
 }
 
 // calculateImportOffsets calculates all offsets for import data layout.
-func (im *ImportModifier) calculateImportOffsets(existing []ExistingImportData, newDLL string, newFunctions []string, ptrSize uint32) *importDataOffsets {
-	offsets := &importDataOffsets{}
-	currentOffset := uint32((len(existing) + 2) * 20) // after descriptor table
+func (im *ImportModifier) calculateImportOffsets(existing []ExistingImportData, newDLL string, newFunctions []ImportFunction, ptrSize uint32) *importDataOffsets {
+	offsets := &importDataOffsets{hasNew: len(newFunctions) > 0}
+	currentOffset := uint32((len(existing) + min(len(newFunctions), 1) + 1) * 20) // after descriptor table
 
 	// INT offsets.
 	offsets.intOffsets = make([]uint32, len(existing))
@@ -425,12 +546,14 @@ func (im *ImportModifier) calculateImportOffsets(existing []ExistingImportData,
 		offsets.intOffsets[i] = currentOffset
 		currentOffset += uint32(len(imp.Functions)+1) * ptrSize
 	}
-	offsets.newINTOffset = currentOffset
-	currentOffset += uint32(len(newFunctions)+1) * ptrSize
+	if offsets.hasNew {
+		offsets.newINTOffset = currentOffset
+		currentOffset += uint32(len(newFunctions)+1) * ptrSize
 
-	// IAT offset (only for new import).
-	offsets.newIATOffset = currentOffset
-	currentOffset += uint32(len(newFunctions)+1) * ptrSize
+		// IAT offset (only for new import).
+		offsets.newIATOffset = currentOffset
+		currentOffset += uint32(len(newFunctions)+1) * ptrSize
+	}
 
 	// DLL name offsets.
 	offsets.dllNameOffsets = make([]uint32, len(existing))
@@ -438,8 +561,10 @@ func (im *ImportModifier) calculateImportOffsets(existing []ExistingImportData,
 		offsets.dllNameOffsets[i] = currentOffset
 		currentOffset += uint32(len(imp.DLLName)) + 1
 	}
-	offsets.newDLLNameOffset = currentOffset
-	currentOffset += uint32(len(newDLL)) + 1
+	if offsets.hasNew {
+		offsets.newDLLNameOffset = currentOffset
+		currentOffset += uint32(len(newDLL)) + 1
+	}
 
 	// Function name offsets.
 	offsets.funcNameOffsets = make([][]uint32, len(existing))
@@ -454,8 +579,10 @@ func (im *ImportModifier) calculateImportOffsets(existing []ExistingImportData,
 	}
 	offsets.newFuncNameOffsets = make([]uint32, len(newFunctions))
 	for i, fn := range newFunctions {
-		offsets.newFuncNameOffsets[i] = currentOffset
-		currentOffset += 2 + uint32(len(fn)) + 1
+		if !fn.IsByOrdinal {
+			offsets.newFuncNameOffsets[i] = currentOffset
+			currentOffset += 2 + uint32(len(fn.Name)) + 1
+		}
 	}
 
 	return offsets
@@ -476,6 +603,9 @@ func (im *ImportModifier) writeImportDescriptors(data []byte, baseRVA uint32, ex
 	}
 
 	// Write new descriptor.
+	if !offsets.hasNew {
+		return
+	}
 	newDesc := ImportDescriptor{
 		OriginalFirstThunk: baseRVA + offsets.newINTOffset,
 		TimeDateStamp:      0,
@@ -487,7 +617,7 @@ func (im *ImportModifier) writeImportDescriptors(data []byte, baseRVA uint32, ex
 }
 
 // writeImportThunks writes INT entries for existing and new imports.
-func (im *ImportModifier) writeImportThunks(data []byte, baseRVA uint32, existing []ExistingImportData, newFunctions []string, offsets *importDataOffsets, is64bit bool, ptrSize uint32) {
+func (im *ImportModifier) writeImportThunks(data []byte, baseRVA uint32, existing []ExistingImportData, newFunctions []ImportFunction, offsets *importDataOffsets, is64bit bool, ptrSize uint32) {
 	// Write INT data for existing imports.
 	for i, imp := range existing {
 		for j, fn := range imp.Functions {
@@ -502,22 +632,27 @@ func (im *ImportModifier) writeImportThunks(data []byte, baseRVA uint32, existin
 	}
 
 	// Write INT and IAT for new import.
-	for i := range newFunctions {
-		nameRVA := baseRVA + offsets.newFuncNameOffsets[i]
-		im.writeThunkEntry(data, offsets.newINTOffset+uint32(i)*ptrSize, uint64(nameRVA), is64bit)
-		im.writeThunkEntry(data, offsets.newIATOffset+uint32(i)*ptrSize, uint64(nameRVA), is64bit)
+	for i, fn := range newFunctions {
+		thunkValue := uint64(baseRVA + offsets.newFuncNameOffsets[i])
+		if fn.IsByOrdinal {
+			thunkValue = im.getOrdinalFlag(is64bit) | uint64(fn.Ordinal)
+		}
+		im.writeThunkEntry(data, offsets.newINTOffset+uint32(i)*ptrSize, thunkValue, is64bit)
+		im.writeThunkEntry(data, offsets.newIATOffset+uint32(i)*ptrSize, thunkValue, is64bit)
 	}
 }
 
 // writeImportNames writes DLL and function names to data buffer.
-func (im *ImportModifier) writeImportNames(data []byte, existing []ExistingImportData, newDLL string, newFunctions []string, offsets *importDataOffsets) {
+func (im *ImportModifier) writeImportNames(data []byte, existing []ExistingImportData, newDLL string, newFunctions []ImportFunction, offsets *importDataOffsets) {
 	// Write DLL names.
 	for i, imp := range existing {
 		copy(data[offsets.dllNameOffsets[i]:], imp.DLLName)
 		data[offsets.dllNameOffsets[i]+uint32(len(imp.DLLName))] = 0
 	}
-	copy(data[offsets.newDLLNameOffset:], newDLL)
-	data[offsets.newDLLNameOffset+uint32(len(newDLL))] = 0
+	if offsets.hasNew {
+		copy(data[offsets.newDLLNameOffset:], newDLL)
+		data[offsets.newDLLNameOffset+uint32(len(newDLL))] = 0
+	}
 
 	// Write function names.
 	for i, imp := range existing {
@@ -531,29 +666,32 @@ func (im *ImportModifier) writeImportNames(data []byte, existing []ExistingImpor
 		}
 	}
 	for i, fn := range newFunctions {
+		if fn.IsByOrdinal {
+			continue
+		}
 		offset := offsets.newFuncNameOffsets[i]
-		binary.LittleEndian.PutUint16(data[offset:], 0)
-		copy(data[offset+2:], fn)
-		data[offset+2+uint32(len(fn))] = 0
+		binary.LittleEndian.PutUint16(data[offset:], fn.Hint)
+		copy(data[offset+2:], fn.Name)
+		data[offset+2+uint32(len(fn.Name))] = 0
 	}
 }
 
 // buildCompatibleImportData builds import data preserving original IAT RVAs.
 // Returns IATInfo for the new import only.
-func (im *ImportModifier) buildCompatibleImportData(section *pe.Section, existing []ExistingImportData, newDLL string, newFunctions []string) (IATInfo, error) {
+func (im *ImportModifier) buildCompatibleImportData(space allocation, existing []ExistingImportData, newDLL string, newFunctions []ImportFunction) (IATInfo, error) {
 	is64bit := im.is64Bit()
 	ptrSize := im.getPtrSize(is64bit)
 
 	dataSize := im.calculateCompatibleImportDataSize(existing, newDLL, newFunctions)
 	data := make([]byte, dataSize)
-	baseRVA := section.VirtualAddress
+	baseRVA := space.RVA
 
 	offsets := im.calculateImportOffsets(existing, newDLL, newFunctions, ptrSize)
 	im.writeImportDescriptors(data, baseRVA, existing, offsets)
 	im.writeImportThunks(data, baseRVA, existing, newFunctions, offsets, is64bit, ptrSize)
 	im.writeImportNames(data, existing, newDLL, newFunctions, offsets)
 
-	if _, err := im.patcher.file.WriteAt(data, int64(section.Offset)); err != nil {
+	if _, err := im.patcher.file.WriteAt(data, int64(space.Offset)); err != nil {
 		return IATInfo{}, fmt.Errorf("写入导入数据失败: %w", err)
 	}
 
@@ -563,54 +701,20 @@ func (im *ImportModifier) buildCompatibleImportData(section *pe.Section, existin
 	}, nil
 }
 
-// updateImportDirectoryInPlace updates data directories keeping Import Directory RVA unchanged.
+// updateImportDirectoryInPlace points the import directory (1) and the IAT
+// directory (12) at the rebuilt table. rebuildImportTable grows the data
+// directories first, so directory 12 is only missing when there is no IAT to
+// record.
 func (im *ImportModifier) updateImportDirectoryInPlace(importRVA, importSize uint32, iatInfo IATInfo) error {
-	// Calculate offset to Data Directory.
-	dosHeader := make([]byte, 64)
-	_, err := im.patcher.file.ReadAt(dosHeader, 0)
-	if err != nil {
-		return err
-	}
-
-	peHeaderOffset := int64(binary.LittleEndian.Uint32(dosHeader[60:64]))
-	optHeaderStart := peHeaderOffset + 4 + 20
-	magicBuf := make([]byte, 2)
-	_, err = im.patcher.file.ReadAt(magicBuf, optHeaderStart)
-	if err != nil {
-		return err
-	}
-	magic := binary.LittleEndian.Uint16(magicBuf)
-
-	var dataDirOffset int64
-	if magic == 0x10b { // PE32
-		dataDirOffset = optHeaderStart + 96
-	} else if magic == 0x20b { // PE32+
-		dataDirOffset = optHeaderStart + 112
-	} else {
-		return fmt.Errorf("unknown PE magic: 0x%X", magic)
-	}
-
-	// Update Import Directory (index 1) - keep RVA, update Size.
-	importDirOffset := dataDirOffset + (1 * 8)
-	dirData := make([]byte, 8)
-	binary.LittleEndian.PutUint32(dirData[0:4], importRVA)
-	binary.LittleEndian.PutUint32(dirData[4:8], importSize)
-	_, err = im.patcher.file.WriteAt(dirData, importDirOffset)
-	if err != nil {
+	if err := im.patcher.setDataDirectory(1, importRVA, importSize); err != nil {
 		return fmt.Errorf("更新导入目录失败: %w", err)
 	}
-
-	// Update IAT Directory (index 12) - keep RVA, update Size.
-	iatDirOffset := dataDirOffset + (12 * 8)
-	binary.LittleEndian.PutUint32(dirData[0:4], iatInfo.RVA)
-	binary.LittleEndian.PutUint32(dirData[4:8], iatInfo.Size)
-	_, err = im.patcher.file.WriteAt(dirData, iatDirOffset)
-	if err != nil {
+	if iatInfo == (IATInfo{}) && dataDirectoryCount(im.patcher.peFile) <= 12 {
+		return nil
+	}
+	if err := im.patcher.setDataDirectory(12, iatInfo.RVA, iatInfo.Size); err != nil {
 		return fmt.Errorf("更新IAT目录失败: %w", err)
 	}
-
-	// Don't clear other directories - keep them as-is.
-
 	return nil
 }
 
@@ -656,6 +760,63 @@ func (p *Patcher) AddImport(dllName string, functions []string) error {
 	return modifier.AddImport(dllName, functions)
 }
 
+// ResolveImportHints sets the Hint of each named function to its index in the
+// export name table of dllName, which is located like dependencies are,
+// starting in baseDir. It returns the path of the DLL used, or "" if it was
+// not found, and the names it does not export; their hints stay unchanged.
+func ResolveImportHints(dllName, baseDir string, functions []ImportFunction) (string, []string, error) {
+	dllPath := findDLL(dllName, baseDir)
+	if dllPath == "" {
+		return "", nil, nil
+	}
+
+	reader, err := Open(dllPath)
+	if err != nil {
+		return dllPath, nil, err
+	}
+	defer func() { _ = reader.Close() }()
+
+	exports, err := parseExports(reader.File(), reader.RawFile())
+	if err != nil {
+		return dllPath, nil, fmt.Errorf("读取 %s 的导出表失败: %w", dllPath, err)
+	}
+	var names []string
+	if exports != nil {
+		names = exports.Names()
+	}
+	return dllPath, applyExportHints(names, functions), nil
+}
+
+// applyExportHints sets hints from an export name table and returns the
+// named functions missing from it.
+func applyExportHints(exportNames []string, functions []ImportFunction) []string {
+	hints := make(map[string]int, len(exportNames))
+	for i, name := range exportNames {
+		if _, dup := hints[name]; !dup {
+			hints[name] = i
+		}
+	}
+
+	var missing []string
+	for i := range functions {
+		fn := &functions[i]
+		if fn.IsByOrdinal {
+			continue
+		}
+		if hint, ok := hints[fn.Name]; ok && hint <= 0xFFFF {
+			fn.Hint = uint16(hint)
+		} else {
+			missing = append(missing, fn.Name)
+		}
+	}
+	return missing
+}
+
+// AddImportFunctions is a convenience method on Patcher.
+func (p *Patcher) AddImportFunctions(dllName string, functions []ImportFunction) error {
+	return NewImportModifier(p).AddImportFunctions(dllName, functions)
+}
+
 // ListImports returns detailed import information.
 func (p *Patcher) ListImports() ([]ImportInfo, error) {
 	modifier := NewImportModifier(p)
@@ -750,11 +911,7 @@ func (im *ImportModifier) readImportFunctions(desc ImportDescriptor) ([]string,
 func (im *ImportModifier) formatFunctionList(funcs []ImportFunction) []string {
 	result := make([]string, len(funcs))
 	for i, fn := range funcs {
-		if fn.IsByOrdinal {
-			result[i] = fmt.Sprintf("Ordinal_%d", fn.Ordinal)
-		} else {
-			result[i] = fn.Name
-		}
+		result[i] = fn.String()
 	}
 	return result
 }
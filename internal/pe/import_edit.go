@@ -0,0 +1,339 @@
+package pe
+
+import (
+	"debug/pe"
+	"fmt"
+	"strings"
+)
+
+// readExistingImports reads every import descriptor with its INT for
+// rebuilding the table. An image without an import directory has none.
+func (im *ImportModifier) readExistingImports() ([]ExistingImportData, error) {
+	if rva, _ := dataDirectory(im.patcher.peFile, 1); rva == 0 {
+		return nil, nil
+	}
+
+	importDir, err := im.getImportDirectory()
+	if err != nil {
+		return nil, err
+	}
+
+	descriptors, err := im.readImportDescriptors(importDir)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := im.readAllImportData(descriptors)
+	if err != nil {
+		return nil, fmt.Errorf("读取现有导入数据失败: %w", err)
+	}
+	return existing, nil
+}
+
+// RemoveImport removes functions imported from dllName, or the whole DLL if
+// functions is empty. The table is rebuilt without them and the removed IAT
+// slots are zeroed. All other slots stay at their RVAs: a descriptor losing
+// functions in the middle is split, with each removed slot terminating the
+// IAT run before it. It returns the instructions that still call or jump
+// through a removed slot.
+func (im *ImportModifier) RemoveImport(dllName string, functions []ImportFunction) ([]IATReference, error) {
+	existing, err := im.readExistingImports()
+	if err != nil {
+		return nil, err
+	}
+
+	ptrSize := im.getPtrSize(im.is64Bit())
+	kept, slots, err := removeImportFunctions(existing, dllName, functions, ptrSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unbinding only rewrites the IATs, the INTs read above stay valid
+	if _, err := im.stripBoundImports(); err != nil {
+		return nil, fmt.Errorf("解除导入绑定失败: %w", err)
+	}
+
+	// Scan before rebuilding, while the section list is the original one
+	refs, err := FindIATReferences(im.patcher.peFile, im.patcher.file, slots)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := im.rebuildImportTable(kept, "", nil); err != nil {
+		return nil, err
+	}
+
+	// Unused slots read as null, so stale calls fault instead of jumping to
+	// a hint/name entry
+	for _, slot := range slots {
+		offset, err := im.rvaToOffset(slot)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := im.patcher.file.WriteAt(make([]byte, ptrSize), int64(offset)); err != nil {
+			return nil, fmt.Errorf("清除IAT槽位失败: %w", err)
+		}
+	}
+	return refs, nil
+}
+
+// removeImportFunctions drops the functions from every descriptor of
+// dllName, or the descriptors entirely if functions is empty, and returns
+// the remaining descriptors and the IAT slots that were removed.
+func removeImportFunctions(existing []ExistingImportData, dllName string, functions []ImportFunction, ptrSize uint32) ([]ExistingImportData, []uint32, error) {
+	remove := make(map[string]bool, len(functions))
+	for _, fn := range functions {
+		remove[fn.String()] = true
+	}
+
+	var kept []ExistingImportData
+	var slots []uint32
+	found := false
+	matched := make(map[string]bool)
+	for _, imp := range existing {
+		if !strings.EqualFold(imp.DLLName, dllName) {
+			kept = append(kept, imp)
+			continue
+		}
+		found = true
+
+		removed := make(map[int]bool)
+		for i, fn := range imp.Functions {
+			if len(functions) == 0 || remove[fn.String()] {
+				removed[i] = true
+				matched[fn.String()] = true
+				slots = append(slots, imp.Descriptor.FirstThunk+uint32(i)*ptrSize)
+			}
+		}
+		kept = append(kept, splitImport(imp, removed, ptrSize)...)
+	}
+
+	if !found {
+		return nil, nil, fmt.Errorf("DLL %s 不在导入表中", dllName)
+	}
+	for _, fn := range functions {
+		if !matched[fn.String()] {
+			return nil, nil, fmt.Errorf("%s 未从 %s 导入", fn, dllName)
+		}
+	}
+	return kept, slots, nil
+}
+
+// splitImport removes the functions at the given indexes from a descriptor.
+// Each remaining run of functions becomes its own descriptor whose IAT starts
+// at the run's original slot.
+func splitImport(imp ExistingImportData, removed map[int]bool, ptrSize uint32) []ExistingImportData {
+	if len(removed) == 0 {
+		return []ExistingImportData{imp}
+	}
+
+	var parts []ExistingImportData
+	for start := 0; start < len(imp.Functions); {
+		if removed[start] {
+			start++
+			continue
+		}
+		end := start
+		for end < len(imp.Functions) && !removed[end] {
+			end++
+		}
+
+		part := ExistingImportData{
+			Descriptor: imp.Descriptor,
+			DLLName:    imp.DLLName,
+			INT:        imp.INT[start:end],
+			Functions:  imp.Functions[start:end],
+		}
+		part.Descriptor.FirstThunk += uint32(start) * ptrSize
+		if start < len(imp.IAT) {
+			part.IAT = imp.IAT[start:min(end, len(imp.IAT))]
+		}
+		parts = append(parts, part)
+		start = end
+	}
+	return parts
+}
+
+// RenameImport changes the name of an imported DLL in every descriptor that
+// imports it, e.g. to load a renamed runtime. Functions and IAT slots are
+// unchanged.
+func (im *ImportModifier) RenameImport(oldName, newName string) error {
+	if newName == "" {
+		return fmt.Errorf("新的DLL名称不能为空")
+	}
+	existing, err := im.readExistingImports()
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i := range existing {
+		if strings.EqualFold(existing[i].DLLName, oldName) {
+			existing[i].DLLName = newName
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("DLL %s 不在导入表中", oldName)
+	}
+
+	if _, err := im.stripBoundImports(); err != nil {
+		return fmt.Errorf("解除导入绑定失败: %w", err)
+	}
+
+	return im.rebuildImportTable(existing, "", nil)
+}
+
+// RedirectImport makes the loader resolve a function imported from dllName
+// to newFunction from newDLL instead, e.g. to route a call through a shim
+// DLL. Each IAT slot of the function is split from its descriptor into a
+// descriptor of its own for newDLL, so the slot keeps its RVA and the code
+// calling through it is unchanged. The slot is rewritten to the new INT
+// entry, as a freshly linked IAT would be.
+func (im *ImportModifier) RedirectImport(dllName string, function ImportFunction, newDLL string, newFunction ImportFunction) error {
+	if newDLL == "" {
+		return fmt.Errorf("新的DLL名称不能为空")
+	}
+	existing, err := im.readExistingImports()
+	if err != nil {
+		return err
+	}
+
+	kept, slots, err := redirectImportFunction(existing, dllName, function, newDLL, newFunction, im.getPtrSize(im.is64Bit()))
+	if err != nil {
+		return err
+	}
+
+	if _, err := im.stripBoundImports(); err != nil {
+		return fmt.Errorf("解除导入绑定失败: %w", err)
+	}
+	if err := im.rebuildImportTable(kept, "", nil); err != nil {
+		return err
+	}
+	if err := im.patcher.Reload(); err != nil {
+		return fmt.Errorf("重新加载PE文件失败: %w", err)
+	}
+
+	// Copy the new INT entries over the redirected slots
+	importDir, err := im.getImportDirectory()
+	if err != nil {
+		return err
+	}
+	descriptors, err := im.readImportDescriptors(importDir)
+	if err != nil {
+		return err
+	}
+	redirected := make(map[uint32]bool, len(slots))
+	for _, slot := range slots {
+		redirected[slot] = true
+	}
+	for _, desc := range descriptors {
+		if redirected[desc.FirstThunk] {
+			if err := im.restoreIAT(desc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// redirectImportFunction removes function from every descriptor of dllName
+// and gives each of its IAT slots a descriptor importing newFunction from
+// newDLL. It returns the new descriptor list and the slots.
+func redirectImportFunction(existing []ExistingImportData, dllName string, function ImportFunction, newDLL string, newFunction ImportFunction, ptrSize uint32) ([]ExistingImportData, []uint32, error) {
+	kept, slots, err := removeImportFunctions(existing, dllName, []ImportFunction{function}, ptrSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, slot := range slots {
+		kept = append(kept, ExistingImportData{
+			Descriptor: ImportDescriptor{FirstThunk: slot},
+			DLLName:    newDLL,
+			Functions:  []ImportFunction{newFunction},
+		})
+	}
+	return kept, slots, nil
+}
+
+// RedirectImportToRVA statically binds the IAT slots of a function imported
+// from dllName to code inside the image at rva. The function is removed from
+// the import table so the loader no longer overwrites the slots, which get
+// the address of rva and a base relocation. In CFG images rva is also
+// registered as a valid call target.
+func (im *ImportModifier) RedirectImportToRVA(dllName string, function ImportFunction, rva uint32) error {
+	if !im.isExecutableRVA(rva) {
+		return fmt.Errorf("RVA 0x%X 不在可执行节区中", rva)
+	}
+	existing, err := im.readExistingImports()
+	if err != nil {
+		return err
+	}
+
+	is64bit := im.is64Bit()
+	ptrSize := im.getPtrSize(is64bit)
+	kept, slots, err := removeImportFunctions(existing, dllName, []ImportFunction{function}, ptrSize)
+	if err != nil {
+		return err
+	}
+
+	if _, err := im.stripBoundImports(); err != nil {
+		return fmt.Errorf("解除导入绑定失败: %w", err)
+	}
+	if err := im.rebuildImportTable(kept, "", nil); err != nil {
+		return err
+	}
+
+	target := make([]byte, ptrSize)
+	im.writeThunkEntry(target, 0, imageBase(im.patcher.peFile)+uint64(rva), is64bit)
+	for _, slot := range slots {
+		offset, err := im.rvaToOffset(slot)
+		if err != nil {
+			return err
+		}
+		if _, err := im.patcher.file.WriteAt(target, int64(offset)); err != nil {
+			return fmt.Errorf("写入IAT槽位失败: %w", err)
+		}
+	}
+
+	relocType := uint16(IMAGE_REL_BASED_HIGHLOW)
+	if is64bit {
+		relocType = IMAGE_REL_BASED_DIR64
+	}
+	if err := im.patcher.Reload(); err != nil {
+		return fmt.Errorf("重新加载PE文件失败: %w", err)
+	}
+	if err := im.patcher.AddBaseRelocations(relocType, slots...); err != nil {
+		return err
+	}
+	return im.patcher.AddGuardCFTargets(rva)
+}
+
+// isExecutableRVA reports whether rva lies in an executable section.
+func (im *ImportModifier) isExecutableRVA(rva uint32) bool {
+	for _, s := range im.patcher.peFile.Sections {
+		if rva >= s.VirtualAddress && rva < s.VirtualAddress+s.VirtualSize {
+			return s.Characteristics&pe.IMAGE_SCN_MEM_EXECUTE != 0
+		}
+	}
+	return false
+}
+
+// RemoveImport is a convenience method on Patcher.
+func (p *Patcher) RemoveImport(dllName string, functions []ImportFunction) ([]IATReference, error) {
+	return NewImportModifier(p).RemoveImport(dllName, functions)
+}
+
+// RenameImport is a convenience method on Patcher.
+func (p *Patcher) RenameImport(oldName, newName string) error {
+	return NewImportModifier(p).RenameImport(oldName, newName)
+}
+
+// RedirectImport is a convenience method on Patcher.
+func (p *Patcher) RedirectImport(dllName string, function ImportFunction, newDLL string, newFunction ImportFunction) error {
+	return NewImportModifier(p).RedirectImport(dllName, function, newDLL, newFunction)
+}
+
+// RedirectImportToRVA is a convenience method on Patcher.
+func (p *Patcher) RedirectImportToRVA(dllName string, function ImportFunction, rva uint32) error {
+	return NewImportModifier(p).RedirectImportToRVA(dllName, function, rva)
+}
@@ -0,0 +1,276 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestPendingImports(t *testing.T) {
+	existing := []ExistingImportData{
+		{DLLName: "KERNEL32.dll", Functions: []ImportFunction{{Name: "Sleep"}, {Name: "ExitProcess"}}},
+		{DLLName: "USER32.dll", Functions: []ImportFunction{{Name: "MessageBoxA"}}},
+		{DLLName: "kernel32.dll", Functions: []ImportFunction{{Name: "GetTickCount"}, {Ordinal: 7, IsByOrdinal: true}}},
+	}
+	named := func(names ...string) []ImportFunction {
+		funcs := make([]ImportFunction, len(names))
+		for i, name := range names {
+			funcs[i] = ImportFunction{Name: name}
+		}
+		return funcs
+	}
+
+	// Both descriptors for the DLL count, matched case-insensitively
+	request := append(named("Sleep", "CreateThread", "GetTickCount", "CreateThread", "MessageBoxA"),
+		ImportFunction{Ordinal: 7, IsByOrdinal: true}, ImportFunction{Ordinal: 8, IsByOrdinal: true})
+	dll, funcs := pendingImports(existing, "Kernel32.DLL", request)
+	want := append(named("CreateThread", "MessageBoxA"), ImportFunction{Ordinal: 8, IsByOrdinal: true})
+	if dll != "kernel32.dll" || !reflect.DeepEqual(funcs, want) {
+		t.Errorf("pendingImports() = %q, %v", dll, funcs)
+	}
+
+	dll, funcs = pendingImports(existing, "ws2_32.dll", named("socket", "socket"))
+	if dll != "ws2_32.dll" || !reflect.DeepEqual(funcs, named("socket")) {
+		t.Errorf("pendingImports(new DLL) = %q, %v", dll, funcs)
+	}
+
+	if _, funcs := pendingImports(existing, "user32.dll", named("MessageBoxA")); len(funcs) != 0 {
+		t.Errorf("pendingImports(all imported) = %v, want none", funcs)
+	}
+}
+
+func TestParseImportFunction(t *testing.T) {
+	tests := []struct {
+		spec string
+		want ImportFunction
+	}{
+		{"connect", ImportFunction{Name: "connect"}},
+		{"#23", ImportFunction{Ordinal: 23, IsByOrdinal: true}},
+		{"#65535", ImportFunction{Ordinal: 65535, IsByOrdinal: true}},
+	}
+	for _, tt := range tests {
+		if got, err := ParseImportFunction(tt.spec); err != nil || got != tt.want {
+			t.Errorf("ParseImportFunction(%q) = %+v, %v; want %+v", tt.spec, got, err, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"", "#", "#x17", "#65536", "#-1"} {
+		if _, err := ParseImportFunction(spec); err == nil {
+			t.Errorf("ParseImportFunction(%q) expected error", spec)
+		}
+	}
+	if got := (ImportFunction{Ordinal: 23, IsByOrdinal: true}).String(); got != "Ordinal_23" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestOrdinalThunks(t *testing.T) {
+	im := &ImportModifier{}
+	funcs := []ImportFunction{{Name: "socket", Hint: 0x17}, {Ordinal: 23, IsByOrdinal: true}}
+
+	for _, is64 := range []bool{false, true} {
+		ptrSize := im.getPtrSize(is64)
+		offsets := im.calculateImportOffsets(nil, "ws2_32.dll", funcs, ptrSize)
+		data := make([]byte, 0x100)
+		im.writeImportThunks(data, 0x5000, nil, funcs, offsets, is64, ptrSize)
+		im.writeImportNames(data, nil, "ws2_32.dll", funcs, offsets)
+
+		read := func(off uint32) uint64 {
+			if is64 {
+				return binary.LittleEndian.Uint64(data[off:])
+			}
+			return uint64(binary.LittleEndian.Uint32(data[off:]))
+		}
+		ordinal := im.getOrdinalFlag(is64) | 23
+		for _, table := range []uint32{offsets.newINTOffset, offsets.newIATOffset} {
+			if got := read(table + ptrSize); got != ordinal {
+				t.Errorf("is64=%v: ordinal thunk = 0x%X, want 0x%X", is64, got, ordinal)
+			}
+			if got := read(table); got != uint64(0x5000+offsets.newFuncNameOffsets[0]) {
+				t.Errorf("is64=%v: name thunk = 0x%X", is64, got)
+			}
+		}
+		if hint := data[offsets.newFuncNameOffsets[0]]; hint != 0x17 {
+			t.Errorf("is64=%v: hint = 0x%X, want 0x17", is64, hint)
+		}
+	}
+}
+
+func TestApplyExportHints(t *testing.T) {
+	exports := []string{"WSAStartup", "accept", "bind", "connect", "bind"}
+	funcs := []ImportFunction{{Name: "connect"}, {Name: "bind"}, {Ordinal: 23, IsByOrdinal: true}, {Name: "nosuch", Hint: 9}}
+
+	missing := applyExportHints(exports, funcs)
+	if funcs[0].Hint != 3 || funcs[1].Hint != 2 || funcs[2].Hint != 0 || funcs[3].Hint != 9 {
+		t.Errorf("hints = %+v", funcs)
+	}
+	if !reflect.DeepEqual(missing, []string{"nosuch"}) {
+		t.Errorf("missing = %v", missing)
+	}
+}
+
+func TestRemoveImportFunctions(t *testing.T) {
+	kernel32 := ExistingImportData{
+		Descriptor: ImportDescriptor{FirstThunk: 0x3000},
+		DLLName:    "KERNEL32.dll",
+		INT:        []uint64{0x10, 0x20, 0x30, 0x40, 0x50},
+		Functions: []ImportFunction{
+			{Name: "CreateFileA"}, {Name: "ReadFile"}, {Name: "CloseHandle"}, {Ordinal: 5, IsByOrdinal: true}, {Name: "Sleep"},
+		},
+	}
+	user32 := ExistingImportData{Descriptor: ImportDescriptor{FirstThunk: 0x3040}, DLLName: "USER32.dll", Functions: []ImportFunction{{Name: "MessageBoxA"}}}
+	existing := []ExistingImportData{kernel32, user32}
+
+	// Removing ReadFile and the ordinal splits the descriptor in three runs
+	kept, slots, err := removeImportFunctions(existing, "kernel32.dll", []ImportFunction{{Name: "ReadFile"}, {Ordinal: 5, IsByOrdinal: true}}, 8)
+	if err != nil {
+		t.Fatalf("removeImportFunctions() error = %v", err)
+	}
+	if !reflect.DeepEqual(slots, []uint32{0x3008, 0x3018}) {
+		t.Errorf("slots = %X", slots)
+	}
+	var thunks []uint32
+	var names [][]string
+	for _, imp := range kept {
+		thunks = append(thunks, imp.Descriptor.FirstThunk)
+		var fns []string
+		for _, fn := range imp.Functions {
+			fns = append(fns, fn.String())
+		}
+		names = append(names, fns)
+	}
+	if !reflect.DeepEqual(thunks, []uint32{0x3000, 0x3010, 0x3020, 0x3040}) {
+		t.Errorf("FirstThunks = %X", thunks)
+	}
+	wantNames := [][]string{{"CreateFileA"}, {"CloseHandle"}, {"Sleep"}, {"MessageBoxA"}}
+	if !reflect.DeepEqual(names, wantNames) || !reflect.DeepEqual(kept[1].INT, []uint64{0x30}) {
+		t.Errorf("kept = %v, INT %X", names, kept[1].INT)
+	}
+
+	// Removing the whole DLL drops every slot
+	kept, slots, err = removeImportFunctions(existing, "USER32.DLL", nil, 4)
+	if err != nil || len(kept) != 1 || kept[0].DLLName != "KERNEL32.dll" || !reflect.DeepEqual(slots, []uint32{0x3040}) {
+		t.Errorf("remove DLL = %v, %X, %v", kept, slots, err)
+	}
+
+	if _, _, err := removeImportFunctions(existing, "ws2_32.dll", nil, 4); err == nil {
+		t.Error("removing a DLL that is not imported should fail")
+	}
+	if _, _, err := removeImportFunctions(existing, "user32.dll", []ImportFunction{{Name: "MessageBoxW"}}, 4); err == nil {
+		t.Error("removing a function that is not imported should fail")
+	}
+}
+
+func TestRedirectImportFunction(t *testing.T) {
+	existing := []ExistingImportData{
+		{
+			Descriptor: ImportDescriptor{FirstThunk: 0x3000},
+			DLLName:    "KERNEL32.dll",
+			INT:        []uint64{0x10, 0x20, 0x30},
+			Functions:  []ImportFunction{{Name: "GetVersion"}, {Name: "GetVersionExW"}, {Name: "Sleep"}},
+		},
+		{Descriptor: ImportDescriptor{FirstThunk: 0x3020}, DLLName: "kernel32.dll", INT: []uint64{0x40}, Functions: []ImportFunction{{Name: "GetVersionExW"}}},
+	}
+	shim := ImportFunction{Name: "ShimGetVersionExW", Hint: 2}
+
+	kept, slots, err := redirectImportFunction(existing, "kernel32.dll", ImportFunction{Name: "GetVersionExW"}, "shim.dll", shim, 8)
+	if err != nil {
+		t.Fatalf("redirectImportFunction() error = %v", err)
+	}
+	if !reflect.DeepEqual(slots, []uint32{0x3008, 0x3020}) {
+		t.Errorf("slots = %X", slots)
+	}
+
+	// Each slot keeps its RVA under a descriptor of its own for the shim
+	var got []string
+	for _, imp := range kept {
+		got = append(got, fmt.Sprintf("%s@%X:%v", imp.DLLName, imp.Descriptor.FirstThunk, imp.Functions))
+	}
+	want := []string{
+		"KERNEL32.dll@3000:[GetVersion]",
+		"KERNEL32.dll@3010:[Sleep]",
+		"shim.dll@3008:[ShimGetVersionExW]",
+		"shim.dll@3020:[ShimGetVersionExW]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("kept = %v, want %v", got, want)
+	}
+	if hint := kept[3].Functions[0].Hint; hint != 2 {
+		t.Errorf("redirected hint = %d, want 2", hint)
+	}
+
+	if _, _, err := redirectImportFunction(existing, "user32.dll", ImportFunction{Name: "MessageBoxA"}, "shim.dll", shim, 8); err == nil {
+		t.Error("redirecting a DLL that is not imported should fail")
+	}
+}
+
+func TestAddImportWithoutImportDirectories(t *testing.T) {
+	data := testSection{
+		name:            ".data",
+		characteristics: pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_WRITE,
+		data:            []byte{1},
+	}
+	for _, dirCount := range []uint32{16, 10, 1} {
+		p := newTestPatcher(t, dirCount, data)
+		if err := p.AddImport("user32.dll", []string{"MessageBoxA", "#5"}); err != nil {
+			t.Fatalf("%d directories: AddImport() error = %v", dirCount, err)
+		}
+		if err := p.Reload(); err != nil {
+			t.Fatal(err)
+		}
+
+		f := p.File()
+		importRVA, importSize := dataDirectory(f, 1)
+		iatRVA, iatSize := dataDirectory(f, 12)
+		if dataDirectoryCount(f) < 13 || importRVA == 0 || importSize != 40 || iatSize != 24 {
+			t.Errorf("%d directories: %d declared, import 0x%X/%d, IAT 0x%X/%d",
+				dirCount, dataDirectoryCount(f), importRVA, importSize, iatRVA, iatSize)
+		}
+		if len(f.Sections) != 1 || f.Sections[0].Name != ".data" {
+			t.Errorf("%d directories: section table damaged: %d sections", dirCount, len(f.Sections))
+		}
+
+		imports, err := NewImportModifier(p).readExistingImports()
+		if err != nil {
+			t.Fatalf("%d directories: readExistingImports() error = %v", dirCount, err)
+		}
+		if len(imports) != 1 || imports[0].DLLName != "user32.dll" || imports[0].Descriptor.FirstThunk != iatRVA {
+			t.Fatalf("%d directories: imports = %+v, IAT directory at 0x%X", dirCount, imports, iatRVA)
+		}
+		var names []string
+		for _, fn := range imports[0].Functions {
+			names = append(names, fn.String())
+		}
+		if !reflect.DeepEqual(names, []string{"MessageBoxA", "Ordinal_5"}) {
+			t.Errorf("%d directories: functions = %v", dirCount, names)
+		}
+	}
+
+	// 19 section headers fill the header space once the directories grow;
+	// nothing may be written before that is found out
+	sections := make([]testSection, 19)
+	for i := range sections {
+		sections[i] = data
+	}
+	p := newTestPatcher(t, 1, sections...)
+	before, err := p.file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddImport("user32.dll", []string{"MessageBoxA"}); err == nil {
+		t.Fatal("AddImport() without room for the directories should fail")
+	}
+	after, err := p.file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() != before.Size() || len(p.File().Sections) != 19 || dataDirectoryCount(p.File()) != 1 {
+		t.Errorf("failed AddImport() changed the image: size %d -> %d, %d sections, %d directories",
+			before.Size(), after.Size(), len(p.File().Sections), dataDirectoryCount(p.File()))
+	}
+}
@@ -0,0 +1,552 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// GuardFlags bits from IMAGE_LOAD_CONFIG_DIRECTORY (Windows SDK naming convention).
+//
+//nolint:revive // ALL_CAPS matches Windows SDK naming
+const (
+	IMAGE_GUARD_CF_INSTRUMENTED                    = 0x00000100
+	IMAGE_GUARD_CFW_INSTRUMENTED                   = 0x00000200
+	IMAGE_GUARD_CF_FUNCTION_TABLE_PRESENT          = 0x00000400
+	IMAGE_GUARD_SECURITY_COOKIE_UNUSED             = 0x00000800
+	IMAGE_GUARD_PROTECT_DELAYLOAD_IAT              = 0x00001000
+	IMAGE_GUARD_DELAYLOAD_IAT_IN_ITS_OWN_SECTION   = 0x00002000
+	IMAGE_GUARD_CF_EXPORT_SUPPRESSION_INFO_PRESENT = 0x00004000
+	IMAGE_GUARD_CF_ENABLE_EXPORT_SUPPRESSION       = 0x00008000
+	IMAGE_GUARD_CF_LONGJUMP_TABLE_PRESENT          = 0x00010000
+	IMAGE_GUARD_RF_INSTRUMENTED                    = 0x00020000
+	IMAGE_GUARD_RF_ENABLE                          = 0x00040000
+	IMAGE_GUARD_RF_STRICT                          = 0x00080000
+	IMAGE_GUARD_RETPOLINE_PRESENT                  = 0x00100000
+	IMAGE_GUARD_EH_CONTINUATION_TABLE_PRESENT      = 0x00400000
+	IMAGE_GUARD_XFG_ENABLED                        = 0x00800000
+	IMAGE_GUARD_CASTGUARD_PRESENT                  = 0x01000000
+	IMAGE_GUARD_MEMCPY_PRESENT                     = 0x02000000
+	IMAGE_GUARD_CF_FUNCTION_TABLE_SIZE_MASK        = 0xF0000000
+	IMAGE_GUARD_CF_FUNCTION_TABLE_SIZE_SHIFT       = 28
+)
+
+// Per-entry metadata flags in guard function tables (Windows SDK naming convention).
+//
+//nolint:revive // ALL_CAPS matches Windows SDK naming
+const (
+	IMAGE_GUARD_FLAG_FID_SUPPRESSED       = 0x01
+	IMAGE_GUARD_FLAG_EXPORT_SUPPRESSED    = 0x02
+	IMAGE_GUARD_FLAG_FID_LANGEXCPTHANDLER = 0x04
+	IMAGE_GUARD_FLAG_FID_XFG              = 0x08
+)
+
+var guardFlagNames = []struct {
+	mask uint32
+	name string
+}{
+	{IMAGE_GUARD_CF_INSTRUMENTED, "CF_INSTRUMENTED"},
+	{IMAGE_GUARD_CFW_INSTRUMENTED, "CFW_INSTRUMENTED"},
+	{IMAGE_GUARD_CF_FUNCTION_TABLE_PRESENT, "CF_FUNCTION_TABLE_PRESENT"},
+	{IMAGE_GUARD_SECURITY_COOKIE_UNUSED, "SECURITY_COOKIE_UNUSED"},
+	{IMAGE_GUARD_PROTECT_DELAYLOAD_IAT, "PROTECT_DELAYLOAD_IAT"},
+	{IMAGE_GUARD_DELAYLOAD_IAT_IN_ITS_OWN_SECTION, "DELAYLOAD_IAT_IN_ITS_OWN_SECTION"},
+	{IMAGE_GUARD_CF_EXPORT_SUPPRESSION_INFO_PRESENT, "CF_EXPORT_SUPPRESSION_INFO_PRESENT"},
+	{IMAGE_GUARD_CF_ENABLE_EXPORT_SUPPRESSION, "CF_ENABLE_EXPORT_SUPPRESSION"},
+	{IMAGE_GUARD_CF_LONGJUMP_TABLE_PRESENT, "CF_LONGJUMP_TABLE_PRESENT"},
+	{IMAGE_GUARD_RF_INSTRUMENTED, "RF_INSTRUMENTED"},
+	{IMAGE_GUARD_RF_ENABLE, "RF_ENABLE"},
+	{IMAGE_GUARD_RF_STRICT, "RF_STRICT"},
+	{IMAGE_GUARD_RETPOLINE_PRESENT, "RETPOLINE_PRESENT"},
+	{IMAGE_GUARD_EH_CONTINUATION_TABLE_PRESENT, "EH_CONTINUATION_TABLE_PRESENT"},
+	{IMAGE_GUARD_XFG_ENABLED, "XFG_ENABLED"},
+	{IMAGE_GUARD_CASTGUARD_PRESENT, "CASTGUARD_PRESENT"},
+	{IMAGE_GUARD_MEMCPY_PRESENT, "MEMCPY_PRESENT"},
+}
+
+// LoadConfigInfo contains IMAGE_LOAD_CONFIG_DIRECTORY information.
+// The structure has grown with every Windows release; fields beyond the
+// directory's self-declared Size are left zero.
+type LoadConfigInfo struct {
+	HasLoadConfig                            bool
+	Size                                     uint32
+	TimeDateStamp                            uint32
+	MajorVersion                             uint16
+	MinorVersion                             uint16
+	GlobalFlagsClear                         uint32
+	GlobalFlagsSet                           uint32
+	CriticalSectionDefaultTimeout            uint32
+	DeCommitFreeBlockThreshold               uint64
+	DeCommitTotalFreeThreshold               uint64
+	LockPrefixTable                          uint64
+	MaximumAllocationSize                    uint64
+	VirtualMemoryThreshold                   uint64
+	ProcessHeapFlags                         uint32
+	ProcessAffinityMask                      uint64
+	CSDVersion                               uint16
+	DependentLoadFlags                       uint16
+	EditList                                 uint64
+	SecurityCookie                           uint64
+	SEHandlerTable                           uint64
+	SEHandlerCount                           uint64
+	GuardCFCheckFunctionPointer              uint64
+	GuardCFDispatchFunctionPointer           uint64
+	GuardCFFunctionTable                     uint64
+	GuardCFFunctionCount                     uint64
+	GuardFlags                               uint32
+	CodeIntegrityFlags                       uint16
+	CodeIntegrityCatalog                     uint16
+	CodeIntegrityCatalogOffset               uint32
+	GuardAddressTakenIatEntryTable           uint64
+	GuardAddressTakenIatEntryCount           uint64
+	GuardLongJumpTargetTable                 uint64
+	GuardLongJumpTargetCount                 uint64
+	DynamicValueRelocTable                   uint64
+	CHPEMetadataPointer                      uint64
+	GuardRFFailureRoutine                    uint64
+	GuardRFFailureRoutineFunctionPointer     uint64
+	DynamicValueRelocTableOffset             uint32
+	DynamicValueRelocTableSection            uint16
+	GuardRFVerifyStackPointerFunctionPointer uint64
+	HotPatchTableOffset                      uint32
+	EnclaveConfigurationPointer              uint64
+	VolatileMetadataPointer                  uint64
+	GuardEHContinuationTable                 uint64
+	GuardEHContinuationCount                 uint64
+	GuardXFGCheckFunctionPointer             uint64
+	GuardXFGDispatchFunctionPointer          uint64
+	GuardXFGTableDispatchFunctionPointer     uint64
+	CastGuardOsDeterminedFailureMode         uint64
+	GuardMemcpyFunctionPointer               uint64
+
+	// Decoded tables referenced by the directory.
+	SEHandlers                  []uint32
+	GuardCFFunctions            []GuardFunction
+	GuardAddressTakenIATEntries []GuardFunction
+	GuardLongJumpTargets        []GuardFunction
+	GuardEHContinuations        []GuardFunction
+	DynamicRelocations          *DynamicRelocationInfo
+	CHPE                        *CHPEInfo
+}
+
+// GuardFunction is an entry of a CFG function, longjmp, EH continuation or
+// address-taken IAT table: an RVA followed by optional metadata bytes.
+type GuardFunction struct {
+	RVA   uint32
+	Flags uint8
+}
+
+// DynamicRelocationInfo summarizes the dynamic value relocation table.
+type DynamicRelocationInfo struct {
+	Version uint32
+	Size    uint32
+	Entries []DynamicRelocationEntry
+}
+
+// DynamicRelocationEntry is one IMAGE_DYNAMIC_RELOCATION header.
+type DynamicRelocationEntry struct {
+	Symbol uint64
+	Size   uint32
+}
+
+// CHPEInfo summarizes compiled-hybrid (x86 CHPE / ARM64EC) metadata.
+type CHPEInfo struct {
+	Version      uint32
+	CodeMapRVA   uint32
+	CodeMapCount uint32
+}
+
+// Dynamic relocation symbols (Windows SDK naming convention).
+//
+//nolint:revive // ALL_CAPS matches Windows SDK naming
+const (
+	IMAGE_DYNAMIC_RELOCATION_GUARD_RF_PROLOGUE                 = 1
+	IMAGE_DYNAMIC_RELOCATION_GUARD_RF_EPILOGUE                 = 2
+	IMAGE_DYNAMIC_RELOCATION_GUARD_IMPORT_CONTROL_TRANSFER     = 3
+	IMAGE_DYNAMIC_RELOCATION_GUARD_INDIR_CONTROL_TRANSFER      = 4
+	IMAGE_DYNAMIC_RELOCATION_GUARD_SWITCHTABLE_BRANCH          = 5
+	IMAGE_DYNAMIC_RELOCATION_ARM64X                            = 6
+	IMAGE_DYNAMIC_RELOCATION_FUNCTION_OVERRIDE                 = 7
+	IMAGE_DYNAMIC_RELOCATION_ARM64_KERNEL_IMPORT_CALL_TRANSFER = 8
+)
+
+// loadConfigField locates a LoadConfigInfo field in the 32-bit and 64-bit
+// directory layouts.
+type loadConfigField struct {
+	off32, off64   int
+	size32, size64 int
+	set            func(lc *LoadConfigInfo, v uint64)
+}
+
+var loadConfigFields = []loadConfigField{
+	{4, 4, 4, 4, func(lc *LoadConfigInfo, v uint64) { lc.TimeDateStamp = uint32(v) }},
+	{8, 8, 2, 2, func(lc *LoadConfigInfo, v uint64) { lc.MajorVersion = uint16(v) }},
+	{10, 10, 2, 2, func(lc *LoadConfigInfo, v uint64) { lc.MinorVersion = uint16(v) }},
+	{12, 12, 4, 4, func(lc *LoadConfigInfo, v uint64) { lc.GlobalFlagsClear = uint32(v) }},
+	{16, 16, 4, 4, func(lc *LoadConfigInfo, v uint64) { lc.GlobalFlagsSet = uint32(v) }},
+	{20, 20, 4, 4, func(lc *LoadConfigInfo, v uint64) { lc.CriticalSectionDefaultTimeout = uint32(v) }},
+	{24, 24, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.DeCommitFreeBlockThreshold = v }},
+	{28, 32, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.DeCommitTotalFreeThreshold = v }},
+	{32, 40, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.LockPrefixTable = v }},
+	{36, 48, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.MaximumAllocationSize = v }},
+	{40, 56, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.VirtualMemoryThreshold = v }},
+	{44, 72, 4, 4, func(lc *LoadConfigInfo, v uint64) { lc.ProcessHeapFlags = uint32(v) }},
+	{48, 64, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.ProcessAffinityMask = v }},
+	{52, 76, 2, 2, func(lc *LoadConfigInfo, v uint64) { lc.CSDVersion = uint16(v) }},
+	{54, 78, 2, 2, func(lc *LoadConfigInfo, v uint64) { lc.DependentLoadFlags = uint16(v) }},
+	{56, 80, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.EditList = v }},
+	{60, 88, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.SecurityCookie = v }},
+	{64, 96, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.SEHandlerTable = v }},
+	{68, 104, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.SEHandlerCount = v }},
+	{72, 112, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardCFCheckFunctionPointer = v }},
+	{76, 120, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardCFDispatchFunctionPointer = v }},
+	{80, 128, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardCFFunctionTable = v }},
+	{84, 136, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardCFFunctionCount = v }},
+	{88, 144, 4, 4, func(lc *LoadConfigInfo, v uint64) { lc.GuardFlags = uint32(v) }},
+	{92, 148, 2, 2, func(lc *LoadConfigInfo, v uint64) { lc.CodeIntegrityFlags = uint16(v) }},
+	{94, 150, 2, 2, func(lc *LoadConfigInfo, v uint64) { lc.CodeIntegrityCatalog = uint16(v) }},
+	{96, 152, 4, 4, func(lc *LoadConfigInfo, v uint64) { lc.CodeIntegrityCatalogOffset = uint32(v) }},
+	{104, 160, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardAddressTakenIatEntryTable = v }},
+	{108, 168, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardAddressTakenIatEntryCount = v }},
+	{112, 176, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardLongJumpTargetTable = v }},
+	{116, 184, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardLongJumpTargetCount = v }},
+	{120, 192, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.DynamicValueRelocTable = v }},
+	{124, 200, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.CHPEMetadataPointer = v }},
+	{128, 208, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardRFFailureRoutine = v }},
+	{132, 216, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardRFFailureRoutineFunctionPointer = v }},
+	{136, 224, 4, 4, func(lc *LoadConfigInfo, v uint64) { lc.DynamicValueRelocTableOffset = uint32(v) }},
+	{140, 228, 2, 2, func(lc *LoadConfigInfo, v uint64) { lc.DynamicValueRelocTableSection = uint16(v) }},
+	{144, 232, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardRFVerifyStackPointerFunctionPointer = v }},
+	{148, 240, 4, 4, func(lc *LoadConfigInfo, v uint64) { lc.HotPatchTableOffset = uint32(v) }},
+	{156, 248, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.EnclaveConfigurationPointer = v }},
+	{160, 256, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.VolatileMetadataPointer = v }},
+	{164, 264, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardEHContinuationTable = v }},
+	{168, 272, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardEHContinuationCount = v }},
+	{172, 280, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardXFGCheckFunctionPointer = v }},
+	{176, 288, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardXFGDispatchFunctionPointer = v }},
+	{180, 296, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardXFGTableDispatchFunctionPointer = v }},
+	{184, 304, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.CastGuardOsDeterminedFailureMode = v }},
+	{188, 312, 4, 8, func(lc *LoadConfigInfo, v uint64) { lc.GuardMemcpyFunctionPointer = v }},
+}
+
+// Limits that keep malformed directories from causing huge allocations.
+const (
+	maxLoadConfigSize      = 0x400
+	maxGuardTableEntries   = 1 << 20
+	maxDynamicRelocEntries = 4096
+)
+
+// ParseLoadConfig extracts load configuration directory information from PE file.
+func ParseLoadConfig(f *pe.File, r io.ReaderAt) (*LoadConfigInfo, error) {
+	info := &LoadConfigInfo{}
+
+	// Get Load Config Directory (Data Directory[10])
+	dirRVA, dirSize := dataDirectory(f, dataDirLoadConfig)
+	if dirRVA == 0 || dirSize == 0 {
+		return info, nil
+	}
+
+	offset, err := rvaToOffset(f, dirRVA)
+	if err != nil {
+		return info, err
+	}
+
+	data, err := readLoadConfigData(r, int64(offset))
+	if err != nil {
+		return info, err
+	}
+
+	info.HasLoadConfig = true
+	info.Size = uint32(len(data))
+
+	_, is64Bit := f.OptionalHeader.(*pe.OptionalHeader64)
+
+	for _, field := range loadConfigFields {
+		if v, ok := readLoadConfigField(data, field, is64Bit); ok {
+			field.set(info, v)
+		}
+	}
+
+	parseLoadConfigTables(f, r, info, is64Bit)
+
+	return info, nil
+}
+
+// GuardTableStride returns the size of one guard table entry: a 4-byte RVA
+// followed by the number of metadata bytes encoded in GuardFlags.
+func (lc *LoadConfigInfo) GuardTableStride() int {
+	return 4 + int((lc.GuardFlags&IMAGE_GUARD_CF_FUNCTION_TABLE_SIZE_MASK)>>IMAGE_GUARD_CF_FUNCTION_TABLE_SIZE_SHIFT)
+}
+
+// DescribeGuardFlags decodes GuardFlags into flag names.
+func DescribeGuardFlags(flags uint32) []string {
+	var names []string
+	for _, f := range guardFlagNames {
+		if flags&f.mask != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// parseLoadConfigTables decodes the tables the directory points to.
+// Malformed tables are skipped rather than failing the whole parse.
+func parseLoadConfigTables(f *pe.File, r io.ReaderAt, info *LoadConfigInfo, is64Bit bool) {
+	stride := info.GuardTableStride()
+
+	if !is64Bit {
+		info.SEHandlers = readSEHandlers(f, r, info.SEHandlerTable, info.SEHandlerCount)
+	}
+	info.GuardCFFunctions = readGuardTable(f, r, info.GuardCFFunctionTable, info.GuardCFFunctionCount, stride)
+	info.GuardAddressTakenIATEntries = readGuardTable(f, r, info.GuardAddressTakenIatEntryTable, info.GuardAddressTakenIatEntryCount, stride)
+	info.GuardLongJumpTargets = readGuardTable(f, r, info.GuardLongJumpTargetTable, info.GuardLongJumpTargetCount, stride)
+	info.GuardEHContinuations = readGuardTable(f, r, info.GuardEHContinuationTable, info.GuardEHContinuationCount, stride)
+	info.DynamicRelocations = parseDynamicRelocations(f, r, info, is64Bit)
+	info.CHPE = parseCHPEMetadata(f, r, info.CHPEMetadataPointer)
+}
+
+// readTable reads count*stride bytes at a virtual address.
+func readTable(f *pe.File, r io.ReaderAt, va, count uint64, stride int) []byte {
+	if va == 0 || count == 0 || count > maxGuardTableEntries {
+		return nil
+	}
+
+	offset, err := vaToOffset(f, va)
+	if err != nil {
+		return nil
+	}
+
+	data := make([]byte, int(count)*stride)
+	if _, err := r.ReadAt(data, int64(offset)); err != nil {
+		return nil
+	}
+	return data
+}
+
+func readSEHandlers(f *pe.File, r io.ReaderAt, va, count uint64) []uint32 {
+	data := readTable(f, r, va, count, 4)
+	if data == nil {
+		return nil
+	}
+
+	handlers := make([]uint32, count)
+	for i := range handlers {
+		handlers[i] = binary.LittleEndian.Uint32(data[i*4:])
+	}
+	return handlers
+}
+
+func readGuardTable(f *pe.File, r io.ReaderAt, va, count uint64, stride int) []GuardFunction {
+	data := readTable(f, r, va, count, stride)
+	if data == nil {
+		return nil
+	}
+
+	entries := make([]GuardFunction, count)
+	for i := range entries {
+		entry := data[i*stride:]
+		entries[i].RVA = binary.LittleEndian.Uint32(entry)
+		if stride > 4 {
+			entries[i].Flags = entry[4]
+		}
+	}
+	return entries
+}
+
+// dynamicRelocTableOffset locates IMAGE_DYNAMIC_RELOCATION_TABLE. Newer
+// linkers store a section number and offset; older ones a VA.
+func dynamicRelocTableOffset(f *pe.File, info *LoadConfigInfo) (uint32, bool) {
+	section := int(info.DynamicValueRelocTableSection)
+	if section > 0 && section <= len(f.Sections) {
+		return f.Sections[section-1].Offset + info.DynamicValueRelocTableOffset, true
+	}
+	if info.DynamicValueRelocTable != 0 {
+		offset, err := vaToOffset(f, info.DynamicValueRelocTable)
+		return offset, err == nil
+	}
+	return 0, false
+}
+
+func parseDynamicRelocations(f *pe.File, r io.ReaderAt, info *LoadConfigInfo, is64Bit bool) *DynamicRelocationInfo {
+	offset, ok := dynamicRelocTableOffset(f, info)
+	if !ok {
+		return nil
+	}
+
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, int64(offset)); err != nil {
+		return nil
+	}
+
+	table := &DynamicRelocationInfo{
+		Version: binary.LittleEndian.Uint32(header[0:4]),
+		Size:    binary.LittleEndian.Uint32(header[4:8]),
+	}
+
+	// Size comes from the file, so it must fit in the section holding the table
+	if table.Size > sectionBytesAfter(f, offset+8) {
+		return nil
+	}
+
+	data := make([]byte, table.Size)
+	if _, err := r.ReadAt(data, int64(offset)+8); err != nil {
+		return table
+	}
+	table.Entries = parseDynamicRelocationEntries(data, table.Version, is64Bit)
+	return table
+}
+
+// sectionBytesAfter returns the raw data left in the section containing file
+// offset, or 0 if no section contains it.
+func sectionBytesAfter(f *pe.File, offset uint32) uint32 {
+	for _, s := range f.Sections {
+		if offset >= s.Offset && offset-s.Offset < s.Size {
+			return s.Size - (offset - s.Offset)
+		}
+	}
+	return 0
+}
+
+// parseDynamicRelocationEntries walks IMAGE_DYNAMIC_RELOCATION(V2) headers.
+func parseDynamicRelocationEntries(data []byte, version uint32, is64Bit bool) []DynamicRelocationEntry {
+	ptrSize := 4
+	if is64Bit {
+		ptrSize = 8
+	}
+
+	var entries []DynamicRelocationEntry
+	for pos := 0; pos < len(data) && len(entries) < maxDynamicRelocEntries; {
+		var entry DynamicRelocationEntry
+		var next int
+
+		switch version {
+		case 1:
+			// Symbol (pointer-sized), BaseRelocSize.
+			if pos+ptrSize+4 > len(data) {
+				return entries
+			}
+			entry.Symbol = readPointer(data[pos:], ptrSize)
+			entry.Size = binary.LittleEndian.Uint32(data[pos+ptrSize:])
+			next = pos + ptrSize + 4 + int(entry.Size)
+		case 2:
+			// HeaderSize, FixupInfoSize, Symbol (pointer-sized), SymbolGroup, Flags.
+			if pos+8+ptrSize > len(data) {
+				return entries
+			}
+			headerSize := binary.LittleEndian.Uint32(data[pos:])
+			entry.Size = binary.LittleEndian.Uint32(data[pos+4:])
+			entry.Symbol = readPointer(data[pos+8:], ptrSize)
+			next = pos + int(headerSize) + int(entry.Size)
+		default:
+			return entries
+		}
+
+		entries = append(entries, entry)
+		if next <= pos {
+			break
+		}
+		pos = next
+	}
+	return entries
+}
+
+func readPointer(b []byte, size int) uint64 {
+	if size == 8 {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return uint64(binary.LittleEndian.Uint32(b))
+}
+
+// parseCHPEMetadata reads the header shared by IMAGE_CHPE_METADATA_X86 and
+// IMAGE_ARM64EC_METADATA: Version, code range/map RVA and count.
+func parseCHPEMetadata(f *pe.File, r io.ReaderAt, va uint64) *CHPEInfo {
+	if va == 0 {
+		return nil
+	}
+
+	offset, err := vaToOffset(f, va)
+	if err != nil {
+		return nil
+	}
+
+	buf := make([]byte, 12)
+	if _, err := r.ReadAt(buf, int64(offset)); err != nil {
+		return nil
+	}
+
+	return &CHPEInfo{
+		Version:      binary.LittleEndian.Uint32(buf[0:4]),
+		CodeMapRVA:   binary.LittleEndian.Uint32(buf[4:8]),
+		CodeMapCount: binary.LittleEndian.Uint32(buf[8:12]),
+	}
+}
+
+// DynamicRelocationSymbolName returns a readable name for a dynamic relocation symbol.
+func DynamicRelocationSymbolName(symbol uint64) string {
+	switch symbol {
+	case IMAGE_DYNAMIC_RELOCATION_GUARD_RF_PROLOGUE:
+		return "GUARD_RF_PROLOGUE"
+	case IMAGE_DYNAMIC_RELOCATION_GUARD_RF_EPILOGUE:
+		return "GUARD_RF_EPILOGUE"
+	case IMAGE_DYNAMIC_RELOCATION_GUARD_IMPORT_CONTROL_TRANSFER:
+		return "GUARD_IMPORT_CONTROL_TRANSFER"
+	case IMAGE_DYNAMIC_RELOCATION_GUARD_INDIR_CONTROL_TRANSFER:
+		return "GUARD_INDIR_CONTROL_TRANSFER"
+	case IMAGE_DYNAMIC_RELOCATION_GUARD_SWITCHTABLE_BRANCH:
+		return "GUARD_SWITCHTABLE_BRANCH"
+	case IMAGE_DYNAMIC_RELOCATION_ARM64X:
+		return "ARM64X"
+	case IMAGE_DYNAMIC_RELOCATION_FUNCTION_OVERRIDE:
+		return "FUNCTION_OVERRIDE"
+	case IMAGE_DYNAMIC_RELOCATION_ARM64_KERNEL_IMPORT_CALL_TRANSFER:
+		return "ARM64_KERNEL_IMPORT_CALL_TRANSFER"
+	default:
+		return fmt.Sprintf("0x%X", symbol)
+	}
+}
+
+// readLoadConfigData reads the directory up to its self-declared Size.
+// The Size field, not the data directory size, is authoritative: x86 linkers
+// historically wrote 64 in the data directory regardless of the real size.
+func readLoadConfigData(r io.ReaderAt, offset int64) ([]byte, error) {
+	sizeBuf := make([]byte, 4)
+	if _, err := r.ReadAt(sizeBuf, offset); err != nil {
+		return nil, fmt.Errorf("读取加载配置失败: %w", err)
+	}
+
+	size := binary.LittleEndian.Uint32(sizeBuf)
+	if size < 4 {
+		return nil, fmt.Errorf("加载配置大小无效: %d", size)
+	}
+	if size > maxLoadConfigSize {
+		size = maxLoadConfigSize
+	}
+
+	data := make([]byte, size)
+	n, err := r.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("读取加载配置失败: %w", err)
+	}
+	return data[:n], nil
+}
+
+func readLoadConfigField(data []byte, field loadConfigField, is64Bit bool) (uint64, bool) {
+	off, size := field.off32, field.size32
+	if is64Bit {
+		off, size = field.off64, field.size64
+	}
+
+	if off+size > len(data) {
+		return 0, false
+	}
+
+	switch size {
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(data[off:])), true
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(data[off:])), true
+	default:
+		return binary.LittleEndian.Uint64(data[off:]), true
+	}
+}
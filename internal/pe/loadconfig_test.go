@@ -0,0 +1,120 @@
+package pe
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfigFieldLayout(t *testing.T) {
+	// Build a 64-bit directory with the GuardCF fields filled in and check
+	// the table decodes them at the documented offsets.
+	data := make([]byte, 320)
+	binary.LittleEndian.PutUint32(data[0:], 320)
+	binary.LittleEndian.PutUint64(data[88:], 0x140005008)
+	binary.LittleEndian.PutUint64(data[128:], 0x140004000)
+	binary.LittleEndian.PutUint64(data[136:], 42)
+	binary.LittleEndian.PutUint32(data[144:], 0x10000500)
+	binary.LittleEndian.PutUint64(data[264:], 0x140004800)
+	binary.LittleEndian.PutUint64(data[272:], 7)
+
+	info := &LoadConfigInfo{}
+	for _, field := range loadConfigFields {
+		if v, ok := readLoadConfigField(data, field, true); ok {
+			field.set(info, v)
+		}
+	}
+
+	if info.SecurityCookie != 0x140005008 || info.GuardCFFunctionTable != 0x140004000 ||
+		info.GuardCFFunctionCount != 42 || info.GuardFlags != 0x10000500 ||
+		info.GuardEHContinuationTable != 0x140004800 || info.GuardEHContinuationCount != 7 {
+		t.Errorf("decoded fields = %+v", info)
+	}
+	if stride := info.GuardTableStride(); stride != 5 {
+		t.Errorf("GuardTableStride() = %d, want 5", stride)
+	}
+}
+
+func TestReadLoadConfigFieldTruncated(t *testing.T) {
+	// A 64-byte x86 directory (Windows XP era) ends before SEHandlerTable.
+	data := make([]byte, 64)
+	for _, field := range loadConfigFields {
+		if field.off32 == 64 {
+			if _, ok := readLoadConfigField(data, field, false); ok {
+				t.Error("field beyond Size should not be read")
+			}
+		}
+		if field.off32 == 60 {
+			if _, ok := readLoadConfigField(data, field, false); !ok {
+				t.Error("SecurityCookie should be read from a 64-byte directory")
+			}
+		}
+	}
+}
+
+func TestDescribeGuardFlags(t *testing.T) {
+	got := DescribeGuardFlags(IMAGE_GUARD_CF_INSTRUMENTED | IMAGE_GUARD_CF_FUNCTION_TABLE_PRESENT | 0x10000000)
+	want := []string{"CF_INSTRUMENTED", "CF_FUNCTION_TABLE_PRESENT"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DescribeGuardFlags() = %v, want %v", got, want)
+	}
+}
+
+func TestParseDynamicRelocationEntries(t *testing.T) {
+	// Version 1, 64-bit: Symbol(8) + BaseRelocSize(4) + relocation blocks.
+	v1 := make([]byte, 0, 64)
+	v1 = binary.LittleEndian.AppendUint64(v1, IMAGE_DYNAMIC_RELOCATION_GUARD_RF_PROLOGUE)
+	v1 = binary.LittleEndian.AppendUint32(v1, 8)
+	v1 = append(v1, make([]byte, 8)...)
+	v1 = binary.LittleEndian.AppendUint64(v1, IMAGE_DYNAMIC_RELOCATION_GUARD_IMPORT_CONTROL_TRANSFER)
+	v1 = binary.LittleEndian.AppendUint32(v1, 0)
+
+	got := parseDynamicRelocationEntries(v1, 1, true)
+	want := []DynamicRelocationEntry{
+		{Symbol: IMAGE_DYNAMIC_RELOCATION_GUARD_RF_PROLOGUE, Size: 8},
+		{Symbol: IMAGE_DYNAMIC_RELOCATION_GUARD_IMPORT_CONTROL_TRANSFER, Size: 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("v1 entries = %+v, want %+v", got, want)
+	}
+
+	// Version 2, 32-bit: HeaderSize, FixupInfoSize, Symbol(4), SymbolGroup, Flags.
+	v2 := make([]byte, 0, 32)
+	v2 = binary.LittleEndian.AppendUint32(v2, 20)
+	v2 = binary.LittleEndian.AppendUint32(v2, 4)
+	v2 = binary.LittleEndian.AppendUint32(v2, IMAGE_DYNAMIC_RELOCATION_FUNCTION_OVERRIDE)
+	v2 = append(v2, make([]byte, 8+4)...)
+
+	got = parseDynamicRelocationEntries(v2, 2, false)
+	if len(got) != 1 || got[0].Symbol != IMAGE_DYNAMIC_RELOCATION_FUNCTION_OVERRIDE || got[0].Size != 4 {
+		t.Errorf("v2 entries = %+v", got)
+	}
+
+	if got := parseDynamicRelocationEntries(v1, 3, true); got != nil {
+		t.Errorf("unknown version entries = %+v, want nil", got)
+	}
+}
+
+func TestParseDynamicRelocationsSize(t *testing.T) {
+	// The table lies at offset 0x10 of a section with 0x100 bytes of raw data
+	data := make([]byte, 0x200)
+	f := &pe.File{Sections: []*pe.Section{
+		{SectionHeader: pe.SectionHeader{Name: ".rdata", VirtualAddress: 0x1000, VirtualSize: 0x100, Offset: 0x100, Size: 0x100}},
+	}}
+	info := &LoadConfigInfo{DynamicValueRelocTableSection: 1, DynamicValueRelocTableOffset: 0x10}
+
+	binary.LittleEndian.PutUint32(data[0x110:], 1)
+	binary.LittleEndian.PutUint32(data[0x114:], 0xE8) // Up to the end of the section
+	if table := parseDynamicRelocations(f, bytes.NewReader(data), info, true); table == nil || table.Size != 0xE8 {
+		t.Errorf("parseDynamicRelocations() = %+v, want a table of 0xE8 bytes", table)
+	}
+
+	for _, size := range []uint32{0xE9, 0xFFFFFFFF} {
+		binary.LittleEndian.PutUint32(data[0x114:], size)
+		if table := parseDynamicRelocations(f, bytes.NewReader(data), info, true); table != nil {
+			t.Errorf("parseDynamicRelocations(Size=0x%X) = %+v, want nil", size, table)
+		}
+	}
+}
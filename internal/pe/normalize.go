@@ -0,0 +1,287 @@
+package pe
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// maxResourceDepth bounds the resource tree walk. Windows uses three levels
+// (type, name, language); the extra room tolerates unusual but valid trees.
+const maxResourceDepth = 8
+
+// NormalizeOptions controls reproducible-build normalization.
+type NormalizeOptions struct {
+	// Timestamp replaces every embedded timestamp.
+	Timestamp uint32
+	// StripRichHeader removes the Rich header from the DOS stub. It records
+	// the exact toolchain build numbers, which differ between build machines.
+	StripRichHeader bool
+}
+
+// NormalizeResult reports what Normalize rewrote.
+type NormalizeResult struct {
+	Timestamps        int
+	CodeViewGUIDs     int
+	ReproHashes       int
+	RichHeaderRemoved bool
+}
+
+// SourceDateEpoch returns the SOURCE_DATE_EPOCH environment variable as a PE
+// timestamp. The second result is false when the variable is unset.
+func SourceDateEpoch() (uint32, bool, error) {
+	value, ok := os.LookupEnv("SOURCE_DATE_EPOCH")
+	if !ok || value == "" {
+		return 0, false, nil
+	}
+
+	ts, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, false, fmt.Errorf("SOURCE_DATE_EPOCH 无效: %s", value)
+	}
+	return uint32(ts), true, nil
+}
+
+// Normalize rewrites every embedded timestamp to a fixed value so that two
+// builds of the same sources produce byte-identical images: the COFF header,
+// export directory, every resource directory, debug directory entries, NB10
+// signatures and the load config. RSDS GUIDs and REPRO hashes are derived
+// from a SHA-256 of the normalized image. The checksum is recomputed last.
+func (p *Patcher) Normalize(opts NormalizeOptions) (*NormalizeResult, error) {
+	result := &NormalizeResult{}
+	ts := opts.Timestamp
+
+	peOffset, err := p.peHeaderOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	// COFF header TimeDateStamp
+	if err := p.writeUint32(peOffset+8, ts); err != nil {
+		return nil, err
+	}
+	result.Timestamps++
+
+	n, err := p.normalizeExportTimestamp(ts)
+	if err != nil {
+		return nil, err
+	}
+	result.Timestamps += n
+
+	n, err = p.normalizeResourceTimestamps(ts)
+	if err != nil {
+		return nil, err
+	}
+	result.Timestamps += n
+
+	n, err = p.normalizeLoadConfigTimestamp(ts)
+	if err != nil {
+		return nil, err
+	}
+	result.Timestamps += n
+
+	hashFields, err := p.normalizeDebugTimestamps(ts, result)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.StripRichHeader {
+		if result.RichHeaderRemoved, err = p.RemoveRichHeader(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.fillContentHashes(peOffset, hashFields); err != nil {
+		return nil, err
+	}
+
+	return result, p.UpdateChecksum()
+}
+
+// hashField is a region that receives the content hash of the image.
+type hashField struct {
+	offset int64
+	size   int
+}
+
+func (p *Patcher) normalizeExportTimestamp(ts uint32) (int, error) {
+	rva, size := dataDirectory(p.peFile, pe.IMAGE_DIRECTORY_ENTRY_EXPORT)
+	if rva == 0 || size == 0 {
+		return 0, nil
+	}
+
+	offset, err := rvaToOffset(p.peFile, rva)
+	if err != nil {
+		return 0, fmt.Errorf("定位导出目录失败: %w", err)
+	}
+	return 1, p.writeUint32(int64(offset)+4, ts)
+}
+
+// normalizeResourceTimestamps walks the resource tree and rewrites the
+// TimeDateStamp of every IMAGE_RESOURCE_DIRECTORY.
+func (p *Patcher) normalizeResourceTimestamps(ts uint32) (int, error) {
+	rva, size := dataDirectory(p.peFile, pe.IMAGE_DIRECTORY_ENTRY_RESOURCE)
+	if rva == 0 || size == 0 {
+		return 0, nil
+	}
+
+	base, err := rvaToOffset(p.peFile, rva)
+	if err != nil {
+		return 0, fmt.Errorf("定位资源目录失败: %w", err)
+	}
+
+	visited := make(map[uint32]bool)
+	var walk func(dirOffset uint32, depth int) (int, error)
+	walk = func(dirOffset uint32, depth int) (int, error) {
+		if depth > maxResourceDepth || visited[dirOffset] || dirOffset+16 > size {
+			return 0, nil
+		}
+		visited[dirOffset] = true
+
+		header := make([]byte, 16)
+		if _, err := p.file.ReadAt(header, int64(base+dirOffset)); err != nil {
+			return 0, fmt.Errorf("读取资源目录失败: %w", err)
+		}
+		if err := p.writeUint32(int64(base+dirOffset)+4, ts); err != nil {
+			return 0, err
+		}
+		count := 1
+
+		entries := int(binary.LittleEndian.Uint16(header[12:14])) + int(binary.LittleEndian.Uint16(header[14:16]))
+		entry := make([]byte, 8)
+		for i := 0; i < entries; i++ {
+			entryOffset := dirOffset + 16 + uint32(i*8)
+			if entryOffset+8 > size {
+				break
+			}
+			if _, err := p.file.ReadAt(entry, int64(base+entryOffset)); err != nil {
+				return 0, fmt.Errorf("读取资源目录项失败: %w", err)
+			}
+
+			target := binary.LittleEndian.Uint32(entry[4:8])
+			if target&0x80000000 == 0 {
+				continue // Data entry, no timestamp
+			}
+			n, err := walk(target&0x7FFFFFFF, depth+1)
+			if err != nil {
+				return 0, err
+			}
+			count += n
+		}
+		return count, nil
+	}
+
+	return walk(0, 0)
+}
+
+func (p *Patcher) normalizeLoadConfigTimestamp(ts uint32) (int, error) {
+	lc, err := ParseLoadConfig(p.peFile, p.file)
+	if err != nil {
+		return 0, fmt.Errorf("解析加载配置失败: %w", err)
+	}
+	if !lc.HasLoadConfig || lc.Size < 8 {
+		return 0, nil
+	}
+
+	rva, _ := dataDirectory(p.peFile, dataDirLoadConfig)
+	offset, err := rvaToOffset(p.peFile, rva)
+	if err != nil {
+		return 0, fmt.Errorf("定位加载配置失败: %w", err)
+	}
+	return 1, p.writeUint32(int64(offset)+4, ts)
+}
+
+// normalizeDebugTimestamps rewrites debug entry and NB10 timestamps and
+// zeroes the RSDS GUIDs and REPRO hashes, returning their locations so they
+// can be filled with the content hash.
+func (p *Patcher) normalizeDebugTimestamps(ts uint32, result *NormalizeResult) ([]hashField, error) {
+	rva, size := dataDirectory(p.peFile, pe.IMAGE_DIRECTORY_ENTRY_DEBUG)
+	if rva == 0 || size == 0 {
+		return nil, nil
+	}
+
+	dm := NewDebugModifier(p)
+	dir, err := dm.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []hashField
+	for i := range dir.entries {
+		e := &dir.entries[i]
+		e.TimeDateStamp = ts
+		result.Timestamps++
+
+		offset := int64(dm.payloadOffset(e))
+		if offset == 0 {
+			continue
+		}
+
+		switch {
+		case e.CodeView != nil && e.CodeView.Signature == codeViewNB10:
+			if err := p.writeUint32(offset+8, ts); err != nil {
+				return nil, err
+			}
+			result.Timestamps++
+		case e.CodeView != nil:
+			fields = append(fields, hashField{offset: offset + 4, size: len(e.CodeView.GUID)})
+			result.CodeViewGUIDs++
+		case e.Repro != nil && len(e.Repro.Hash) > 0:
+			fields = append(fields, hashField{offset: offset + 4, size: len(e.Repro.Hash)})
+			result.ReproHashes++
+		}
+	}
+
+	for _, f := range fields {
+		if _, err := p.file.WriteAt(make([]byte, f.size), f.offset); err != nil {
+			return nil, fmt.Errorf("清除调试哈希失败: %w", err)
+		}
+	}
+
+	return fields, dm.writeEntries(dir, dir.entries)
+}
+
+// fillContentHashes hashes the image with the hash fields and checksum zeroed
+// and writes the digest into each field. The certificate table is excluded
+// since it is never reproducible.
+func (p *Patcher) fillContentHashes(peOffset int64, fields []hashField) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if err := p.writeUint32(peOffset+4+20+64, 0); err != nil {
+		return err
+	}
+
+	end := p.filesize
+	if certOffset, certSize := dataDirectory(p.peFile, pe.IMAGE_DIRECTORY_ENTRY_SECURITY); certOffset != 0 && certSize != 0 {
+		end = min(end, int64(certOffset))
+	}
+
+	data := make([]byte, end)
+	if _, err := p.file.ReadAt(data, 0); err != nil {
+		return fmt.Errorf("读取文件失败: %w", err)
+	}
+	sum := sha256.Sum256(data)
+
+	for _, f := range fields {
+		digest := bytes.Repeat(sum[:], f.size/len(sum)+1)[:f.size]
+		if _, err := p.file.WriteAt(digest, f.offset); err != nil {
+			return fmt.Errorf("写入内容哈希失败: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *Patcher) writeUint32(offset int64, v uint32) error {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, v)
+	if _, err := p.file.WriteAt(buf, offset); err != nil {
+		return fmt.Errorf("写入文件失败 (偏移 0x%X): %w", offset, err)
+	}
+	return nil
+}
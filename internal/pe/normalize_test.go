@@ -0,0 +1,158 @@
+package pe
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+func TestSourceDateEpoch(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	if _, ok, err := SourceDateEpoch(); ok || err != nil {
+		t.Errorf("empty: ok=%v err=%v, want unset", ok, err)
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	ts, ok, err := SourceDateEpoch()
+	if !ok || err != nil || ts != 1700000000 {
+		t.Errorf("got %d ok=%v err=%v", ts, ok, err)
+	}
+
+	for _, bad := range []string{"yesterday", "-1", "4294967296"} {
+		t.Setenv("SOURCE_DATE_EPOCH", bad)
+		if _, _, err := SourceDateEpoch(); err == nil {
+			t.Errorf("SOURCE_DATE_EPOCH=%q expected error", bad)
+		}
+	}
+}
+
+// newNormalizeTestPatcher builds an image with a timestamp in every place
+// Normalize rewrites. .rdata holds the export directory, the load config and
+// a debug directory with RSDS, NB10 and REPRO records; .rsrc holds a three
+// level resource tree. build varies the timestamps and the build-specific
+// GUID and hash like two separate builds would.
+func newNormalizeTestPatcher(t *testing.T, build byte) *Patcher {
+	t.Helper()
+	le := binary.LittleEndian
+	ts := 0x60000000 + uint32(build)
+
+	rdata := make([]byte, 0x164)
+	le.PutUint32(rdata[0x04:], ts) // Export directory
+	le.PutUint32(rdata[0x40:], 0x40)
+	le.PutUint32(rdata[0x44:], ts) // Load config
+	debugEntries := []struct {
+		typ, size, rva uint32
+	}{
+		{IMAGE_DEBUG_TYPE_CODEVIEW, 30, 0x1100},
+		{IMAGE_DEBUG_TYPE_CODEVIEW, 22, 0x1120},
+		{IMAGE_DEBUG_TYPE_REPRO, 36, 0x1140},
+	}
+	for i, e := range debugEntries {
+		entry := rdata[0x80+i*debugDirectoryEntrySize:]
+		le.PutUint32(entry[4:], ts)
+		le.PutUint32(entry[12:], e.typ)
+		le.PutUint32(entry[16:], e.size)
+		le.PutUint32(entry[20:], e.rva)
+		le.PutUint32(entry[24:], e.rva-0x1000+0x400)
+	}
+	copy(rdata[0x100:], "RSDS")
+	copy(rdata[0x104:0x114], bytes.Repeat([]byte{build}, 16))
+	le.PutUint32(rdata[0x114:], 1)
+	copy(rdata[0x118:], "a.pdb")
+	copy(rdata[0x120:], "NB10")
+	le.PutUint32(rdata[0x128:], ts)
+	le.PutUint32(rdata[0x12C:], 1)
+	copy(rdata[0x130:], "b.pdb")
+	le.PutUint32(rdata[0x140:], 32)
+	copy(rdata[0x144:], bytes.Repeat([]byte{build}, 32))
+
+	// Type 3 / name 1 / language 0x409 / data entry
+	rsrc := make([]byte, 0x5C)
+	for i, next := range []uint32{0x80000018, 0x80000030, 0x48} {
+		dir := rsrc[i*0x18:]
+		le.PutUint32(dir[4:], ts)
+		le.PutUint16(dir[14:], 1)
+		le.PutUint32(dir[16:], uint32(i+1))
+		le.PutUint32(dir[20:], next)
+	}
+	le.PutUint32(rsrc[0x48:], 0x2058)
+	le.PutUint32(rsrc[0x4C:], 4)
+	copy(rsrc[0x58:], "DATA")
+
+	p := newTestPatcher(t, 16,
+		testSection{name: ".rdata", characteristics: pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ, data: rdata},
+		testSection{name: ".rsrc", characteristics: pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ, data: rsrc})
+	for _, dir := range []struct {
+		index     int
+		rva, size uint32
+	}{
+		{pe.IMAGE_DIRECTORY_ENTRY_EXPORT, 0x1000, 40},
+		{pe.IMAGE_DIRECTORY_ENTRY_RESOURCE, 0x2000, uint32(len(rsrc))},
+		{pe.IMAGE_DIRECTORY_ENTRY_DEBUG, 0x1080, uint32(len(debugEntries)) * debugDirectoryEntrySize},
+		{dataDirLoadConfig, 0x1040, 0x40},
+	} {
+		if err := p.setDataDirectory(dir.index, dir.rva, dir.size); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.writeUint32(0x40+8, ts); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestNormalize(t *testing.T) {
+	const ts = 1700000000
+	var images [][]byte
+	for _, build := range []byte{1, 2} {
+		p := newNormalizeTestPatcher(t, build)
+		result, err := p.Normalize(NormalizeOptions{Timestamp: ts})
+		if err != nil {
+			t.Fatalf("Normalize() error = %v", err)
+		}
+
+		// COFF, export, three resource directories, load config, three debug
+		// entries and the NB10 signature
+		want := NormalizeResult{Timestamps: 10, CodeViewGUIDs: 1, ReproHashes: 1}
+		if *result != want {
+			t.Errorf("build %d: Normalize() = %+v, want %+v", build, *result, want)
+		}
+
+		if err := p.Reload(); err != nil {
+			t.Fatal(err)
+		}
+		if p.File().TimeDateStamp != ts {
+			t.Errorf("build %d: COFF TimeDateStamp = %d", build, p.File().TimeDateStamp)
+		}
+		checksum := p.File().OptionalHeader.(*pe.OptionalHeader64).CheckSum
+		computed, err := CalculatePEChecksum(p.file, p.filesize, 0x40+24+64)
+		if err != nil || checksum == 0 || checksum != computed {
+			t.Errorf("build %d: CheckSum = 0x%X, computed 0x%X (%v)", build, checksum, computed, err)
+		}
+
+		image, err := os.ReadFile(p.Path())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(image[0x504:0x514], bytes.Repeat([]byte{build}, 16)) || bytes.Equal(image[0x544:0x564], make([]byte, 32)) {
+			t.Errorf("build %d: RSDS GUID or REPRO hash not replaced", build)
+		}
+		if sig := binary.LittleEndian.Uint32(image[0x528:]); sig != ts {
+			t.Errorf("build %d: NB10 signature = %d", build, sig)
+		}
+		images = append(images, image)
+	}
+
+	if !bytes.Equal(images[0], images[1]) {
+		for i := range images[0] {
+			if images[0][i] != images[1][i] {
+				t.Fatalf("normalized images differ at offset 0x%X", i)
+			}
+		}
+	}
+}
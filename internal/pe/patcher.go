@@ -110,6 +110,10 @@ func (p *Patcher) PatchSectionPermissions(sectionName string, newPerms uint32) e
 		return fmt.Errorf("写入节区特征失败: %w", err)
 	}
 
+	// Later edits read the characteristics from the parsed headers
+	if err := p.Reload(); err != nil {
+		return fmt.Errorf("重新加载PE文件失败: %w", err)
+	}
 	return nil
 }
 
@@ -191,6 +195,7 @@ func (p *Patcher) SetSectionPermissions(sectionName string, read, write, execute
 }
 
 // PatchEntryPoint modifies the PE entry point address.
+// In CFG images the new entry point is also registered as a valid call target.
 func (p *Patcher) PatchEntryPoint(newEntryPoint uint32) error {
 	// Read DOS header to get e_lfanew
 	dosHeader := make([]byte, 64)
@@ -219,7 +224,8 @@ func (p *Patcher) PatchEntryPoint(newEntryPoint uint32) error {
 		return fmt.Errorf("写入入口点失败: %w", err)
 	}
 
-	return nil
+	// The loader calls the entry point indirectly; CFG images must list it
+	return p.AddGuardCFTargets(newEntryPoint)
 }
 
 // GetEntryPoint returns the current entry point address.
@@ -237,6 +243,11 @@ func (p *Patcher) File() *pe.File {
 	return p.peFile
 }
 
+// Path returns the path of the file being patched.
+func (p *Patcher) Path() string {
+	return p.filepath
+}
+
 // Reload re-parses the PE file to reflect changes made to disk.
 func (p *Patcher) Reload() error {
 	// Sync file to ensure all writes are flushed
@@ -0,0 +1,114 @@
+package pe
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testSection describes a section of an image built by newTestPatcher.
+type testSection struct {
+	name            string
+	characteristics uint32
+	data            []byte // Raw data, padded to 0x200 bytes
+}
+
+// newTestPatcher writes a minimal x64 image with the given number of data
+// directories and sections to a temporary file and opens it. Section i is
+// mapped at RVA 0x1000*(i+1) with 0x200 bytes of raw data and a VirtualSize
+// covering its data.
+func newTestPatcher(t *testing.T, dirCount uint32, sections ...testSection) *Patcher {
+	t.Helper()
+	const (
+		peOffset    = 0x40
+		headersSize = 0x400
+		rawSize     = 0x200
+	)
+
+	optionalHeaderSize := 112 + 8*dirCount
+	var buf bytes.Buffer
+	dos := make([]byte, peOffset)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[60:], peOffset)
+	buf.Write(dos)
+	buf.WriteString("PE\x00\x00")
+	_ = binary.Write(&buf, binary.LittleEndian, pe.FileHeader{
+		Machine:              pe.IMAGE_FILE_MACHINE_AMD64,
+		NumberOfSections:     uint16(len(sections)),
+		SizeOfOptionalHeader: uint16(optionalHeaderSize),
+		Characteristics:      pe.IMAGE_FILE_EXECUTABLE_IMAGE | pe.IMAGE_FILE_LARGE_ADDRESS_AWARE,
+	})
+
+	oh := pe.OptionalHeader64{
+		Magic:                 0x20B,
+		ImageBase:             0x140000000,
+		SectionAlignment:      0x1000,
+		FileAlignment:         rawSize,
+		MajorSubsystemVersion: 6,
+		SizeOfImage:           uint32(0x1000 * (len(sections) + 1)),
+		SizeOfHeaders:         headersSize,
+		Subsystem:             pe.IMAGE_SUBSYSTEM_WINDOWS_CUI,
+		NumberOfRvaAndSizes:   dirCount,
+	}
+	var ohBuf bytes.Buffer
+	_ = binary.Write(&ohBuf, binary.LittleEndian, oh)
+	buf.Write(ohBuf.Bytes()[:optionalHeaderSize])
+
+	for i, s := range sections {
+		header := pe.SectionHeader32{
+			VirtualSize:      uint32(max(len(s.data), 1)),
+			VirtualAddress:   uint32(0x1000 * (i + 1)),
+			SizeOfRawData:    rawSize,
+			PointerToRawData: uint32(headersSize + rawSize*i),
+			Characteristics:  s.characteristics,
+		}
+		copy(header.Name[:], s.name)
+		_ = binary.Write(&buf, binary.LittleEndian, header)
+	}
+
+	image := make([]byte, headersSize+rawSize*len(sections))
+	copy(image, buf.Bytes())
+	for i, s := range sections {
+		copy(image[headersSize+rawSize*i:], s.data)
+	}
+
+	path := filepath.Join(t.TempDir(), "test.exe")
+	if err := os.WriteFile(path, image, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPatcher(path)
+	if err != nil {
+		t.Fatalf("NewPatcher() error = %v", err)
+	}
+	t.Cleanup(func() { _ = p.Close() })
+	return p
+}
+
+func TestPermissionsThenSectionFlags(t *testing.T) {
+	p := newTestPatcher(t, 16, testSection{
+		name:            ".data",
+		characteristics: pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_WRITE,
+	})
+
+	// -perms R-- followed by -set-flags MEM_SHARED must keep MEM_WRITE cleared
+	if err := p.SetSectionPermissions(".data", true, false, false); err != nil {
+		t.Fatalf("SetSectionPermissions() error = %v", err)
+	}
+	if err := p.ModifySectionCharacteristics(".data", scnMemShared, 0); err != nil {
+		t.Fatalf("ModifySectionCharacteristics() error = %v", err)
+	}
+
+	want := uint32(pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ | scnMemShared)
+	if c := p.File().Sections[0].Characteristics; c != want {
+		t.Errorf("parsed characteristics = 0x%08X, want 0x%08X", c, want)
+	}
+	if err := p.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if c := p.File().Sections[0].Characteristics; c != want {
+		t.Errorf("characteristics on disk = 0x%08X, want 0x%08X", c, want)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"sort"
 )
 
 // RelocationInfo contains base relocation information.
@@ -124,3 +125,81 @@ func GetRelocationTypeName(relocType uint16) string {
 		return fmt.Sprintf("UNKNOWN(%d)", relocType)
 	}
 }
+
+// relocationPageSize is the span covered by one IMAGE_BASE_RELOCATION block.
+const relocationPageSize = 0x1000
+
+// relocatable reports whether the loader can rebase the image, in which case
+// absolute addresses written by a patch need base relocations.
+func relocatable(f *pe.File) bool {
+	rva, size := dataDirectory(f, dataDirBaseReloc)
+	return rva != 0 && size != 0 && f.Characteristics&pe.IMAGE_FILE_RELOCS_STRIPPED == 0
+}
+
+// encodeBaseRelocations builds one relocation block per 4K page for the
+// given RVAs. Blocks are padded to a 4-byte boundary with an ABSOLUTE entry.
+func encodeBaseRelocations(relocType uint16, rvas []uint32) []byte {
+	sorted := append([]uint32(nil), rvas...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	le := binary.LittleEndian
+	var data []byte
+	for i := 0; i < len(sorted); {
+		page := sorted[i] &^ (relocationPageSize - 1)
+		var entries []uint16
+		for ; i < len(sorted) && sorted[i]&^(relocationPageSize-1) == page; i++ {
+			entries = append(entries, relocType<<12|uint16(sorted[i]-page))
+		}
+		if len(entries)%2 != 0 {
+			entries = append(entries, IMAGE_REL_BASED_ABSOLUTE)
+		}
+
+		data = le.AppendUint32(data, page)
+		data = le.AppendUint32(data, uint32(8+2*len(entries)))
+		for _, e := range entries {
+			data = le.AppendUint16(data, e)
+		}
+	}
+	return data
+}
+
+// AddBaseRelocations registers absolute addresses written by a patch so the
+// loader fixes them up when the image is rebased. The existing blocks
+// followed by the new ones are written where allocate finds room, usually
+// the old table's location grown into the slack of .reloc, and data
+// directory 5 is pointed at them. Images that cannot be rebased are left
+// unchanged.
+func (p *Patcher) AddBaseRelocations(relocType uint16, rvas ...uint32) error {
+	if len(rvas) == 0 || !relocatable(p.peFile) {
+		return nil
+	}
+
+	rva, size := dataDirectory(p.peFile, dataDirBaseReloc)
+	existing := make([]byte, size)
+	offset, err := rvaToOffset(p.peFile, rva)
+	if err != nil {
+		return fmt.Errorf("定位重定位表失败: %w", err)
+	}
+	if _, err := p.file.ReadAt(existing, int64(offset)); err != nil {
+		return fmt.Errorf("读取重定位表失败: %w", err)
+	}
+
+	data := append(existing, encodeBaseRelocations(relocType, rvas)...)
+	space, err := p.allocate(allocRequest{
+		section:         ".reloc2",
+		size:            uint32(len(data)),
+		characteristics: pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_DISCARDABLE,
+		old:             pe.DataDirectory{VirtualAddress: rva, Size: size},
+	})
+	if err != nil {
+		return fmt.Errorf("分配重定位表空间失败: %w", err)
+	}
+	if _, err := p.file.WriteAt(data, int64(space.Offset)); err != nil {
+		return fmt.Errorf("写入重定位表失败: %w", err)
+	}
+
+	if err := p.setDataDirectory(dataDirBaseReloc, space.RVA, uint32(len(data))); err != nil {
+		return err
+	}
+	return p.Reload()
+}
@@ -0,0 +1,80 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeBaseRelocations(t *testing.T) {
+	data := encodeBaseRelocations(IMAGE_REL_BASED_DIR64, []uint32{0x3010, 0x2FF8, 0x3000})
+
+	le := binary.LittleEndian
+	var got [][]uint16
+	for off := 0; off < len(data); {
+		page, size := le.Uint32(data[off:]), le.Uint32(data[off+4:])
+		if size%4 != 0 {
+			t.Errorf("block 0x%X size %d not 4-byte aligned", page, size)
+		}
+		block := []uint16{uint16(page >> 12)}
+		for i := off + 8; i < off+int(size); i += 2 {
+			block = append(block, le.Uint16(data[i:]))
+		}
+		got = append(got, block)
+		off += int(size)
+	}
+
+	want := [][]uint16{
+		{0x2, 0xAFF8, 0},
+		{0x3, 0xA000, 0xA010},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("blocks = %X, want %X", got, want)
+	}
+}
+
+func TestAddBaseRelocations(t *testing.T) {
+	p := newTestPatcher(t, 16,
+		testSection{name: ".text", characteristics: pe.IMAGE_SCN_CNT_CODE | pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_EXECUTE, data: []byte{0xC3}},
+		testSection{
+			name:            ".reloc",
+			characteristics: pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_DISCARDABLE,
+			data:            encodeBaseRelocations(IMAGE_REL_BASED_DIR64, []uint32{0x1000}),
+		})
+	if err := p.setDataDirectory(dataDirBaseReloc, 0x2000, 12); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The table grows in place in .reloc until its raw data is full, then
+	// moves to one new section that keeps growing
+	for i := 0; i < 50; i++ {
+		if err := p.AddBaseRelocations(IMAGE_REL_BASED_DIR64, 0x1008+uint32(i)*8); err != nil {
+			t.Fatalf("AddBaseRelocations() #%d error = %v", i, err)
+		}
+		if i == 2 {
+			rva, size := dataDirectory(p.File(), dataDirBaseReloc)
+			if rva != 0x2000 || size != 48 || len(p.File().Sections) != 2 || p.File().Sections[1].VirtualSize != 48 {
+				t.Errorf("after 3 calls: directory 0x%X/%d, %d sections", rva, size, len(p.File().Sections))
+			}
+		}
+	}
+
+	sections := p.File().Sections
+	if len(sections) != 3 || sections[2].Name != ".reloc2" {
+		t.Errorf("%d sections after 50 calls, want .reloc2 added once", len(sections))
+	}
+	info, err := ParseRelocations(p.File(), p.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rva, size := dataDirectory(p.File(), dataDirBaseReloc); rva != sections[len(sections)-1].VirtualAddress || size != 51*12 {
+		t.Errorf("directory = 0x%X/%d", rva, size)
+	}
+	if info.BlockCount != 51 || info.TotalEntries != 102 {
+		t.Errorf("ParseRelocations() = %d blocks, %d entries, want 51 and 102", info.BlockCount, info.TotalEntries)
+	}
+}
@@ -0,0 +1,338 @@
+package pe
+
+import (
+	"bytes"
+	"crypto/md5" //nolint:gosec // Rich header hash is defined as MD5
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/bits"
+	"strings"
+)
+
+// Rich header markers.
+const (
+	richMarker = "Rich"
+	dansMarker = 0x536E6144 // "DanS"
+)
+
+// richLfanewStart and richLfanewEnd delimit e_lfanew, which is excluded
+// from the Rich checksum because the linker writes it afterwards.
+const (
+	richLfanewStart = 0x3C
+	richLfanewEnd   = 0x40
+)
+
+// RichHeader is the decoded Rich header from the DOS stub. It lists every
+// tool (compiler, assembler, linker, ...) that contributed objects to the
+// image, with its build number and object count.
+type RichHeader struct {
+	Offset int // File offset of the DanS marker
+	Size   int // Bytes from DanS through the Rich marker and key
+	// Key is the stored XOR key, which doubles as a checksum over the DOS
+	// header and the records.
+	Key         uint32
+	ComputedKey uint32
+	Entries     []RichEntry
+	// Hash is the MD5 of the decrypted header from DanS up to the Rich
+	// marker, as computed by pefile and reported as rich_pe_header_hash.
+	Hash string
+}
+
+// Valid reports whether the stored key matches the recomputed checksum.
+// A mismatch means the DOS header or records were edited after linking.
+func (h *RichHeader) Valid() bool {
+	return h.Key == h.ComputedKey
+}
+
+// Linker returns the linker record, which identifies the toolchain that
+// produced the final image.
+func (h *RichHeader) Linker() (RichEntry, bool) {
+	for _, e := range h.Entries {
+		if strings.HasPrefix(e.ProductName(), "Linker") {
+			return e, true
+		}
+	}
+	return RichEntry{}, false
+}
+
+// RichEntry is one comp.id record.
+type RichEntry struct {
+	ProductID uint16
+	BuildID   uint16
+	Count     uint32
+}
+
+// CompID returns the packed comp.id value (product ID << 16 | build).
+func (e RichEntry) CompID() uint32 {
+	return uint32(e.ProductID)<<16 | uint32(e.BuildID)
+}
+
+// ParseRichHeader decodes the Rich header in the DOS stub. It returns nil
+// without error when the file has none (e.g. non-Microsoft linkers).
+func ParseRichHeader(r io.ReaderAt) (*RichHeader, error) {
+	dos := make([]byte, 64)
+	if _, err := r.ReadAt(dos, 0); err != nil {
+		return nil, fmt.Errorf("读取DOS头失败: %w", err)
+	}
+
+	peOffset := binary.LittleEndian.Uint32(dos[60:64])
+	if peOffset > 0x10000 {
+		return nil, fmt.Errorf("e_lfanew 无效: 0x%X", peOffset)
+	}
+
+	stub := make([]byte, peOffset)
+	if _, err := r.ReadAt(stub, 0); err != nil {
+		return nil, fmt.Errorf("读取DOS存根失败: %w", err)
+	}
+
+	start, end, ok := findRichHeader(stub)
+	if !ok {
+		return nil, nil
+	}
+	return decodeRichHeader(stub, start, end), nil
+}
+
+// findRichHeader locates the Rich header in the DOS stub: from the XOR-masked
+// "DanS" marker up to and including the "Rich" marker and its key.
+func findRichHeader(stub []byte) (start, end int, ok bool) {
+	rich := bytes.LastIndex(stub, []byte(richMarker))
+	if rich < 0 || rich%4 != 0 || rich+8 > len(stub) {
+		return 0, 0, false
+	}
+
+	key := binary.LittleEndian.Uint32(stub[rich+4:])
+	for off := rich - 4; off >= 0; off -= 4 {
+		if binary.LittleEndian.Uint32(stub[off:])^key == dansMarker {
+			return off, rich + 8, true
+		}
+	}
+	return 0, 0, false
+}
+
+func decodeRichHeader(stub []byte, start, end int) *RichHeader {
+	le := binary.LittleEndian
+	rich := end - 8
+	h := &RichHeader{Offset: start, Size: end - start, Key: le.Uint32(stub[rich+4:])}
+
+	clear := make([]byte, rich-start)
+	for i := 0; i < len(clear); i += 4 {
+		le.PutUint32(clear[i:], le.Uint32(stub[start+i:])^h.Key)
+	}
+
+	// DanS is followed by three zero padding dwords, then 8-byte records
+	for i := 16; i+8 <= len(clear); i += 8 {
+		compID := le.Uint32(clear[i:])
+		h.Entries = append(h.Entries, RichEntry{
+			ProductID: uint16(compID >> 16),
+			BuildID:   uint16(compID),
+			Count:     le.Uint32(clear[i+4:]),
+		})
+	}
+
+	sum := md5.Sum(clear) //nolint:gosec // hash identity, not security
+	h.Hash = hex.EncodeToString(sum[:])
+	h.ComputedKey = richChecksum(stub[:start], h.Entries)
+	return h
+}
+
+// richChecksum computes the Rich key: the DanS offset, plus every DOS stub
+// byte before it rotated by its offset (skipping e_lfanew), plus every comp.id
+// rotated by its count.
+func richChecksum(dos []byte, entries []RichEntry) uint32 {
+	sum := uint32(len(dos))
+	for i, b := range dos {
+		if i >= richLfanewStart && i < richLfanewEnd {
+			continue
+		}
+		sum += bits.RotateLeft32(uint32(b), i)
+	}
+	for _, e := range entries {
+		sum += bits.RotateLeft32(e.CompID(), int(e.Count))
+	}
+	return sum
+}
+
+// encodeRichHeader serializes a Rich header with the given key.
+func encodeRichHeader(entries []RichEntry, key uint32) []byte {
+	le := binary.LittleEndian
+	data := le.AppendUint32(nil, dansMarker^key)
+	for i := 0; i < 3; i++ {
+		data = le.AppendUint32(data, key)
+	}
+	for _, e := range entries {
+		data = le.AppendUint32(data, e.CompID()^key)
+		data = le.AppendUint32(data, e.Count^key)
+	}
+	data = append(data, richMarker...)
+	return le.AppendUint32(data, key)
+}
+
+// RemoveRichHeader zeroes the Rich header in the DOS stub. It reports false
+// if the file has none.
+func (p *Patcher) RemoveRichHeader() (bool, error) {
+	h, err := ParseRichHeader(p.file)
+	if err != nil || h == nil {
+		return false, err
+	}
+
+	if _, err := p.file.WriteAt(make([]byte, h.Size), int64(h.Offset)); err != nil {
+		return false, fmt.Errorf("清除Rich头失败: %w", err)
+	}
+	return true, nil
+}
+
+// FixRichHeader recomputes the Rich key from the current DOS header and
+// records and re-encodes the header with it, so that it validates again
+// after the DOS header has been edited. Returns the new key.
+func (p *Patcher) FixRichHeader() (uint32, error) {
+	h, err := ParseRichHeader(p.file)
+	if err != nil {
+		return 0, err
+	}
+	if h == nil {
+		return 0, fmt.Errorf("文件没有Rich头")
+	}
+
+	dos := make([]byte, h.Offset)
+	if _, err := p.file.ReadAt(dos, 0); err != nil {
+		return 0, fmt.Errorf("读取DOS存根失败: %w", err)
+	}
+
+	key := richChecksum(dos, h.Entries)
+	if _, err := p.file.WriteAt(encodeRichHeader(h.Entries, key), int64(h.Offset)); err != nil {
+		return 0, fmt.Errorf("写入Rich头失败: %w", err)
+	}
+	return key, nil
+}
+
+// richToolKinds is the per-release layout of product IDs used since VS2010
+// SP1: seven tools followed by eleven compiler (Utc) variants.
+var richToolKinds = []string{
+	"AliasObj", "Cvtpgd", "Cvtres", "Export", "Implib", "Linker", "Masm",
+	"Utc_C", "Utc_CPP", "Utc_CVTCIL_C", "Utc_CVTCIL_CPP", "Utc_LTCG_C", "Utc_LTCG_CPP",
+	"Utc_LTCG_MSIL", "Utc_POGO_I_C", "Utc_POGO_I_CPP", "Utc_POGO_O_C", "Utc_POGO_O_CPP",
+}
+
+// richToolGroup is a block of product IDs laid out as richToolKinds.
+type richToolGroup struct {
+	base    uint16
+	tools   string // Version suffix for linker, MASM, ...
+	utc     string // Version suffix for the compiler and Cvtpgd
+	release string // Empty if it must be derived from the build number
+}
+
+var richToolGroups = []richToolGroup{
+	{0x00FD, "1400", "1900", ""},
+	{0x00EB, "1210", "1810", "VS2013"},
+	{0x00D9, "1200", "1800", "VS2013"},
+	{0x00C7, "1100", "1700", "VS2012"},
+	{0x00B5, "1010", "1610", "VS2010 SP1"},
+}
+
+// richLegacyNames names the VS2008 and VS2010 RTM product IDs, which predate
+// the regular layout.
+var richLegacyNames = func() map[uint16]string {
+	names := make(map[uint16]string)
+	utc := make([]string, 0, 11)
+	for _, kind := range richToolKinds[7:] {
+		utc = append(utc, kind[3:])
+	}
+
+	utc1500 := []string{
+		"_C", "_CPP", "_C_Std", "_CPP_Std", "_CVTCIL_C", "_CVTCIL_CPP", "_LTCG_C",
+		"_LTCG_CPP", "_LTCG_MSIL", "_POGO_I_C", "_POGO_I_CPP", "_POGO_O_C", "_POGO_O_CPP",
+	}
+	for i, suffix := range utc1500 {
+		names[0x0083+uint16(i)] = "Utc1500" + suffix
+	}
+	for i, name := range []string{
+		"Cvtpgd1500", "Linker900", "Export900", "Implib900", "Cvtres900", "Masm900", "AliasObj900", "Resource",
+		"AliasObj1000", "Cvtpgd1600", "Cvtres1000", "Export1000", "Implib1000", "Linker1000", "Masm1000",
+	} {
+		names[0x0090+uint16(i)] = name
+	}
+	for i, suffix := range utc {
+		names[0x009F+uint16(i)] = "Phx1600" + suffix
+		names[0x00AA+uint16(i)] = "Utc1600" + suffix
+	}
+	return names
+}()
+
+// richReleaseRanges maps older product ID ranges, which predate the regular
+// layout, to Visual Studio releases.
+var richReleaseRanges = []struct {
+	first, last uint16
+	release     string
+}{
+	{0x0098, 0x00B4, "VS2010"},
+	{0x0083, 0x0097, "VS2008"},
+	{0x006D, 0x0082, "VS2005"},
+	{0x005A, 0x006C, "VS2003"},
+	{0x0019, 0x0059, "VS2002"},
+	{0x0002, 0x0018, "VS6"},
+}
+
+// ProductName returns the Microsoft tool name for the product ID, such as
+// "Utc1900_CPP" or "Linker1400".
+func (e RichEntry) ProductName() string {
+	switch e.ProductID {
+	case 0x0000:
+		return "Unknown"
+	case 0x0001:
+		return "Import0"
+	}
+
+	if g, kind, ok := e.toolGroup(); ok {
+		switch {
+		case kind == "Cvtpgd":
+			return kind + g.utc
+		case strings.HasPrefix(kind, "Utc"):
+			return "Utc" + g.utc + kind[3:]
+		default:
+			return kind + g.tools
+		}
+	}
+	if name, ok := richLegacyNames[e.ProductID]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04X", e.ProductID)
+}
+
+// VisualStudioVersion returns the Visual Studio release that shipped the
+// tool, or an empty string if it is unknown. The VS2015 and later toolsets
+// share product IDs and are told apart by build number.
+func (e RichEntry) VisualStudioVersion() string {
+	if g, _, ok := e.toolGroup(); ok {
+		if g.release != "" {
+			return g.release
+		}
+		switch {
+		case e.BuildID < 25000:
+			return "VS2015"
+		case e.BuildID < 27500:
+			return "VS2017"
+		case e.BuildID < 30500:
+			return "VS2019"
+		default:
+			return "VS2022"
+		}
+	}
+
+	for _, r := range richReleaseRanges {
+		if e.ProductID >= r.first && e.ProductID <= r.last {
+			return r.release
+		}
+	}
+	return ""
+}
+
+func (e RichEntry) toolGroup() (richToolGroup, string, bool) {
+	for _, g := range richToolGroups {
+		if e.ProductID >= g.base && int(e.ProductID-g.base) < len(richToolKinds) {
+			return g, richToolKinds[e.ProductID-g.base], true
+		}
+	}
+	return richToolGroup{}, "", false
+}
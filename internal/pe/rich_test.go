@@ -0,0 +1,99 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+var testRichEntries = []RichEntry{
+	{ProductID: 0x0105, BuildID: 32420, Count: 19},
+	{ProductID: 0x0001, BuildID: 0, Count: 66},
+	{ProductID: 0x0102, BuildID: 32532, Count: 1},
+}
+
+// richStub builds a DOS stub with a Rich header at 0x80 signed with key.
+func richStub(key uint32) []byte {
+	stub := make([]byte, 0x80)
+	copy(stub, "MZ")
+	stub = append(stub, encodeRichHeader(testRichEntries, key)...)
+	stub = append(stub, make([]byte, 8)...)
+	binary.LittleEndian.PutUint32(stub[0x3C:], uint32(len(stub)))
+	return stub
+}
+
+func TestFindRichHeader(t *testing.T) {
+	stub := richStub(0x9A1B2C3D)
+	size := 16 + 8*len(testRichEntries) + 8
+
+	start, end, ok := findRichHeader(stub)
+	if !ok || start != 0x80 || end != 0x80+size {
+		t.Errorf("findRichHeader() = %#x, %#x, %v; want 0x80, %#x, true", start, end, ok, 0x80+size)
+	}
+
+	if _, _, ok := findRichHeader(make([]byte, 0x100)); ok {
+		t.Error("findRichHeader() found a header in an empty stub")
+	}
+}
+
+func TestParseRichHeader(t *testing.T) {
+	key := richChecksum(richStub(0)[:0x80], testRichEntries)
+	h, err := ParseRichHeader(bytes.NewReader(richStub(key)))
+	if err != nil || h == nil {
+		t.Fatalf("ParseRichHeader() = %v, %v", h, err)
+	}
+
+	if !reflect.DeepEqual(h.Entries, testRichEntries) {
+		t.Errorf("Entries = %+v, want %+v", h.Entries, testRichEntries)
+	}
+	if !h.Valid() {
+		t.Errorf("Valid() = false (key 0x%08X, computed 0x%08X)", h.Key, h.ComputedKey)
+	}
+	if len(h.Hash) != 32 {
+		t.Errorf("Hash = %q, want 32 hex digits", h.Hash)
+	}
+
+	// The checksum covers the DOS header but not e_lfanew
+	stub := richStub(key)
+	stub[0x3C] -= 4
+	if h, _ := ParseRichHeader(bytes.NewReader(stub)); !h.Valid() {
+		t.Error("editing e_lfanew invalidated the key")
+	}
+	stub[0x02] = 0x90
+	if h, _ := ParseRichHeader(bytes.NewReader(stub)); h.Valid() {
+		t.Error("editing the DOS header kept the key valid")
+	}
+
+	if h, err := ParseRichHeader(bytes.NewReader(make([]byte, 0x100))); h != nil || err != nil {
+		t.Errorf("ParseRichHeader(no header) = %v, %v; want nil, nil", h, err)
+	}
+}
+
+func TestRichEntryNames(t *testing.T) {
+	tests := []struct {
+		entry   RichEntry
+		name    string
+		release string
+	}{
+		{RichEntry{ProductID: 0x0105, BuildID: 32420}, "Utc1900_CPP", "VS2022"},
+		{RichEntry{ProductID: 0x0102, BuildID: 24215}, "Linker1400", "VS2015"},
+		{RichEntry{ProductID: 0x0104, BuildID: 27045}, "Utc1900_C", "VS2017"},
+		{RichEntry{ProductID: 0x00FF, BuildID: 29913}, "Cvtres1400", "VS2019"},
+		{RichEntry{ProductID: 0x00FE, BuildID: 30795}, "Cvtpgd1900", "VS2022"},
+		{RichEntry{ProductID: 0x00DE, BuildID: 21005}, "Linker1200", "VS2013"},
+		{RichEntry{ProductID: 0x00AA, BuildID: 40219}, "Utc1600_C", "VS2010"},
+		{RichEntry{ProductID: 0x0093, BuildID: 30729}, "Implib900", "VS2008"},
+		{RichEntry{ProductID: 0x0001}, "Import0", ""},
+		{RichEntry{ProductID: 0x0400}, "0x0400", ""},
+	}
+
+	for _, tt := range tests {
+		if got := tt.entry.ProductName(); got != tt.name {
+			t.Errorf("ProductName(0x%04X) = %s, want %s", tt.entry.ProductID, got, tt.name)
+		}
+		if got := tt.entry.VisualStudioVersion(); got != tt.release {
+			t.Errorf("VisualStudioVersion(0x%04X, %d) = %q, want %q", tt.entry.ProductID, tt.entry.BuildID, got, tt.release)
+		}
+	}
+}
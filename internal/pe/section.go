@@ -87,6 +87,12 @@ func (s *SectionInjector) InjectSection(name string, data []byte, characteristic
 	binary.LittleEndian.PutUint16(sectionHeader[34:36], 0)                 // NumberOfLinenumbers.
 	binary.LittleEndian.PutUint32(sectionHeader[36:40], characteristics)   // Characteristics.
 
+	// Bound import data is usually stored right after the section table,
+	// where the new header goes.
+	if err := s.patcher.stripBoundImportsOverlapping(newSectionHeaderOffset, newSectionHeaderOffset+40); err != nil {
+		return err
+	}
+
 	// Write section header.
 	_, err = s.patcher.file.WriteAt(sectionHeader, newSectionHeaderOffset)
 	if err != nil {
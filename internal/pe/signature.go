@@ -1,6 +1,8 @@
 package pe
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"debug/pe"
@@ -8,14 +10,19 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math/big"
 	"time"
 )
 
 // SignatureInfo contains PE signature information.
 type SignatureInfo struct {
 	IsSigned        bool
-	Certificates    []CertificateInfo
-	SigningTime     time.Time
+	Certificates    []CertificateInfo // Including those carried by an RFC 3161 timestamp
+	Signer          *CertificateInfo  // Certificate named by the SignerInfo, nil if not included
+	Verified        bool              // The signer's signature and the image digest check out
+	VerifyError     string            // Why verification failed
+	SigningTime     time.Time         // Time of a verified timestamp, zero without one
+	Timestamper     *CertificateInfo  // Certificate of the verified timestamp's signer
 	DigestAlgorithm string
 }
 
@@ -26,7 +33,8 @@ type CertificateInfo struct {
 	SerialNumber string
 	NotBefore    time.Time
 	NotAfter     time.Time
-	IsValid      bool
+	IsValid      bool   // At SigningTime, or now for an untimestamped signature
+	Raw          []byte // DER encoding
 }
 
 // WIN_CERTIFICATE structure.
@@ -95,11 +103,17 @@ func VerifySignature(f *pe.File, r io.ReaderAt) (*SignatureInfo, error) {
 	}
 
 	// Parse PKCS#7 signature
-	err = parsePKCS7(certData, info)
+	signed, err := parsePKCS7(certData, info)
 	if err != nil {
 		return info, fmt.Errorf("解析PKCS#7签名失败: %w", err)
 	}
 
+	if err := verifyAuthenticode(f, r, secDirRVA, signed); err != nil {
+		info.VerifyError = err.Error()
+	} else {
+		info.Verified = true
+	}
+
 	return info, nil
 }
 
@@ -114,22 +128,88 @@ type signedData struct {
 	Version          int
 	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
 	ContentInfo      contentInfo
-	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
-	SignerInfos      []interface{} `asn1:"set"`
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []asn1.RawValue `asn1:"set"`
+}
+
+// PKCS#7 SignerInfo structure.
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerial           issuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// Authenticode SpcIndirectDataContent, the signed content holding the
+// image hash.
+type spcIndirectDataContent struct {
+	Data          asn1.RawValue
+	MessageDigest digestInfo
 }
 
-func parsePKCS7(data []byte, info *SignatureInfo) error {
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+// RFC 3161 TSTInfo, up to the fields used.
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint digestInfo
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+var (
+	oidMessageDigest    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidCounterSignature = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 6}
+	oidRFC3161Timestamp = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 3, 3, 1}
+)
+
+// digestHashes maps digest algorithm OIDs to hashes.
+var digestHashes = map[string]crypto.Hash{
+	"1.3.14.3.2.26":          crypto.SHA1,
+	"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+	"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+	"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+}
+
+// signedContent is what the first SignerInfo vouches for.
+type signedContent struct {
+	signer  *signerInfo
+	cert    *x509.Certificate // Signer's certificate, nil if not included
+	content []byte            // SpcIndirectDataContent without its tag and length
+	digest  digestInfo        // Image hash recorded in the content
+}
+
+func parsePKCS7(data []byte, info *SignatureInfo) (*signedContent, error) {
 	var content contentInfo
 	_, err := asn1.Unmarshal(data, &content)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Parse SignedData
 	var signed signedData
 	_, err = asn1.Unmarshal(content.Content.Bytes, &signed)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Extract digest algorithm
@@ -137,27 +217,399 @@ func parsePKCS7(data []byte, info *SignatureInfo) error {
 		info.DigestAlgorithm = signed.DigestAlgorithms[0].Algorithm.String()
 	}
 
+	// Content keeps its [0] tag; the signed bytes are those of the
+	// SpcIndirectDataContent inside, without its own tag and length
+	result := &signedContent{}
+	var spc asn1.RawValue
+	if _, err := asn1.Unmarshal(signed.ContentInfo.Content.Bytes, &spc); err == nil {
+		result.content = spc.Bytes
+	}
+	var indirectData spcIndirectDataContent
+	if _, err := asn1.Unmarshal(signed.ContentInfo.Content.Bytes, &indirectData); err == nil {
+		result.digest = indirectData.MessageDigest
+	}
+	if len(signed.SignerInfos) > 0 {
+		var si signerInfo
+		if _, err := asn1.Unmarshal(signed.SignerInfos[0].FullBytes, &si); err == nil {
+			result.signer = &si
+		}
+	}
+
 	// Parse certificates
-	if signed.Certificates.Bytes != nil {
-		certs, err := x509.ParseCertificates(signed.Certificates.Bytes)
-		if err == nil {
-			for _, cert := range certs {
-				certInfo := CertificateInfo{
-					Subject:      cert.Subject.String(),
-					Issuer:       cert.Issuer.String(),
-					SerialNumber: fmt.Sprintf("%X", cert.SerialNumber),
-					NotBefore:    cert.NotBefore,
-					NotAfter:     cert.NotAfter,
-					IsValid:      time.Now().After(cert.NotBefore) && time.Now().Before(cert.NotAfter),
-				}
-				info.Certificates = append(info.Certificates, certInfo)
-			}
+	certs := parseCertificates(signed.Certificates.Bytes)
+	for _, cert := range certs {
+		if result.signer != nil && result.signer.issuedTo(cert) {
+			result.cert = cert
+			break
+		}
+	}
+
+	// A timestamp that checks out moves the validity check to its time; an
+	// invalid one is ignored like a missing one
+	var ts *countersignature
+	if result.signer != nil {
+		ts, _ = result.signer.countersignature(certs)
+	}
+	validAt := time.Now()
+	if ts != nil {
+		info.SigningTime = ts.time
+		validAt = ts.time
+		certs = append(certs, ts.certs...)
+	}
+
+	signerIndex, timestamperIndex := -1, -1
+	for _, cert := range certs {
+		if cert == result.cert {
+			signerIndex = len(info.Certificates)
+		}
+		if ts != nil && cert == ts.cert {
+			timestamperIndex = len(info.Certificates)
+		}
+
+		certInfo := CertificateInfo{
+			Subject:      cert.Subject.String(),
+			Issuer:       cert.Issuer.String(),
+			SerialNumber: fmt.Sprintf("%X", cert.SerialNumber),
+			NotBefore:    cert.NotBefore,
+			NotAfter:     cert.NotAfter,
+			IsValid:      validAt.After(cert.NotBefore) && validAt.Before(cert.NotAfter),
+			Raw:          cert.Raw,
+		}
+		info.Certificates = append(info.Certificates, certInfo)
+	}
+	if signerIndex >= 0 {
+		info.Signer = &info.Certificates[signerIndex]
+	}
+	if timestamperIndex >= 0 {
+		info.Timestamper = &info.Certificates[timestamperIndex]
+	}
+
+	return result, nil
+}
+
+// parseCertificates parses a sequence of DER certificates, skipping those
+// crypto/x509 rejects so one malformed certificate doesn't hide the rest.
+func parseCertificates(der []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for len(der) > 0 {
+		var raw asn1.RawValue
+		rest, err := asn1.Unmarshal(der, &raw)
+		if err != nil {
+			break
+		}
+		if cert, err := x509.ParseCertificate(raw.FullBytes); err == nil {
+			certs = append(certs, cert)
+		}
+		der = rest
+	}
+	return certs
+}
+
+// issuedTo reports whether cert is the one the SignerInfo names.
+func (si *signerInfo) issuedTo(cert *x509.Certificate) bool {
+	return si.IssuerAndSerial.Serial != nil && cert.SerialNumber.Cmp(si.IssuerAndSerial.Serial) == 0 &&
+		bytes.Equal(cert.RawIssuer, si.IssuerAndSerial.Issuer.FullBytes)
+}
+
+// verifyAuthenticode checks the signer's signature over the signed content
+// and that the image hash recorded in it matches the file.
+func verifyAuthenticode(f *pe.File, r io.ReaderAt, certOffset uint32, signed *signedContent) error {
+	switch {
+	case signed.signer == nil:
+		return fmt.Errorf("无法解析签名者信息")
+	case signed.cert == nil:
+		return fmt.Errorf("证书中没有签名者的证书")
+	}
+	if err := signed.signer.verify(signed.cert, signed.content); err != nil {
+		return err
+	}
+
+	h, ok := digestHashes[signed.digest.Algorithm.Algorithm.String()]
+	if !ok || !h.Available() {
+		return fmt.Errorf("不支持的映像摘要算法 %s", signed.digest.Algorithm.Algorithm)
+	}
+	digest, err := imageDigest(f, r, certOffset, h)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(digest, signed.digest.Digest) {
+		return fmt.Errorf("映像摘要不匹配，文件在签名后被修改")
+	}
+	return nil
+}
+
+// verify checks the signature of the SignerInfo over content. With
+// authenticated attributes the signature covers the attributes, whose
+// messageDigest must be the hash of content.
+func (si *signerInfo) verify(cert *x509.Certificate, content []byte) error {
+	h, ok := digestHashes[si.DigestAlgorithm.Algorithm.String()]
+	if !ok || !h.Available() {
+		return fmt.Errorf("不支持的摘要算法 %s", si.DigestAlgorithm.Algorithm)
+	}
+
+	signed := content
+	if len(si.AuthenticatedAttributes.FullBytes) > 0 {
+		digest, err := messageDigestAttribute(si.AuthenticatedAttributes.Bytes)
+		if err != nil {
+			return err
+		}
+		hash := h.New()
+		hash.Write(content)
+		if !bytes.Equal(hash.Sum(nil), digest) {
+			return fmt.Errorf("已签名属性中的消息摘要与签名内容不符")
+		}
+		// The attributes are signed as a SET, not with their implicit [0] tag
+		signed = append([]byte{0x31}, si.AuthenticatedAttributes.FullBytes[1:]...)
+	}
+
+	algorithm := signatureAlgorithm(cert.PublicKeyAlgorithm, h)
+	if algorithm == x509.UnknownSignatureAlgorithm {
+		return fmt.Errorf("不支持的签名算法 %s", cert.PublicKeyAlgorithm)
+	}
+	if err := cert.CheckSignature(algorithm, signed, si.EncryptedDigest); err != nil {
+		return fmt.Errorf("签名者的签名无效: %w", err)
+	}
+	return nil
+}
+
+// messageDigestAttribute returns the messageDigest authenticated attribute.
+func messageDigestAttribute(attrs []byte) ([]byte, error) {
+	value, err := findAttribute(attrs, oidMessageDigest)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, fmt.Errorf("已签名属性中没有消息摘要")
+	}
+	var digest []byte
+	if _, err := asn1.Unmarshal(value, &digest); err != nil {
+		return nil, fmt.Errorf("解析消息摘要失败: %w", err)
+	}
+	return digest, nil
+}
+
+// findAttribute returns the first value of the attribute with the given
+// type, or nil if attrs has none.
+func findAttribute(attrs []byte, oid asn1.ObjectIdentifier) ([]byte, error) {
+	for len(attrs) > 0 {
+		var attr attribute
+		rest, err := asn1.Unmarshal(attrs, &attr)
+		if err != nil {
+			return nil, fmt.Errorf("解析签名属性失败: %w", err)
+		}
+		if attr.Type.Equal(oid) {
+			return attr.Values.Bytes, nil
+		}
+		attrs = rest
+	}
+	return nil, nil
+}
+
+// countersignature is a verified timestamp over the signer's signature.
+type countersignature struct {
+	time  time.Time
+	cert  *x509.Certificate   // Timestamp signer's certificate
+	certs []*x509.Certificate // Certificates carried by an RFC 3161 timestamp
+}
+
+// countersignature finds the timestamp in the unauthenticated attributes,
+// either a PKCS#9 countersignature signed by one of certs or an RFC 3161
+// timestamp token, and verifies it covers the signer's signature. It
+// returns nil if the signature is not timestamped.
+func (si *signerInfo) countersignature(certs []*x509.Certificate) (*countersignature, error) {
+	attrs := si.UnauthenticatedAttributes.Bytes
+	value, err := findAttribute(attrs, oidCounterSignature)
+	if err != nil {
+		return nil, err
+	}
+	if value != nil {
+		return si.pkcs9Timestamp(value, certs)
+	}
+	value, err = findAttribute(attrs, oidRFC3161Timestamp)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	return si.rfc3161Timestamp(value)
+}
+
+// pkcs9Timestamp verifies a countersignature SignerInfo, whose signed
+// content is the signer's encrypted digest.
+func (si *signerInfo) pkcs9Timestamp(value []byte, certs []*x509.Certificate) (*countersignature, error) {
+	var counter signerInfo
+	if _, err := asn1.Unmarshal(value, &counter); err != nil {
+		return nil, fmt.Errorf("解析副署签名失败: %w", err)
+	}
+	var cert *x509.Certificate
+	for _, c := range certs {
+		if counter.issuedTo(c) {
+			cert = c
+			break
+		}
+	}
+	if cert == nil {
+		return nil, fmt.Errorf("证书中没有副署者的证书")
+	}
+	if err := counter.verify(cert, si.EncryptedDigest); err != nil {
+		return nil, err
+	}
+
+	signingTime, err := findAttribute(counter.AuthenticatedAttributes.Bytes, oidSigningTime)
+	if err != nil || signingTime == nil {
+		return nil, fmt.Errorf("副署签名中没有签名时间")
+	}
+	result := &countersignature{cert: cert}
+	if _, err := asn1.Unmarshal(signingTime, &result.time); err != nil {
+		return nil, fmt.Errorf("解析签名时间失败: %w", err)
+	}
+	return result, nil
+}
+
+// rfc3161Timestamp verifies a timestamp token, a SignedData over a TSTInfo
+// whose message imprint is the hash of the signer's encrypted digest.
+func (si *signerInfo) rfc3161Timestamp(value []byte) (*countersignature, error) {
+	var token contentInfo
+	if _, err := asn1.Unmarshal(value, &token); err != nil {
+		return nil, fmt.Errorf("解析时间戳失败: %w", err)
+	}
+	var signed signedData
+	if _, err := asn1.Unmarshal(token.Content.Bytes, &signed); err != nil {
+		return nil, fmt.Errorf("解析时间戳失败: %w", err)
+	}
+	if len(signed.SignerInfos) == 0 {
+		return nil, fmt.Errorf("时间戳中没有签名者信息")
+	}
+	var counter signerInfo
+	if _, err := asn1.Unmarshal(signed.SignerInfos[0].FullBytes, &counter); err != nil {
+		return nil, fmt.Errorf("解析时间戳签名者失败: %w", err)
+	}
+
+	// The eContent is an OCTET STRING holding the DER TSTInfo
+	var content []byte
+	if _, err := asn1.Unmarshal(signed.ContentInfo.Content.Bytes, &content); err != nil {
+		return nil, fmt.Errorf("解析时间戳内容失败: %w", err)
+	}
+	var tst tstInfo
+	if _, err := asn1.Unmarshal(content, &tst); err != nil {
+		return nil, fmt.Errorf("解析时间戳内容失败: %w", err)
+	}
+
+	result := &countersignature{time: tst.GenTime, certs: parseCertificates(signed.Certificates.Bytes)}
+	for _, c := range result.certs {
+		if counter.issuedTo(c) {
+			result.cert = c
+			break
 		}
 	}
+	if result.cert == nil {
+		return nil, fmt.Errorf("时间戳中没有签名者的证书")
+	}
+	if err := counter.verify(result.cert, content); err != nil {
+		return nil, err
+	}
 
+	h, ok := digestHashes[tst.MessageImprint.Algorithm.Algorithm.String()]
+	if !ok || !h.Available() {
+		return nil, fmt.Errorf("不支持的时间戳摘要算法 %s", tst.MessageImprint.Algorithm.Algorithm)
+	}
+	hash := h.New()
+	hash.Write(si.EncryptedDigest)
+	if !bytes.Equal(hash.Sum(nil), tst.MessageImprint.Digest) {
+		return nil, fmt.Errorf("时间戳与签名不符")
+	}
+	return result, nil
+}
+
+// VerifyChain checks that the signer's certificate chains to roots, or to
+// the system roots if roots is nil, through the certificates embedded in
+// the signature. The timestamp signer's chain is checked too, and both at
+// SigningTime when the signature is timestamped.
+func (s *SignatureInfo) VerifyChain(roots *x509.CertPool) error {
+	if s.Signer == nil {
+		return fmt.Errorf("证书中没有签名者的证书")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range s.Certificates {
+		cert, err := x509.ParseCertificate(c.Raw)
+		if err != nil {
+			return fmt.Errorf("解析证书 %s 失败: %w", c.Subject, err)
+		}
+		intermediates.AddCert(cert)
+	}
+	at := s.SigningTime
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	verify := func(c *CertificateInfo, usage x509.ExtKeyUsage) error {
+		cert, err := x509.ParseCertificate(c.Raw)
+		if err != nil {
+			return err
+		}
+		_, err = cert.Verify(x509.VerifyOptions{
+			Intermediates: intermediates,
+			Roots:         roots,
+			CurrentTime:   at,
+			KeyUsages:     []x509.ExtKeyUsage{usage},
+		})
+		return err
+	}
+	if err := verify(s.Signer, x509.ExtKeyUsageCodeSigning); err != nil {
+		return fmt.Errorf("签名者证书链无效: %w", err)
+	}
+	if s.Timestamper != nil {
+		if err := verify(s.Timestamper, x509.ExtKeyUsageTimeStamping); err != nil {
+			return fmt.Errorf("时间戳证书链无效: %w", err)
+		}
+	}
 	return nil
 }
 
+// signatureAlgorithm returns the x509 signature algorithm for a key type
+// and hash.
+func signatureAlgorithm(key x509.PublicKeyAlgorithm, h crypto.Hash) x509.SignatureAlgorithm {
+	algorithms := map[x509.PublicKeyAlgorithm]map[crypto.Hash]x509.SignatureAlgorithm{
+		x509.RSA: {
+			crypto.SHA1: x509.SHA1WithRSA, crypto.SHA256: x509.SHA256WithRSA,
+			crypto.SHA384: x509.SHA384WithRSA, crypto.SHA512: x509.SHA512WithRSA,
+		},
+		x509.ECDSA: {
+			crypto.SHA1: x509.ECDSAWithSHA1, crypto.SHA256: x509.ECDSAWithSHA256,
+			crypto.SHA384: x509.ECDSAWithSHA384, crypto.SHA512: x509.ECDSAWithSHA512,
+		},
+	}
+	return algorithms[key][h]
+}
+
+// imageDigest computes the Authenticode hash of the image: the file up to
+// the certificate table, without the CheckSum field and the certificate
+// table directory entry.
+func imageDigest(f *pe.File, r io.ReaderAt, certOffset uint32, h crypto.Hash) ([]byte, error) {
+	dosHeader := make([]byte, 64)
+	if _, err := r.ReadAt(dosHeader, 0); err != nil {
+		return nil, fmt.Errorf("读取DOS头失败: %w", err)
+	}
+	optOffset := int64(binary.LittleEndian.Uint32(dosHeader[60:64])) + 24
+	dirOff := int64(optDataDirectoryOff32)
+	if _, ok := f.OptionalHeader.(*pe.OptionalHeader64); ok {
+		dirOff = optDataDirectoryOff64
+	}
+	checksumOffset := optOffset + 64
+	certDirOffset := optOffset + dirOff + 4*8
+	if int64(certOffset) < certDirOffset+8 {
+		return nil, fmt.Errorf("证书表位置无效: 0x%X", certOffset)
+	}
+
+	hash := h.New()
+	for _, part := range [][2]int64{{0, checksumOffset}, {checksumOffset + 4, certDirOffset}, {certDirOffset + 8, int64(certOffset)}} {
+		n, err := io.Copy(hash, io.NewSectionReader(r, part[0], part[1]-part[0]))
+		if err != nil || n != part[1]-part[0] {
+			return nil, fmt.Errorf("读取映像数据失败")
+		}
+	}
+	return hash.Sum(nil), nil
+}
+
 // SignatureRemover handles digital signature removal.
 type SignatureRemover struct {
 	patcher *Patcher
@@ -0,0 +1,304 @@
+package pe
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"debug/pe"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSigner is a self-signed code signing certificate and its key.
+type testSigner struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestSigner(t *testing.T, name string, serial int64) testSigner {
+	t.Helper()
+	return newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+}
+
+func newTestCertificate(t *testing.T, template *x509.Certificate) testSigner {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testSigner{key: key, cert: cert}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func contextTag(tag int, der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: der}
+}
+
+var testSHA256 = pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, Parameters: asn1.NullRawValue}
+
+// newTestSignerInfo signs content by s, naming the signer by serial. The
+// authenticated attributes hold the content's messageDigest and attrs.
+func newTestSignerInfo(t *testing.T, s testSigner, serial int64, content []byte, attrs ...attribute) signerInfo {
+	t.Helper()
+	contentDigest := sha256.Sum256(content)
+	attrs = append([]attribute{{
+		Type:   oidMessageDigest,
+		Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: mustMarshal(t, contentDigest[:])},
+	}}, attrs...)
+	var attrBytes []byte
+	for _, attr := range attrs {
+		attrBytes = append(attrBytes, mustMarshal(t, attr)...)
+	}
+	attrsDigest := sha256.Sum256(mustMarshal(t, asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrBytes}))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, attrsDigest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signerInfo{
+		Version:                   1,
+		IssuerAndSerial:           issuerAndSerial{Issuer: asn1.RawValue{FullBytes: s.cert.RawIssuer}, Serial: big.NewInt(serial)},
+		DigestAlgorithm:           testSHA256,
+		AuthenticatedAttributes:   contextTag(0, attrBytes),
+		DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}, Parameters: asn1.NullRawValue},
+		EncryptedDigest:           signature,
+	}
+}
+
+// signTestImage appends an Authenticode signature by s to image, naming the
+// signer by serial and including certs in the SignedData.
+func signTestImage(t *testing.T, image []byte, s testSigner, serial int64, certs ...*x509.Certificate) []byte {
+	t.Helper()
+
+	// Image hash without CheckSum and the certificate table entry
+	optOffset := int(binary.LittleEndian.Uint32(image[60:])) + 24
+	checksum, certDir := optOffset+64, optOffset+optDataDirectoryOff64+4*8
+	hash := sha256.New()
+	hash.Write(image[:checksum])
+	hash.Write(image[checksum+4 : certDir])
+	hash.Write(image[certDir+8:])
+
+	spc := mustMarshal(t, spcIndirectDataContent{
+		Data:          asn1.RawValue{FullBytes: mustMarshal(t, struct{ Type asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 15}})},
+		MessageDigest: digestInfo{Algorithm: testSHA256, Digest: hash.Sum(nil)},
+	})
+	var spcValue asn1.RawValue
+	if _, err := asn1.Unmarshal(spc, &spcValue); err != nil {
+		t.Fatal(err)
+	}
+	si := newTestSignerInfo(t, s, serial, spcValue.Bytes)
+
+	var certBytes []byte
+	for _, c := range certs {
+		certBytes = append(certBytes, c.Raw...)
+	}
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{testSHA256},
+		ContentInfo:      contentInfo{ContentType: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}, Content: contextTag(0, spc)},
+		Certificates:     contextTag(0, certBytes),
+		SignerInfos:      []asn1.RawValue{{FullBytes: mustMarshal(t, si)}},
+	}
+	return setTestSignature(t, image, sd)
+}
+
+// setTestSignature replaces the certificate table of image, which must be
+// at its end, with one holding sd.
+func setTestSignature(t *testing.T, image []byte, sd signedData) []byte {
+	t.Helper()
+	certDir := int(binary.LittleEndian.Uint32(image[60:])) + 24 + optDataDirectoryOff64 + 4*8
+	if offset := binary.LittleEndian.Uint32(image[certDir:]); offset != 0 {
+		image = image[:offset]
+	}
+
+	pkcs7 := mustMarshal(t, contentInfo{ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}, Content: contextTag(0, mustMarshal(t, sd))})
+	table := make([]byte, alignUp(uint32(8+len(pkcs7)), 8))
+	binary.LittleEndian.PutUint32(table[0:], uint32(8+len(pkcs7)))
+	binary.LittleEndian.PutUint16(table[4:], WIN_CERT_REVISION_2_0)
+	binary.LittleEndian.PutUint16(table[6:], WIN_CERT_TYPE_PKCS_SIGNED_DATA)
+	copy(table[8:], pkcs7)
+
+	signed := append(bytes.Clone(image), table...)
+	binary.LittleEndian.PutUint32(signed[certDir:], uint32(len(image)))
+	binary.LittleEndian.PutUint32(signed[certDir+4:], uint32(len(table)))
+	return signed
+}
+
+// timestampTestImage adds a PKCS#9 countersignature by tsa at signingTime
+// to the signature of a signTestImage image.
+func timestampTestImage(t *testing.T, signed []byte, tsa testSigner, serial int64, signingTime time.Time) []byte {
+	t.Helper()
+	offset := binary.LittleEndian.Uint32(signed[int(binary.LittleEndian.Uint32(signed[60:]))+24+optDataDirectoryOff64+4*8:])
+	var content contentInfo
+	if _, err := asn1.Unmarshal(signed[offset+8:], &content); err != nil {
+		t.Fatal(err)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(content.Content.Bytes, &sd); err != nil {
+		t.Fatal(err)
+	}
+	var si signerInfo
+	if _, err := asn1.Unmarshal(sd.SignerInfos[0].FullBytes, &si); err != nil {
+		t.Fatal(err)
+	}
+
+	counter := newTestSignerInfo(t, tsa, serial, si.EncryptedDigest, attribute{
+		Type:   oidSigningTime,
+		Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: mustMarshal(t, signingTime)},
+	})
+	si.UnauthenticatedAttributes = contextTag(1, mustMarshal(t, attribute{
+		Type:   oidCounterSignature,
+		Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: mustMarshal(t, counter)},
+	}))
+	sd.SignerInfos[0] = asn1.RawValue{FullBytes: mustMarshal(t, si)}
+	return setTestSignature(t, signed, sd)
+}
+
+func verifyTestImage(t *testing.T, image []byte) *SignatureInfo {
+	t.Helper()
+	f, err := pe.NewFile(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := VerifySignature(f, bytes.NewReader(image))
+	if err != nil {
+		t.Fatalf("VerifySignature() error = %v", err)
+	}
+	return info
+}
+
+func TestVerifySignature(t *testing.T) {
+	p := newTestPatcher(t, 16, testSection{
+		name:            ".text",
+		characteristics: pe.IMAGE_SCN_CNT_CODE | pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_EXECUTE,
+		data:            []byte{0xC3},
+	})
+	image, err := os.ReadFile(p.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := newTestSigner(t, "Test Signer", 42)
+	other := newTestSigner(t, "Other", 7)
+
+	// The signer is found by issuer and serial, not by position
+	signed := signTestImage(t, image, signer, 42, other.cert, signer.cert)
+	info := verifyTestImage(t, signed)
+	if !info.Verified || info.Signer == nil || info.Signer.Subject != "CN=Test Signer" {
+		t.Fatalf("VerifySignature() = verified %v (%s), signer %+v", info.Verified, info.VerifyError, info.Signer)
+	}
+
+	// CheckSum is not covered by the image hash
+	binary.LittleEndian.PutUint32(signed[0x40+24+64:], 0x1234)
+	if info := verifyTestImage(t, signed); !info.Verified {
+		t.Errorf("VerifySignature() after a CheckSum change: %s", info.VerifyError)
+	}
+
+	modified := bytes.Clone(signed)
+	modified[0x400] = 0xCC
+	if info := verifyTestImage(t, modified); info.Verified || !strings.Contains(info.VerifyError, "映像摘要") {
+		t.Errorf("VerifySignature() of a modified image = verified %v (%s)", info.Verified, info.VerifyError)
+	}
+
+	// A SignerInfo naming a certificate that isn't included
+	info = verifyTestImage(t, signTestImage(t, image, signer, 43, other.cert, signer.cert))
+	if info.Verified || info.Signer != nil || len(info.Certificates) != 2 {
+		t.Errorf("VerifySignature() with an unknown signer = verified %v, signer %+v", info.Verified, info.Signer)
+	}
+
+	// Signed by another key than the named certificate's
+	info = verifyTestImage(t, signTestImage(t, image, testSigner{key: other.key, cert: signer.cert}, 42, signer.cert))
+	if info.Verified || !strings.Contains(info.VerifyError, "签名者的签名无效") {
+		t.Errorf("VerifySignature() with a forged signature = verified %v (%s)", info.Verified, info.VerifyError)
+	}
+}
+
+func TestVerifySignatureTimestamp(t *testing.T) {
+	p := newTestPatcher(t, 16, testSection{
+		name:            ".text",
+		characteristics: pe.IMAGE_SCN_CNT_CODE | pe.IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_MEM_EXECUTE,
+		data:            []byte{0xC3},
+	})
+	image, err := os.ReadFile(p.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	expired := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "Expired Signer"},
+		NotBefore:    now.Add(-72 * time.Hour),
+		NotAfter:     now.Add(-24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	tsa := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(9),
+		Subject:      pkix.Name{CommonName: "Test TSA"},
+		NotBefore:    now.Add(-72 * time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	roots := x509.NewCertPool()
+	roots.AddCert(expired.cert)
+	roots.AddCert(tsa.cert)
+
+	// Without a timestamp the certificate is checked now
+	signed := signTestImage(t, image, expired, 42, expired.cert, tsa.cert)
+	info := verifyTestImage(t, signed)
+	if !info.Verified || info.Signer.IsValid || !info.SigningTime.IsZero() {
+		t.Errorf("untimestamped: verified %v, valid %v, signing time %v", info.Verified, info.Signer.IsValid, info.SigningTime)
+	}
+	if err := info.VerifyChain(roots); err == nil {
+		t.Error("VerifyChain() of an expired untimestamped signer succeeded")
+	}
+
+	signingTime := now.Add(-48 * time.Hour)
+	info = verifyTestImage(t, timestampTestImage(t, signed, tsa, 9, signingTime))
+	if !info.Verified || !info.SigningTime.Equal(signingTime) || !info.Signer.IsValid ||
+		info.Timestamper == nil || info.Timestamper.Subject != "CN=Test TSA" {
+		t.Fatalf("timestamped: verified %v (%s), signing time %v, signer %+v, timestamper %+v",
+			info.Verified, info.VerifyError, info.SigningTime, info.Signer, info.Timestamper)
+	}
+	if err := info.VerifyChain(roots); err != nil {
+		t.Errorf("VerifyChain() = %v", err)
+	}
+	if err := info.VerifyChain(x509.NewCertPool()); err == nil || !strings.Contains(err.Error(), "签名者证书链无效") {
+		t.Errorf("VerifyChain() without the roots = %v", err)
+	}
+
+	// A countersignature by another key than the TSA certificate's is ignored
+	info = verifyTestImage(t, timestampTestImage(t, signed, testSigner{key: expired.key, cert: tsa.cert}, 9, signingTime))
+	if !info.SigningTime.IsZero() || info.Timestamper != nil || info.Signer.IsValid {
+		t.Errorf("forged timestamp: signing time %v, timestamper %+v", info.SigningTime, info.Timestamper)
+	}
+}
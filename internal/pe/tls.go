@@ -267,26 +267,32 @@ func (tm *TLSModifier) AddTLSCallback(callbackRVA uint32) error {
 	newCallbackVA := imageBase + uint64(callbackRVA)
 	newCallbacks := append([]uint64{newCallbackVA}, existingCallbacks...)
 
-	// Write new callbacks array to a new section
+	// Write new callbacks array where there is room
 	callbacksData := tm.buildCallbacksArray(newCallbacks, is64Bit)
-
-	// Inject section for callbacks
-	err = tm.patcher.InjectSection(".tlscb", callbacksData, pe.IMAGE_SCN_CNT_INITIALIZED_DATA|pe.IMAGE_SCN_MEM_READ)
+	var oldArray pe.DataDirectory
+	if existingCallbacksVA != 0 {
+		pointerSize := uint32(4)
+		if is64Bit {
+			pointerSize = 8
+		}
+		oldArray.VirtualAddress = uint32(existingCallbacksVA - imageBase)
+		oldArray.Size = uint32(len(existingCallbacks)+1) * pointerSize
+	}
+	space, err := tm.patcher.allocate(allocRequest{
+		section:         ".tlscb",
+		size:            uint32(len(callbacksData)),
+		characteristics: pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ,
+		old:             oldArray,
+	})
 	if err != nil {
-		return fmt.Errorf("注入回调节区失败: %w", err)
+		return fmt.Errorf("分配回调数组空间失败: %w", err)
 	}
-
-	// Reload PE
-	if err := tm.patcher.Reload(); err != nil {
-		return fmt.Errorf("重新加载PE失败: %w", err)
+	if _, err := tm.patcher.file.WriteAt(callbacksData, int64(space.Offset)); err != nil {
+		return fmt.Errorf("写入回调数组失败: %w", err)
 	}
 
-	// Get new section
-	sections := tm.patcher.File().Sections
-	newSection := sections[len(sections)-1]
-
 	// Calculate new callbacks VA
-	newCallbacksVA := imageBase + uint64(newSection.VirtualAddress)
+	newCallbacksVA := imageBase + uint64(space.RVA)
 
 	// Update TLS directory to point to new callbacks array
 	return tm.updateTLSCallbacksPointer(tlsRVA, newCallbacksVA, is64Bit)
@@ -0,0 +1,283 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Limits of the x64 unwind encoding.
+const (
+	maxPrologSize      = 0xFF
+	maxAllocSmall      = 128
+	maxAllocLargeShort = 0xFFFF * 8
+	regRSP             = 4
+)
+
+// PrologOpKind is the kind of a prolog instruction.
+type PrologOpKind int
+
+// Prolog instructions supported by AddRuntimeFunctions.
+const (
+	PrologPush     PrologOpKind = iota // push reg
+	PrologAlloc                        // sub rsp, size
+	PrologSetFrame                     // mov reg, rsp
+)
+
+// PrologOp is one instruction of a simple x64 prolog.
+type PrologOp struct {
+	Kind     PrologOpKind
+	Register uint8  // x64 register number for push and set-frame
+	Size     uint32 // Bytes for alloc
+}
+
+// Length returns the size of the instruction's standard encoding, which is
+// what the unwind code offsets are computed from.
+func (op PrologOp) Length() uint8 {
+	switch op.Kind {
+	case PrologPush:
+		if op.Register >= 8 {
+			return 2 // REX.B prefix
+		}
+		return 1
+	case PrologAlloc:
+		if op.Size < 0x80 {
+			return 4 // sub rsp, imm8
+		}
+		return 7 // sub rsp, imm32
+	default:
+		return 3 // mov reg, rsp
+	}
+}
+
+// UnwindFunction describes injected code to register in the exception
+// directory. EndAddress is exclusive. An empty prolog describes a leaf
+// function that never moves RSP.
+type UnwindFunction struct {
+	BeginAddress uint32
+	EndAddress   uint32
+	Prolog       []PrologOp
+}
+
+// ParsePrologSpec parses a comma-separated prolog description such as
+// "push rbp, push rbx, alloc 0x28, frame rbp". Instructions are listed in
+// execution order.
+func ParsePrologSpec(spec string) ([]PrologOp, error) {
+	var ops []PrologOp
+	for _, item := range strings.Split(spec, ",") {
+		fields := strings.Fields(strings.ToLower(item))
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("序言指令格式错误: %q (应为 push <寄存器>、alloc <大小> 或 frame <寄存器>)", strings.TrimSpace(item))
+		}
+
+		switch fields[0] {
+		case "push", "frame":
+			reg, ok := lookupX64Register(fields[1])
+			if !ok || reg == regRSP {
+				return nil, fmt.Errorf("无效的寄存器: %s", fields[1])
+			}
+			kind := PrologPush
+			if fields[0] == "frame" {
+				kind = PrologSetFrame
+			}
+			ops = append(ops, PrologOp{Kind: kind, Register: reg})
+		case "alloc", "sub":
+			size, err := strconv.ParseUint(fields[1], 0, 32)
+			if err != nil {
+				return nil, fmt.Errorf("无效的栈分配大小: %s", fields[1])
+			}
+			ops = append(ops, PrologOp{Kind: PrologAlloc, Size: uint32(size)})
+		default:
+			return nil, fmt.Errorf("不支持的序言指令: %s", fields[0])
+		}
+	}
+	return ops, nil
+}
+
+func lookupX64Register(name string) (uint8, bool) {
+	for i, n := range x64RegisterNames {
+		if n == name {
+			return uint8(i), true
+		}
+	}
+	return 0, false
+}
+
+// encodeUnwindInfo builds a version 1 UNWIND_INFO for the prolog. Unwind
+// codes are stored in reverse order, each tagged with the offset of the
+// instruction following it.
+func encodeUnwindInfo(prolog []PrologOp) ([]byte, error) {
+	var slots []uint16
+	var frameReg uint8
+	frameSet := false
+	offset := 0
+
+	for _, op := range prolog {
+		offset += int(op.Length())
+		if offset > maxPrologSize {
+			return nil, fmt.Errorf("序言过长: 超过 %d 字节", maxPrologSize)
+		}
+		code := func(uwop, info int) uint16 { return uint16(offset) | uint16(uwop)<<8 | uint16(info)<<12 }
+
+		var opSlots []uint16
+		switch op.Kind {
+		case PrologPush:
+			opSlots = []uint16{code(UWOP_PUSH_NONVOL, int(op.Register))}
+		case PrologSetFrame:
+			switch {
+			case frameSet:
+				return nil, fmt.Errorf("序言中只能设置一个帧寄存器")
+			case op.Register == 0:
+				return nil, fmt.Errorf("rax 不能作为帧寄存器")
+			}
+			frameReg, frameSet = op.Register, true
+			opSlots = []uint16{code(UWOP_SET_FPREG, 0)}
+		case PrologAlloc:
+			switch {
+			case op.Size == 0 || op.Size%8 != 0:
+				return nil, fmt.Errorf("栈分配大小必须是8的正整数倍: 0x%X", op.Size)
+			case op.Size <= maxAllocSmall:
+				opSlots = []uint16{code(UWOP_ALLOC_SMALL, int(op.Size/8-1))}
+			case op.Size <= maxAllocLargeShort:
+				opSlots = []uint16{code(UWOP_ALLOC_LARGE, 0), uint16(op.Size / 8)}
+			default:
+				opSlots = []uint16{code(UWOP_ALLOC_LARGE, 1), uint16(op.Size), uint16(op.Size >> 16)}
+			}
+		}
+		slots = append(opSlots, slots...)
+	}
+
+	data := []byte{1, byte(offset), byte(len(slots)), frameReg}
+	for _, s := range slots {
+		data = binary.LittleEndian.AppendUint16(data, s)
+	}
+	if len(slots)%2 != 0 {
+		data = append(data, 0, 0)
+	}
+	return data, nil
+}
+
+// AddRuntimeFunctions registers unwind data for code that has none, such as
+// code placed with InjectSection or InjectCodeCave on x64. Without it, an
+// exception or stack walk through that code terminates the process. The
+// exception directory is rebuilt in a new .xpdata section, with the new
+// entries inserted in sorted order and their UNWIND_INFO stored after the
+// table, and data directory 3 is pointed at it.
+func (p *Patcher) AddRuntimeFunctions(funcs ...UnwindFunction) error {
+	if p.peFile.Machine != pe.IMAGE_FILE_MACHINE_AMD64 {
+		return fmt.Errorf("仅支持x64文件注册展开信息")
+	}
+	if len(funcs) == 0 {
+		return nil
+	}
+
+	// Pick up sections injected earlier in the same session
+	if err := p.Reload(); err != nil {
+		return err
+	}
+
+	existing, err := ParseExceptionDirectory(p.peFile, p.file)
+	if err != nil {
+		return fmt.Errorf("解析异常目录失败: %w", err)
+	}
+
+	unwind := make([][]byte, len(funcs))
+	for i, fn := range funcs {
+		if err := p.validateRuntimeFunction(fn, existing.Functions, funcs[:i]); err != nil {
+			return err
+		}
+		if unwind[i], err = encodeUnwindInfo(fn.Prolog); err != nil {
+			return err
+		}
+		if prolog := uint32(unwind[i][1]); prolog > fn.EndAddress-fn.BeginAddress {
+			return fmt.Errorf("序言 (%d 字节) 超出函数范围 0x%X-0x%X", prolog, fn.BeginAddress, fn.EndAddress)
+		}
+	}
+
+	// Layout: sorted RUNTIME_FUNCTION table, then the new UNWIND_INFO records
+	count := len(existing.Functions) + len(funcs)
+	tableSize := uint32(count * runtimeFunctionSizeX64)
+	unwindOffsets := make([]uint32, len(funcs))
+	size := tableSize
+	for i := range unwind {
+		unwindOffsets[i] = size
+		size += alignUp(uint32(len(unwind[i])), 4)
+	}
+
+	if err := p.InjectSection(".xpdata", make([]byte, size),
+		pe.IMAGE_SCN_CNT_INITIALIZED_DATA|pe.IMAGE_SCN_MEM_READ); err != nil {
+		return err
+	}
+	if err := p.Reload(); err != nil {
+		return err
+	}
+	section := p.peFile.Sections[len(p.peFile.Sections)-1]
+
+	entries := append([]RuntimeFunction(nil), existing.Functions...)
+	for i, fn := range funcs {
+		entries = append(entries, RuntimeFunction{
+			BeginAddress:      fn.BeginAddress,
+			EndAddress:        fn.EndAddress,
+			UnwindInfoAddress: section.VirtualAddress + unwindOffsets[i],
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].BeginAddress < entries[j].BeginAddress })
+
+	data := make([]byte, size)
+	for i, e := range entries {
+		entry := data[i*runtimeFunctionSizeX64:]
+		binary.LittleEndian.PutUint32(entry[0:4], e.BeginAddress)
+		binary.LittleEndian.PutUint32(entry[4:8], e.EndAddress)
+		binary.LittleEndian.PutUint32(entry[8:12], e.UnwindInfoAddress)
+	}
+	for i := range unwind {
+		copy(data[unwindOffsets[i]:], unwind[i])
+	}
+
+	if _, err := p.file.WriteAt(data, int64(section.Offset)); err != nil {
+		return fmt.Errorf("写入异常目录失败: %w", err)
+	}
+	if err := p.setDataDirectory(dataDirException, section.VirtualAddress, tableSize); err != nil {
+		return err
+	}
+	return p.Reload()
+}
+
+// validateRuntimeFunction checks that the range lies in executable code and
+// does not overlap a function that already has unwind data.
+func (p *Patcher) validateRuntimeFunction(fn UnwindFunction, existing []RuntimeFunction, added []UnwindFunction) error {
+	if fn.EndAddress <= fn.BeginAddress {
+		return fmt.Errorf("函数范围无效: 0x%X-0x%X", fn.BeginAddress, fn.EndAddress)
+	}
+
+	inCode := false
+	for _, s := range p.peFile.Sections {
+		if fn.BeginAddress >= s.VirtualAddress && fn.EndAddress <= s.VirtualAddress+max(s.VirtualSize, s.Size) {
+			inCode = s.Characteristics&pe.IMAGE_SCN_MEM_EXECUTE != 0
+			break
+		}
+	}
+	if !inCode {
+		return fmt.Errorf("函数范围 0x%X-0x%X 不在可执行节区内", fn.BeginAddress, fn.EndAddress)
+	}
+
+	for _, e := range existing {
+		if fn.BeginAddress < e.EndAddress && e.BeginAddress < fn.EndAddress {
+			return fmt.Errorf("函数范围 0x%X-0x%X 与已有函数 0x%X-0x%X 重叠",
+				fn.BeginAddress, fn.EndAddress, e.BeginAddress, e.EndAddress)
+		}
+	}
+	for _, e := range added {
+		if fn.BeginAddress < e.EndAddress && e.BeginAddress < fn.EndAddress {
+			return fmt.Errorf("函数范围 0x%X-0x%X 与 0x%X-0x%X 重叠",
+				fn.BeginAddress, fn.EndAddress, e.BeginAddress, e.EndAddress)
+		}
+	}
+	return nil
+}
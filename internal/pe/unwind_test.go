@@ -0,0 +1,98 @@
+package pe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePrologSpec(t *testing.T) {
+	got, err := ParsePrologSpec("push rbp, PUSH R12,alloc 0x200 , frame rbp")
+	if err != nil {
+		t.Fatalf("ParsePrologSpec() error = %v", err)
+	}
+	want := []PrologOp{
+		{Kind: PrologPush, Register: 5},
+		{Kind: PrologPush, Register: 12},
+		{Kind: PrologAlloc, Size: 0x200},
+		{Kind: PrologSetFrame, Register: 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParsePrologSpec() = %+v, want %+v", got, want)
+	}
+
+	if ops, err := ParsePrologSpec(""); err != nil || len(ops) != 0 {
+		t.Errorf("ParsePrologSpec(\"\") = %v, %v; want leaf prolog", ops, err)
+	}
+	for _, spec := range []string{"push rsp", "push xmm0", "alloc", "alloc big", "mov rbp, rsp"} {
+		if _, err := ParsePrologSpec(spec); err == nil {
+			t.Errorf("ParsePrologSpec(%q) expected error", spec)
+		}
+	}
+}
+
+func TestEncodeUnwindInfo(t *testing.T) {
+	prolog := []PrologOp{
+		{Kind: PrologPush, Register: 5},     // push rbp       +1
+		{Kind: PrologPush, Register: 12},    // push r12       +2
+		{Kind: PrologAlloc, Size: 0x200},    // sub rsp, imm32 +7
+		{Kind: PrologSetFrame, Register: 5}, // mov rbp, rsp   +3
+	}
+	data, err := encodeUnwindInfo(prolog)
+	if err != nil {
+		t.Fatalf("encodeUnwindInfo() error = %v", err)
+	}
+
+	// Header: version 1, prolog 13 bytes, 5 slots, frame register rbp
+	if want := []byte{1, 13, 5, 5}; !reflect.DeepEqual(data[:4], want) {
+		t.Errorf("header = % X, want % X", data[:4], want)
+	}
+	if len(data)%4 != 0 {
+		t.Errorf("len = %d, want slots padded to an even count", len(data))
+	}
+
+	got := decodeUnwindCodes(data[4 : 4+5*2])
+	want := []UnwindCode{
+		{CodeOffset: 13, Op: UWOP_SET_FPREG},
+		{CodeOffset: 10, Op: UWOP_ALLOC_LARGE, Operand: 0x200},
+		{CodeOffset: 3, Op: UWOP_PUSH_NONVOL, OpInfo: 12},
+		{CodeOffset: 1, Op: UWOP_PUSH_NONVOL, OpInfo: 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("codes = %+v, want %+v", got, want)
+	}
+}
+
+func TestEncodeUnwindInfoAllocSizes(t *testing.T) {
+	tests := []struct {
+		size    uint32
+		op      uint8
+		operand uint32
+	}{
+		{8, UWOP_ALLOC_SMALL, 8},
+		{0x78, UWOP_ALLOC_SMALL, 0x78},
+		{0x80, UWOP_ALLOC_SMALL, 0x80},
+		{0x88, UWOP_ALLOC_LARGE, 0x88},
+		{0x7FFF8, UWOP_ALLOC_LARGE, 0x7FFF8},
+		{0x100000, UWOP_ALLOC_LARGE, 0x100000},
+	}
+	for _, tt := range tests {
+		data, err := encodeUnwindInfo([]PrologOp{{Kind: PrologAlloc, Size: tt.size}})
+		if err != nil {
+			t.Fatalf("encodeUnwindInfo(alloc 0x%X) error = %v", tt.size, err)
+		}
+		codes := decodeUnwindCodes(data[4 : 4+int(data[2])*2])
+		if len(codes) != 1 || codes[0].Op != tt.op || codes[0].Operand != tt.operand {
+			t.Errorf("alloc 0x%X encoded as %+v", tt.size, codes)
+		}
+	}
+
+	for _, prolog := range [][]PrologOp{
+		{{Kind: PrologAlloc, Size: 0x14}},
+		{{Kind: PrologSetFrame, Register: 0}},
+		{{Kind: PrologSetFrame, Register: 5}, {Kind: PrologSetFrame, Register: 3}},
+	} {
+		if _, err := encodeUnwindInfo(prolog); err == nil {
+			t.Errorf("encodeUnwindInfo(%+v) expected error", prolog)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+// Package policy evaluates PE analysis results against declarative release policies.
+package policy
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ZacharyZcR/PEPatch/internal/pe"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy declares the requirements a binary must satisfy.
+// Zero values disable the corresponding rule.
+type Policy struct {
+	// RequireSigned requires a verified Authenticode signature whose signer
+	// chains to a trusted root and is inside its validity period at the
+	// timestamp, or now without one.
+	RequireSigned bool `yaml:"require_signed" json:"require_signed"`
+	// SignerSubject requires the signer certificate subject to contain this
+	// text. The signature must pass the RequireSigned checks as well.
+	SignerSubject string `yaml:"signer_subject" json:"signer_subject"`
+	// TrustedRoots lists PEM files with the root certificates signers must
+	// chain to, relative to the policy file. Empty uses the system roots.
+	TrustedRoots []string `yaml:"trusted_roots" json:"trusted_roots"`
+	// ForbidRWXSections rejects sections that are readable, writable and executable.
+	ForbidRWXSections bool `yaml:"forbid_rwx_sections" json:"forbid_rwx_sections"`
+	// RequiredMitigations lists hardening check IDs that must pass
+	// (aslr, dep, cfg, high_entropy_va, safeseh, gs, rfg, cet, ...).
+	// Checks that do not apply to a binary are skipped.
+	RequiredMitigations []string `yaml:"required_mitigations" json:"required_mitigations"`
+	// MaxSectionEntropy rejects sections whose entropy exceeds this value.
+	MaxSectionEntropy float64 `yaml:"max_section_entropy" json:"max_section_entropy"`
+	// ForbiddenImports lists "dll" or "dll!function" entries that must not be imported.
+	ForbiddenImports []string `yaml:"forbidden_imports" json:"forbidden_imports"`
+	// RequiredVersionInfo lists version resource fields that must be present
+	// (CompanyName, ProductName, FileVersion, ...).
+	RequiredVersionInfo []string `yaml:"required_version_info" json:"required_version_info"`
+	// ForbidTLSCallbacks rejects binaries with TLS callbacks.
+	ForbidTLSCallbacks bool `yaml:"forbid_tls_callbacks" json:"forbid_tls_callbacks"`
+
+	roots *x509.CertPool // Loaded TrustedRoots
+}
+
+// Violation is a single failed policy rule.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Result is the evaluation outcome for one binary.
+type Result struct {
+	File       string      `json:"file"`
+	Passed     bool        `json:"passed"`
+	Violations []Violation `json:"violations"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// Load reads a policy file. Files ending in .json are parsed as JSON,
+// everything else as YAML. Unknown keys are rejected to catch typos.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取策略文件失败: %w", err)
+	}
+
+	p := &Policy{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(p)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析策略文件失败: %w", err)
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	for i, root := range p.TrustedRoots {
+		if !filepath.IsAbs(root) {
+			p.TrustedRoots[i] = filepath.Join(filepath.Dir(path), root)
+		}
+	}
+	if p.roots, err = loadRoots(p.TrustedRoots); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// loadRoots reads PEM certificate files into a pool, nil for no files.
+func loadRoots(paths []string) (*x509.CertPool, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取根证书失败: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("根证书文件中没有PEM证书: %s", path)
+		}
+	}
+	return pool, nil
+}
+
+// Validate checks that the policy only references known mitigations and fields.
+func (p *Policy) Validate() error {
+	for _, id := range p.RequiredMitigations {
+		if !knownMitigations[id] {
+			return fmt.Errorf("未知的缓解措施: %s", id)
+		}
+	}
+	for _, field := range p.RequiredVersionInfo {
+		if _, ok := versionInfoFields[field]; !ok {
+			return fmt.Errorf("未知的版本信息字段: %s", field)
+		}
+	}
+	for _, entry := range p.ForbiddenImports {
+		if dll, _, _ := strings.Cut(entry, "!"); dll == "" {
+			return fmt.Errorf("禁止导入项格式错误 (应为 dll 或 dll!function): %s", entry)
+		}
+	}
+	return nil
+}
+
+var knownMitigations = map[string]bool{
+	"aslr": true, "relocations": true, "high_entropy_va": true, "dep": true, "cfg": true,
+	"safeseh": true, "gs": true, "rfg": true, "cet": true, "force_integrity": true,
+	"appcontainer": true, "no_rwx_sections": true, "entry_section": true, "signature": true,
+}
+
+var versionInfoFields = map[string]func(v *pe.VersionInfo) string{
+	"FileVersion":      func(v *pe.VersionInfo) string { return v.FileVersion },
+	"ProductVersion":   func(v *pe.VersionInfo) string { return v.ProductVersion },
+	"CompanyName":      func(v *pe.VersionInfo) string { return v.CompanyName },
+	"ProductName":      func(v *pe.VersionInfo) string { return v.ProductName },
+	"FileDescription":  func(v *pe.VersionInfo) string { return v.FileDescription },
+	"InternalName":     func(v *pe.VersionInfo) string { return v.InternalName },
+	"OriginalFilename": func(v *pe.VersionInfo) string { return v.OriginalFilename },
+	"LegalCopyright":   func(v *pe.VersionInfo) string { return v.LegalCopyright },
+}
+
+// Evaluate checks an analyzed binary against the policy.
+func (p *Policy) Evaluate(info *pe.Info) Result {
+	violations := make([]Violation, 0)
+	violations = append(violations, p.checkSignature(info)...)
+	violations = append(violations, p.checkSections(info)...)
+	violations = append(violations, p.checkMitigations(info)...)
+	violations = append(violations, p.checkImports(info)...)
+	violations = append(violations, p.checkVersionInfo(info)...)
+	violations = append(violations, p.checkTLS(info)...)
+
+	return Result{
+		File:       info.FilePath,
+		Passed:     len(violations) == 0,
+		Violations: violations,
+	}
+}
+
+func (p *Policy) checkSignature(info *pe.Info) []Violation {
+	if !p.RequireSigned && p.SignerSubject == "" {
+		return nil
+	}
+	// A subject alone is only meaningful for a signature that checks out
+	rule := "require_signed"
+	if !p.RequireSigned {
+		rule = "signer_subject"
+	}
+
+	sig := info.Signature
+	if sig == nil || !sig.IsSigned {
+		return []Violation{{Rule: rule, Message: "文件未签名"}}
+	}
+	if sig.Signer == nil {
+		return []Violation{{Rule: rule, Message: "证书中没有签名者的证书"}}
+	}
+
+	var violations []Violation
+	signer := sig.Signer
+	if !sig.Verified {
+		violations = append(violations, Violation{Rule: rule,
+			Message: fmt.Sprintf("签名校验失败: %s", sig.VerifyError)})
+	}
+	roots := p.roots
+	if roots == nil && len(p.TrustedRoots) > 0 {
+		var err error
+		if roots, err = loadRoots(p.TrustedRoots); err != nil {
+			return append(violations, Violation{Rule: rule, Message: err.Error()})
+		}
+	}
+	if err := sig.VerifyChain(roots); err != nil {
+		violations = append(violations, Violation{Rule: rule, Message: err.Error()})
+	}
+	if !signer.IsValid {
+		violations = append(violations, Violation{Rule: rule,
+			Message: fmt.Sprintf("签名证书不在有效期内 (%s - %s)",
+				signer.NotBefore.Format("2006-01-02"), signer.NotAfter.Format("2006-01-02"))})
+	}
+	if p.SignerSubject != "" && !strings.Contains(signer.Subject, p.SignerSubject) {
+		violations = append(violations, Violation{Rule: "signer_subject",
+			Message: fmt.Sprintf("签名者 %q 不包含 %q", signer.Subject, p.SignerSubject)})
+	}
+	return violations
+}
+
+func (p *Policy) checkSections(info *pe.Info) []Violation {
+	var violations []Violation
+	for _, s := range info.Sections {
+		if p.ForbidRWXSections && strings.HasPrefix(s.Permissions, "RWX") {
+			violations = append(violations, Violation{Rule: "forbid_rwx_sections",
+				Message: fmt.Sprintf("节区 %s 具有RWX权限", s.Name)})
+		}
+		if p.MaxSectionEntropy > 0 && s.Entropy > p.MaxSectionEntropy {
+			violations = append(violations, Violation{Rule: "max_section_entropy",
+				Message: fmt.Sprintf("节区 %s 熵值 %.2f 超过上限 %.2f", s.Name, s.Entropy, p.MaxSectionEntropy)})
+		}
+	}
+	return violations
+}
+
+func (p *Policy) checkMitigations(info *pe.Info) []Violation {
+	if len(p.RequiredMitigations) == 0 {
+		return nil
+	}
+
+	results := make(map[string]pe.HardeningCheck)
+	for _, c := range pe.AuditHardening(info) {
+		results[c.ID] = c
+	}
+
+	var violations []Violation
+	for _, id := range p.RequiredMitigations {
+		c, ok := results[id]
+		if !ok || c.Status == pe.HardeningPass {
+			continue // Not applicable or satisfied.
+		}
+		violations = append(violations, Violation{Rule: "required_mitigations",
+			Message: fmt.Sprintf("%s: %s", c.Name, c.Detail)})
+	}
+	return violations
+}
+
+func (p *Policy) checkImports(info *pe.Info) []Violation {
+	// Delay-loaded DLLs are imports too; they are only resolved later
+	imports := append([]pe.ImportInfo(nil), info.Imports...)
+	for _, d := range info.DelayImports {
+		imports = append(imports, pe.ImportInfo{DLL: d.DLL, Functions: d.FunctionNames()})
+	}
+
+	var violations []Violation
+	for _, entry := range p.ForbiddenImports {
+		dll, fn, byFunction := strings.Cut(entry, "!")
+		for _, imp := range imports {
+			if !strings.EqualFold(imp.DLL, dll) {
+				continue
+			}
+			if !byFunction {
+				violations = append(violations, Violation{Rule: "forbidden_imports",
+					Message: fmt.Sprintf("导入了禁止的DLL %s", imp.DLL)})
+				continue
+			}
+			for _, name := range imp.Functions {
+				if name == fn {
+					violations = append(violations, Violation{Rule: "forbidden_imports",
+						Message: fmt.Sprintf("导入了禁止的函数 %s!%s", imp.DLL, name)})
+				}
+			}
+		}
+	}
+	return violations
+}
+
+func (p *Policy) checkVersionInfo(info *pe.Info) []Violation {
+	if len(p.RequiredVersionInfo) == 0 {
+		return nil
+	}
+
+	if info.Resources == nil || info.Resources.VersionInfo == nil {
+		return []Violation{{Rule: "required_version_info", Message: "缺少版本信息资源"}}
+	}
+
+	var violations []Violation
+	for _, field := range p.RequiredVersionInfo {
+		if versionInfoFields[field](info.Resources.VersionInfo) == "" {
+			violations = append(violations, Violation{Rule: "required_version_info",
+				Message: fmt.Sprintf("版本信息缺少 %s", field)})
+		}
+	}
+	return violations
+}
+
+func (p *Policy) checkTLS(info *pe.Info) []Violation {
+	if !p.ForbidTLSCallbacks || info.TLS == nil || len(info.TLS.Callbacks) == 0 {
+		return nil
+	}
+	return []Violation{{Rule: "forbid_tls_callbacks",
+		Message: fmt.Sprintf("存在 %d 个TLS回调", len(info.TLS.Callbacks))}}
+}
@@ -0,0 +1,312 @@
+package policy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZacharyZcR/PEPatch/internal/pe"
+)
+
+// testCA and testCAKey are the root the test signers chain to.
+var testCA, testCAKey = newTestCA()
+
+func newTestCA() (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             time.Now().Add(-30 * 24 * time.Hour),
+		NotAfter:              time.Now().Add(30 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	return cert, key
+}
+
+func testRoots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(testCA)
+	return pool
+}
+
+// testCertificate issues a code signing certificate for "CN=Example Corp"
+// valid from notBefore to notAfter, by the test CA or self-signed.
+func testCertificate(notBefore, notAfter time.Time, selfSigned bool) pe.CertificateInfo {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Example Corp"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	parent, signerKey := testCA, testCAKey
+	if selfSigned {
+		parent, signerKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signerKey)
+	if err != nil {
+		panic(err)
+	}
+	return pe.CertificateInfo{
+		Subject:   "CN=Example Corp",
+		NotBefore: notBefore,
+		NotAfter:  notAfter,
+		IsValid:   true,
+		Raw:       der,
+	}
+}
+
+func testInfo() *pe.Info {
+	signer := testCertificate(time.Now().Add(-time.Hour), time.Now().Add(time.Hour), false)
+	return &pe.Info{
+		FilePath: "app.exe",
+		Signature: &pe.SignatureInfo{
+			IsSigned:     true,
+			Certificates: []pe.CertificateInfo{signer},
+			Signer:       &signer,
+			Verified:     true,
+		},
+		Sections: []pe.SectionInfo{
+			{Name: ".text", Permissions: "R-X", Entropy: 6.1},
+			{Name: ".packed", Permissions: "RWX", Entropy: 7.9},
+		},
+		Imports: []pe.ImportInfo{
+			{DLL: "KERNEL32.dll", Functions: []string{"CreateFileW", "VirtualAlloc"}},
+		},
+		Resources: &pe.ResourceInfo{VersionInfo: &pe.VersionInfo{CompanyName: "Example Corp"}},
+		TLS:       &pe.TLSInfo{HasTLS: true, Callbacks: []uint64{0x401000}},
+	}
+}
+
+func rules(r Result) map[string]int {
+	m := make(map[string]int)
+	for _, v := range r.Violations {
+		m[v.Rule]++
+	}
+	return m
+}
+
+func TestEvaluate(t *testing.T) {
+	p := &Policy{
+		RequireSigned:       true,
+		SignerSubject:       "Example Corp",
+		ForbidRWXSections:   true,
+		MaxSectionEntropy:   7.2,
+		ForbiddenImports:    []string{"kernel32.dll!VirtualAlloc", "ws2_32.dll"},
+		RequiredVersionInfo: []string{"CompanyName", "ProductName"},
+		ForbidTLSCallbacks:  true,
+		RequiredMitigations: []string{"dep"},
+		roots:               testRoots(),
+	}
+
+	result := p.Evaluate(testInfo())
+	if result.Passed {
+		t.Fatal("Evaluate() passed, want violations")
+	}
+
+	want := map[string]int{
+		"forbid_rwx_sections":   1,
+		"max_section_entropy":   1,
+		"forbidden_imports":     1,
+		"required_version_info": 1,
+		"forbid_tls_callbacks":  1,
+		"required_mitigations":  1,
+	}
+	got := rules(result)
+	for rule, n := range want {
+		if got[rule] != n {
+			t.Errorf("violations for %s = %d, want %d", rule, got[rule], n)
+		}
+	}
+	if got["require_signed"] != 0 || got["signer_subject"] != 0 {
+		t.Errorf("unexpected signature violations: %v", result.Violations)
+	}
+}
+
+func TestEvaluateEmptyPolicy(t *testing.T) {
+	result := (&Policy{}).Evaluate(testInfo())
+	if !result.Passed || len(result.Violations) != 0 {
+		t.Errorf("Evaluate() = %+v, want pass", result)
+	}
+}
+
+func TestEvaluateDelayImports(t *testing.T) {
+	info := testInfo()
+	info.DelayImports = []pe.DelayImportInfo{{
+		DLL:       "WS2_32.dll",
+		Functions: []pe.DelayImportFunction{{ImportFunction: pe.ImportFunction{Name: "connect"}}},
+	}}
+
+	got := rules((&Policy{ForbiddenImports: []string{"ws2_32.dll!connect"}}).Evaluate(info))
+	if got["forbidden_imports"] != 1 {
+		t.Errorf("violations = %v, want the delay-loaded function flagged", got)
+	}
+}
+
+func TestEvaluateSignature(t *testing.T) {
+	info := testInfo()
+	info.Signature.Signer.IsValid = false
+
+	got := rules((&Policy{RequireSigned: true, SignerSubject: "Other Inc", roots: testRoots()}).Evaluate(info))
+	if got["require_signed"] != 1 || got["signer_subject"] != 1 {
+		t.Errorf("violations = %v, want expired certificate and subject mismatch", got)
+	}
+
+	// A certificate that isn't the signer's doesn't count, nor does a
+	// signature over a modified image
+	info = testInfo()
+	info.Signature.Verified, info.Signature.VerifyError = false, "映像摘要不匹配"
+	if got = rules((&Policy{RequireSigned: true, roots: testRoots()}).Evaluate(info)); got["require_signed"] != 1 {
+		t.Errorf("violations = %v, want digest mismatch", got)
+	}
+	info.Signature.Signer = nil
+	if got = rules((&Policy{RequireSigned: true}).Evaluate(info)); got["require_signed"] != 1 {
+		t.Errorf("violations = %v, want missing signer", got)
+	}
+
+	info.Signature = &pe.SignatureInfo{}
+	got = rules((&Policy{RequireSigned: true}).Evaluate(info))
+	if got["require_signed"] != 1 {
+		t.Errorf("violations = %v, want unsigned", got)
+	}
+
+	// Not chaining to the trusted roots
+	info = testInfo()
+	if got = rules((&Policy{RequireSigned: true}).Evaluate(info)); got["require_signed"] != 1 {
+		t.Errorf("violations = %v, want an untrusted chain", got)
+	}
+
+	// A certificate that expired after the timestamp
+	info = testInfo()
+	signer := testCertificate(time.Now().Add(-72*time.Hour), time.Now().Add(-24*time.Hour), false)
+	info.Signature.Certificates = []pe.CertificateInfo{signer}
+	info.Signature.Signer = &info.Signature.Certificates[0]
+	info.Signature.SigningTime = time.Now().Add(-48 * time.Hour)
+	if got = rules((&Policy{RequireSigned: true, roots: testRoots()}).Evaluate(info)); len(got) != 0 {
+		t.Errorf("violations = %v, want a timestamped signature to pass", got)
+	}
+	info.Signature.SigningTime = time.Time{}
+	if got = rules((&Policy{RequireSigned: true, roots: testRoots()}).Evaluate(info)); got["require_signed"] != 1 {
+		t.Errorf("violations = %v, want an expired chain without a timestamp", got)
+	}
+}
+
+func TestEvaluateSignerSubject(t *testing.T) {
+	p := &Policy{SignerSubject: "Example Corp", roots: testRoots()}
+	if got := rules(p.Evaluate(testInfo())); len(got) != 0 {
+		t.Errorf("violations = %v, want pass", got)
+	}
+
+	// A signature block copied from another binary
+	info := testInfo()
+	info.Signature.Verified, info.Signature.VerifyError = false, "映像摘要不匹配"
+	if got := rules(p.Evaluate(info)); got["signer_subject"] != 1 {
+		t.Errorf("violations = %v, want digest mismatch", got)
+	}
+
+	// A self-signed certificate with the right subject
+	info = testInfo()
+	signer := testCertificate(time.Now().Add(-time.Hour), time.Now().Add(time.Hour), true)
+	info.Signature.Certificates = []pe.CertificateInfo{signer}
+	info.Signature.Signer = &info.Signature.Certificates[0]
+	if got := rules(p.Evaluate(info)); got["signer_subject"] != 1 {
+		t.Errorf("violations = %v, want an untrusted chain", got)
+	}
+
+	info.Signature = &pe.SignatureInfo{}
+	if got := rules(p.Evaluate(info)); got["signer_subject"] != 1 {
+		t.Errorf("violations = %v, want unsigned", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	root := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testCA.Raw})
+	if err := os.WriteFile(filepath.Join(dir, "root.pem"), root, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr bool
+	}{
+		{"YAML", "p.yaml", "require_signed: true\nrequired_mitigations: [aslr, dep]\n", false},
+		{"JSON", "p.json", `{"forbid_rwx_sections": true, "max_section_entropy": 7.5}`, false},
+		{"Unknown YAML key", "bad.yaml", "forbid_rwx: true\n", true},
+		{"Unknown JSON key", "bad.json", `{"forbid_rwx": true}`, true},
+		{"Unknown mitigation", "m.yaml", "required_mitigations: [aslr, magic]\n", true},
+		{"Unknown version field", "v.yaml", "required_version_info: [Author]\n", true},
+		{"Bad import entry", "i.yaml", "forbidden_imports: ['!VirtualAlloc']\n", true},
+		{"Trusted roots", "r.yaml", "trusted_roots: [root.pem]\n", false},
+		{"Missing trusted roots", "mr.yaml", "trusted_roots: [missing.pem]\n", true},
+		{"Trusted roots not PEM", "pr.yaml", "trusted_roots: [pr.yaml]\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadTrustedRoots(t *testing.T) {
+	dir := t.TempDir()
+	root := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testCA.Raw})
+	if err := os.WriteFile(filepath.Join(dir, "root.pem"), root, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(path, []byte("signer_subject: Example Corp\ntrusted_roots: [root.pem]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rules(p.Evaluate(testInfo())); len(got) != 0 {
+		t.Errorf("violations = %v, want the signer to chain to root.pem", got)
+	}
+
+	// A policy built in code loads its roots when evaluated
+	p = &Policy{SignerSubject: "Example Corp", TrustedRoots: []string{filepath.Join(dir, "missing.pem")}}
+	result := p.Evaluate(testInfo())
+	if len(result.Violations) != 1 || !strings.Contains(result.Violations[0].Message, "读取根证书失败") {
+		t.Errorf("violations = %v, want the missing root file reported", result.Violations)
+	}
+}